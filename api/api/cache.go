@@ -0,0 +1,139 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	backend "github.com/PhilRanzato/kubensure/backend"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/kubernetes"
+)
+
+var sharedClientset kubernetes.Interface
+var resourceCache *backend.ResourceCache
+
+// Init : sets the clientset shared by the handlers and the cache they read from once synced,
+//			without it every request loads the kubeconfig and lists the cluster
+func Init(clientset kubernetes.Interface, cache *backend.ResourceCache) {
+	sharedClientset = clientset
+	resourceCache = cache
+}
+
+// CacheStatusHandler : returns the synchronization state of the cache, with status 503 until every resource is listed
+func CacheStatusHandler(w http.ResponseWriter, r *http.Request) {
+	if resourceCache == nil {
+		http.Error(w, "resource cache disabled", http.StatusNotFound)
+		return
+	}
+	status := resourceCache.Status()
+	w.Header().Set("Content-Type", "application/json")
+	if !status.Synced {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	json.NewEncoder(w).Encode(status)
+}
+
+// servedResources : the resources of the cache the handlers read, the other ones do not delay the readiness
+var servedResources = []string{"pods", "services"}
+
+// ReadyHandler : readiness probe of the server, ready once the resources read by the handlers are synced,
+//			whether or not the other resources of the cache can be listed
+func ReadyHandler(w http.ResponseWriter, r *http.Request) {
+	if resourceCache != nil && !resourceCache.Synced(servedResources...) {
+		http.Error(w, "resource cache not synced", http.StatusServiceUnavailable)
+		return
+	}
+	w.Write([]byte("ok"))
+}
+
+// clientSet : returns the shared clientset, else a clientset of the resolved kubeconfig
+func clientSet() (kubernetes.Interface, error) {
+	if sharedClientset != nil {
+		return sharedClientset, nil
+	}
+	return backend.GetClientSet()
+}
+
+// cacheSynced : returns true when reads of the resource can be served from the cache
+func cacheSynced(resource string) bool {
+	return resourceCache != nil && resourceCache.Synced(resource)
+}
+
+// readFromCache : returns true when the page of the token can be read from the cache: the cache is synced and
+//			the token is empty or one of the cache, the tokens of the API server are used with the API server
+func readFromCache(resource string, token string) bool {
+	return cacheSynced(resource) && (token == "" || backend.CachePageToken(token))
+}
+
+// listPods : returns the page of the pods matching the query and the continue token of the next page, from the
+//			cache once synced unless it does not support the field selector
+func listPods(r *http.Request, query backend.QueryOptions, token string) ([]v1.Pod, string, error) {
+	if readFromCache("pods", token) {
+		pods, next, err := resourceCache.PodsPage(query, token)
+		if !errors.Is(err, backend.ErrUnsupportedFieldSelector) {
+			return pods, next, err
+		}
+	}
+	cs, err := clientSet()
+	if err != nil {
+		return nil, "", err
+	}
+	return backend.GetPodsPage(r.Context(), cs, query, token)
+}
+
+// listServices : returns the page of the services matching the query and the continue token of the next page,
+//			from the cache once synced unless it does not support the field selector
+func listServices(r *http.Request, query backend.QueryOptions, token string) ([]v1.Service, string, error) {
+	if readFromCache("services", token) {
+		svcs, next, err := resourceCache.ServicesPage(query, token)
+		if !errors.Is(err, backend.ErrUnsupportedFieldSelector) {
+			return svcs, next, err
+		}
+	}
+	cs, err := clientSet()
+	if err != nil {
+		return nil, "", err
+	}
+	return backend.GetServicesPage(r.Context(), cs, query, token)
+}
+
+// findPod : returns the pod by name+namespace, from the cache once synced
+func findPod(r *http.Request, name string, namespace string) (v1.Pod, error) {
+	if cacheSynced("pods") {
+		return resourceCache.FindPod(name, namespace)
+	}
+	cs, err := clientSet()
+	if err != nil {
+		return v1.Pod{}, err
+	}
+	return backend.FindPod(r.Context(), cs, name, namespace)
+}
+
+// findService : returns the service by name+namespace, from the cache once synced
+func findService(r *http.Request, name string, namespace string) (v1.Service, error) {
+	if cacheSynced("services") {
+		return resourceCache.FindService(name, namespace)
+	}
+	cs, err := clientSet()
+	if err != nil {
+		return v1.Service{}, err
+	}
+	return backend.FindService(r.Context(), cs, name, namespace)
+}
+
+// servicePods : returns the pods selected by the service, from the cache once synced
+func servicePods(r *http.Request, svc v1.Service) ([]v1.Pod, error) {
+	if len(svc.Spec.Selector) == 0 {
+		return nil, nil
+	}
+	if cacheSynced("pods") {
+		return resourceCache.Pods(backend.QueryOptions{Namespaces: []string{svc.Namespace}, LabelSelector: labels.SelectorFromSet(svc.Spec.Selector).String()})
+	}
+	cs, err := clientSet()
+	if err != nil {
+		return nil, err
+	}
+	return backend.GetServicePods(r.Context(), cs, svc)
+}
@@ -0,0 +1,28 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	backend "github.com/PhilRanzato/kubensure/backend"
+)
+
+// httpError writes the error with the status code matching its cause
+func httpError(w http.ResponseWriter, err error) {
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, backend.ErrForbidden):
+		status = http.StatusForbidden
+	case errors.Is(err, backend.ErrNotFound):
+		status = http.StatusNotFound
+	case errors.Is(err, backend.ErrTimeout):
+		status = http.StatusGatewayTimeout
+	case errors.Is(err, backend.ErrInvalidContinue):
+		status = http.StatusBadRequest
+	case errors.Is(err, backend.ErrNotSynced):
+		status = http.StatusServiceUnavailable
+	}
+	fmt.Println(err)
+	http.Error(w, err.Error(), status)
+}
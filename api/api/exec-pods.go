@@ -4,9 +4,9 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"strconv"
 
 	backend "github.com/PhilRanzato/kubensure/backend"
-	v1 "k8s.io/api/core/v1"
 )
 
 type Connection struct {
@@ -14,10 +14,11 @@ type Connection struct {
 	FromNamespace string
 	To            string
 	ToNamespace   string
+	// Port is the port of the service to probe, 0 for every declared port
+	Port   int
+	Expect backend.Expectation
 }
 
-var result bool = false
-
 type ExecCommand struct {
 	PodName      string
 	PodNamespace string
@@ -37,19 +38,19 @@ func PodExecHandler(w http.ResponseWriter, r *http.Request) {
 		fmt.Println(err.Error())
 	}
 
-	clientset := backend.GetClientSet()
-	pods := backend.GetPods(clientset)
-
-	// Search for pod and service to test connection on
-	var pod v1.Pod
-
-	for _, p := range pods {
-		if exec.PodName == p.Name && exec.PodNamespace == p.Namespace {
-			pod = p
-		}
+	clientset, err := clientSet()
+	if err != nil {
+		httpError(w, err)
+		return
+	}
+	// Search for pod to exec into
+	pod, err := findPod(r, exec.PodName, exec.PodNamespace)
+	if err != nil {
+		httpError(w, err)
+		return
 	}
 
-	stdout, stderr, _ := backend.ExecIntoPod(clientset, &pod, exec.Command, nil)
+	stdout, stderr, _ := backend.ExecIntoPod(clientset, &pod, exec.Command, nil, false)
 
 	var output ExecResult
 
@@ -78,26 +79,46 @@ func TestConnection(w http.ResponseWriter, r *http.Request) {
 		// return
 	}
 
-	clientset := backend.GetClientSet()
-	pods := backend.GetPods(clientset)
-	svcs := backend.GetServices(clientset)
+	clientset, err := clientSet()
+	if err != nil {
+		httpError(w, err)
+		return
+	}
 
 	// Search for pod and service to test connection on
-	var podFrom v1.Pod
-	var serviceTo v1.Service
+	podFrom, err := findPod(r, conn.From, conn.FromNamespace)
+	if err != nil {
+		httpError(w, err)
+		return
+	}
+	serviceTo, err := findService(r, conn.To, conn.ToNamespace)
+	if err != nil {
+		httpError(w, err)
+		return
+	}
+	expect, err := backend.ParseExpectation(string(conn.Expect))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 
-	for _, pod := range pods {
-		if conn.From == pod.Name && conn.FromNamespace == pod.Namespace {
-			podFrom = pod
-		}
+	port := ""
+	if conn.Port != 0 {
+		port = strconv.Itoa(conn.Port)
 	}
-	for _, svc := range svcs {
-		if conn.To == svc.Name && conn.ToNamespace == svc.Namespace {
-			serviceTo = svc
-		}
+	ports, err := backend.ResolveServicePorts(serviceTo, port, "")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
 	}
-	result = backend.TestConnectionPodToService(podFrom, serviceTo)
-	connResult, _ := json.Marshal(result)
+	backends, err := servicePods(r, serviceTo)
+	if err != nil {
+		httpError(w, err)
+		return
+	}
+
+	results := backend.ConnectionPodToServicePorts(clientset, podFrom, serviceTo, ports, backends, nil, backend.ConnectionOptions{})
+	connResult, _ := json.Marshal(backend.EvaluateServiceConnections(results, expect))
 
 	json.NewEncoder(w).Encode(string(connResult))
 }
@@ -5,7 +5,6 @@ import (
 	"fmt"
 	"net/http"
 
-	backend "github.com/PhilRanzato/kubensure/backend"
 	v1 "k8s.io/api/core/v1"
 )
 
@@ -14,7 +13,11 @@ type PageVariables struct {
 }
 
 func PodHandler(w http.ResponseWriter, r *http.Request) {
-	cs := backend.GetClientSet()
+	query, token, err := queryOptions(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 
 	// podVars := PageVariables{
 	// 	Pods: getPods(cs),
@@ -29,7 +32,15 @@ func PodHandler(w http.ResponseWriter, r *http.Request) {
 	// 	log.Print("template executing error: ", err) //log it
 	// }
 	fmt.Println("Get pods")
-	pods, _ := json.Marshal(backend.GetPods(cs))
+	list, next, err := listPods(r, query, token)
+	if err != nil {
+		httpError(w, err)
+		return
+	}
+	if next != "" {
+		w.Header().Set(continueHeader, next)
+	}
+	pods, _ := json.Marshal(list)
 
 	json.NewEncoder(w).Encode(string(pods))
 
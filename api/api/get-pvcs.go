@@ -4,13 +4,9 @@ import (
 	"html/template"
 	"log"
 	"net/http"
-	"os"
-	"path/filepath"
 
+	backend "github.com/PhilRanzato/kubensure/backend"
 	v1 "k8s.io/api/core/v1"
-	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/client-go/kubernetes"
-	"k8s.io/client-go/tools/clientcmd"
 )
 
 type Pvc struct {
@@ -25,32 +21,19 @@ type PageVars struct {
 
 func PvcHandler(w http.ResponseWriter, r *http.Request) {
 
-	kubeconfig := filepath.Join(os.Getenv("HOME"), ".kube", "config")
-	log.Println("Using kubeconfig file: ", kubeconfig)
-	config, err := clientcmd.BuildConfigFromFlags("", kubeconfig)
+	clientset, err := clientSet()
 	if err != nil {
-		log.Fatal(err)
+		httpError(w, err)
+		return
 	}
 
-	// Create an rest client not targeting specific API version
-	clientset, err := kubernetes.NewForConfig(config)
+	pvcs, err := backend.GetPersistentVolumeClaims(r.Context(), clientset, backend.QueryOptions{})
 	if err != nil {
-		log.Fatal(err)
-	}
-	var ns, label, field string
-
-	api := clientset.CoreV1()
-	// setup list options
-	listOptions := metav1.ListOptions{
-		LabelSelector: label,
-		FieldSelector: field,
-	}
-	pvcs, err := api.PersistentVolumeClaims(ns).List(listOptions)
-	if err != nil {
-		log.Fatal(err)
+		httpError(w, err)
+		return
 	}
 	var pvcsList []Pvc
-	for _, pvc := range pvcs.Items {
+	for _, pvc := range pvcs {
 		quant := pvc.Spec.Resources.Requests[v1.ResourceStorage]
 		pvcObj := Pvc{
 			pvc.Name,
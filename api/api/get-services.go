@@ -4,16 +4,26 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
-
-	backend "github.com/PhilRanzato/kubensure/backend"
 )
 
 func ServiceHandler(w http.ResponseWriter, r *http.Request) {
-	cs := backend.GetClientSet()
+	query, token, err := queryOptions(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 
 	fmt.Println("Get services")
 
-	svcs, _ := json.Marshal(backend.GetServices(cs))
+	list, next, err := listServices(r, query, token)
+	if err != nil {
+		httpError(w, err)
+		return
+	}
+	if next != "" {
+		w.Header().Set(continueHeader, next)
+	}
+	svcs, _ := json.Marshal(list)
 
 	json.NewEncoder(w).Encode(string(svcs))
 
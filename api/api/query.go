@@ -0,0 +1,40 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	backend "github.com/PhilRanzato/kubensure/backend"
+)
+
+// continueHeader : the response header holding the continue token of the next page, absent on the last page
+const continueHeader = "Continue"
+
+// queryOptions : returns the query set by the parameters of the request and the continue token of the page, e.g.
+//			/api/pods?namespace=shop,payments&labelSelector=app%3Dweb&fieldSelector=spec.nodeName%3Dnode-1&limit=500
+//			With a limit the handlers return a page of objects, the next one is requested with the continue
+//			parameter set to the Continue header of the response and the same query.
+func queryOptions(r *http.Request) (backend.QueryOptions, string, error) {
+	params := r.URL.Query()
+	query := backend.QueryOptions{
+		LabelSelector: params.Get("labelSelector"),
+		FieldSelector: params.Get("fieldSelector"),
+	}
+	for _, ns := range params["namespace"] {
+		for _, n := range strings.Split(ns, ",") {
+			if n = strings.TrimSpace(n); n != "" {
+				query.Namespaces = append(query.Namespaces, n)
+			}
+		}
+	}
+	if limit := params.Get("limit"); limit != "" {
+		l, err := strconv.ParseInt(limit, 10, 64)
+		if err != nil {
+			return query, "", fmt.Errorf("invalid limit '%s': %v", limit, err)
+		}
+		query.Limit = l
+	}
+	return query, params.Get("continue"), query.Validate()
+}
@@ -1,12 +1,16 @@
 package main
 
 import (
+	"context"
 	"fmt"
+	"log"
 	"net/http"
 
 	"github.com/PhilRanzato/kubensure/api/api"
+	"github.com/PhilRanzato/kubensure/backend"
 	"github.com/gorilla/handlers"
 	"github.com/gorilla/mux"
+	"github.com/spf13/pflag"
 )
 
 func newRouter() *mux.Router {
@@ -16,13 +20,38 @@ func newRouter() *mux.Router {
 	r.HandleFunc("/api/pod-exec", api.PodExecHandler).Methods("POST")
 	r.HandleFunc("/api/test-connection", api.TestConnection).Methods("POST")
 	r.HandleFunc("/api/pvc", api.PvcHandler).Methods("GET")
+	r.HandleFunc("/api/cache/status", api.CacheStatusHandler).Methods("GET")
+	r.HandleFunc("/readyz", api.ReadyHandler).Methods("GET")
 	return r
 }
 
 func main() {
+	// the cluster is resolved as by the CLI: flags, then $KUBECONFIG, then $HOME/.kube/config,
+	// then the in-cluster configuration of the pod service account
+	var opts backend.KubeConfigOptions
+	pflag.StringVar(&opts.Kubeconfig, "kubeconfig", "", "Path to the kubeconfig file")
+	pflag.StringVar(&opts.Context, "context", "", "The kubeconfig context to use")
+	pflag.StringVar(&opts.Namespace, "namespace", "", "Default namespace")
+	pflag.StringVar(&opts.As, "as", "", "Username to impersonate")
+	pflag.StringSliceVar(&opts.AsGroups, "as-group", nil, "Group to impersonate, can be repeated")
+	cacheEnabled := pflag.Bool("cache", true, "Serve reads from an in-memory cache of the cluster, filled by list and watch")
+	pflag.Parse()
+	backend.SetKubeConfigOptions(opts)
+
+	clientset, err := backend.GetClientSet()
+	if err != nil {
+		log.Fatal(err)
+	}
+	var cache *backend.ResourceCache
+	if *cacheEnabled {
+		cache = backend.NewResourceCache(clientset)
+		go cache.Run(context.Background())
+	}
+	api.Init(clientset, cache)
+
 	r := newRouter()
 	fmt.Println("Server listening on port 80")
 	// enable CORS
-	router := handlers.CORS(handlers.AllowedHeaders([]string{"Accept", "X-Requested-With", "Content-Type", "Authorization"}), handlers.AllowedMethods([]string{"GET", "POST", "PUT", "HEAD", "OPTIONS"}), handlers.AllowedOrigins([]string{"*"}))(r)
+	router := handlers.CORS(handlers.AllowedHeaders([]string{"Accept", "X-Requested-With", "Content-Type", "Authorization"}), handlers.AllowedMethods([]string{"GET", "POST", "PUT", "HEAD", "OPTIONS"}), handlers.AllowedOrigins([]string{"*"}), handlers.ExposedHeaders([]string{"Continue"}))(r)
 	http.ListenAndServe(":80", router)
 }
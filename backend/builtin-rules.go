@@ -0,0 +1,168 @@
+package backend
+
+import (
+	"fmt"
+	"strings"
+
+	appv1 "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// ProtectedNamespaceLabel : the namespace label marking a namespace as protected when set to "true"
+const ProtectedNamespaceLabel = "kubensure.io/protected"
+
+// workloadKinds : the kinds carrying a pod spec, bare pods included
+var workloadKinds = []string{"Pod", "Deployment", "DaemonSet", "StatefulSet"}
+
+// funcRule : a rule evaluated by a function, used by the built-in rules
+type funcRule struct {
+	id          string
+	description string
+	severity    Severity
+	kinds       []string
+	evaluate    func(obj runtime.Object, snapshot *ClusterSnapshot) []Finding
+}
+
+func (r *funcRule) ID() string {
+	return r.id
+}
+
+func (r *funcRule) Description() string {
+	return r.description
+}
+
+func (r *funcRule) Severity() Severity {
+	return r.severity
+}
+
+func (r *funcRule) Kinds() []string {
+	return r.kinds
+}
+
+func (r *funcRule) Evaluate(obj runtime.Object, snapshot *ClusterSnapshot) []Finding {
+	return r.evaluate(obj, snapshot)
+}
+
+// containerRule : returns a rule evaluated on every container of the pod spec of the workloads,
+//			check returns the reason the container violates the rule, empty when it complies
+func containerRule(id string, description string, severity Severity, initContainers bool, check func(c v1.Container) string) Rule {
+	return &funcRule{
+		id:          id,
+		description: description,
+		severity:    severity,
+		kinds:       workloadKinds,
+		evaluate: func(obj runtime.Object, snapshot *ClusterSnapshot) []Finding {
+			spec := podSpec(obj)
+			if spec == nil {
+				return nil
+			}
+			containers := spec.Containers
+			if initContainers {
+				containers = append(append([]v1.Container(nil), spec.InitContainers...), spec.Containers...)
+			}
+			var findings []Finding
+			for _, c := range containers {
+				if reason := check(c); reason != "" {
+					findings = append(findings, Finding{Message: "container " + c.Name + " " + reason})
+				}
+			}
+			return findings
+		},
+	}
+}
+
+func checkResources(c v1.Container) string {
+	var missing []string
+	if _, ok := c.Resources.Requests[v1.ResourceCPU]; !ok {
+		missing = append(missing, "cpu request")
+	}
+	if _, ok := c.Resources.Requests[v1.ResourceMemory]; !ok {
+		missing = append(missing, "memory request")
+	}
+	if _, ok := c.Resources.Limits[v1.ResourceMemory]; !ok {
+		missing = append(missing, "memory limit")
+	}
+	if len(missing) == 0 {
+		return ""
+	}
+	return "has no " + strings.Join(missing, ", ")
+}
+
+func checkImageTag(c v1.Container) string {
+	if strings.Contains(c.Image, "@") {
+		return ""
+	}
+	name := c.Image[strings.LastIndex(c.Image, "/")+1:]
+	i := strings.LastIndex(name, ":")
+	switch {
+	case i < 0:
+		return "uses image " + c.Image + " without tag, which defaults to latest"
+	case name[i+1:] == "latest":
+		return "uses image " + c.Image
+	}
+	return ""
+}
+
+func checkProbes(c v1.Container) string {
+	var missing []string
+	if c.LivenessProbe == nil {
+		missing = append(missing, "liveness")
+	}
+	if c.ReadinessProbe == nil {
+		missing = append(missing, "readiness")
+	}
+	if len(missing) == 0 {
+		return ""
+	}
+	return "has no " + strings.Join(missing, " and ") + " probe"
+}
+
+func checkPrivileged(c v1.Container) string {
+	if c.SecurityContext != nil && c.SecurityContext.Privileged != nil && *c.SecurityContext.Privileged {
+		return "is privileged"
+	}
+	return ""
+}
+
+// NewSingleReplicaRule : accepts the names of the protected namespaces
+//			returns the rule flagging the Deployments running a single replica in a protected namespace,
+//			a namespace is also protected when labelled with ProtectedNamespaceLabel
+func NewSingleReplicaRule(protectedNamespaces []string) Rule {
+	return &funcRule{
+		id:          "single-replica",
+		description: "deployments of protected namespaces run more than one replica",
+		severity:    SeverityError,
+		kinds:       []string{"Deployment"},
+		evaluate: func(obj runtime.Object, snapshot *ClusterSnapshot) []Finding {
+			d, ok := obj.(*appv1.Deployment)
+			if !ok {
+				return nil
+			}
+			replicas := int32(1)
+			if d.Spec.Replicas != nil {
+				replicas = *d.Spec.Replicas
+			}
+			if replicas != 1 || !isProtectedNamespace(d.Namespace, protectedNamespaces, snapshot) {
+				return nil
+			}
+			return []Finding{{Message: fmt.Sprintf("runs a single replica in protected namespace %s", d.Namespace)}}
+		},
+	}
+}
+
+func isProtectedNamespace(name string, protectedNamespaces []string, snapshot *ClusterSnapshot) bool {
+	if containsString(protectedNamespaces, name) {
+		return true
+	}
+	ns := snapshot.namespace(name)
+	return ns != nil && ns.Labels[ProtectedNamespaceLabel] == "true"
+}
+
+func init() {
+	RegisterRule(containerRule("resources", "containers declare cpu and memory requests and a memory limit", SeverityWarning, true, checkResources))
+	RegisterRule(containerRule("image-latest-tag", "container images are pinned to a tag other than latest or to a digest", SeverityWarning, true, checkImageTag))
+	RegisterRule(containerRule("probes", "containers declare liveness and readiness probes", SeverityWarning, false, checkProbes))
+	RegisterRule(containerRule("privileged", "containers do not run privileged", SeverityError, true, checkPrivileged))
+	RegisterRule(NewSingleReplicaRule(nil))
+}
@@ -0,0 +1,515 @@
+package backend
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes"
+)
+
+// cacheListChunkSize : the page size of the lists filling the cache
+const cacheListChunkSize = 500
+
+// ResourceCache : an in-memory copy of the Pods, Services, Endpoints, Namespaces and NetworkPolicies of the cluster, filled by a list and kept up to date by a watch per resource, relisting when the watch expires.
+// The objects returned by the cache are shared and must not be modified.
+type ResourceCache struct {
+	stores []*cacheStore
+}
+
+// CacheStatus : the synchronization state of the cache
+type CacheStatus struct {
+	// Synced is true once every resource has been listed
+	Synced    bool
+	Resources []ResourceCacheStatus
+}
+
+// ResourceCacheStatus : the synchronization state of a single resource of the cache
+type ResourceCacheStatus struct {
+	Resource        string
+	Synced          bool
+	Objects         int
+	ResourceVersion string
+	// LastSync is the time of the last full list
+	LastSync time.Time
+	// LastEvent is the time of the last watch event
+	LastEvent time.Time
+	// Error is the last list or watch error, cleared by the next successful list
+	Error string `json:",omitempty"`
+}
+
+type cacheStore struct {
+	resource string
+	list     func(opts metav1.ListOptions) (runtime.Object, error)
+	watch    func(opts metav1.ListOptions) (watch.Interface, error)
+
+	mu      sync.RWMutex
+	objects map[string]runtime.Object
+	status  ResourceCacheStatus
+}
+
+// NewResourceCache : accepts a clientset
+//			returns a cache of the cluster objects, filled once Run is started
+func NewResourceCache(clientset kubernetes.Interface) *ResourceCache {
+	c := &ResourceCache{}
+	c.add("pods", func(opts metav1.ListOptions) (runtime.Object, error) {
+		return clientset.CoreV1().Pods("").List(opts)
+	}, clientset.CoreV1().Pods("").Watch)
+	c.add("services", func(opts metav1.ListOptions) (runtime.Object, error) {
+		return clientset.CoreV1().Services("").List(opts)
+	}, clientset.CoreV1().Services("").Watch)
+	c.add("endpoints", func(opts metav1.ListOptions) (runtime.Object, error) {
+		return clientset.CoreV1().Endpoints("").List(opts)
+	}, clientset.CoreV1().Endpoints("").Watch)
+	c.add("namespaces", func(opts metav1.ListOptions) (runtime.Object, error) {
+		return clientset.CoreV1().Namespaces().List(opts)
+	}, clientset.CoreV1().Namespaces().Watch)
+	c.add("networkpolicies", func(opts metav1.ListOptions) (runtime.Object, error) {
+		return clientset.NetworkingV1().NetworkPolicies("").List(opts)
+	}, clientset.NetworkingV1().NetworkPolicies("").Watch)
+	return c
+}
+
+func (c *ResourceCache) add(resource string, list func(metav1.ListOptions) (runtime.Object, error), watch func(metav1.ListOptions) (watch.Interface, error)) {
+	c.stores = append(c.stores, &cacheStore{
+		resource: resource,
+		list:     list,
+		watch:    watch,
+		objects:  map[string]runtime.Object{},
+		status:   ResourceCacheStatus{Resource: resource},
+	})
+}
+
+// Run : lists and watches every resource until the context is done
+func (c *ResourceCache) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+	for _, s := range c.stores {
+		wg.Add(1)
+		go func(s *cacheStore) {
+			defer wg.Done()
+			s.run(ctx)
+		}(s)
+	}
+	wg.Wait()
+}
+
+// WaitForSync : blocks until every resource has been listed
+//			returns false when the context is done first
+func (c *ResourceCache) WaitForSync(ctx context.Context) bool {
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+	for !c.Synced() {
+		select {
+		case <-ctx.Done():
+			return false
+		case <-ticker.C:
+		}
+	}
+	return true
+}
+
+// Synced : accepts a list of resources, e.g. "pods", empty for every resource of the cache
+//			returns true once they have been listed
+func (c *ResourceCache) Synced(resources ...string) bool {
+	wanted := map[string]bool{}
+	for _, r := range resources {
+		wanted[r] = true
+	}
+	for _, s := range c.stores {
+		if (len(wanted) == 0 || wanted[s.resource]) && !s.synced() {
+			return false
+		}
+	}
+	return true
+}
+
+// Status : returns the synchronization state of every resource
+func (c *ResourceCache) Status() CacheStatus {
+	status := CacheStatus{Synced: true}
+	for _, s := range c.stores {
+		s.mu.RLock()
+		rs := s.status
+		rs.Objects = len(s.objects)
+		s.mu.RUnlock()
+		status.Synced = status.Synced && rs.Synced
+		status.Resources = append(status.Resources, rs)
+	}
+	return status
+}
+
+// store : returns the store of the resource
+func (c *ResourceCache) store(resource string) *cacheStore {
+	for _, s := range c.stores {
+		if s.resource == resource {
+			return s
+		}
+	}
+	return nil
+}
+
+func (s *cacheStore) synced() bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.status.Synced
+}
+
+// run : relists the resource and watches it from the listed version, relisting when the watch version
+//			expires and with a backoff when the list or the watch fails
+func (s *cacheStore) run(ctx context.Context) {
+	backoff := time.Second
+	for ctx.Err() == nil {
+		version, err := s.relist()
+		if err == nil {
+			backoff = time.Second
+			err = s.watchFrom(ctx, version)
+		}
+		if err == nil || watchExpired(err) {
+			continue
+		}
+		s.setError(err)
+		select {
+		case <-ctx.Done():
+		case <-time.After(backoff):
+		}
+		if backoff < 30*time.Second {
+			backoff *= 2
+		}
+	}
+}
+
+// relist : replaces the objects of the store with a full list, returns the version to watch from
+func (s *cacheStore) relist() (string, error) {
+	objects := map[string]runtime.Object{}
+	opts := metav1.ListOptions{Limit: cacheListChunkSize}
+	var version string
+	for {
+		list, err := s.list(opts)
+		if err != nil {
+			return "", &APIError{Op: "list " + s.resource, Err: err}
+		}
+		listMeta, err := meta.ListAccessor(list)
+		if err != nil {
+			return "", &APIError{Op: "list " + s.resource, Err: err}
+		}
+		objs, err := meta.ExtractList(list)
+		if err != nil {
+			return "", &APIError{Op: "list " + s.resource, Err: err}
+		}
+		for _, o := range objs {
+			objects[cacheKey(o)] = o
+		}
+		version = listMeta.GetResourceVersion()
+		if listMeta.GetContinue() == "" {
+			break
+		}
+		opts.Continue = listMeta.GetContinue()
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.objects = objects
+	s.status.Synced = true
+	s.status.ResourceVersion = version
+	s.status.LastSync = time.Now()
+	s.status.Error = ""
+	return version, nil
+}
+
+// watchFrom : applies the watch events to the store until the watch is closed or the context is done,
+//			re-watching from the last seen version. Returns an error when the store must be relisted.
+func (s *cacheStore) watchFrom(ctx context.Context, version string) error {
+	for ctx.Err() == nil {
+		// like the client-go reflectors, watches are renewed every 5 to 10 minutes
+		timeout := int64(300 + rand.Intn(300))
+		w, err := s.watch(metav1.ListOptions{ResourceVersion: version, TimeoutSeconds: &timeout})
+		if err != nil {
+			return &APIError{Op: "watch " + s.resource, Err: err}
+		}
+		version, err = s.handleEvents(ctx, w)
+		w.Stop()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *cacheStore) handleEvents(ctx context.Context, w watch.Interface) (string, error) {
+	version := s.resourceVersion()
+	for {
+		select {
+		case <-ctx.Done():
+			return version, nil
+		case event, ok := <-w.ResultChan():
+			if !ok {
+				return version, nil
+			}
+			if event.Type == watch.Error {
+				// typically the watched version expired, the store is relisted
+				return "", &APIError{Op: "watch " + s.resource, Err: apierrors.FromObject(event.Object)}
+			}
+			accessor, err := meta.Accessor(event.Object)
+			if err != nil {
+				continue
+			}
+			version = accessor.GetResourceVersion()
+
+			s.mu.Lock()
+			switch event.Type {
+			case watch.Added, watch.Modified:
+				s.objects[cacheKey(event.Object)] = event.Object
+			case watch.Deleted:
+				delete(s.objects, cacheKey(event.Object))
+			}
+			s.status.ResourceVersion = version
+			s.status.LastEvent = time.Now()
+			s.mu.Unlock()
+		}
+	}
+}
+
+// watchExpired : returns true when the watched version is older than the history of the API server,
+//			410 Gone, the store is relisted right away
+func watchExpired(err error) bool {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		err = apiErr.Err
+	}
+	return apierrors.IsResourceExpired(err) || apierrors.IsGone(err)
+}
+
+func (s *cacheStore) resourceVersion() string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.status.ResourceVersion
+}
+
+func (s *cacheStore) setError(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.status.Error = err.Error()
+}
+
+// cacheKey : returns the namespace/name key of an object
+func cacheKey(o runtime.Object) string {
+	accessor, err := meta.Accessor(o)
+	if err != nil {
+		return ""
+	}
+	return accessor.GetNamespace() + "/" + accessor.GetName()
+}
+
+// query : returns the objects of the resource matching the namespaces and selectors of the query,
+//			sorted by namespace and name. Limit is ignored, see queryPage. Returns ErrUnsupportedFieldSelector when the field
+//			selector uses a field the cache does not index, to be listed from the API server instead.
+func (c *ResourceCache) query(resource string, query QueryOptions) ([]runtime.Object, error) {
+	if err := query.Validate(); err != nil {
+		return nil, err
+	}
+	labelSelector, _ := labels.Parse(query.LabelSelector)
+	fieldSelector, _ := fields.ParseSelector(query.FieldSelector)
+	for _, r := range fieldSelector.Requirements() {
+		if !cachedField(resource, r.Field) {
+			return nil, &APIError{Op: "read cached " + resource, Err: fmt.Errorf("%w: %s", ErrUnsupportedFieldSelector, r.Field)}
+		}
+	}
+	namespaces := map[string]bool{}
+	for _, ns := range query.Namespaces {
+		namespaces[ns] = true
+	}
+
+	store := c.store(resource)
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+	if !store.status.Synced {
+		return nil, &APIError{Op: "read cached " + resource, Err: ErrNotSynced}
+	}
+
+	var keys []string
+	for key, o := range store.objects {
+		accessor, err := meta.Accessor(o)
+		if err != nil {
+			continue
+		}
+		if len(namespaces) > 0 && accessor.GetNamespace() != "" && !namespaces[accessor.GetNamespace()] {
+			continue
+		}
+		if !labelSelector.Matches(labels.Set(accessor.GetLabels())) || !fieldSelector.Matches(objectFields(o, accessor)) {
+			continue
+		}
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	objects := make([]runtime.Object, len(keys))
+	for i, key := range keys {
+		objects[i] = store.objects[key]
+	}
+	return objects, nil
+}
+
+// queryPage : returns the page of the continue token of the objects returned by query, at most Limit objects
+//			from the offset of the token, and the continue token of the next page, empty on the last one.
+//			The offsets shift when objects are added or deleted between the pages.
+func (c *ResourceCache) queryPage(resource string, query QueryOptions, token string) ([]runtime.Object, string, error) {
+	page, err := parsePageToken(token)
+	if err != nil {
+		return nil, "", err
+	}
+	if token != "" && !page.Cache {
+		return nil, "", fmt.Errorf("%w '%s': not a page of the cache", ErrInvalidContinue, token)
+	}
+	objects, err := c.query(resource, query)
+	if err != nil {
+		return nil, "", err
+	}
+	if page.Offset > len(objects) {
+		page.Offset = len(objects)
+	}
+	objects = objects[page.Offset:]
+	if query.Limit == 0 || int64(len(objects)) <= query.Limit {
+		return objects, "", nil
+	}
+	return objects[:query.Limit], pageToken{Cache: true, Offset: page.Offset + int(query.Limit)}.encode(), nil
+}
+
+// cachedFields : the fields supported by the field selectors of the cache, besides metadata.name and
+// metadata.namespace, by resource
+var cachedFields = map[string][]string{
+	"pods":       {"spec.nodeName", "spec.serviceAccountName", "status.phase", "status.podIP"},
+	"namespaces": {"status.phase"},
+}
+
+// cachedField : returns whether the field selectors of the cache support the field of the resource
+func cachedField(resource string, field string) bool {
+	if field == "metadata.name" || field == "metadata.namespace" {
+		return true
+	}
+	for _, f := range cachedFields[resource] {
+		if f == field {
+			return true
+		}
+	}
+	return false
+}
+
+// objectFields : returns the fields of the object supported by the field selectors of the cache
+func objectFields(o runtime.Object, accessor metav1.Object) fields.Set {
+	set := fields.Set{
+		"metadata.name":      accessor.GetName(),
+		"metadata.namespace": accessor.GetNamespace(),
+	}
+	switch obj := o.(type) {
+	case *v1.Pod:
+		set["spec.nodeName"] = obj.Spec.NodeName
+		set["spec.serviceAccountName"] = obj.Spec.ServiceAccountName
+		set["status.phase"] = string(obj.Status.Phase)
+		set["status.podIP"] = obj.Status.PodIP
+	case *v1.Namespace:
+		set["status.phase"] = string(obj.Status.Phase)
+	}
+	return set
+}
+
+// Pods : returns the cached Pods matching the query
+func (c *ResourceCache) Pods(query QueryOptions) ([]v1.Pod, error) {
+	objs, err := c.query("pods", query)
+	items := make([]v1.Pod, len(objs))
+	for i, o := range objs {
+		items[i] = *o.(*v1.Pod)
+	}
+	return items, err
+}
+
+// PodsPage : returns the page of the continue token of the cached Pods matching the query, and the continue
+//			token of the next page
+func (c *ResourceCache) PodsPage(query QueryOptions, token string) ([]v1.Pod, string, error) {
+	objs, next, err := c.queryPage("pods", query, token)
+	items := make([]v1.Pod, len(objs))
+	for i, o := range objs {
+		items[i] = *o.(*v1.Pod)
+	}
+	return items, next, err
+}
+
+// Services : returns the cached Services matching the query
+func (c *ResourceCache) Services(query QueryOptions) ([]v1.Service, error) {
+	objs, err := c.query("services", query)
+	items := make([]v1.Service, len(objs))
+	for i, o := range objs {
+		items[i] = *o.(*v1.Service)
+	}
+	return items, err
+}
+
+// ServicesPage : returns the page of the continue token of the cached Services matching the query, and the
+//			continue token of the next page
+func (c *ResourceCache) ServicesPage(query QueryOptions, token string) ([]v1.Service, string, error) {
+	objs, next, err := c.queryPage("services", query, token)
+	items := make([]v1.Service, len(objs))
+	for i, o := range objs {
+		items[i] = *o.(*v1.Service)
+	}
+	return items, next, err
+}
+
+// Endpoints : returns the cached Endpoints matching the query
+func (c *ResourceCache) Endpoints(query QueryOptions) ([]v1.Endpoints, error) {
+	objs, err := c.query("endpoints", query)
+	items := make([]v1.Endpoints, len(objs))
+	for i, o := range objs {
+		items[i] = *o.(*v1.Endpoints)
+	}
+	return items, err
+}
+
+// Namespaces : returns the cached Namespaces matching the query
+func (c *ResourceCache) Namespaces(query QueryOptions) ([]v1.Namespace, error) {
+	objs, err := c.query("namespaces", query)
+	items := make([]v1.Namespace, len(objs))
+	for i, o := range objs {
+		items[i] = *o.(*v1.Namespace)
+	}
+	return items, err
+}
+
+// NetworkPolicies : returns the cached NetworkPolicies matching the query
+func (c *ResourceCache) NetworkPolicies(query QueryOptions) ([]networkingv1.NetworkPolicy, error) {
+	objs, err := c.query("networkpolicies", query)
+	items := make([]networkingv1.NetworkPolicy, len(objs))
+	for i, o := range objs {
+		items[i] = *o.(*networkingv1.NetworkPolicy)
+	}
+	return items, err
+}
+
+// FindPod : returns the cached Pod by name+namespace, or a NotFoundError
+func (c *ResourceCache) FindPod(podName string, podNamespace string) (v1.Pod, error) {
+	pods, err := c.Pods(nameQuery(podName, podNamespace))
+	if err != nil {
+		return v1.Pod{}, err
+	}
+	return GetPodByName(pods, podName, podNamespace)
+}
+
+// FindService : returns the cached Service by name+namespace, or a NotFoundError
+func (c *ResourceCache) FindService(svcName string, svcNamespace string) (v1.Service, error) {
+	svcs, err := c.Services(nameQuery(svcName, svcNamespace))
+	if err != nil {
+		return v1.Service{}, err
+	}
+	return GetServiceByName(svcs, svcName, svcNamespace)
+}
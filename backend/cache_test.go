@@ -0,0 +1,160 @@
+package backend
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+// syncedCache : returns a cache of the objects of the clientset, listed once without watching
+func syncedCache(t *testing.T, clientset *fake.Clientset) *ResourceCache {
+	c := NewResourceCache(clientset)
+	for _, s := range c.stores {
+		if _, err := s.relist(); err != nil {
+			t.Fatalf("relist %s: %v", s.resource, err)
+		}
+	}
+	return c
+}
+
+func TestCachePodsPage(t *testing.T) {
+	c := syncedCache(t, fake.NewSimpleClientset(
+		testPod("web-0", "shop", map[string]string{"app": "web"}),
+		testPod("web-1", "shop", map[string]string{"app": "web"}),
+		testPod("db-0", "shop", map[string]string{"app": "db"}),
+		testPod("web-0", "staging", map[string]string{"app": "web"}),
+		testPod("batch", "jobs", nil),
+	))
+
+	tests := []struct {
+		name  string
+		query QueryOptions
+		want  [][]string
+	}{
+		{"pages", QueryOptions{Limit: 2}, [][]string{{"jobs/batch", "shop/db-0"}, {"shop/web-0", "shop/web-1"}, {"staging/web-0"}}},
+		{"last page full", QueryOptions{LabelSelector: "app=web", Limit: 3}, [][]string{{"shop/web-0", "shop/web-1", "staging/web-0"}}},
+		{"no limit", QueryOptions{Namespaces: []string{"shop"}}, [][]string{{"shop/db-0", "shop/web-0", "shop/web-1"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var pages [][]string
+			token := ""
+			for i := 0; i < 10; i++ {
+				pods, next, err := c.PodsPage(tt.query, token)
+				if err != nil {
+					t.Fatalf("PodsPage: %v", err)
+				}
+				pages = append(pages, podNames(pods))
+				if token = next; token == "" {
+					break
+				}
+				if !CachePageToken(token) {
+					t.Errorf("PodsPage token %q is not a token of the cache", token)
+				}
+			}
+			if !reflect.DeepEqual(pages, tt.want) {
+				t.Errorf("PodsPage pages = %v, want %v", pages, tt.want)
+			}
+		})
+	}
+
+	if _, _, err := c.PodsPage(QueryOptions{Limit: 1}, pageToken{Continue: "abc"}.encode()); !errors.Is(err, ErrInvalidContinue) {
+		t.Errorf("PodsPage with a token of the API server = %v, want %v", err, ErrInvalidContinue)
+	}
+}
+
+// watchCall : a watch started by the cache, with the version it watches from
+type watchCall struct {
+	version string
+	watcher *watch.FakeWatcher
+}
+
+func versionedPod(name, namespace, version string) *v1.Pod {
+	pod := testPod(name, namespace, nil)
+	pod.ResourceVersion = version
+	return pod
+}
+
+// nextWatch : returns the next watch started by the cache, failing when it does not start from the version
+func nextWatch(t *testing.T, watches chan watchCall, version string) *watch.FakeWatcher {
+	t.Helper()
+	select {
+	case call := <-watches:
+		if call.version != version {
+			t.Fatalf("watch from version %q, want %q", call.version, version)
+		}
+		return call.watcher
+	case <-time.After(5 * time.Second):
+		t.Fatalf("no watch from version %q", version)
+	}
+	return nil
+}
+
+// waitForPods : waits until the cached pods are the wanted ones
+func waitForPods(t *testing.T, c *ResourceCache, want []string) {
+	t.Helper()
+	var got []string
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		pods, err := c.Pods(QueryOptions{})
+		if got = podNames(pods); err == nil && reflect.DeepEqual(got, want) {
+			return
+		}
+	}
+	t.Fatalf("cached pods = %v, want %v", got, want)
+}
+
+func TestCacheWatch(t *testing.T) {
+	clientset := fake.NewSimpleClientset()
+	var mu sync.Mutex
+	lists := 0
+	clientset.PrependReactor("list", "pods", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		lists++
+		version := strconv.Itoa(lists * 100)
+		return true, &v1.PodList{ListMeta: metav1.ListMeta{ResourceVersion: version}, Items: []v1.Pod{*versionedPod("web-0", "shop", version)}}, nil
+	})
+	watches := make(chan watchCall, 10)
+	clientset.PrependWatchReactor("pods", func(action k8stesting.Action) (bool, watch.Interface, error) {
+		w := watch.NewFake()
+		watches <- watchCall{action.(k8stesting.WatchActionImpl).WatchRestrictions.ResourceVersion, w}
+		return true, w, nil
+	})
+
+	c := NewResourceCache(clientset)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go c.store("pods").run(ctx)
+
+	w := nextWatch(t, watches, "100")
+	w.Add(versionedPod("web-1", "shop", "101"))
+	waitForPods(t, c, []string{"shop/web-0", "shop/web-1"})
+	w.Modify(versionedPod("web-1", "shop", "102"))
+	w.Delete(versionedPod("web-0", "shop", "103"))
+	waitForPods(t, c, []string{"shop/web-1"})
+
+	// the API server closes the watch at its timeout, the cache watches again from the last event
+	w.Stop()
+	w = nextWatch(t, watches, "103")
+
+	// the version expired, the cache relists right away and watches from the new list
+	w.Error(&metav1.Status{Status: metav1.StatusFailure, Code: 410, Reason: metav1.StatusReasonExpired, Message: "too old resource version: 103"})
+	nextWatch(t, watches, "200")
+	waitForPods(t, c, []string{"shop/web-0"})
+	for _, r := range c.Status().Resources {
+		if r.Resource == "pods" && (r.Error != "" || r.ResourceVersion != "200") {
+			t.Errorf("pods status = %+v, want version 200 without error", r)
+		}
+	}
+}
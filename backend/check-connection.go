@@ -2,71 +2,34 @@ package backend
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"io"
 	"strings"
+	"time"
 
 	v1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/tools/remotecommand"
+	utilexec "k8s.io/client-go/util/exec"
 )
 
-type networkCommandStructure struct {
-	command       string
-	portMandatory bool
-}
-
-type networkCommand struct {
-	command string
-}
-
-var networkCommandConstructorList = []networkCommandStructure{
-	networkCommandStructure{"wget --spider -q --timeout=5 %s", false},
-	networkCommandStructure{"curl -s -k %s", false},
-	networkCommandStructure{"nmap -p %s %d", true},
-	networkCommandStructure{"nc -z -v -w 2 %s %d", true},
-	networkCommandStructure{"echo -n | telnet %s %d", true},
-}
-
-func networkCommandConstructor(ncs networkCommandStructure, ep string, epNs string, port int) networkCommand {
-
-	var nc networkCommand
-
-	if epNs != "" {
-		epNs = "." + epNs
-	}
-
-	if ncs.portMandatory && port != 0 {
-		nc = networkCommand{
-			command: fmt.Sprintf(ncs.command, ep+epNs, port),
-		}
-	} else if ncs.portMandatory && port == 0 {
-	} else if port != 0 {
-		nc = networkCommand{
-			command: fmt.Sprintf(ncs.command+":%d", ep+epNs, port),
-		}
-	} else {
-		nc = networkCommand{
-			command: fmt.Sprintf(ncs.command, ep+epNs),
-		}
+// ExecIntoPod : accepts a clientset, a pod, a command and a standard redader
+//				 executes the specified command into the specified pod
+func ExecIntoPod(clientset kubernetes.Interface, pod *v1.Pod, command string, stdin io.Reader, getOnlyResultCode bool) (string, string, error) {
+	if getOnlyResultCode {
+		return execInPod(clientset, pod, []string{"sh", "-c", command + " > /dev/null 2>&1"}, stdin)
 	}
-
-	return nc
+	return execInPod(clientset, pod, strings.Fields(command), stdin)
 }
 
-func networkCommandList(ep string, epNs string, port int) []networkCommand {
-	var ncl []networkCommand
+// execInPod : executes the command into the first container of the pod
+//			returns stdout and stderr, also when the command fails. The tests replace it to fake the pods.
+var execInPod = streamExecInPod
 
-	for _, t := range networkCommandConstructorList {
-		ncl = append(ncl, networkCommandConstructor(t, ep, epNs, port))
-	}
-	return ncl
-}
-
-// ExecIntoPod : accepts a clientset, a pod, a command and a standard redader
-//				 executes the specified command into the specified pod
-func ExecIntoPod(clientset *kubernetes.Clientset, pod *v1.Pod, command string, stdin io.Reader, getOnlyResultCode bool) (string, string, error) {
+// streamExecInPod : executes the command into the first container of the pod through the exec subresource
+func streamExecInPod(clientset kubernetes.Interface, pod *v1.Pod, command []string, stdin io.Reader) (string, string, error) {
 	req := clientset.CoreV1().RESTClient().Post().
 		Resource("pods").
 		Name(pod.Name).
@@ -78,30 +41,19 @@ func ExecIntoPod(clientset *kubernetes.Clientset, pod *v1.Pod, command string, s
 	}
 
 	parameterCodec := runtime.NewParameterCodec(scheme)
-	if getOnlyResultCode == false {
-		req.VersionedParams(&v1.PodExecOptions{
-			Command: strings.Fields(command),
-			Stdin:   stdin != nil,
-			Stdout:  true,
-			Stderr:  true,
-			TTY:     false,
-		}, parameterCodec)
-	} else {
-		req.VersionedParams(&v1.PodExecOptions{
-			Command: []string{
-				"sh",
-				"-c",
-				command + " &> /dev/null && echo $?",
-			},
-			Stdin:  stdin != nil,
-			Stdout: true,
-			Stderr: true,
-			TTY:    false,
-		}, parameterCodec)
-
+	req.VersionedParams(&v1.PodExecOptions{
+		Command: command,
+		Stdin:   stdin != nil,
+		Stdout:  true,
+		Stderr:  true,
+		TTY:     false,
+	}, parameterCodec)
+
+	config, err := GetConfig()
+	if err != nil {
+		return "", "", err
 	}
-
-	exec, err := remotecommand.NewSPDYExecutor(GetConfig(), "POST", req.URL())
+	exec, err := remotecommand.NewSPDYExecutor(config, "POST", req.URL())
 	if err != nil {
 		return "", "", fmt.Errorf("error while creating Executor: %v", err)
 	}
@@ -114,7 +66,7 @@ func ExecIntoPod(clientset *kubernetes.Clientset, pod *v1.Pod, command string, s
 		Tty:    false,
 	})
 	if err != nil {
-		return "", "", fmt.Errorf("error in Stream: %v", err)
+		return stdout.String(), stderr.String(), fmt.Errorf("error in Stream: %w", err)
 	}
 
 	return stdout.String(), stderr.String(), nil
@@ -122,82 +74,161 @@ func ExecIntoPod(clientset *kubernetes.Clientset, pod *v1.Pod, command string, s
 }
 
 // ConnectionPodToService : accepts a pod and a service
-//				 executes the specified command into the specified pod to test connection to the specified service
-func ConnectionPodToService(clientset *kubernetes.Clientset, pod v1.Pod, svc v1.Service, svcPort int) bool {
-
-	var result = false
-	commands := networkCommandList(svc.Name, svc.Namespace, svcPort)
-	for _, nc := range commands {
-		if nc.command != "" {
-			fmt.Printf("Testing with %s\n", nc.command)
-			_, stderr, err := ExecIntoPod(clientset, &pod, nc.command, nil, true)
-			if len(stderr) != 0 {
-				// fmt.Println("STDERR:", stderr)
-			}
-			if err != nil {
-				// fmt.Printf("Error occured while `exec`ing to the Pod %s, namespace %s, command %s\n", pod.Name, pod.Namespace, nc.command)
-				// fmt.Println(err)
-			} else {
-				// fmt.Println("Output:")
-				// fmt.Println(output)
-				result = true
-				break
-			}
-		}
-	}
-	return result
+//				 executes the specified command into the specified pod to test connection to the specified service,
+//				 with the protocol of the service port, or of the options when the service does not declare the port
+func ConnectionPodToService(clientset kubernetes.Interface, pod v1.Pod, svc v1.Service, svcPort int, opts ConnectionOptions) ConnectionResult {
+
+	port := servicePort(svc, svcPort, opts.Protocol)
+	return probeConnection(clientset, pod, newProbeTarget(svc.Name+"."+svc.Namespace, int(port.Port), portProtocol(port.Protocol)), opts)
 }
 
 // ConnectionPodToExternal : accepts a pod and an external endpoint
 //				 executes the specified command into the specified pod to test connection to the specified external endpoint
-func ConnectionPodToExternal(clientset *kubernetes.Clientset, pod v1.Pod, url string, urlPort int) bool {
-
-	var result = false
-	commands := networkCommandList(url, "", urlPort)
-	for _, nc := range commands {
-		if nc.command != "" {
-			fmt.Printf("Testing with %s\n", nc.command)
-			_, stderr, err := ExecIntoPod(clientset, &pod, nc.command, nil, true)
-			if len(stderr) != 0 {
-				// fmt.Println("STDERR:", stderr)
-			}
-			if err != nil {
-				// fmt.Printf("Error occured while `exec`ing to the Pod %s, namespace %s, command %s\n", pod.Name, pod.Namespace, nc.command)
-				// fmt.Println(err)
-			} else {
-				// fmt.Println("Output:")
-				// fmt.Println(output)
-				result = true
-				break
-			}
+func ConnectionPodToExternal(clientset kubernetes.Interface, pod v1.Pod, url string, urlPort int, opts ConnectionOptions) ConnectionResult {
+
+	return probeConnection(clientset, pod, newProbeTarget(url, urlPort, opts.Protocol), opts)
+}
+
+// ConnectionPodToPod : accepts two pods
+//				 executes the specified command into the specified pod to test connection against the IP of the
+//				 other pod, which does not depend on the pod records of the cluster DNS
+func ConnectionPodToPod(clientset kubernetes.Interface, pod v1.Pod, target v1.Pod, targetPort int, opts ConnectionOptions) ConnectionResult {
+
+	ip := GetPodIP(target)
+	if ip == "" {
+		return ConnectionResult{
+			Source: pod.Namespace + "/" + pod.Name,
+			Target: target.Namespace + "/" + target.Name,
+			Port:   targetPort,
+			Reason: ReasonTargetNotFound,
+			Error:  fmt.Sprintf("pod %s/%s has no IP address", target.Namespace, target.Name),
 		}
 	}
-	return result
+	return probeConnection(clientset, pod, newProbeTarget(ip, targetPort, opts.Protocol), opts)
 }
 
-// ConnectionPodToPod : accepts two pods
-//				 executes the specified command into the specified pod to test connection against the other pod
-func ConnectionPodToPod(clientset *kubernetes.Clientset, pod v1.Pod, target v1.Pod, targetPort int) bool {
-
-	var result = false
-	commands := networkCommandList(strings.ReplaceAll(GetPodIP(target), ".", "-"), target.Namespace+".pod", targetPort)
-	for _, nc := range commands {
-		if nc.command != "" {
-			fmt.Printf("Testing with %s\n", nc.command)
-			_, stderr, err := ExecIntoPod(clientset, &pod, nc.command, nil, true)
-			if len(stderr) != 0 {
-				// fmt.Println("STDERR:", stderr)
-			}
-			if err != nil {
-				// fmt.Printf("Error occured while `exec`ing to the Pod %s, namespace %s, command %s\n", pod.Name, pod.Namespace, nc.command)
-				// fmt.Println(err)
-			} else {
-				// fmt.Println("Output:")
-				// fmt.Println(output)
-				result = true
+// requiredProber : returns the only prober able to probe the target, nil when any prober can
+func requiredProber(target ProbeTarget) Prober {
+	switch {
+	case target.Perf != nil:
+		// the samples are timed by curl, the duration of the exec would include the API server round trips
+		return perfProber{}
+	case target.TLS != nil:
+		// TLS checks need the chain and the verification, only printed by openssl
+		return tlsProber{}
+	case target.HTTP != nil:
+		// HTTP checks need the response and the measured values, only printed by curl
+		return httpProber{}
+	case target.Proxy != "":
+		// connections through a proxy are checked by forwarding or tunneling them with curl
+		return proxyProber{}
+	}
+	return nil
+}
+
+// checkProbers : returns an error when the names restrict the probers and exclude the required one
+func checkProbers(names []string, required Prober) error {
+	if len(names) == 0 {
+		return nil
+	}
+	for _, name := range names {
+		if name == required.Name() {
+			return nil
+		}
+	}
+	return fmt.Errorf("the probers %s exclude %s, the only prober able to run this check", strings.Join(names, ","), required.Name())
+}
+
+// ValidateProbers : accepts whether the connections go through a proxy and whether their performance is measured
+//			returns an error when the probers of the options exclude the only prober able to run the HTTP or TLS
+//			check of the options, to probe through the proxy or to measure the performance
+func (o ConnectionOptions) ValidateProbers(proxy bool, perf bool) error {
+	target := ProbeTarget{HTTP: o.HTTP, TLS: o.TLS}
+	if proxy {
+		target.Proxy = "proxy"
+	}
+	if perf {
+		target.Perf = &PerfOptions{}
+	}
+	if p := requiredProber(target); p != nil {
+		return checkProbers(o.Probers, p)
+	}
+	return nil
+}
+
+// runProbers : executes the selected probers into the pod until one of them succeeds
+//			returns the result and whether at least one of the probers is available in the pod
+func runProbers(clientset kubernetes.Interface, pod v1.Pod, target ProbeTarget, opts ConnectionOptions) (ConnectionResult, bool) {
+	result := ConnectionResult{Strategy: ProbeStrategyExec}
+	available := false
+
+	probers, err := selectProbers(opts.Probers, target.Protocol)
+	if p := requiredProber(target); p != nil {
+		probers, err = []Prober{p}, checkProbers(opts.Probers, p)
+	}
+	if err != nil {
+		result.Error = err.Error()
+		result.Reason = ReasonToolMissing
+		return result, true
+	}
+
+	for _, p := range probers {
+		attempt := ProbeAttempt{Prober: p.Name()}
+		command, err := p.Command(target)
+		if err != nil {
+			attempt.Error = err.Error()
+			result.Attempts = append(result.Attempts, attempt)
+			continue
+		}
+		attempt.Command = command
+		if !opts.Quiet {
+			fmt.Printf("Testing with %s\n", command)
+		}
+
+		// the shell exits with 127 when a required binary is missing, the probes ignore the proxy
+		// environment of the container and connect directly unless the target sets a proxy
+		script := "unset http_proxy https_proxy all_proxy HTTP_PROXY HTTPS_PROXY ALL_PROXY; "
+		for _, b := range p.RequiredBinaries() {
+			script += "command -v " + b + " > /dev/null 2>&1 || exit 127; "
+		}
+		start := time.Now()
+		stdout, stderr, err := execInPod(clientset, &pod, []string{"sh", "-c", script + command}, nil)
+		attempt.Duration = time.Since(start)
+		attempt.Stdout = stdout
+		attempt.Stderr = stderr
+
+		if err != nil {
+			var exitErr utilexec.ExitError
+			if !errors.As(err, &exitErr) {
+				// the shell itself cannot be run, no prober can be
+				attempt.ExitCode = -1
+				attempt.Error = err.Error()
+				attempt.Reason = classifyFailure(-1, stderr, err)
+				result.Attempts = append(result.Attempts, attempt)
 				break
 			}
+			attempt.ExitCode = exitErr.ExitStatus()
 		}
+		if attempt.ExitCode == 126 || attempt.ExitCode == 127 {
+			attempt.Error = "not available in the container"
+			attempt.Reason = ReasonToolMissing
+			result.Attempts = append(result.Attempts, attempt)
+			continue
+		}
+
+		attempt.Available = true
+		available = true
+		if err := p.Interpret(attempt.ExitCode, stdout, stderr); err != nil {
+			attempt.Error = err.Error()
+			attempt.Reason = classifyFailure(attempt.ExitCode, stdout+"\n"+stderr, nil)
+			result.Attempts = append(result.Attempts, attempt)
+			continue
+		}
+
+		result.Attempts = append(result.Attempts, attempt)
+		result.Connected = true
+		result.Prober = p.Name()
+		break
 	}
-	return result
+	return result, available
 }
@@ -0,0 +1,225 @@
+package backend
+
+import (
+	"context"
+
+	appv1 "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+	networkingv1beta1 "k8s.io/api/networking/v1beta1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes"
+)
+
+// ClusterSnapshot : the resources the consistency rules are evaluated on
+type ClusterSnapshot struct {
+	Namespaces             []v1.Namespace
+	Pods                   []v1.Pod
+	Deployments            []appv1.Deployment
+	DaemonSets             []appv1.DaemonSet
+	StatefulSets           []appv1.StatefulSet
+	Services               []v1.Service
+	Endpoints              []v1.Endpoints
+	Ingresses              []networkingv1beta1.Ingress
+	ConfigMaps             []v1.ConfigMap
+	Secrets                []v1.Secret
+	ServiceAccounts        []v1.ServiceAccount
+	PersistentVolumeClaims []v1.PersistentVolumeClaim
+
+	// referenced indexes the objects referenced by another object of the snapshot, see isReferenced
+	referenced map[string]bool
+}
+
+// snapshotKinds : the kinds of the objects of the snapshot the rules can be evaluated on
+var snapshotKinds = []string{"Namespace", "Pod", "Deployment", "DaemonSet", "StatefulSet", "Service", "Endpoints", "Ingress", "ConfigMap", "Secret", "ServiceAccount", "PersistentVolumeClaim"}
+
+// GetClusterSnapshot : accepts a context, a clientset and the query scoping the namespaced resources
+//			returns the resources of the cluster the consistency rules are evaluated on.
+//			Only the namespaces and the limit of the query are used: every object of the namespaces
+//			is listed so that references resolve, the selectors are set in CheckOptions instead.
+//			The namespaces are always listed in full.
+func GetClusterSnapshot(ctx context.Context, clientset kubernetes.Interface, query QueryOptions) (ClusterSnapshot, error) {
+	var snapshot ClusterSnapshot
+	var err error
+	scope := QueryOptions{Namespaces: query.Namespaces, Limit: query.Limit}
+
+	if snapshot.Namespaces, err = GetNamespaces(ctx, clientset, QueryOptions{Limit: query.Limit}); err != nil {
+		return snapshot, err
+	}
+	if snapshot.Pods, err = GetPods(ctx, clientset, scope); err != nil {
+		return snapshot, err
+	}
+	if snapshot.Deployments, err = GetDeployments(ctx, clientset, scope); err != nil {
+		return snapshot, err
+	}
+	if snapshot.DaemonSets, err = GetDaemonSets(ctx, clientset, scope); err != nil {
+		return snapshot, err
+	}
+	if snapshot.StatefulSets, err = GetStatefulSets(ctx, clientset, scope); err != nil {
+		return snapshot, err
+	}
+	if snapshot.Services, err = GetServices(ctx, clientset, scope); err != nil {
+		return snapshot, err
+	}
+	if snapshot.Endpoints, err = GetEndpoints(ctx, clientset, scope); err != nil {
+		return snapshot, err
+	}
+	if snapshot.Ingresses, err = GetIngresses(ctx, clientset, scope); err != nil {
+		return snapshot, err
+	}
+	if snapshot.ConfigMaps, err = GetConfigMaps(ctx, clientset, scope); err != nil {
+		return snapshot, err
+	}
+	if snapshot.Secrets, err = GetSecrets(ctx, clientset, scope); err != nil {
+		return snapshot, err
+	}
+	if snapshot.ServiceAccounts, err = GetServiceAccounts(ctx, clientset, scope); err != nil {
+		return snapshot, err
+	}
+	if snapshot.PersistentVolumeClaims, err = GetPersistentVolumeClaims(ctx, clientset, scope); err != nil {
+		return snapshot, err
+	}
+	return snapshot, nil
+}
+
+// LoadClusterSnapshot : accepts a list of manifest files or directories
+//			returns the resources they declare, other kinds are ignored
+func LoadClusterSnapshot(paths []string) (ClusterSnapshot, error) {
+	var snapshot ClusterSnapshot
+	err := loadManifests(paths, snapshot.add)
+	return snapshot, err
+}
+
+func (s *ClusterSnapshot) add(obj runtime.Object) {
+	if o, err := meta.Accessor(obj); err == nil && o.GetNamespace() == "" && objectKind(obj) != "Namespace" {
+		o.SetNamespace("default")
+	}
+	switch o := obj.(type) {
+	case *v1.Namespace:
+		s.Namespaces = append(s.Namespaces, *o)
+	case *v1.Pod:
+		s.Pods = append(s.Pods, *o)
+	case *appv1.Deployment:
+		s.Deployments = append(s.Deployments, *o)
+	case *appv1.DaemonSet:
+		s.DaemonSets = append(s.DaemonSets, *o)
+	case *appv1.StatefulSet:
+		s.StatefulSets = append(s.StatefulSets, *o)
+	case *v1.Service:
+		s.Services = append(s.Services, *o)
+	case *v1.Endpoints:
+		s.Endpoints = append(s.Endpoints, *o)
+	case *networkingv1beta1.Ingress:
+		s.Ingresses = append(s.Ingresses, *o)
+	case *v1.ConfigMap:
+		s.ConfigMaps = append(s.ConfigMaps, *o)
+	case *v1.Secret:
+		s.Secrets = append(s.Secrets, *o)
+	case *v1.ServiceAccount:
+		s.ServiceAccounts = append(s.ServiceAccounts, *o)
+	case *v1.PersistentVolumeClaim:
+		s.PersistentVolumeClaims = append(s.PersistentVolumeClaims, *o)
+	}
+}
+
+// objects : returns the objects of the snapshot the rules are evaluated on,
+//			pods managed by a controller are evaluated through their workload and are left out
+func (s *ClusterSnapshot) objects() []runtime.Object {
+	var objects []runtime.Object
+	for i := range s.Namespaces {
+		objects = append(objects, &s.Namespaces[i])
+	}
+	for i := range s.Pods {
+		if metav1.GetControllerOf(&s.Pods[i]) == nil {
+			objects = append(objects, &s.Pods[i])
+		}
+	}
+	for i := range s.Deployments {
+		objects = append(objects, &s.Deployments[i])
+	}
+	for i := range s.DaemonSets {
+		objects = append(objects, &s.DaemonSets[i])
+	}
+	for i := range s.StatefulSets {
+		objects = append(objects, &s.StatefulSets[i])
+	}
+	for i := range s.Services {
+		objects = append(objects, &s.Services[i])
+	}
+	for i := range s.Endpoints {
+		objects = append(objects, &s.Endpoints[i])
+	}
+	for i := range s.Ingresses {
+		objects = append(objects, &s.Ingresses[i])
+	}
+	for i := range s.ConfigMaps {
+		objects = append(objects, &s.ConfigMaps[i])
+	}
+	for i := range s.Secrets {
+		objects = append(objects, &s.Secrets[i])
+	}
+	for i := range s.ServiceAccounts {
+		objects = append(objects, &s.ServiceAccounts[i])
+	}
+	for i := range s.PersistentVolumeClaims {
+		objects = append(objects, &s.PersistentVolumeClaims[i])
+	}
+	return objects
+}
+
+// namespace : returns the namespace with the given name, nil if the snapshot does not know it
+func (s *ClusterSnapshot) namespace(name string) *v1.Namespace {
+	for i := range s.Namespaces {
+		if s.Namespaces[i].Name == name {
+			return &s.Namespaces[i]
+		}
+	}
+	return nil
+}
+
+// objectKind : returns the kind of a typed object, the objects returned by the API have an empty TypeMeta
+func objectKind(obj runtime.Object) string {
+	switch obj.(type) {
+	case *v1.Namespace:
+		return "Namespace"
+	case *v1.Pod:
+		return "Pod"
+	case *appv1.Deployment:
+		return "Deployment"
+	case *appv1.DaemonSet:
+		return "DaemonSet"
+	case *appv1.StatefulSet:
+		return "StatefulSet"
+	case *v1.Service:
+		return "Service"
+	case *v1.Endpoints:
+		return "Endpoints"
+	case *networkingv1beta1.Ingress:
+		return "Ingress"
+	case *v1.ConfigMap:
+		return "ConfigMap"
+	case *v1.Secret:
+		return "Secret"
+	case *v1.ServiceAccount:
+		return "ServiceAccount"
+	case *v1.PersistentVolumeClaim:
+		return "PersistentVolumeClaim"
+	}
+	return obj.GetObjectKind().GroupVersionKind().Kind
+}
+
+// podSpec : returns the pod spec of a pod or of the pod template of a workload, nil for other kinds
+func podSpec(obj runtime.Object) *v1.PodSpec {
+	switch o := obj.(type) {
+	case *v1.Pod:
+		return &o.Spec
+	case *appv1.Deployment:
+		return &o.Spec.Template.Spec
+	case *appv1.DaemonSet:
+		return &o.Spec.Template.Spec
+	case *appv1.StatefulSet:
+		return &o.Spec.Template.Spec
+	}
+	return nil
+}
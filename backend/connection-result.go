@@ -0,0 +1,155 @@
+package backend
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+)
+
+// FailureReason : the classified cause of a failed connection check
+type FailureReason string
+
+const (
+	// ReasonToolMissing : none of the probing tools could be run in the container
+	ReasonToolMissing FailureReason = "ToolMissing"
+	// ReasonDNSFailure : the target name could not be resolved
+	ReasonDNSFailure FailureReason = "DNSFailure"
+	// ReasonConnectionRefused : the target actively refused the connection
+	ReasonConnectionRefused FailureReason = "ConnectionRefused"
+	// ReasonTimeout : the connection timed out, typically dropped by a NetworkPolicy or a firewall
+	ReasonTimeout FailureReason = "Timeout"
+	// ReasonExecForbidden : exec'ing into the pod or creating the probe is denied by RBAC
+	ReasonExecForbidden FailureReason = "ExecForbidden"
+	// ReasonPodNotFound : the source pod does not exist
+	ReasonPodNotFound FailureReason = "PodNotFound"
+	// ReasonTargetNotFound : the target pod or service does not exist
+	ReasonTargetNotFound FailureReason = "TargetNotFound"
+	// ReasonProtocolUnsupported : the protocol, typically SCTP, is not supported by the kernel of the node
+	ReasonProtocolUnsupported FailureReason = "ProtocolUnsupported"
+	// ReasonConnectionFailed : the probe failed for any other reason
+	ReasonConnectionFailed FailureReason = "ConnectionFailed"
+)
+
+// ConnectionResult : the outcome of a connection check
+type ConnectionResult struct {
+	Source    string
+	Target    string
+	Port      int
+	Connected bool
+	// Strategy is the probe strategy that produced the result
+	Strategy ProbeStrategy
+	// Prober is the name of the prober that succeeded
+	Prober   string
+	Attempts []ProbeAttempt
+	// Reason is the classified cause of the failure, empty when connected
+	Reason   FailureReason `json:",omitempty"`
+	Error    string        `json:",omitempty"`
+	Duration time.Duration
+	// HTTP is the measured response of an HTTP check, nil for plain connection checks
+	HTTP *HTTPResult `json:",omitempty"`
+	// TLS is the measured handshake of a TLS check, nil for plain connection checks
+	TLS *TLSResult `json:",omitempty"`
+}
+
+// ProbeAttempt : the outcome of a single prober
+type ProbeAttempt struct {
+	Prober  string
+	Command string
+	// Available is false when the binaries of the prober are missing in the container
+	Available bool
+	ExitCode  int
+	Stdout    string
+	Stderr    string
+	Duration  time.Duration
+	// Reason is the classified cause of the failure, empty when the attempt succeeded
+	Reason FailureReason `json:",omitempty"`
+	// Error is the reason the prober failed or was skipped
+	Error string `json:",omitempty"`
+}
+
+// failureMessages : substrings of the probing tools output, by failure reason
+var failureMessages = []struct {
+	reason   FailureReason
+	messages []string
+}{
+	{ReasonProtocolUnsupported, []string{"protocol not supported", "protocol not available"}},
+	{ReasonDNSFailure, []string{"bad address", "could not resolve", "couldn't resolve", "can't resolve", "name or service not known", "nxdomain", "unknown host", "temporary failure in name resolution", "no such host", "failed to resolve", "can't find"}},
+	{ReasonConnectionRefused, []string{"connection refused", "refused"}},
+	{ReasonTimeout, []string{"timed out", "timeout", "deadline exceeded"}},
+	{ReasonToolMissing, []string{"executable file not found", "command not found"}},
+}
+
+// classifyFailure : accepts the exit code, the output and the exec error of a failed probe
+//			returns the most likely cause of the failure
+func classifyFailure(exitCode int, output string, err error) FailureReason {
+	var statusErr *apierrors.StatusError
+	if err != nil && errors.As(err, &statusErr) {
+		switch {
+		case apierrors.IsForbidden(statusErr), apierrors.IsUnauthorized(statusErr):
+			return ReasonExecForbidden
+		case apierrors.IsNotFound(statusErr):
+			return ReasonPodNotFound
+		}
+	}
+	if exitCode == 126 || exitCode == 127 {
+		return ReasonToolMissing
+	}
+
+	if err != nil {
+		output += "\n" + err.Error()
+	}
+	output = strings.ToLower(output)
+	if strings.Contains(output, "forbidden") {
+		return ReasonExecForbidden
+	}
+	for _, f := range failureMessages {
+		for _, m := range f.messages {
+			if strings.Contains(output, m) {
+				return f.reason
+			}
+		}
+	}
+
+	// curl exit codes, see man curl
+	switch exitCode {
+	case 6:
+		return ReasonDNSFailure
+	case 7:
+		return ReasonConnectionRefused
+	case 28:
+		return ReasonTimeout
+	}
+	return ReasonConnectionFailed
+}
+
+// inconclusive : returns true when the reason means the connection could not be checked at all,
+//			in which case the check fails whatever the expectation
+func (r FailureReason) inconclusive() bool {
+	switch r {
+	case ReasonToolMissing, ReasonExecForbidden, ReasonPodNotFound, ReasonTargetNotFound, ReasonProtocolUnsupported:
+		return true
+	}
+	return false
+}
+
+// inconclusiveFor : returns true when the reason means the connection could not be checked against the
+//			expectation: a name that cannot be resolved does not show that a denied connection is blocked
+func (r FailureReason) inconclusiveFor(expect Expectation) bool {
+	return r.inconclusive() || (expect == ExpectDeny && r == ReasonDNSFailure)
+}
+
+// finalReason : returns the reason of a failed result, taken from the last attempt of an available prober
+func finalReason(attempts []ProbeAttempt) FailureReason {
+	reason := ReasonToolMissing
+	for _, a := range attempts {
+		if a.Reason == ReasonExecForbidden || a.Reason == ReasonPodNotFound {
+			return a.Reason
+		}
+		if a.Available && a.Reason != "" {
+			reason = a.Reason
+		}
+	}
+	return reason
+}
@@ -0,0 +1,70 @@
+package backend
+
+import (
+	"errors"
+	"testing"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+func TestClassifyFailure(t *testing.T) {
+	pods := schema.GroupResource{Resource: "pods"}
+	tests := []struct {
+		name     string
+		exitCode int
+		output   string
+		err      error
+		want     FailureReason
+	}{
+		{"exec forbidden", -1, "", apierrors.NewForbidden(pods, "web", errors.New("cannot create pods/exec")), ReasonExecForbidden},
+		{"pod deleted", -1, "", apierrors.NewNotFound(pods, "web"), ReasonPodNotFound},
+		{"missing binary", 127, "", nil, ReasonToolMissing},
+		{"missing command", 1, "sh: nmap: command not found", nil, ReasonToolMissing},
+		{"missing executable", -1, "", errors.New(`exec: "curl": executable file not found in $PATH`), ReasonToolMissing},
+		{"http not found", 8, "wget: server returned error: HTTP/1.1 404 Not Found", nil, ReasonConnectionFailed},
+		{"wget bad address", 1, "wget: bad address 'db.shop.svc'", nil, ReasonDNSFailure},
+		{"nslookup nxdomain", 1, "** server can't find db.shop.svc: NXDOMAIN", nil, ReasonDNSFailure},
+		{"nc refused", 1, "nc: connect to 10.0.0.1 port 80 (tcp) failed: Connection refused", nil, ReasonConnectionRefused},
+		{"wget timeout", 1, "wget: download timed out", nil, ReasonTimeout},
+		{"sctp module missing", 1, "ncat: Protocol not supported.", nil, ReasonProtocolUnsupported},
+		{"curl resolve exit code", 6, "", nil, ReasonDNSFailure},
+		{"curl refused exit code", 7, "", nil, ReasonConnectionRefused},
+		{"curl timeout exit code", 28, "", nil, ReasonTimeout},
+		{"unknown", 1, "something went wrong", nil, ReasonConnectionFailed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := classifyFailure(tt.exitCode, tt.output, tt.err); got != tt.want {
+				t.Errorf("classifyFailure = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEvaluateConnection(t *testing.T) {
+	tests := []struct {
+		name      string
+		connected bool
+		reason    FailureReason
+		expect    Expectation
+		want      bool
+	}{
+		{"allowed and connected", true, "", ExpectAllow, true},
+		{"allowed and blocked", false, ReasonTimeout, ExpectAllow, false},
+		{"denied and blocked", false, ReasonTimeout, ExpectDeny, true},
+		{"denied and refused", false, ReasonConnectionRefused, ExpectDeny, true},
+		{"denied and connected", true, "", ExpectDeny, false},
+		{"denied without probing tool", false, ReasonToolMissing, ExpectDeny, false},
+		{"denied with unresolved name", false, ReasonDNSFailure, ExpectDeny, false},
+		{"allowed with unresolved name", false, ReasonDNSFailure, ExpectAllow, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			check := EvaluateConnection(ConnectionResult{Connected: tt.connected, Reason: tt.reason}, tt.expect)
+			if check.Passed != tt.want {
+				t.Errorf("EvaluateConnection(%t, %s, %s).Passed = %t, want %t", tt.connected, tt.reason, tt.expect, check.Passed, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,526 @@
+package backend
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes"
+	utilexec "k8s.io/client-go/util/exec"
+)
+
+// DefaultClusterDomain : the cluster domain used when the resolv.conf of the pod does not reveal it
+const DefaultClusterDomain = "cluster.local"
+
+// DNSQuery : a name resolved from inside a pod and the answers expected from the API objects
+type DNSQuery struct {
+	// Name is the queried name, as given to the resolver so that the search list of the pod applies
+	Name string
+	// Type is the record type, A or SRV
+	Type string
+	// Object is the object the name belongs to, e.g. service shop/web, empty for external names
+	Object string `json:",omitempty"`
+	// Expected are the addresses, or the target:port of SRV records, known from the API;
+	// empty when only the resolution itself is checked
+	Expected []string `json:",omitempty"`
+}
+
+// DNSQueryResult : the outcome of a DNS query from inside a pod
+type DNSQueryResult struct {
+	DNSQuery
+	Resolver string
+	Command  string
+	Answers  []string
+	// Mismatch describes how the answers differ from the expected ones, empty when they match
+	Mismatch string `json:",omitempty"`
+	Passed   bool
+	// Reason is the classified cause of the failure, empty when the name resolved
+	Reason   FailureReason `json:",omitempty"`
+	Error    string        `json:",omitempty"`
+	Duration time.Duration
+}
+
+// ResolvConf : the resolver configuration of a pod, read from its /etc/resolv.conf
+type ResolvConf struct {
+	Nameservers []string
+	Search      []string
+	Ndots       int
+	Options     []string `json:",omitempty"`
+	// Problems are the settings preventing cluster names from resolving
+	Problems []string `json:",omitempty"`
+	Error    string   `json:",omitempty"`
+}
+
+// DNSResult : the outcome of the DNS diagnostics of a pod
+type DNSResult struct {
+	Source        string
+	ClusterDomain string
+	ResolvConf    ResolvConf
+	Queries       []DNSQueryResult
+}
+
+// DNSOptions : the names checked by CheckDNS, derived from the API objects
+type DNSOptions struct {
+	// Services are resolved by FQDN and by short svc.namespace name, headless services with their SRV records
+	Services []v1.Service
+	// Endpoints are the Endpoints of the services, the answers expected for headless services
+	Endpoints []v1.Endpoints
+	// Pods are resolved by their a-b-c-d.namespace.pod name
+	Pods []v1.Pod
+	// External are names resolved without expected answers
+	External []string
+	// ClusterDomain defaults to the domain of the search list of the pod, then to DefaultClusterDomain
+	ClusterDomain string
+	// ClusterDNS are the ClusterIPs of the cluster DNS service, the nameserver of the pod is compared against them
+	ClusterDNS []string
+}
+
+// errNoResolver : none of the resolvers is available in the container of the pod
+var errNoResolver = errors.New("none of dig, nslookup and getent is available in the container")
+
+// dnsResolver : a tool resolving names from inside a pod
+type dnsResolver struct {
+	name string
+	// types are the record types the tool can query
+	types   []string
+	command func(qtype string, name string) string
+	parse   func(qtype string, output string) []string
+}
+
+// dnsResolvers : the resolvers tried in this order, the first one available in the container is used
+var dnsResolvers = []dnsResolver{
+	{
+		name:  "dig",
+		types: []string{"A", "SRV"},
+		command: func(qtype string, name string) string {
+			return "dig +search +short +time=2 +tries=1 -t " + qtype + " " + name
+		},
+		parse: parseDigAnswers,
+	},
+	{
+		name:  "nslookup",
+		types: []string{"A", "SRV"},
+		command: func(qtype string, name string) string {
+			if qtype == "A" {
+				return "nslookup " + name
+			}
+			return "nslookup -type=" + strings.ToLower(qtype) + " " + name
+		},
+		parse: parseNslookupAnswers,
+	},
+	{
+		name:  "getent",
+		types: []string{"A"},
+		command: func(qtype string, name string) string {
+			return "getent hosts " + name
+		},
+		parse: parseGetentAnswers,
+	},
+}
+
+// DNSQueries : accepts the options and the cluster domain
+//			returns the queries checking the services, pods and external names of the options
+func DNSQueries(opts DNSOptions, domain string) []DNSQuery {
+	var queries []DNSQuery
+	for _, svc := range opts.Services {
+		object := "service " + svc.Namespace + "/" + svc.Name
+		fqdn := svc.Name + "." + svc.Namespace + ".svc." + domain
+		switch {
+		case svc.Spec.Type == v1.ServiceTypeExternalName:
+			queries = append(queries, DNSQuery{Name: fqdn, Type: "A", Object: object})
+		case svc.Spec.ClusterIP == v1.ClusterIPNone:
+			ep := findEndpoints(opts.Endpoints, svc.Namespace, svc.Name)
+			queries = append(queries, DNSQuery{Name: fqdn, Type: "A", Object: object, Expected: endpointAddresses(ep)})
+			for _, port := range svc.Spec.Ports {
+				if port.Name == "" {
+					continue
+				}
+				srv := "_" + port.Name + "._" + strings.ToLower(string(portProtocol(port.Protocol))) + "." + fqdn
+				queries = append(queries, DNSQuery{Name: srv, Type: "SRV", Object: object, Expected: endpointSRVTargets(ep, port, fqdn)})
+			}
+		default:
+			queries = append(queries,
+				DNSQuery{Name: fqdn, Type: "A", Object: object, Expected: []string{svc.Spec.ClusterIP}},
+				DNSQuery{Name: svc.Name + "." + svc.Namespace, Type: "A", Object: object, Expected: []string{svc.Spec.ClusterIP}})
+		}
+	}
+	for _, pod := range opts.Pods {
+		ip := GetPodIP(pod)
+		if ip == "" {
+			continue
+		}
+		name := strings.NewReplacer(".", "-", ":", "-").Replace(ip) + "." + pod.Namespace + ".pod." + domain
+		queries = append(queries, DNSQuery{Name: name, Type: "A", Object: "pod " + pod.Namespace + "/" + pod.Name, Expected: []string{ip}})
+	}
+	for _, name := range opts.External {
+		queries = append(queries, DNSQuery{Name: name, Type: "A"})
+	}
+	return queries
+}
+
+func findEndpoints(endpoints []v1.Endpoints, namespace string, name string) *v1.Endpoints {
+	for i := range endpoints {
+		if endpoints[i].Namespace == namespace && endpoints[i].Name == name {
+			return &endpoints[i]
+		}
+	}
+	return nil
+}
+
+// endpointAddresses : returns the sorted ready addresses of the endpoints, the A records of a headless service
+func endpointAddresses(ep *v1.Endpoints) []string {
+	var addresses []string
+	if ep == nil {
+		return addresses
+	}
+	for _, subset := range ep.Subsets {
+		for _, addr := range subset.Addresses {
+			addresses = append(addresses, addr.IP)
+		}
+	}
+	sort.Strings(addresses)
+	return addresses
+}
+
+// endpointSRVTargets : returns the sorted target:port of the SRV records of a named port of a headless service.
+//			Addresses with a hostname are published as hostname.<service FQDN>, the others under a name
+//			chosen by the DNS server, published as *.<service FQDN>.
+func endpointSRVTargets(ep *v1.Endpoints, port v1.ServicePort, fqdn string) []string {
+	var targets []string
+	if ep == nil {
+		return targets
+	}
+	for _, subset := range ep.Subsets {
+		for _, p := range subset.Ports {
+			if p.Name != port.Name || portProtocol(p.Protocol) != portProtocol(port.Protocol) {
+				continue
+			}
+			for _, addr := range subset.Addresses {
+				host := "*"
+				if addr.Hostname != "" {
+					host = addr.Hostname
+				}
+				targets = append(targets, host+"."+fqdn+":"+strconv.Itoa(int(p.Port)))
+			}
+		}
+	}
+	sort.Strings(targets)
+	return targets
+}
+
+// CheckDNS : accepts a clientset, a pod and the options
+//			reads the resolv.conf of the pod, then resolves the names of the services, pods and external names
+//			of the options from inside the pod and compares the answers against the API objects
+func CheckDNS(clientset kubernetes.Interface, pod v1.Pod, opts DNSOptions) DNSResult {
+	result := DNSResult{Source: pod.Namespace + "/" + pod.Name}
+
+	stdout, stderr, err := execInPod(clientset, &pod, []string{"cat", "/etc/resolv.conf"}, nil)
+	if err != nil {
+		result.ResolvConf.Error = strings.TrimSpace(err.Error() + firstLine(stderr))
+	} else {
+		result.ResolvConf = ParseResolvConf(stdout)
+	}
+
+	result.ClusterDomain = opts.ClusterDomain
+	if result.ClusterDomain == "" {
+		result.ClusterDomain = result.ResolvConf.clusterDomain()
+	}
+	if err == nil {
+		result.ResolvConf.Problems = result.ResolvConf.problems(pod.Namespace, result.ClusterDomain, opts.ClusterDNS)
+	}
+
+	resolver, err := selectResolver(clientset, pod)
+	reason := ReasonToolMissing
+	if err != nil && !errors.Is(err, errNoResolver) {
+		reason = classifyFailure(-1, "", err)
+	}
+	for _, q := range DNSQueries(opts, result.ClusterDomain) {
+		if err != nil {
+			result.Queries = append(result.Queries, DNSQueryResult{DNSQuery: q, Error: err.Error(), Reason: reason})
+			continue
+		}
+		result.Queries = append(result.Queries, resolve(clientset, pod, resolver, q))
+	}
+	return result
+}
+
+// selectResolver : returns the first resolver available in the container of the pod
+func selectResolver(clientset kubernetes.Interface, pod v1.Pod) (dnsResolver, error) {
+	script := ""
+	for _, r := range dnsResolvers {
+		script += "command -v " + r.name + " > /dev/null 2>&1 && echo " + r.name + " && exit 0; "
+	}
+	stdout, stderr, err := execInPod(clientset, &pod, []string{"sh", "-c", script + "exit 127"}, nil)
+	name := strings.TrimSpace(stdout)
+	for _, r := range dnsResolvers {
+		if r.name == name {
+			return r, nil
+		}
+	}
+	if err != nil && !isExitError(err) {
+		return dnsResolver{}, err
+	}
+	return dnsResolver{}, fmt.Errorf("%w%s", errNoResolver, firstLine(stderr))
+}
+
+func isExitError(err error) bool {
+	var exitErr utilexec.ExitError
+	return errors.As(err, &exitErr)
+}
+
+// resolve : runs the query with the resolver in the pod and compares the answers against the expected ones
+func resolve(clientset kubernetes.Interface, pod v1.Pod, resolver dnsResolver, q DNSQuery) DNSQueryResult {
+	r := DNSQueryResult{DNSQuery: q, Resolver: resolver.name}
+	if !containsString(resolver.types, q.Type) {
+		r.Error = resolver.name + " cannot query " + q.Type + " records"
+		r.Reason = ReasonToolMissing
+		return r
+	}
+	r.Command = resolver.command(q.Type, q.Name)
+
+	start := time.Now()
+	stdout, stderr, err := execInPod(clientset, &pod, []string{"sh", "-c", r.Command}, nil)
+	r.Duration = time.Since(start)
+	r.Answers = resolver.parse(q.Type, stdout)
+
+	if len(r.Answers) == 0 {
+		exitCode := 0
+		var exitErr utilexec.ExitError
+		if errors.As(err, &exitErr) {
+			exitCode = exitErr.ExitStatus()
+		} else if err != nil {
+			exitCode = -1
+		}
+		r.Reason = ReasonDNSFailure
+		r.Error = "no answer" + firstLine(stdout+"\n"+stderr)
+		if reason := classifyFailure(exitCode, stdout+"\n"+stderr, err); reason == ReasonTimeout || reason == ReasonExecForbidden || reason == ReasonPodNotFound {
+			r.Reason = reason
+		} else if resolver.name == "dig" && exitCode == 9 {
+			r.Reason = ReasonTimeout
+		}
+		return r
+	}
+
+	r.Mismatch = compareAnswers(q, r.Answers)
+	r.Passed = r.Mismatch == ""
+	return r
+}
+
+// compareAnswers : returns how the answers differ from the expected ones, empty when they match.
+//			A * host in an expected SRV target matches any host.
+func compareAnswers(q DNSQuery, answers []string) string {
+	if len(q.Expected) == 0 {
+		return ""
+	}
+	matches := func(expected string, answer string) bool {
+		if strings.HasPrefix(expected, "*.") {
+			return strings.HasSuffix(answer, expected[1:])
+		}
+		return expected == answer
+	}
+
+	// the expected targets with a * host are matched last, so that they do not consume a named answer
+	var expected, wildcards []string
+	for _, e := range q.Expected {
+		if strings.HasPrefix(e, "*.") {
+			wildcards = append(wildcards, e)
+		} else {
+			expected = append(expected, e)
+		}
+	}
+
+	var missing, unexpected []string
+	used := make([]bool, len(answers))
+	for _, e := range append(expected, wildcards...) {
+		found := false
+		for i, a := range answers {
+			if !used[i] && matches(e, a) {
+				used[i] = true
+				found = true
+				break
+			}
+		}
+		if !found {
+			missing = append(missing, e)
+		}
+	}
+	for i, a := range answers {
+		if !used[i] {
+			unexpected = append(unexpected, a)
+		}
+	}
+
+	var problems []string
+	if len(missing) > 0 {
+		problems = append(problems, "missing "+strings.Join(missing, ", "))
+	}
+	if len(unexpected) > 0 {
+		problems = append(problems, "unexpected "+strings.Join(unexpected, ", "))
+	}
+	return strings.Join(problems, "; ")
+}
+
+// parseDigAnswers : returns the addresses, or the target:port of the SRV records, of the output of dig +short
+func parseDigAnswers(qtype string, output string) []string {
+	var answers []string
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.Fields(line)
+		switch {
+		case qtype == "SRV" && len(fields) == 4:
+			answers = append(answers, strings.TrimSuffix(fields[3], ".")+":"+fields[2])
+		case qtype == "A" && len(fields) == 1 && net.ParseIP(fields[0]) != nil:
+			answers = append(answers, fields[0])
+		}
+	}
+	sort.Strings(answers)
+	return answers
+}
+
+// parseNslookupAnswers : returns the addresses, or the target:port of the SRV records, of the output of nslookup,
+//			the addresses listed before the first Name line are the ones of the server
+func parseNslookupAnswers(qtype string, output string) []string {
+	var answers []string
+	named := false
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimSpace(line)
+		switch {
+		case qtype == "SRV" && strings.Contains(line, "service = "):
+			fields := strings.Fields(line[strings.Index(line, "service = ")+len("service = "):])
+			if len(fields) == 4 {
+				answers = append(answers, strings.TrimSuffix(fields[3], ".")+":"+fields[2])
+			}
+		case strings.HasPrefix(line, "Name:"):
+			named = true
+		case qtype == "A" && named && strings.HasPrefix(line, "Address"):
+			// "Address: 10.0.0.1" or "Address 1: 10.0.0.1 web.shop.svc.cluster.local"
+			if i := strings.Index(line, ":"); i >= 0 {
+				if fields := strings.Fields(line[i+1:]); len(fields) > 0 && net.ParseIP(fields[0]) != nil && net.ParseIP(fields[0]).To4() != nil {
+					answers = append(answers, fields[0])
+				}
+			}
+		}
+	}
+	sort.Strings(answers)
+	return answers
+}
+
+// parseGetentAnswers : returns the IPv4 addresses of the output of getent hosts
+func parseGetentAnswers(qtype string, output string) []string {
+	var answers []string
+	for _, line := range strings.Split(output, "\n") {
+		if fields := strings.Fields(line); len(fields) > 0 && net.ParseIP(fields[0]) != nil && net.ParseIP(fields[0]).To4() != nil {
+			answers = append(answers, fields[0])
+		}
+	}
+	sort.Strings(answers)
+	return answers
+}
+
+// ParseResolvConf : accepts the content of a resolv.conf file
+//			returns its nameservers, search list and options, ndots defaults to 1 as in the resolver
+func ParseResolvConf(content string) ResolvConf {
+	conf := ResolvConf{Ndots: 1}
+	for _, line := range strings.Split(content, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 || strings.HasPrefix(fields[0], "#") || strings.HasPrefix(fields[0], ";") {
+			continue
+		}
+		switch fields[0] {
+		case "nameserver":
+			conf.Nameservers = append(conf.Nameservers, fields[1])
+		case "search", "domain":
+			conf.Search = fields[1:]
+		case "options":
+			for _, o := range fields[1:] {
+				if strings.HasPrefix(o, "ndots:") {
+					if n, err := strconv.Atoi(strings.TrimPrefix(o, "ndots:")); err == nil {
+						conf.Ndots = n
+					}
+					continue
+				}
+				conf.Options = append(conf.Options, o)
+			}
+		}
+	}
+	return conf
+}
+
+// clusterDomain : returns the cluster domain of the svc.<domain> entry of the search list, DefaultClusterDomain when there is none
+func (c ResolvConf) clusterDomain() string {
+	for _, s := range c.Search {
+		if strings.HasPrefix(s, "svc.") {
+			return strings.TrimPrefix(s, "svc.")
+		}
+	}
+	return DefaultClusterDomain
+}
+
+// problems : returns the settings of the resolv.conf of a pod of the namespace preventing cluster names from resolving
+func (c ResolvConf) problems(namespace string, domain string, clusterDNS []string) []string {
+	var problems []string
+	if len(c.Nameservers) == 0 {
+		problems = append(problems, "no nameserver")
+	} else if len(clusterDNS) > 0 && !containsString(clusterDNS, c.Nameservers[0]) {
+		problems = append(problems, "the first nameserver "+c.Nameservers[0]+" is not the cluster DNS service "+strings.Join(clusterDNS, ", ")+", check the dnsPolicy of the pod")
+	}
+	if !containsString(c.Search, namespace+".svc."+domain) || !containsString(c.Search, "svc."+domain) {
+		problems = append(problems, "the search list lacks "+namespace+".svc."+domain+" or svc."+domain+", short service names do not resolve")
+	}
+	return problems
+}
+
+// Passed : returns true if the resolv.conf could be read and has no problem, and every query passed
+func (r DNSResult) Passed() bool {
+	if r.ResolvConf.Error != "" || len(r.ResolvConf.Problems) > 0 {
+		return false
+	}
+	for _, q := range r.Queries {
+		if !q.Passed {
+			return false
+		}
+	}
+	return true
+}
+
+// Report : returns the resolv.conf and every query as a case
+func (r DNSResult) Report() Report {
+	report := Report{Name: "dns"}
+	conf := ReportCase{
+		Name:    r.Source + " resolv.conf",
+		Passed:  r.ResolvConf.Error == "" && len(r.ResolvConf.Problems) == 0,
+		Message: fmt.Sprintf("nameservers %s, search %s, ndots %d", strings.Join(r.ResolvConf.Nameservers, " "), strings.Join(r.ResolvConf.Search, " "), r.ResolvConf.Ndots),
+	}
+	switch {
+	case r.ResolvConf.Error != "":
+		conf.Message = r.ResolvConf.Error
+		conf.ExitCode = caseExitCode(false, classifyFailure(-1, r.ResolvConf.Error, nil))
+	case len(r.ResolvConf.Problems) > 0:
+		conf.Details = strings.Join(r.ResolvConf.Problems, "\n")
+		conf.ExitCode = ExitFailed
+	}
+	report.Cases = append(report.Cases, conf)
+
+	for _, q := range r.Queries {
+		c := ReportCase{
+			Name:     r.Source + " -> " + q.Type + " " + q.Name,
+			Passed:   q.Passed,
+			Message:  strings.Join(q.Answers, ", "),
+			Duration: q.Duration,
+			ExitCode: caseExitCode(q.Passed, q.Reason),
+		}
+		switch {
+		case q.Error != "":
+			c.Message = q.Error
+		case q.Mismatch != "":
+			c.Message = q.Mismatch
+			c.Details = "answers: " + strings.Join(q.Answers, ", ") + "\nexpected: " + strings.Join(q.Expected, ", ")
+		}
+		report.Cases = append(report.Cases, c)
+	}
+	return report
+}
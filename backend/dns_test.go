@@ -0,0 +1,249 @@
+package backend
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const clusterResolvConf = `nameserver 10.96.0.53
+search shop.svc.cluster.local svc.cluster.local cluster.local
+options ndots:5 edns0
+`
+
+// dnsAnswer : the output of a resolver for a name
+type dnsAnswer struct {
+	stdout string
+	err    error
+}
+
+// fakeDNS : fakes a pod with the resolv.conf, unreadable when empty, and the resolver, none when empty.
+// The resolver answers the names with the answers, the other names resolve to nothing.
+func fakeDNS(t *testing.T, resolvConf string, resolver string, answers map[string]dnsAnswer) {
+	fakeExec(t, func(pod *v1.Pod, command string) (string, string, error) {
+		switch {
+		case command == "cat /etc/resolv.conf":
+			if resolvConf == "" {
+				return "", "cat: can't open '/etc/resolv.conf': No such file or directory", exitError(1)
+			}
+			return resolvConf, "", nil
+		case strings.Contains(command, "command -v"):
+			if resolver == "" {
+				return "", "", exitError(127)
+			}
+			return resolver + "\n", "", nil
+		}
+		fields := strings.Fields(command)
+		answer := answers[fields[len(fields)-1]]
+		return answer.stdout, "", answer.err
+	})
+}
+
+func dnsOptions() DNSOptions {
+	return DNSOptions{
+		Services: []v1.Service{
+			{ObjectMeta: shopMeta("web"), Spec: v1.ServiceSpec{ClusterIP: "10.96.0.10", Ports: []v1.ServicePort{{Name: "http", Port: 80}}}},
+			{ObjectMeta: shopMeta("db"), Spec: v1.ServiceSpec{ClusterIP: v1.ClusterIPNone, Ports: []v1.ServicePort{{Name: "postgres", Port: 5432}}}},
+		},
+		Endpoints: []v1.Endpoints{{ObjectMeta: shopMeta("db"), Subsets: []v1.EndpointSubset{{
+			Addresses: []v1.EndpointAddress{{IP: "10.0.0.5", Hostname: "db-0"}, {IP: "10.0.0.6"}},
+			Ports:     []v1.EndpointPort{{Name: "postgres", Port: 5432}},
+		}}}},
+		Pods:       []v1.Pod{{ObjectMeta: metav1.ObjectMeta{Name: "web-0", Namespace: "shop"}, Status: v1.PodStatus{PodIP: "10.0.0.1"}}},
+		External:   []string{"example.com"},
+		ClusterDNS: []string{"10.96.0.53"},
+	}
+}
+
+// digAnswers : the answers of dig +short to the queries of dnsOptions
+func digAnswers() map[string]dnsAnswer {
+	return map[string]dnsAnswer{
+		"web.shop.svc.cluster.local":               {stdout: "10.96.0.10\n"},
+		"web.shop":                                 {stdout: "10.96.0.10\n"},
+		"db.shop.svc.cluster.local":                {stdout: "10.0.0.6\n10.0.0.5\n"},
+		"_postgres._tcp.db.shop.svc.cluster.local": {stdout: "0 50 5432 db-0.db.shop.svc.cluster.local.\n0 50 5432 3561643563.db.shop.svc.cluster.local.\n"},
+		"10-0-0-1.shop.pod.cluster.local":          {stdout: "10.0.0.1\n"},
+		"example.com":                              {stdout: "93.184.216.34\n"},
+	}
+}
+
+func TestCheckDNS(t *testing.T) {
+	queries := []string{
+		"A web.shop.svc.cluster.local",
+		"A web.shop",
+		"A db.shop.svc.cluster.local",
+		"SRV _postgres._tcp.db.shop.svc.cluster.local",
+		"A 10-0-0-1.shop.pod.cluster.local",
+		"A example.com",
+	}
+	// verdicts : the verdicts of the queries, the ones not listed pass
+	tests := []struct {
+		name       string
+		resolvConf string
+		resolver   string
+		answers    func(map[string]dnsAnswer)
+		domain     string
+		verdicts   map[string]string
+		problems   []string
+	}{
+		{
+			name:     "every name resolves",
+			resolver: "dig",
+		},
+		{
+			name:     "stale answers",
+			resolver: "dig",
+			answers: func(a map[string]dnsAnswer) {
+				a["web.shop.svc.cluster.local"] = dnsAnswer{stdout: "10.96.0.11\n"}
+				a["_postgres._tcp.db.shop.svc.cluster.local"] = dnsAnswer{stdout: "0 50 5432 db-0.db.shop.svc.cluster.local.\n0 50 5432 db-9.db.other.svc.cluster.local.\n"}
+				a["db.shop.svc.cluster.local"] = dnsAnswer{stdout: "10.0.0.5\n10.0.0.7\n"}
+			},
+			verdicts: map[string]string{
+				"A web.shop.svc.cluster.local":                 "mismatch missing 10.96.0.10; unexpected 10.96.0.11",
+				"SRV _postgres._tcp.db.shop.svc.cluster.local": "mismatch missing *.db.shop.svc.cluster.local:5432; unexpected db-9.db.other.svc.cluster.local:5432",
+				"A db.shop.svc.cluster.local":                  "mismatch missing 10.0.0.6; unexpected 10.0.0.7",
+			},
+		},
+		{
+			name:     "unresolved names",
+			resolver: "dig",
+			answers: func(a map[string]dnsAnswer) {
+				a["example.com"] = dnsAnswer{}
+				a["web.shop"] = dnsAnswer{stdout: ";; connection timed out; no servers could be reached\n", err: exitError(9)}
+				a["10-0-0-1.shop.pod.cluster.local"] = dnsAnswer{err: exitError(9)}
+			},
+			verdicts: map[string]string{
+				"A example.com":                     "DNSFailure no answer",
+				"A web.shop":                        "Timeout no answer: ;; connection timed out; no servers could be reached",
+				"A 10-0-0-1.shop.pod.cluster.local": "Timeout no answer",
+			},
+		},
+		{
+			name:     "nslookup",
+			resolver: "nslookup",
+			answers: func(a map[string]dnsAnswer) {
+				server := "Server:\t\t10.96.0.53\nAddress:\t10.96.0.53#53\n\n"
+				a["web.shop.svc.cluster.local"] = dnsAnswer{stdout: server + "Name:\tweb.shop.svc.cluster.local\nAddress: 10.96.0.10\n"}
+				a["web.shop"] = dnsAnswer{stdout: server + "Name:\tweb.shop.svc.cluster.local\nAddress: 10.96.0.10\n"}
+				a["db.shop.svc.cluster.local"] = dnsAnswer{stdout: server + "Name:\tdb.shop.svc.cluster.local\nAddress 1: 10.0.0.5 db-0.db.shop.svc.cluster.local\nAddress 2: 10.0.0.6\nAddress 3: fd00::6\n"}
+				a["_postgres._tcp.db.shop.svc.cluster.local"] = dnsAnswer{stdout: server + "_postgres._tcp.db.shop.svc.cluster.local\tservice = 0 50 5432 db-0.db.shop.svc.cluster.local.\n_postgres._tcp.db.shop.svc.cluster.local\tservice = 0 50 5432 3561643563.db.shop.svc.cluster.local.\n"}
+				a["10-0-0-1.shop.pod.cluster.local"] = dnsAnswer{stdout: server + "Name:\t10-0-0-1.shop.pod.cluster.local\nAddress: 10.0.0.1\n"}
+				a["example.com"] = dnsAnswer{stdout: server + "** server can't find example.com: NXDOMAIN\n", err: exitError(1)}
+			},
+			verdicts: map[string]string{
+				"A example.com": "DNSFailure no answer: Server:\t\t10.96.0.53",
+			},
+		},
+		{
+			name:     "getent cannot query SRV records",
+			resolver: "getent",
+			answers: func(a map[string]dnsAnswer) {
+				for name, answer := range a {
+					if strings.HasPrefix(answer.stdout, "10.") || strings.HasPrefix(answer.stdout, "93.") {
+						a[name] = dnsAnswer{stdout: strings.Fields(answer.stdout)[0] + "  " + name + "\n"}
+					}
+				}
+				a["db.shop.svc.cluster.local"] = dnsAnswer{stdout: "10.0.0.5  db.shop.svc.cluster.local\n10.0.0.6  db.shop.svc.cluster.local\n"}
+			},
+			verdicts: map[string]string{
+				"SRV _postgres._tcp.db.shop.svc.cluster.local": "ToolMissing getent cannot query SRV records",
+			},
+		},
+		{
+			name: "no resolver",
+			verdicts: map[string]string{
+				"A web.shop.svc.cluster.local":                 "ToolMissing none of dig, nslookup and getent is available in the container",
+				"A web.shop":                                   "ToolMissing none of dig, nslookup and getent is available in the container",
+				"A db.shop.svc.cluster.local":                  "ToolMissing none of dig, nslookup and getent is available in the container",
+				"SRV _postgres._tcp.db.shop.svc.cluster.local": "ToolMissing none of dig, nslookup and getent is available in the container",
+				"A 10-0-0-1.shop.pod.cluster.local":            "ToolMissing none of dig, nslookup and getent is available in the container",
+				"A example.com":                                "ToolMissing none of dig, nslookup and getent is available in the container",
+			},
+		},
+		{
+			name:       "resolv.conf without the cluster DNS",
+			resolvConf: "nameserver 8.8.8.8\nsearch example.com\n",
+			resolver:   "dig",
+			problems: []string{
+				"the first nameserver 8.8.8.8 is not the cluster DNS service 10.96.0.53, check the dnsPolicy of the pod",
+				"the search list lacks shop.svc.cluster.local or svc.cluster.local, short service names do not resolve",
+			},
+		},
+		{
+			name:       "custom cluster domain",
+			resolvConf: strings.Replace(clusterResolvConf, "cluster.local", "k8s.example.com", -1),
+			resolver:   "dig",
+			answers: func(a map[string]dnsAnswer) {
+				for name, answer := range digAnswers() {
+					a[strings.Replace(name, "cluster.local", "k8s.example.com", 1)] = dnsAnswer{stdout: strings.Replace(answer.stdout, "cluster.local", "k8s.example.com", -1)}
+				}
+			},
+			domain: "k8s.example.com",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			answers := digAnswers()
+			if tt.answers != nil {
+				tt.answers(answers)
+			}
+			if tt.resolvConf == "" {
+				tt.resolvConf = clusterResolvConf
+			}
+			if tt.domain == "" {
+				tt.domain = DefaultClusterDomain
+			}
+			fakeDNS(t, tt.resolvConf, tt.resolver, answers)
+
+			pod := v1.Pod{ObjectMeta: shopMeta("web-0")}
+			result := CheckDNS(nil, pod, dnsOptions())
+
+			if result.ClusterDomain != tt.domain {
+				t.Errorf("CheckDNS cluster domain = %s, want %s", result.ClusterDomain, tt.domain)
+			}
+			if !reflect.DeepEqual(result.ResolvConf.Problems, tt.problems) {
+				t.Errorf("CheckDNS resolv.conf problems = %q, want %q", result.ResolvConf.Problems, tt.problems)
+			}
+			var got, want []string
+			for i, q := range result.Queries {
+				verdict := "passed"
+				switch {
+				case q.Error != "":
+					verdict = string(q.Reason) + " " + q.Error
+				case !q.Passed:
+					verdict = "mismatch " + q.Mismatch
+				}
+				query := q.Type + " " + strings.Replace(q.Name, tt.domain, "cluster.local", 1)
+				got = append(got, query+": "+verdict)
+				if i < len(queries) {
+					v, ok := tt.verdicts[queries[i]]
+					if !ok {
+						v = "passed"
+					}
+					want = append(want, queries[i]+": "+v)
+				}
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("CheckDNS queries =\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+			}
+			if passed := len(tt.verdicts) == 0 && len(tt.problems) == 0; result.Passed() != passed {
+				t.Errorf("CheckDNS passed = %t, want %t", result.Passed(), passed)
+			}
+		})
+	}
+}
+
+func TestCheckDNSUnreadableResolvConf(t *testing.T) {
+	fakeDNS(t, "", "", nil)
+
+	result := CheckDNS(nil, v1.Pod{ObjectMeta: shopMeta("web-0")}, DNSOptions{External: []string{"example.com"}})
+	want := fmt.Sprintf("%v: cat: can't open '/etc/resolv.conf': No such file or directory", exitError(1))
+	if result.ResolvConf.Error != want || result.ClusterDomain != DefaultClusterDomain || result.Passed() {
+		t.Errorf("CheckDNS resolv.conf error %q, domain %s, passed %t, want %q, %s, false", result.ResolvConf.Error, result.ClusterDomain, result.Passed(), want, DefaultClusterDomain)
+	}
+}
@@ -0,0 +1,69 @@
+package backend
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+)
+
+// Typed errors of the backend, matched with errors.Is
+var (
+	// ErrForbidden : the request was denied by RBAC or the credentials were rejected
+	ErrForbidden = errors.New("forbidden")
+	// ErrNotFound : the requested object does not exist
+	ErrNotFound = errors.New("not found")
+	// ErrTimeout : the request timed out or its context deadline was exceeded
+	ErrTimeout = errors.New("timeout")
+	// ErrNotSynced : the resource cache has not listed the resource yet
+	ErrNotSynced = errors.New("cache not synced")
+	// ErrUnsupportedFieldSelector : the resource cache does not index a field of the field selector
+	ErrUnsupportedFieldSelector = errors.New("field selector not supported by the cache")
+	// ErrInvalidContinue : the continue token of a paginated list is malformed or belongs to another query
+	ErrInvalidContinue = errors.New("invalid continue token")
+)
+
+// APIError : a failed request to the Kubernetes API
+type APIError struct {
+	// Op is the failed operation, e.g. "list pods"
+	Op  string
+	Err error
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("failed to %s: %v", e.Op, e.Err)
+}
+
+func (e *APIError) Unwrap() error {
+	return e.Err
+}
+
+// Is : matches the cause of the error against ErrForbidden, ErrNotFound and ErrTimeout
+func (e *APIError) Is(target error) bool {
+	switch target {
+	case ErrForbidden:
+		return apierrors.IsForbidden(e.Err) || apierrors.IsUnauthorized(e.Err)
+	case ErrNotFound:
+		return apierrors.IsNotFound(e.Err)
+	case ErrTimeout:
+		return apierrors.IsTimeout(e.Err) || apierrors.IsServerTimeout(e.Err) || errors.Is(e.Err, context.DeadlineExceeded)
+	}
+	return false
+}
+
+// NotFoundError : a pod or service referenced by a check does not exist
+type NotFoundError struct {
+	Kind      string
+	Namespace string
+	Name      string
+}
+
+func (e *NotFoundError) Error() string {
+	return fmt.Sprintf("%s %s not found in namespace %s", e.Kind, e.Name, e.Namespace)
+}
+
+// Is : matches ErrNotFound
+func (e *NotFoundError) Is(target error) bool {
+	return target == ErrNotFound
+}
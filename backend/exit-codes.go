@@ -0,0 +1,66 @@
+package backend
+
+import "errors"
+
+// Exit codes of the kubensure commands
+const (
+	// ExitOK : every expectation is met
+	ExitOK = 0
+	// ExitFailed : at least one expectation is not met
+	ExitFailed = 1
+	// ExitUsage : invalid arguments, flags, configuration or input files
+	ExitUsage = 2
+	// ExitAPIError : the cluster could not be reached or denied a request
+	ExitAPIError = 3
+	// ExitNotFound : a pod or service referenced by a check does not exist
+	ExitNotFound = 4
+)
+
+// ExitCodeForError : returns the exit code matching the cause of the error
+func ExitCodeForError(err error) int {
+	if err == nil {
+		return ExitOK
+	}
+	if errors.Is(err, ErrNotFound) {
+		return ExitNotFound
+	}
+	return ExitAPIError
+}
+
+// ExitCodeForReason : returns the exit code of a check failed for the given reason
+func ExitCodeForReason(reason FailureReason) int {
+	switch reason {
+	case ReasonPodNotFound, ReasonTargetNotFound:
+		return ExitNotFound
+	case ReasonExecForbidden:
+		return ExitAPIError
+	}
+	return ExitFailed
+}
+
+// AggregateExitCode : accepts the exit codes of several checks
+//			returns the exit code of the whole run: API errors take precedence over missing pods or services,
+//			which take precedence over unmet expectations
+func AggregateExitCode(codes ...int) int {
+	code := ExitOK
+	for _, c := range codes {
+		if exitCodeSeverity(c) > exitCodeSeverity(code) {
+			code = c
+		}
+	}
+	return code
+}
+
+func exitCodeSeverity(code int) int {
+	switch code {
+	case ExitOK:
+		return 0
+	case ExitFailed:
+		return 1
+	case ExitNotFound:
+		return 2
+	case ExitAPIError:
+		return 3
+	}
+	return 4
+}
@@ -0,0 +1,96 @@
+package backend
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+func TestAggregateExitCode(t *testing.T) {
+	tests := []struct {
+		name  string
+		codes []int
+		want  int
+	}{
+		{"no check", nil, ExitOK},
+		{"every check passed", []int{ExitOK, ExitOK}, ExitOK},
+		{"unmet expectation", []int{ExitOK, ExitFailed, ExitOK}, ExitFailed},
+		{"missing pod over unmet expectation", []int{ExitFailed, ExitNotFound, ExitFailed}, ExitNotFound},
+		{"API error over missing pod", []int{ExitNotFound, ExitAPIError, ExitFailed}, ExitAPIError},
+		{"API error first", []int{ExitAPIError, ExitNotFound}, ExitAPIError},
+		{"usage error over everything", []int{ExitAPIError, ExitUsage, ExitFailed}, ExitUsage},
+	}
+	for _, tt := range tests {
+		if got := AggregateExitCode(tt.codes...); got != tt.want {
+			t.Errorf("%s: AggregateExitCode(%v) = %d, want %d", tt.name, tt.codes, got, tt.want)
+		}
+	}
+}
+
+func TestExitCodeForError(t *testing.T) {
+	notFound := &NotFoundError{Kind: "pod", Namespace: "shop", Name: "web-0"}
+	tests := []struct {
+		name string
+		err  error
+		want int
+	}{
+		{"no error", nil, ExitOK},
+		{"missing pod", notFound, ExitNotFound},
+		{"wrapped missing pod", fmt.Errorf("check web: %w", notFound), ExitNotFound},
+		{"object not found by the API", &APIError{Op: "get pod", Err: apierrors.NewNotFound(schema.GroupResource{Resource: "pods"}, "web-0")}, ExitNotFound},
+		{"forbidden", &APIError{Op: "list pods", Err: apierrors.NewForbidden(schema.GroupResource{Resource: "pods"}, "", errors.New("denied"))}, ExitAPIError},
+		{"unreachable cluster", &APIError{Op: "list pods", Err: errors.New("connection refused")}, ExitAPIError},
+		{"untyped error", errors.New("boom"), ExitAPIError},
+	}
+	for _, tt := range tests {
+		if got := ExitCodeForError(tt.err); got != tt.want {
+			t.Errorf("%s: ExitCodeForError(%v) = %d, want %d", tt.name, tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestExitCodeForReason(t *testing.T) {
+	tests := []struct {
+		reason FailureReason
+		want   int
+	}{
+		{"", ExitFailed},
+		{ReasonTimeout, ExitFailed},
+		{ReasonConnectionRefused, ExitFailed},
+		{ReasonToolMissing, ExitFailed},
+		{ReasonDNSFailure, ExitFailed},
+		{ReasonPodNotFound, ExitNotFound},
+		{ReasonTargetNotFound, ExitNotFound},
+		{ReasonExecForbidden, ExitAPIError},
+	}
+	for _, tt := range tests {
+		if got := ExitCodeForReason(tt.reason); got != tt.want {
+			t.Errorf("ExitCodeForReason(%q) = %d, want %d", tt.reason, got, tt.want)
+		}
+	}
+}
+
+func TestReportExitCode(t *testing.T) {
+	passed := ReportCase{Passed: true}
+	failed := ReportCase{ExitCode: ExitFailed}
+	tests := []struct {
+		name  string
+		cases []ReportCase
+		want  int
+	}{
+		{"empty report", nil, ExitOK},
+		{"every case passed", []ReportCase{passed, passed}, ExitOK},
+		{"passed case with an exit code", []ReportCase{{Passed: true, ExitCode: ExitAPIError}}, ExitOK},
+		{"failed case without exit code", []ReportCase{passed, {}}, ExitFailed},
+		{"missing target", []ReportCase{failed, {ExitCode: caseExitCode(false, ReasonTargetNotFound)}, failed}, ExitNotFound},
+		{"forbidden exec", []ReportCase{{ExitCode: caseExitCode(false, ReasonPodNotFound)}, {ExitCode: caseExitCode(false, ReasonExecForbidden)}}, ExitAPIError},
+	}
+	for _, tt := range tests {
+		if got := (Report{Cases: tt.cases}).ExitCode(); got != tt.want {
+			t.Errorf("%s: ExitCode() = %d, want %d", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,59 @@
+package backend
+
+import "fmt"
+
+// Expectation : the expected outcome of a connection check
+type Expectation string
+
+const (
+	// ExpectAllow : the connection is expected to succeed
+	ExpectAllow Expectation = "allow"
+	// ExpectDeny : the connection is expected to be blocked
+	ExpectDeny Expectation = "deny"
+)
+
+// Verdict : the outcome of a connection check evaluated against its expectation
+type Verdict string
+
+const (
+	// VerdictOpenAsExpected : the connection succeeded and was expected to
+	VerdictOpenAsExpected Verdict = "open as expected"
+	// VerdictBlockedAsExpected : the connection was blocked and was expected to
+	VerdictBlockedAsExpected Verdict = "blocked as expected"
+	// VerdictUnexpectedlyOpen : the connection succeeded but was expected to be blocked
+	VerdictUnexpectedlyOpen Verdict = "unexpectedly open"
+	// VerdictUnexpectedlyBlocked : the connection was blocked but was expected to succeed
+	VerdictUnexpectedlyBlocked Verdict = "unexpectedly blocked"
+)
+
+// ParseExpectation : accepts an expectation string, an empty string defaults to allow
+//			returns the corresponding Expectation
+func ParseExpectation(s string) (Expectation, error) {
+	switch Expectation(s) {
+	case "", ExpectAllow:
+		return ExpectAllow, nil
+	case ExpectDeny:
+		return ExpectDeny, nil
+	}
+	return "", fmt.Errorf("invalid expectation '%s': must be '%s' or '%s'", s, ExpectAllow, ExpectDeny)
+}
+
+// EvaluateExpectation : accepts the result of a connection check and its expectation
+//			returns the resulting Verdict
+func EvaluateExpectation(connected bool, expect Expectation) Verdict {
+	switch {
+	case connected && expect == ExpectDeny:
+		return VerdictUnexpectedlyOpen
+	case connected:
+		return VerdictOpenAsExpected
+	case expect == ExpectDeny:
+		return VerdictBlockedAsExpected
+	default:
+		return VerdictUnexpectedlyBlocked
+	}
+}
+
+// Met : returns true if the verdict satisfies the expectation
+func (v Verdict) Met() bool {
+	return v == VerdictOpenAsExpected || v == VerdictBlockedAsExpected
+}
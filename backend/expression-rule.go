@@ -0,0 +1,175 @@
+package backend
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"text/template"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/yaml"
+)
+
+// RuleSpec : describes a rule evaluating an expression, as declared in the rule files
+type RuleSpec struct {
+	ID          string   `json:"id"`
+	Description string   `json:"description,omitempty"`
+	Severity    Severity `json:"severity,omitempty"`
+	// Kinds are the kinds of the objects the rule is evaluated on, e.g. Deployment
+	Kinds []string  `json:"kinds"`
+	Match RuleMatch `json:"match,omitempty"`
+	// Expression must hold for the object to comply with the rule, see Expression
+	Expression string `json:"expression"`
+	// Message is a text/template rendering the finding with the fields of RuleMessageData,
+	// default is the expression that does not hold
+	Message string `json:"message,omitempty"`
+}
+
+// RuleMatch : restricts a rule to the objects of some namespaces and labels
+type RuleMatch struct {
+	Namespaces []string `json:"namespaces,omitempty"`
+	// Selector is a label selector of the objects, e.g. 'tier=frontend'
+	Selector string `json:"selector,omitempty"`
+}
+
+// RuleFile : the content of a rule file
+type RuleFile struct {
+	Rules []RuleSpec `json:"rules"`
+}
+
+// RuleMessageData : the fields available to the message template of a rule
+type RuleMessageData struct {
+	Kind        string
+	Namespace   string
+	Name        string
+	Labels      map[string]string
+	Annotations map[string]string
+	// Object is the whole object as nested maps, e.g. {{.Object.spec.replicas}}
+	Object map[string]interface{}
+}
+
+type expressionRule struct {
+	spec     RuleSpec
+	selector labels.Selector
+	expr     *Expression
+	message  *template.Template
+}
+
+// NewExpressionRule : accepts a rule spec
+//			returns a Rule flagging the objects of its kinds for which the expression does not hold
+func NewExpressionRule(spec RuleSpec) (Rule, error) {
+	if spec.ID == "" {
+		return nil, fmt.Errorf("rule without id")
+	}
+	if len(spec.Kinds) == 0 {
+		return nil, fmt.Errorf("rule %s: no kinds", spec.ID)
+	}
+	for _, kind := range spec.Kinds {
+		if !containsString(snapshotKinds, kind) {
+			return nil, fmt.Errorf("rule %s: unsupported kind '%s', must be one of %v", spec.ID, kind, snapshotKinds)
+		}
+	}
+	severity, err := ParseSeverity(string(spec.Severity))
+	if err != nil {
+		return nil, fmt.Errorf("rule %s: %v", spec.ID, err)
+	}
+	spec.Severity = severity
+
+	r := &expressionRule{spec: spec, selector: labels.Everything()}
+	if spec.Match.Selector != "" {
+		if r.selector, err = labels.Parse(spec.Match.Selector); err != nil {
+			return nil, fmt.Errorf("rule %s: invalid selector: %v", spec.ID, err)
+		}
+	}
+	if r.expr, err = ParseExpression(spec.Expression); err != nil {
+		return nil, fmt.Errorf("rule %s: %v", spec.ID, err)
+	}
+	message := spec.Message
+	if message == "" {
+		message = "does not satisfy " + spec.Expression
+	}
+	if r.message, err = template.New(spec.ID).Parse(message); err != nil {
+		return nil, fmt.Errorf("rule %s: invalid message: %v", spec.ID, err)
+	}
+	return r, nil
+}
+
+// LoadRuleFile : accepts the path of a YAML or JSON file with a 'rules' list of RuleSpec
+//			returns the rules it declares
+func LoadRuleFile(path string) ([]Rule, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading rule file %s: %v", path, err)
+	}
+	var file RuleFile
+	if err := yaml.UnmarshalStrict(data, &file); err != nil {
+		return nil, fmt.Errorf("error decoding rule file %s: %v", path, err)
+	}
+	var rules []Rule
+	for _, spec := range file.Rules {
+		r, err := NewExpressionRule(spec)
+		if err != nil {
+			return nil, fmt.Errorf("rule file %s: %v", path, err)
+		}
+		rules = append(rules, r)
+	}
+	return rules, nil
+}
+
+func (r *expressionRule) ID() string {
+	return r.spec.ID
+}
+
+func (r *expressionRule) Description() string {
+	if r.spec.Description == "" {
+		return r.spec.Expression
+	}
+	return r.spec.Description
+}
+
+func (r *expressionRule) Severity() Severity {
+	return r.spec.Severity
+}
+
+func (r *expressionRule) Kinds() []string {
+	return r.spec.Kinds
+}
+
+func (r *expressionRule) Evaluate(obj runtime.Object, snapshot *ClusterSnapshot) []Finding {
+	o, err := meta.Accessor(obj)
+	if err != nil {
+		return nil
+	}
+	if len(r.spec.Match.Namespaces) > 0 && !containsString(r.spec.Match.Namespaces, o.GetNamespace()) {
+		return nil
+	}
+	if !r.selector.Matches(labels.Set(o.GetLabels())) {
+		return nil
+	}
+
+	content, err := runtime.DefaultUnstructuredConverter.ToUnstructured(obj)
+	if err != nil {
+		return []Finding{{Message: "cannot be evaluated: " + err.Error()}}
+	}
+	kind := objectKind(obj)
+	content["kind"] = kind
+	if r.expr.Evaluate(content) {
+		return nil
+	}
+
+	var buf bytes.Buffer
+	data := RuleMessageData{
+		Kind:        kind,
+		Namespace:   o.GetNamespace(),
+		Name:        o.GetName(),
+		Labels:      o.GetLabels(),
+		Annotations: o.GetAnnotations(),
+		Object:      content,
+	}
+	if err := r.message.Execute(&buf, data); err != nil {
+		return []Finding{{Message: "does not satisfy " + r.spec.Expression}}
+	}
+	return []Finding{{Message: buf.String()}}
+}
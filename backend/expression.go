@@ -0,0 +1,572 @@
+package backend
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+// Expression : a boolean expression evaluated against an object converted to JSON-like maps and slices.
+//
+// An expression is made of conditions combined with '&&', '||', '!' and parentheses. A condition is
+// a path followed by an operator and, except for 'exists' and 'absent', a value:
+//
+//	.metadata.labels.team exists
+//	.metadata.labels['app.kubernetes.io/name'] == web
+//	.spec.template.spec.containers[*].image =~ '^registry.corp.example/'
+//	.spec.replicas >= 2 && .metadata.annotations.owner in [alice, bob]
+//
+// Paths are made of '.field', "['field']", '[index]' and '[*]' segments. A condition holds when the path
+// resolves to at least one value and every value satisfies the operator, 'absent' holds when the path
+// resolves to no value. The operators are ==, !=, =~, !~, <, <=, >, >=, in, notin, exists and absent;
+// the ordering operators compare numbers and resource quantities such as 512Mi.
+type Expression struct {
+	source string
+	root   exprNode
+}
+
+// ParseExpression : accepts the source of an expression
+//			returns the parsed Expression, or an error locating the syntax error
+func ParseExpression(source string) (*Expression, error) {
+	tokens, err := tokenizeExpression(source)
+	if err != nil {
+		return nil, fmt.Errorf("invalid expression '%s': %v", source, err)
+	}
+	p := &exprParser{tokens: tokens}
+	root, err := p.parseOr()
+	if err == nil && p.pos < len(p.tokens) {
+		err = fmt.Errorf("unexpected '%s'", p.tokens[p.pos].text)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid expression '%s': %v", source, err)
+	}
+	return &Expression{source: source, root: root}, nil
+}
+
+// String : returns the source of the expression
+func (e *Expression) String() string {
+	return e.source
+}
+
+// Evaluate : accepts an object as returned by runtime.DefaultUnstructuredConverter
+//			returns true if the expression holds for the object
+func (e *Expression) Evaluate(obj map[string]interface{}) bool {
+	return e.root.eval(obj)
+}
+
+type exprNode interface {
+	eval(obj map[string]interface{}) bool
+}
+
+type andNode struct{ left, right exprNode }
+
+func (n andNode) eval(obj map[string]interface{}) bool { return n.left.eval(obj) && n.right.eval(obj) }
+
+type orNode struct{ left, right exprNode }
+
+func (n orNode) eval(obj map[string]interface{}) bool { return n.left.eval(obj) || n.right.eval(obj) }
+
+type notNode struct{ expr exprNode }
+
+func (n notNode) eval(obj map[string]interface{}) bool { return !n.expr.eval(obj) }
+
+// pathSegment : a field name, an index, or a wildcard when both are unset
+type pathSegment struct {
+	field    string
+	index    int
+	isField  bool
+	isIndex  bool
+	wildcard bool
+}
+
+type conditionNode struct {
+	path   []pathSegment
+	op     string
+	value  string
+	values []string
+	re     *regexp.Regexp
+}
+
+func (n conditionNode) eval(obj map[string]interface{}) bool {
+	values := resolvePath(obj, n.path)
+	if n.op == "absent" {
+		return len(values) == 0
+	}
+	if len(values) == 0 {
+		return false
+	}
+	for _, v := range values {
+		if !n.holds(v) {
+			return false
+		}
+	}
+	return true
+}
+
+func (n conditionNode) holds(v interface{}) bool {
+	s := scalarString(v)
+	switch n.op {
+	case "exists":
+		return true
+	case "==":
+		return equalValues(s, n.value)
+	case "!=":
+		return !equalValues(s, n.value)
+	case "=~":
+		return n.re.MatchString(s)
+	case "!~":
+		return !n.re.MatchString(s)
+	case "in", "notin":
+		found := false
+		for _, candidate := range n.values {
+			if equalValues(s, candidate) {
+				found = true
+				break
+			}
+		}
+		return found == (n.op == "in")
+	}
+	cmp, ok := compareValues(s, n.value)
+	if !ok {
+		return false
+	}
+	switch n.op {
+	case "<":
+		return cmp < 0
+	case "<=":
+		return cmp <= 0
+	case ">":
+		return cmp > 0
+	case ">=":
+		return cmp >= 0
+	}
+	return false
+}
+
+func resolvePath(obj interface{}, path []pathSegment) []interface{} {
+	current := []interface{}{obj}
+	for _, seg := range path {
+		var next []interface{}
+		for _, v := range current {
+			switch o := v.(type) {
+			case map[string]interface{}:
+				if seg.wildcard {
+					for _, item := range o {
+						next = append(next, item)
+					}
+				} else if item, ok := o[seg.field]; ok && seg.isField && item != nil {
+					next = append(next, item)
+				}
+			case []interface{}:
+				if seg.wildcard {
+					next = append(next, o...)
+				} else if seg.isIndex && seg.index >= 0 && seg.index < len(o) {
+					next = append(next, o[seg.index])
+				}
+			}
+		}
+		current = next
+	}
+	return current
+}
+
+// scalarString : returns the string form of a resolved value
+func scalarString(v interface{}) string {
+	switch o := v.(type) {
+	case string:
+		return o
+	case nil:
+		return ""
+	}
+	return fmt.Sprint(v)
+}
+
+// equalValues : returns true if both values are equal as strings, as numbers or as resource quantities
+func equalValues(a string, b string) bool {
+	if a == b {
+		return true
+	}
+	cmp, ok := compareValues(a, b)
+	return ok && cmp == 0
+}
+
+// compareValues : compares both values as numbers, else as resource quantities
+//			returns false when one of them is neither
+func compareValues(a string, b string) (int, bool) {
+	fa, errA := strconv.ParseFloat(a, 64)
+	fb, errB := strconv.ParseFloat(b, 64)
+	if errA == nil && errB == nil {
+		switch {
+		case fa < fb:
+			return -1, true
+		case fa > fb:
+			return 1, true
+		}
+		return 0, true
+	}
+	qa, errA := resource.ParseQuantity(a)
+	qb, errB := resource.ParseQuantity(b)
+	if errA == nil && errB == nil {
+		return qa.Cmp(qb), true
+	}
+	return 0, false
+}
+
+type tokenKind int
+
+const (
+	tokenPath tokenKind = iota
+	tokenWord
+	tokenString
+	tokenList
+	tokenOperator
+	tokenAnd
+	tokenOr
+	tokenNot
+	tokenOpen
+	tokenClose
+)
+
+type exprToken struct {
+	kind  tokenKind
+	text  string
+	items []string
+}
+
+var exprOperators = []string{"==", "!=", "=~", "!~", "<=", ">=", "<", ">"}
+
+func tokenizeExpression(s string) ([]exprToken, error) {
+	var tokens []exprToken
+	for i := 0; i < len(s); {
+		c := s[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n':
+			i++
+		case c == '(':
+			tokens = append(tokens, exprToken{kind: tokenOpen, text: "("})
+			i++
+		case c == ')':
+			tokens = append(tokens, exprToken{kind: tokenClose, text: ")"})
+			i++
+		case strings.HasPrefix(s[i:], "&&"):
+			tokens = append(tokens, exprToken{kind: tokenAnd, text: "&&"})
+			i += 2
+		case strings.HasPrefix(s[i:], "||"):
+			tokens = append(tokens, exprToken{kind: tokenOr, text: "||"})
+			i += 2
+		case c == '\'' || c == '"':
+			str, end, err := readQuoted(s, i)
+			if err != nil {
+				return nil, err
+			}
+			tokens = append(tokens, exprToken{kind: tokenString, text: str})
+			i = end
+		case c == '.':
+			end, err := pathEnd(s, i)
+			if err != nil {
+				return nil, err
+			}
+			tokens = append(tokens, exprToken{kind: tokenPath, text: s[i:end]})
+			i = end
+		case c == '[':
+			items, end, err := readList(s, i)
+			if err != nil {
+				return nil, err
+			}
+			tokens = append(tokens, exprToken{kind: tokenList, text: s[i:end], items: items})
+			i = end
+		default:
+			op := ""
+			for _, candidate := range exprOperators {
+				if strings.HasPrefix(s[i:], candidate) {
+					op = candidate
+					break
+				}
+			}
+			if op != "" {
+				tokens = append(tokens, exprToken{kind: tokenOperator, text: op})
+				i += len(op)
+				continue
+			}
+			if c == '!' {
+				tokens = append(tokens, exprToken{kind: tokenNot, text: "!"})
+				i++
+				continue
+			}
+			end := i
+			for end < len(s) && !strings.ContainsRune(" \t\n()", rune(s[end])) {
+				end++
+			}
+			word := s[i:end]
+			switch word {
+			case "in", "notin", "exists", "absent":
+				tokens = append(tokens, exprToken{kind: tokenOperator, text: word})
+			default:
+				tokens = append(tokens, exprToken{kind: tokenWord, text: word})
+			}
+			i = end
+		}
+	}
+	return tokens, nil
+}
+
+// readQuoted : reads the quoted string starting at i, a backslash escapes the next character
+//			returns the unquoted string and the index following the closing quote
+func readQuoted(s string, i int) (string, int, error) {
+	quote := s[i]
+	var b strings.Builder
+	for j := i + 1; j < len(s); j++ {
+		switch s[j] {
+		case '\\':
+			if j+1 < len(s) {
+				j++
+				b.WriteByte(s[j])
+			}
+		case quote:
+			return b.String(), j + 1, nil
+		default:
+			b.WriteByte(s[j])
+		}
+	}
+	return "", 0, fmt.Errorf("unterminated string at position %d", i)
+}
+
+// pathEnd : returns the index following the path starting at i, brackets may hold quoted field names
+func pathEnd(s string, i int) (int, error) {
+	depth := 0
+	for j := i; j < len(s); j++ {
+		switch c := s[j]; {
+		case c == '\'' || c == '"':
+			if depth == 0 {
+				return j, nil
+			}
+			_, end, err := readQuoted(s, j)
+			if err != nil {
+				return 0, err
+			}
+			j = end - 1
+		case c == '[':
+			depth++
+		case c == ']':
+			depth--
+		case depth == 0 && strings.ContainsRune(" \t\n()=!<>~", rune(c)):
+			return j, nil
+		}
+	}
+	if depth != 0 {
+		return 0, fmt.Errorf("unterminated bracket in path at position %d", i)
+	}
+	return len(s), nil
+}
+
+// readList : reads the list literal starting at i, e.g. [a, 'b c']
+//			returns its items and the index following the closing bracket
+func readList(s string, i int) ([]string, int, error) {
+	var items []string
+	var b strings.Builder
+	quoted := false
+	flush := func() {
+		if item := strings.TrimSpace(b.String()); item != "" || quoted {
+			items = append(items, item)
+		}
+		b.Reset()
+		quoted = false
+	}
+	for j := i + 1; j < len(s); j++ {
+		switch c := s[j]; c {
+		case '\'', '"':
+			str, end, err := readQuoted(s, j)
+			if err != nil {
+				return nil, 0, err
+			}
+			b.WriteString(str)
+			quoted = true
+			j = end - 1
+		case ',':
+			flush()
+		case ']':
+			flush()
+			return items, j + 1, nil
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return nil, 0, fmt.Errorf("unterminated list at position %d", i)
+}
+
+// parsePath : accepts a path such as .spec.containers[*].image or .metadata.labels['app.kubernetes.io/name']
+//			returns its segments
+func parsePath(s string) ([]pathSegment, error) {
+	var path []pathSegment
+	for i := 0; i < len(s); {
+		switch s[i] {
+		case '.':
+			j := i + 1
+			for j < len(s) && s[j] != '.' && s[j] != '[' {
+				j++
+			}
+			switch field := s[i+1 : j]; field {
+			case "":
+				if j < len(s) && s[j] == '.' {
+					return nil, fmt.Errorf("empty field in path '%s'", s)
+				}
+			case "*":
+				path = append(path, pathSegment{wildcard: true})
+			default:
+				path = append(path, pathSegment{field: field, isField: true})
+			}
+			i = j
+		case '[':
+			if i+1 < len(s) && (s[i+1] == '\'' || s[i+1] == '"') {
+				field, end, err := readQuoted(s, i+1)
+				if err != nil {
+					return nil, err
+				}
+				if end >= len(s) || s[end] != ']' {
+					return nil, fmt.Errorf("missing ']' in path '%s'", s)
+				}
+				path = append(path, pathSegment{field: field, isField: true})
+				i = end + 1
+				continue
+			}
+			end := strings.IndexByte(s[i:], ']')
+			if end < 0 {
+				return nil, fmt.Errorf("missing ']' in path '%s'", s)
+			}
+			switch inner := s[i+1 : i+end]; inner {
+			case "*":
+				path = append(path, pathSegment{wildcard: true})
+			default:
+				index, err := strconv.Atoi(inner)
+				if err != nil {
+					return nil, fmt.Errorf("invalid index '%s' in path '%s'", inner, s)
+				}
+				path = append(path, pathSegment{index: index, isIndex: true})
+			}
+			i += end + 1
+		default:
+			return nil, fmt.Errorf("invalid path '%s'", s)
+		}
+	}
+	return path, nil
+}
+
+type exprParser struct {
+	tokens []exprToken
+	pos    int
+}
+
+func (p *exprParser) peek() *exprToken {
+	if p.pos < len(p.tokens) {
+		return &p.tokens[p.pos]
+	}
+	return nil
+}
+
+func (p *exprParser) parseOr() (exprNode, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for t := p.peek(); t != nil && t.kind == tokenOr; t = p.peek() {
+		p.pos++
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = orNode{left, right}
+	}
+	return left, nil
+}
+
+func (p *exprParser) parseAnd() (exprNode, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for t := p.peek(); t != nil && t.kind == tokenAnd; t = p.peek() {
+		p.pos++
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = andNode{left, right}
+	}
+	return left, nil
+}
+
+func (p *exprParser) parseUnary() (exprNode, error) {
+	t := p.peek()
+	if t == nil {
+		return nil, fmt.Errorf("unexpected end of expression")
+	}
+	switch t.kind {
+	case tokenNot:
+		p.pos++
+		expr, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return notNode{expr}, nil
+	case tokenOpen:
+		p.pos++
+		expr, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if t := p.peek(); t == nil || t.kind != tokenClose {
+			return nil, fmt.Errorf("missing ')'")
+		}
+		p.pos++
+		return expr, nil
+	case tokenPath:
+		return p.parseCondition()
+	}
+	return nil, fmt.Errorf("expected a path starting with '.', got '%s'", t.text)
+}
+
+func (p *exprParser) parseCondition() (exprNode, error) {
+	pathToken := p.tokens[p.pos]
+	p.pos++
+	path, err := parsePath(pathToken.text)
+	if err != nil {
+		return nil, err
+	}
+
+	op := p.peek()
+	if op == nil || op.kind != tokenOperator {
+		return nil, fmt.Errorf("expected an operator after '%s'", pathToken.text)
+	}
+	p.pos++
+	cond := conditionNode{path: path, op: op.text}
+	if cond.op == "exists" || cond.op == "absent" {
+		return cond, nil
+	}
+
+	value := p.peek()
+	if value == nil {
+		return nil, fmt.Errorf("expected a value after '%s %s'", pathToken.text, op.text)
+	}
+	p.pos++
+	switch cond.op {
+	case "in", "notin":
+		if value.kind != tokenList {
+			return nil, fmt.Errorf("expected a list such as [a, b] after '%s'", op.text)
+		}
+		cond.values = value.items
+		return cond, nil
+	}
+	if value.kind != tokenWord && value.kind != tokenString {
+		return nil, fmt.Errorf("expected a value after '%s %s', got '%s'", pathToken.text, op.text, value.text)
+	}
+	cond.value = value.text
+	if cond.op == "=~" || cond.op == "!~" {
+		if cond.re, err = regexp.Compile(cond.value); err != nil {
+			return nil, err
+		}
+	}
+	return cond, nil
+}
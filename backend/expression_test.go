@@ -0,0 +1,76 @@
+package backend
+
+import "testing"
+
+func TestParseExpression(t *testing.T) {
+	obj := map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"name": "web",
+			"labels": map[string]interface{}{
+				"app.kubernetes.io/name": "web",
+				"team":                   "shop",
+			},
+			"annotations": map[string]interface{}{"owner": "alice"},
+		},
+		"spec": map[string]interface{}{
+			"replicas": int64(3),
+			"template": map[string]interface{}{
+				"spec": map[string]interface{}{
+					"containers": []interface{}{
+						map[string]interface{}{"image": "registry.corp.example/web:1.0", "resources": map[string]interface{}{"limits": map[string]interface{}{"memory": "512Mi"}}},
+						map[string]interface{}{"image": "registry.corp.example/sidecar:2.1", "resources": map[string]interface{}{"limits": map[string]interface{}{"memory": "1Gi"}}},
+					},
+				},
+			},
+		},
+	}
+
+	tests := []struct {
+		source string
+		want   bool
+	}{
+		{".metadata.labels.team exists", true},
+		{".metadata.labels.missing exists", false},
+		{".metadata.labels.missing absent", true},
+		{".metadata.labels['app.kubernetes.io/name'] == web", true},
+		{".metadata.name != web", false},
+		{".spec.template.spec.containers[*].image =~ '^registry.corp.example/'", true},
+		{".spec.template.spec.containers[*].image !~ ':2'", false},
+		{".spec.template.spec.containers[1].image =~ 'sidecar'", true},
+		{".spec.replicas >= 2 && .metadata.annotations.owner in [alice, bob]", true},
+		{".spec.replicas < 2 || .metadata.annotations.owner notin [alice, bob]", false},
+		{"!(.spec.replicas > 3)", true},
+		{".spec.template.spec.containers[*].resources.limits.memory <= 1Gi", true},
+		{".spec.template.spec.containers[*].resources.limits.memory > 600Mi", false},
+		{".metadata.labels.team == \"shop\" && (.spec.replicas == 1 || .spec.replicas == 3)", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.source, func(t *testing.T) {
+			expr, err := ParseExpression(tt.source)
+			if err != nil {
+				t.Fatalf("ParseExpression: %v", err)
+			}
+			if got := expr.Evaluate(obj); got != tt.want {
+				t.Errorf("Evaluate = %t, want %t", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseExpressionErrors(t *testing.T) {
+	for _, source := range []string{
+		"",
+		".metadata.name ==",
+		".metadata.name == web &&",
+		"(.metadata.name == web",
+		".metadata.name in [web",
+		".metadata.labels['team == shop",
+		"metadata.name == web",
+	} {
+		t.Run(source, func(t *testing.T) {
+			if _, err := ParseExpression(source); err == nil {
+				t.Errorf("ParseExpression(%q) succeeded, want an error", source)
+			}
+		})
+	}
+}
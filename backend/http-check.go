@@ -0,0 +1,340 @@
+package backend
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/textproto"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+// probeMarker : prefixes the lines of the measured values printed by the HTTP and TLS probes
+const probeMarker = "__kubensure__"
+
+// HTTPCheck : the HTTP request of a connection check and the assertions on its response
+type HTTPCheck struct {
+	// Scheme is http or https, default is the scheme of the URL of an external target, else https for port 443
+	Scheme string `json:"scheme,omitempty"`
+	// Path is appended to the target, default is /
+	Path string `json:"path,omitempty"`
+	// Method defaults to GET
+	Method string `json:"method,omitempty"`
+	// Status are the accepted status codes and ranges, e.g. 200-299,301, default is 200-399
+	Status string `json:"status,omitempty"`
+	// BodyContains are substrings the body must contain
+	BodyContains []string `json:"bodyContains,omitempty"`
+	// BodyRegex is a regular expression the body must match
+	BodyRegex string `json:"bodyRegex,omitempty"`
+	// Headers are the headers the response must carry, as Name or as Name: regular expression of the value
+	Headers []string `json:"headers,omitempty"`
+	// FollowRedirects makes the assertions apply to the response at the end of the redirects
+	FollowRedirects bool `json:"followRedirects,omitempty"`
+	// RedirectTo is a regular expression the Location of the response must match, the response must be a redirect
+	RedirectTo string `json:"redirectTo,omitempty"`
+	// MaxLatency is the maximum duration of the request, e.g. 500ms
+	MaxLatency string `json:"maxLatency,omitempty"`
+	// HTTP2 negotiates HTTP/2 and fails when the server answers with HTTP/1.x
+	HTTP2 bool `json:"http2,omitempty"`
+}
+
+// HTTPResponse : the values measured by an HTTP check
+type HTTPResponse struct {
+	Status int
+	// Protocol is the HTTP version of the response, e.g. HTTP/1.1 or HTTP/2
+	Protocol string
+	Headers  http.Header
+	Body     string `json:"-"`
+	BodySize int
+	// Location is the redirect location of the response, empty when it is not a redirect
+	Location  string `json:",omitempty"`
+	Redirects int
+	// FirstByte is the duration until the first byte of the response, Latency the duration of the whole request
+	FirstByte time.Duration
+	Latency   time.Duration
+}
+
+// HTTPResult : the measured response of an HTTP check and the assertions it failed
+type HTTPResult struct {
+	Response HTTPResponse
+	Failures []string `json:",omitempty"`
+}
+
+// statusRange : an inclusive range of status codes
+type statusRange struct {
+	min, max int
+}
+
+// Validate : returns an error when an assertion of the check cannot be parsed
+func (c HTTPCheck) Validate() error {
+	if _, err := parseStatusRanges(c.Status); err != nil {
+		return err
+	}
+	if c.Scheme != "" && c.Scheme != "http" && c.Scheme != "https" {
+		return fmt.Errorf("invalid scheme '%s': must be http or https", c.Scheme)
+	}
+	for _, re := range []string{c.BodyRegex, c.RedirectTo} {
+		if _, err := regexp.Compile(re); err != nil {
+			return fmt.Errorf("invalid regular expression '%s': %v", re, err)
+		}
+	}
+	for _, h := range c.Headers {
+		if _, re := splitHeaderAssertion(h); re != "" {
+			if _, err := regexp.Compile(re); err != nil {
+				return fmt.Errorf("invalid regular expression of header '%s': %v", h, err)
+			}
+		}
+	}
+	if c.MaxLatency != "" {
+		if _, err := time.ParseDuration(c.MaxLatency); err != nil {
+			return fmt.Errorf("invalid max latency '%s': %v", c.MaxLatency, err)
+		}
+	}
+	return nil
+}
+
+// parseStatusRanges : accepts status codes and ranges separated by commas, e.g. 200-299,301
+//			returns the ranges, 200-399 when empty
+func parseStatusRanges(s string) ([]statusRange, error) {
+	if s == "" {
+		return []statusRange{{200, 399}}, nil
+	}
+	var ranges []statusRange
+	for _, part := range strings.Split(s, ",") {
+		bounds := strings.SplitN(strings.TrimSpace(part), "-", 2)
+		min, err := strconv.Atoi(bounds[0])
+		if err != nil {
+			return nil, fmt.Errorf("invalid status '%s': must be codes or ranges like 200-299,301", s)
+		}
+		max := min
+		if len(bounds) == 2 {
+			if max, err = strconv.Atoi(bounds[1]); err != nil || max < min {
+				return nil, fmt.Errorf("invalid status '%s': must be codes or ranges like 200-299,301", s)
+			}
+		}
+		ranges = append(ranges, statusRange{min, max})
+	}
+	return ranges, nil
+}
+
+// splitHeaderAssertion : returns the name and the regular expression of the value of a header assertion
+func splitHeaderAssertion(h string) (string, string) {
+	parts := strings.SplitN(h, ":", 2)
+	if len(parts) == 1 {
+		return strings.TrimSpace(parts[0]), ""
+	}
+	return strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1])
+}
+
+// Evaluate : accepts the measured response
+//			returns the assertions of the check the response fails
+func (c HTTPCheck) Evaluate(resp HTTPResponse) []string {
+	var failures []string
+	ranges, _ := parseStatusRanges(c.Status)
+	accepted := false
+	for _, r := range ranges {
+		accepted = accepted || resp.Status >= r.min && resp.Status <= r.max
+	}
+	status := c.Status
+	if status == "" {
+		status = "200-399"
+	}
+	if !accepted {
+		failures = append(failures, fmt.Sprintf("status %d is not in %s", resp.Status, status))
+	}
+	if c.RedirectTo != "" {
+		if resp.Location == "" {
+			failures = append(failures, "the response is not a redirect")
+		} else if !regexp.MustCompile(c.RedirectTo).MatchString(resp.Location) {
+			failures = append(failures, fmt.Sprintf("redirect location %s does not match '%s'", resp.Location, c.RedirectTo))
+		}
+	}
+	for _, s := range c.BodyContains {
+		if !strings.Contains(resp.Body, s) {
+			failures = append(failures, fmt.Sprintf("body does not contain '%s'", s))
+		}
+	}
+	if c.BodyRegex != "" && !regexp.MustCompile(c.BodyRegex).MatchString(resp.Body) {
+		failures = append(failures, fmt.Sprintf("body does not match '%s'", c.BodyRegex))
+	}
+	for _, h := range c.Headers {
+		name, re := splitHeaderAssertion(h)
+		values, ok := resp.Headers[textproto.CanonicalMIMEHeaderKey(name)]
+		switch {
+		case !ok:
+			failures = append(failures, "header "+name+" is missing")
+		case re != "" && !matchesAny(regexp.MustCompile(re), values):
+			failures = append(failures, fmt.Sprintf("header %s: %s does not match '%s'", name, strings.Join(values, ", "), re))
+		}
+	}
+	if c.MaxLatency != "" {
+		if max, _ := time.ParseDuration(c.MaxLatency); resp.Latency > max {
+			failures = append(failures, fmt.Sprintf("latency %s exceeds %s", resp.Latency.Round(time.Millisecond), max))
+		}
+	}
+	if c.HTTP2 && !strings.HasPrefix(resp.Protocol, "HTTP/2") {
+		failures = append(failures, "the server answered with "+resp.Protocol+" instead of HTTP/2")
+	}
+	return failures
+}
+
+func matchesAny(re *regexp.Regexp, values []string) bool {
+	for _, v := range values {
+		if re.MatchString(v) {
+			return true
+		}
+	}
+	return false
+}
+
+// httpURL : returns the URL requested by the HTTP check of the target, the path of the check may carry a query
+func httpURL(target ProbeTarget) string {
+	check := target.HTTP
+	u, err := url.Parse(target.Address)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		u = &url.URL{Scheme: "http", Host: target.Host, Path: "/"}
+		if target.Port != 0 {
+			u.Host = net.JoinHostPort(target.Host, strconv.Itoa(target.Port))
+		}
+		if target.Port == 443 {
+			u.Scheme = "https"
+		}
+	}
+	if check.Scheme != "" {
+		u.Scheme = check.Scheme
+	}
+	if check.Path != "" {
+		if ref, err := url.Parse("/" + strings.TrimPrefix(check.Path, "/")); err == nil {
+			u = u.ResolveReference(ref)
+		}
+	}
+	return u.String()
+}
+
+// httpProber : probes the HTTP checks with curl, which prints the response headers and body
+// followed by the measured values
+type httpProber struct{}
+
+func (httpProber) Name() string {
+	return "curl-http"
+}
+
+func (httpProber) Protocols() []v1.Protocol {
+	return []v1.Protocol{v1.ProtocolTCP}
+}
+
+func (httpProber) RequiredBinaries() []string {
+	return []string{"curl"}
+}
+
+func (httpProber) Command(target ProbeTarget) (string, error) {
+	if target.HTTP == nil {
+		return "", fmt.Errorf("curl-http only probes HTTP checks")
+	}
+	method := target.HTTP.Method
+	if method == "" {
+		method = http.MethodGet
+	}
+	command := "curl -sS -k --max-time 10 -D - -X " + shellQuote(method)
+	if target.HTTP.FollowRedirects {
+		command += " -L --max-redirs 10"
+	}
+	if target.HTTP.HTTP2 {
+		command += " --http2"
+	}
+	if target.Proxy != "" {
+		command += " -x " + shellQuote(target.Proxy)
+	}
+	// curl expands the \n of the format of -w
+	command += " -w " + shellQuote(`\n`+probeMarker+` %{http_code} %{http_version} %{time_starttransfer} %{time_total} %{num_redirects} %{redirect_url}\n`)
+	return command + " " + shellQuote(httpURL(target)), nil
+}
+
+func (httpProber) Interpret(exitCode int, stdout string, stderr string) error {
+	if exitCode != 0 {
+		return fmt.Errorf("exit code %d%s", exitCode, firstLine(stderr, stdout))
+	}
+	if _, err := parseHTTPResponse(stdout); err != nil {
+		return err
+	}
+	return nil
+}
+
+// parseHTTPResponse : accepts the output of an HTTP probe: the headers of every response, the body of the last one
+//			and the line of the measured values
+//			returns the measured response
+func parseHTTPResponse(output string) (HTTPResponse, error) {
+	var resp HTTPResponse
+	i := strings.LastIndex(output, probeMarker+" ")
+	if i < 0 {
+		return resp, fmt.Errorf("no HTTP response")
+	}
+	fields := strings.Fields(output[i+len(probeMarker):])
+	if len(fields) < 5 {
+		return resp, fmt.Errorf("invalid HTTP probe output%s", firstLine(output[i:]))
+	}
+	resp.Status, _ = strconv.Atoi(fields[0])
+	if resp.Status == 0 {
+		return resp, fmt.Errorf("no HTTP response")
+	}
+	resp.Protocol = "HTTP/" + fields[1]
+	resp.FirstByte = parseSeconds(fields[2])
+	resp.Latency = parseSeconds(fields[3])
+	resp.Redirects, _ = strconv.Atoi(fields[4])
+	if len(fields) > 5 {
+		resp.Location = fields[5]
+	}
+
+	// the headers of every response of the redirects and of the interim 1xx responses precede the body
+	rest := strings.TrimSuffix(output[:i], "\n")
+	resp.Headers = http.Header{}
+	for strings.HasPrefix(rest, "HTTP/") {
+		block := rest
+		rest = ""
+		for _, sep := range []string{"\r\n\r\n", "\n\n"} {
+			if j := strings.Index(block, sep); j >= 0 {
+				block, rest = block[:j], block[j+len(sep):]
+				break
+			}
+		}
+		resp.Headers = http.Header{}
+		for _, line := range strings.Split(block, "\n")[1:] {
+			if parts := strings.SplitN(strings.TrimSpace(line), ":", 2); len(parts) == 2 {
+				resp.Headers.Add(strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1]))
+			}
+		}
+	}
+	resp.Body = rest
+	resp.BodySize = len(rest)
+	return resp, nil
+}
+
+// parseSeconds : returns the duration of a number of seconds printed by curl
+func parseSeconds(s string) time.Duration {
+	f, _ := strconv.ParseFloat(s, 64)
+	return time.Duration(f * float64(time.Second))
+}
+
+// evaluateHTTP : sets the measured response and the failed assertions of the HTTP check of a connected result
+func evaluateHTTP(result *ConnectionResult, check *HTTPCheck) {
+	if check == nil || !result.Connected {
+		return
+	}
+	for i := len(result.Attempts) - 1; i >= 0; i-- {
+		a := result.Attempts[i]
+		if a.Reason != "" || a.Error != "" {
+			continue
+		}
+		resp, err := parseHTTPResponse(a.Stdout)
+		if err != nil {
+			continue
+		}
+		result.HTTP = &HTTPResult{Response: resp, Failures: check.Evaluate(resp)}
+		return
+	}
+}
@@ -0,0 +1,67 @@
+package backend
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseHTTPResponse(t *testing.T) {
+	tests := []struct {
+		name    string
+		output  string
+		want    HTTPResponse
+		header  string
+		wantErr bool
+	}{
+		{
+			name:   "single response",
+			output: "HTTP/1.1 200 OK\r\nContent-Type: text/plain\r\nX-Served-By: web-0\r\n\r\nok\n" + probeMarker + " 200 1.1 0.012 0.015 0 \n",
+			want:   HTTPResponse{Status: 200, Protocol: "HTTP/1.1", FirstByte: 12 * time.Millisecond, Latency: 15 * time.Millisecond, Body: "ok", BodySize: 2},
+			header: "web-0",
+		},
+		{
+			name: "followed redirect",
+			output: "HTTP/1.1 301 Moved Permanently\r\nLocation: https://web/\r\nX-Served-By: lb\r\n\r\n" +
+				"HTTP/2 200\r\nX-Served-By: web-1\r\n\r\nhello\n" + probeMarker + " 200 2 0.100 0.200 1 \n",
+			want:   HTTPResponse{Status: 200, Protocol: "HTTP/2", FirstByte: 100 * time.Millisecond, Latency: 200 * time.Millisecond, Redirects: 1, Body: "hello", BodySize: 5},
+			header: "web-1",
+		},
+		{
+			name:   "redirect not followed",
+			output: "HTTP/1.1 302 Found\r\nLocation: /login\r\n\r\n\n" + probeMarker + " 302 1.1 0.010 0.010 0 http://web/login\n",
+			want:   HTTPResponse{Status: 302, Protocol: "HTTP/1.1", FirstByte: 10 * time.Millisecond, Latency: 10 * time.Millisecond, Location: "http://web/login"},
+		},
+		{
+			name:    "no response",
+			output:  "curl: (7) Failed to connect to web port 80: Connection refused\n" + probeMarker + " 000 0 0.000 0.001 0 \n",
+			wantErr: true,
+		},
+		{
+			name:    "no marker",
+			output:  "curl: (6) Could not resolve host: web\n",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := parseHTTPResponse(tt.output)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("parseHTTPResponse succeeded, want an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseHTTPResponse: %v", err)
+			}
+			if got := resp.Headers.Get("X-Served-By"); got != tt.header {
+				t.Errorf("X-Served-By = %q, want %q", got, tt.header)
+			}
+			resp.Headers = nil
+			if !reflect.DeepEqual(resp, tt.want) {
+				t.Errorf("parseHTTPResponse = %+v, want %+v", resp, tt.want)
+			}
+		})
+	}
+}
@@ -1,14 +1,17 @@
 package backend
 
 import (
-	"log"
-	"os"
-	"path/filepath"
+	"context"
 
 	appv1 "k8s.io/api/apps/v1"
 	v1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	networkingv1beta1 "k8s.io/api/networking/v1beta1"
 	rbacv1 "k8s.io/api/rbac/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/version"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/clientcmd"
@@ -16,39 +19,125 @@ import (
 
 // Getters
 
-// GetConfig : Get kubeconfig from file
-func GetConfig() *rest.Config {
-	kubeconfig := filepath.Join(os.Getenv("HOME"), ".kube", "config")
-	config, err := clientcmd.BuildConfigFromFlags("", kubeconfig)
+// KubeConfigOptions : selects the kubeconfig, context, namespace and impersonated user,
+// empty fields keep the values of the standard client-go loading rules
+type KubeConfigOptions struct {
+	// Kubeconfig is the path of the kubeconfig file, default is $KUBECONFIG, then $HOME/.kube/config,
+	// then the in-cluster configuration
+	Kubeconfig string
+	Context    string
+	Namespace  string
+	As         string
+	AsGroups   []string
+}
+
+var kubeConfigOptions KubeConfigOptions
+
+// SetKubeConfigOptions : sets the options used by GetConfig, GetClientSet and GetNamespace
+func SetKubeConfigOptions(opts KubeConfigOptions) {
+	kubeConfigOptions = opts
+}
+
+// clientConfig : returns the client configuration resolved from the kubeconfig options
+func clientConfig() clientcmd.ClientConfig {
+	loadingRules := clientcmd.NewDefaultClientConfigLoadingRules()
+	loadingRules.ExplicitPath = kubeConfigOptions.Kubeconfig
+
+	overrides := &clientcmd.ConfigOverrides{
+		CurrentContext: kubeConfigOptions.Context,
+	}
+	overrides.Context.Namespace = kubeConfigOptions.Namespace
+	overrides.AuthInfo.Impersonate = kubeConfigOptions.As
+	overrides.AuthInfo.ImpersonateGroups = kubeConfigOptions.AsGroups
+
+	return clientcmd.NewNonInteractiveDeferredLoadingClientConfig(loadingRules, overrides)
+}
+
+// GetConfig : returns the rest config resolved from the kubeconfig options,
+//			falls back to the in-cluster configuration when no kubeconfig is found
+func GetConfig() (*rest.Config, error) {
+	config, err := clientConfig().ClientConfig()
 	if err != nil {
-		log.Fatal(err)
+		return nil, &APIError{Op: "load kubeconfig", Err: err}
 	}
+	return config, nil
+}
 
-	return config
+// GetNamespace : returns the namespace selected by the kubeconfig options, else the namespace of the current context,
+//			else the namespace of the service account when running in a pod, else "default"
+func GetNamespace() string {
+	ns, _, err := clientConfig().Namespace()
+	if err != nil || ns == "" {
+		return "default"
+	}
+	return ns
 }
 
-// GetClientSet : get client set from the kubeconfig file
-func GetClientSet() *kubernetes.Clientset {
-	var config = GetConfig()
+// GetClientSet : get client set from the resolved kubeconfig
+func GetClientSet() (kubernetes.Interface, error) {
+	config, err := GetConfig()
+	if err != nil {
+		return nil, err
+	}
 
 	// Create a rest client not targeting specific API version
 	clientset, err := kubernetes.NewForConfig(config)
 	if err != nil {
-		log.Fatal(err)
+		return nil, &APIError{Op: "create clientset", Err: err}
+	}
+	return clientset, nil
+}
+
+// request : runs the API call and wraps its error in an APIError,
+//			returns as soon as the context is done since the typed clients do not accept one.
+//			The abandoned call keeps running in its goroutine until the API server answers: the listers
+//			bound it with the deadline of the context, see requestTimeout, a context cancelled without
+//			deadline leaves it to the timeouts of the transport.
+func request(ctx context.Context, op string, call func() error) error {
+	if err := ctx.Err(); err != nil {
+		return &APIError{Op: op, Err: err}
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- call() }()
+	select {
+	case err := <-done:
+		if err != nil {
+			return &APIError{Op: op, Err: err}
+		}
+		return nil
+	case <-ctx.Done():
+		return &APIError{Op: op, Err: ctx.Err()}
 	}
-	return clientset
 }
 
 // GetPodByName : accepts a list of pods and a pod name+namespace
-//			returns a Pod
-func GetPodByName(pods []v1.Pod, podName string, podNamespace string) v1.Pod {
-	var pod v1.Pod
+//			returns the Pod, or a NotFoundError when it is not in the list
+func GetPodByName(pods []v1.Pod, podName string, podNamespace string) (v1.Pod, error) {
 	for _, p := range pods {
 		if p.Name == podName && p.Namespace == podNamespace {
-			pod = p
+			return p, nil
 		}
 	}
-	return pod
+	return v1.Pod{}, &NotFoundError{Kind: "pod", Namespace: podNamespace, Name: podName}
+}
+
+// FindPod : accepts a context, a clientset and a pod name+namespace
+//			returns the Pod listed by name in its namespace only, or a NotFoundError
+func FindPod(ctx context.Context, clientset kubernetes.Interface, podName string, podNamespace string) (v1.Pod, error) {
+	pods, err := GetPods(ctx, clientset, nameQuery(podName, podNamespace))
+	if err != nil {
+		return v1.Pod{}, err
+	}
+	return GetPodByName(pods, podName, podNamespace)
+}
+
+// nameQuery : returns the query selecting a single object by name+namespace
+func nameQuery(name string, namespace string) QueryOptions {
+	return QueryOptions{
+		Namespaces:    []string{namespace},
+		FieldSelector: fields.OneTermEqualSelector("metadata.name", name).String(),
+	}
 }
 
 // GetPodIP : returns the pod ip
@@ -56,176 +145,436 @@ func GetPodIP(pod v1.Pod) string {
 	return pod.Status.PodIP
 }
 
-// GetPods : accepts a clientset and returns a list of Pods
-func GetPods(clientset *kubernetes.Clientset) []v1.Pod {
-	pods, err := clientset.CoreV1().Pods("").List(metav1.ListOptions{})
+// GetPods : accepts a context, a clientset and a query and returns a list of Pods
+func GetPods(ctx context.Context, clientset kubernetes.Interface, query QueryOptions) ([]v1.Pod, error) {
+	var pods []v1.Pod
+	err := listQuery(ctx, "pods", query, true, func(ns string, opts metav1.ListOptions) (string, error) {
+		list, err := clientset.CoreV1().Pods(ns).List(opts)
+		if err != nil {
+			return "", err
+		}
+		pods = append(pods, list.Items...)
+		return list.Continue, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return pods, nil
+}
+
+// GetPodsPage : accepts a context, a clientset, a query and the continue token of the page, empty for the first one
+//			returns the page of at most query.Limit Pods and the continue token of the next page, empty on the last one
+func GetPodsPage(ctx context.Context, clientset kubernetes.Interface, query QueryOptions, token string) ([]v1.Pod, string, error) {
+	var pods []v1.Pod
+	next, err := listPage(ctx, "pods", query, token, func(ns string, opts metav1.ListOptions) (int, string, error) {
+		list, err := clientset.CoreV1().Pods(ns).List(opts)
+		if err != nil {
+			return 0, "", err
+		}
+		pods = append(pods, list.Items...)
+		return len(list.Items), list.Continue, nil
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	return pods, next, nil
+}
+
+// GetDeployments : accepts a context, a clientset and a query and returns a list of Deployments
+func GetDeployments(ctx context.Context, clientset kubernetes.Interface, query QueryOptions) ([]appv1.Deployment, error) {
+	var deploys []appv1.Deployment
+	err := listQuery(ctx, "deployments", query, true, func(ns string, opts metav1.ListOptions) (string, error) {
+		list, err := clientset.AppsV1().Deployments(ns).List(opts)
+		if err != nil {
+			return "", err
+		}
+		deploys = append(deploys, list.Items...)
+		return list.Continue, nil
+	})
 	if err != nil {
-		log.Fatalln("Failed to get Pods:", err)
+		return nil, err
 	}
-	return pods.Items
+	return deploys, nil
 }
 
-// GetDeployments : accepts a clientset and returns a list of Deployments
-func GetDeployments(clientset *kubernetes.Clientset) []appv1.Deployment {
-	deploys, err := clientset.AppsV1().Deployments("").List(metav1.ListOptions{})
+// GetDaemonSets : accepts a context, a clientset and a query and returns a list of DaemonSets
+func GetDaemonSets(ctx context.Context, clientset kubernetes.Interface, query QueryOptions) ([]appv1.DaemonSet, error) {
+	var ds []appv1.DaemonSet
+	err := listQuery(ctx, "daemonsets", query, true, func(ns string, opts metav1.ListOptions) (string, error) {
+		list, err := clientset.AppsV1().DaemonSets(ns).List(opts)
+		if err != nil {
+			return "", err
+		}
+		ds = append(ds, list.Items...)
+		return list.Continue, nil
+	})
 	if err != nil {
-		log.Fatalln("Failed to get Deployments:", err)
+		return nil, err
 	}
-	return deploys.Items
+	return ds, nil
 }
 
-// GetDaemonSets : accepts a clientset and returns a list of DaemonSets
-func GetDaemonSets(clientset *kubernetes.Clientset) []appv1.DaemonSet {
-	ds, err := clientset.AppsV1().DaemonSets("").List(metav1.ListOptions{})
+// GetReplicaSets : accepts a context, a clientset and a query and returns a list of ReplicaSets
+func GetReplicaSets(ctx context.Context, clientset kubernetes.Interface, query QueryOptions) ([]appv1.ReplicaSet, error) {
+	var rs []appv1.ReplicaSet
+	err := listQuery(ctx, "replicasets", query, true, func(ns string, opts metav1.ListOptions) (string, error) {
+		list, err := clientset.AppsV1().ReplicaSets(ns).List(opts)
+		if err != nil {
+			return "", err
+		}
+		rs = append(rs, list.Items...)
+		return list.Continue, nil
+	})
 	if err != nil {
-		log.Fatalln("Failed to get DaemonSets:", err)
+		return nil, err
 	}
-	return ds.Items
+	return rs, nil
 }
 
-// GetReplicaSets : accepts a clientset and returns a list of ReplicaSets
-func GetReplicaSets(clientset *kubernetes.Clientset) []appv1.ReplicaSet {
-	rs, err := clientset.AppsV1().ReplicaSets("").List(metav1.ListOptions{})
+// GetStatefulSets : accepts a context, a clientset and a query and returns a list of StatefulSets
+func GetStatefulSets(ctx context.Context, clientset kubernetes.Interface, query QueryOptions) ([]appv1.StatefulSet, error) {
+	var sts []appv1.StatefulSet
+	err := listQuery(ctx, "statefulsets", query, true, func(ns string, opts metav1.ListOptions) (string, error) {
+		list, err := clientset.AppsV1().StatefulSets(ns).List(opts)
+		if err != nil {
+			return "", err
+		}
+		sts = append(sts, list.Items...)
+		return list.Continue, nil
+	})
 	if err != nil {
-		log.Fatalln("Failed to get ReplicaSets:", err)
+		return nil, err
 	}
-	return rs.Items
+	return sts, nil
 }
 
-// GetStatefulSets : accepts a clientset and returns a list of StatefulSets
-func GetStatefulSets(clientset *kubernetes.Clientset) []appv1.StatefulSet {
-	sts, err := clientset.AppsV1().StatefulSets("").List(metav1.ListOptions{})
+// GetServices : accepts a context, a clientset and a query and returns a list of Services
+func GetServices(ctx context.Context, clientset kubernetes.Interface, query QueryOptions) ([]v1.Service, error) {
+	var svcs []v1.Service
+	err := listQuery(ctx, "services", query, true, func(ns string, opts metav1.ListOptions) (string, error) {
+		list, err := clientset.CoreV1().Services(ns).List(opts)
+		if err != nil {
+			return "", err
+		}
+		svcs = append(svcs, list.Items...)
+		return list.Continue, nil
+	})
 	if err != nil {
-		log.Fatalln("Failed to get StatefulSets:", err)
+		return nil, err
 	}
-	return sts.Items
+	return svcs, nil
 }
 
-// GetServices : accepts a clientset and returns a list of Services
-func GetServices(clientset *kubernetes.Clientset) []v1.Service {
-	svcs, err := clientset.CoreV1().Services("").List(metav1.ListOptions{})
+// GetServicesPage : accepts a context, a clientset, a query and the continue token of the page, empty for the first one
+//			returns the page of at most query.Limit Services and the continue token of the next page, empty on the last one
+func GetServicesPage(ctx context.Context, clientset kubernetes.Interface, query QueryOptions, token string) ([]v1.Service, string, error) {
+	var svcs []v1.Service
+	next, err := listPage(ctx, "services", query, token, func(ns string, opts metav1.ListOptions) (int, string, error) {
+		list, err := clientset.CoreV1().Services(ns).List(opts)
+		if err != nil {
+			return 0, "", err
+		}
+		svcs = append(svcs, list.Items...)
+		return len(list.Items), list.Continue, nil
+	})
 	if err != nil {
-		log.Fatalln("Failed to get Services:", err)
+		return nil, "", err
 	}
-	return svcs.Items
+	return svcs, next, nil
 }
 
 // GetServiceByName : accepts a list of services and a service name+namespace
-//			returns a Service
-func GetServiceByName(svcs []v1.Service, svcName string, svcNamespace string) v1.Service {
-	var svc v1.Service
+//			returns the Service, or a NotFoundError when it is not in the list
+func GetServiceByName(svcs []v1.Service, svcName string, svcNamespace string) (v1.Service, error) {
 	for _, s := range svcs {
 		if s.Name == svcName && s.Namespace == svcNamespace {
-			svc = s
+			return s, nil
 		}
 	}
-	return svc
+	return v1.Service{}, &NotFoundError{Kind: "service", Namespace: svcNamespace, Name: svcName}
 }
 
-// GetSecrets : accepts a clientset and returns a list of Secrets
-func GetSecrets(clientset *kubernetes.Clientset) []v1.Secret {
-	scr, err := clientset.CoreV1().Secrets("").List(metav1.ListOptions{})
+// FindService : accepts a context, a clientset and a service name+namespace
+//			returns the Service listed by name in its namespace only, or a NotFoundError
+func FindService(ctx context.Context, clientset kubernetes.Interface, svcName string, svcNamespace string) (v1.Service, error) {
+	svcs, err := GetServices(ctx, clientset, nameQuery(svcName, svcNamespace))
 	if err != nil {
-		log.Fatalln("Failed to get Secrets:", err)
+		return v1.Service{}, err
 	}
-	return scr.Items
+	return GetServiceByName(svcs, svcName, svcNamespace)
 }
 
-// GetConfigMaps : accepts a clientset and returns a list of ConfigMaps
-func GetConfigMaps(clientset *kubernetes.Clientset) []v1.ConfigMap {
-	cm, err := clientset.CoreV1().ConfigMaps("").List(metav1.ListOptions{})
+// GetNamespaces : accepts a context, a clientset and a query and returns a list of Namespaces
+func GetNamespaces(ctx context.Context, clientset kubernetes.Interface, query QueryOptions) ([]v1.Namespace, error) {
+	var nss []v1.Namespace
+	err := listQuery(ctx, "namespaces", query, false, func(_ string, opts metav1.ListOptions) (string, error) {
+		list, err := clientset.CoreV1().Namespaces().List(opts)
+		if err != nil {
+			return "", err
+		}
+		nss = append(nss, list.Items...)
+		return list.Continue, nil
+	})
 	if err != nil {
-		log.Fatalln("Failed to get ConfigMaps:", err)
+		return nil, err
 	}
-	return cm.Items
+	return nss, nil
 }
 
-// GetServiceAccounts : accepts a clientset and returns a list of ServiceAccounts
-func GetServiceAccounts(clientset *kubernetes.Clientset) []v1.ServiceAccount {
-	sa, err := clientset.CoreV1().ServiceAccounts("").List(metav1.ListOptions{})
+// GetNetworkPolicies : accepts a context, a clientset and a query and returns a list of NetworkPolicies
+func GetNetworkPolicies(ctx context.Context, clientset kubernetes.Interface, query QueryOptions) ([]networkingv1.NetworkPolicy, error) {
+	var np []networkingv1.NetworkPolicy
+	err := listQuery(ctx, "networkpolicies", query, true, func(ns string, opts metav1.ListOptions) (string, error) {
+		list, err := clientset.NetworkingV1().NetworkPolicies(ns).List(opts)
+		if err != nil {
+			return "", err
+		}
+		np = append(np, list.Items...)
+		return list.Continue, nil
+	})
 	if err != nil {
-		log.Fatalln("Failed to get ServiceAccounts:", err)
+		return nil, err
 	}
-	return sa.Items
+	return np, nil
 }
 
-// GetEvents : accepts a clientset and returns a list of Events
-func GetEvents(clientset *kubernetes.Clientset) []v1.Event {
-	ev, err := clientset.CoreV1().Events("").List(metav1.ListOptions{})
+// GetIngresses : accepts a context, a clientset and a query and returns a list of Ingresses
+func GetIngresses(ctx context.Context, clientset kubernetes.Interface, query QueryOptions) ([]networkingv1beta1.Ingress, error) {
+	var ing []networkingv1beta1.Ingress
+	err := listQuery(ctx, "ingresses", query, true, func(ns string, opts metav1.ListOptions) (string, error) {
+		list, err := clientset.NetworkingV1beta1().Ingresses(ns).List(opts)
+		if err != nil {
+			return "", err
+		}
+		ing = append(ing, list.Items...)
+		return list.Continue, nil
+	})
 	if err != nil {
-		log.Fatalln("Failed to get Events:", err)
+		return nil, err
 	}
-	return ev.Items
+	return ing, nil
 }
 
-// GetEndpoints : accepts a clientset and returns a list of Endpoints
-func GetEndpoints(clientset *kubernetes.Clientset) []v1.Endpoints {
-	ep, err := clientset.CoreV1().Endpoints("").List(metav1.ListOptions{})
+// GetSecrets : accepts a context, a clientset and a query and returns a list of Secrets
+func GetSecrets(ctx context.Context, clientset kubernetes.Interface, query QueryOptions) ([]v1.Secret, error) {
+	var scr []v1.Secret
+	err := listQuery(ctx, "secrets", query, true, func(ns string, opts metav1.ListOptions) (string, error) {
+		list, err := clientset.CoreV1().Secrets(ns).List(opts)
+		if err != nil {
+			return "", err
+		}
+		scr = append(scr, list.Items...)
+		return list.Continue, nil
+	})
 	if err != nil {
-		log.Fatalln("Failed to get Endpoints:", err)
+		return nil, err
 	}
-	return ep.Items
+	return scr, nil
 }
 
-// GetPersistentVolumes : accepts a clientset and returns a list of PersistentVolumes
-func GetPersistentVolumes(clientset *kubernetes.Clientset) []v1.PersistentVolume {
-	pvs, err := clientset.CoreV1().PersistentVolumes().List(metav1.ListOptions{})
+// GetConfigMaps : accepts a context, a clientset and a query and returns a list of ConfigMaps
+func GetConfigMaps(ctx context.Context, clientset kubernetes.Interface, query QueryOptions) ([]v1.ConfigMap, error) {
+	var cm []v1.ConfigMap
+	err := listQuery(ctx, "configmaps", query, true, func(ns string, opts metav1.ListOptions) (string, error) {
+		list, err := clientset.CoreV1().ConfigMaps(ns).List(opts)
+		if err != nil {
+			return "", err
+		}
+		cm = append(cm, list.Items...)
+		return list.Continue, nil
+	})
 	if err != nil {
-		log.Fatalln("Failed to get PersistentVolumes:", err)
+		return nil, err
 	}
-	return pvs.Items
+	return cm, nil
 }
 
-// GetPersistentVolumeClaims : accepts a clientset and returns a list of PersistentVolumeClaims
-func GetPersistentVolumeClaims(clientset *kubernetes.Clientset) []v1.PersistentVolumeClaim {
-	pvcs, err := clientset.CoreV1().PersistentVolumeClaims("").List(metav1.ListOptions{})
+// GetServiceAccounts : accepts a context, a clientset and a query and returns a list of ServiceAccounts
+func GetServiceAccounts(ctx context.Context, clientset kubernetes.Interface, query QueryOptions) ([]v1.ServiceAccount, error) {
+	var sa []v1.ServiceAccount
+	err := listQuery(ctx, "serviceaccounts", query, true, func(ns string, opts metav1.ListOptions) (string, error) {
+		list, err := clientset.CoreV1().ServiceAccounts(ns).List(opts)
+		if err != nil {
+			return "", err
+		}
+		sa = append(sa, list.Items...)
+		return list.Continue, nil
+	})
 	if err != nil {
-		log.Fatalln("Failed to get PersistentVolumeClaims:", err)
+		return nil, err
 	}
-	return pvcs.Items
+	return sa, nil
 }
 
-// GetRoles : accepts a clientset and returns a list of Roles
-func GetRoles(clientset *kubernetes.Clientset) []rbacv1.Role {
-	roles, err := clientset.RbacV1().Roles("").List(metav1.ListOptions{})
+// GetEvents : accepts a context, a clientset and a query and returns a list of Events
+func GetEvents(ctx context.Context, clientset kubernetes.Interface, query QueryOptions) ([]v1.Event, error) {
+	var ev []v1.Event
+	err := listQuery(ctx, "events", query, true, func(ns string, opts metav1.ListOptions) (string, error) {
+		list, err := clientset.CoreV1().Events(ns).List(opts)
+		if err != nil {
+			return "", err
+		}
+		ev = append(ev, list.Items...)
+		return list.Continue, nil
+	})
 	if err != nil {
-		log.Fatalln("Failed to get Roles:", err)
+		return nil, err
 	}
-	return roles.Items
+	return ev, nil
 }
 
-// GetRoleBindings : accepts a clientset and returns a list of RoleBindings
-func GetRoleBindings(clientset *kubernetes.Clientset) []rbacv1.RoleBinding {
-	rb, err := clientset.RbacV1().RoleBindings("").List(metav1.ListOptions{})
+// GetEndpoints : accepts a context, a clientset and a query and returns a list of Endpoints
+func GetEndpoints(ctx context.Context, clientset kubernetes.Interface, query QueryOptions) ([]v1.Endpoints, error) {
+	var ep []v1.Endpoints
+	err := listQuery(ctx, "endpoints", query, true, func(ns string, opts metav1.ListOptions) (string, error) {
+		list, err := clientset.CoreV1().Endpoints(ns).List(opts)
+		if err != nil {
+			return "", err
+		}
+		ep = append(ep, list.Items...)
+		return list.Continue, nil
+	})
 	if err != nil {
-		log.Fatalln("Failed to get RoleBindings:", err)
+		return nil, err
 	}
-	return rb.Items
+	return ep, nil
 }
 
-// GetClusterRoles : accepts a clientset and returns a list of ClusterRoles
-func GetClusterRoles(clientset *kubernetes.Clientset) []rbacv1.ClusterRole {
-	cr, err := clientset.RbacV1().ClusterRoles().List(metav1.ListOptions{})
+// FindEndpoints : accepts a context, a clientset and a service name+namespace
+//			returns the Endpoints of the service listed by name in its namespace only, or a NotFoundError
+func FindEndpoints(ctx context.Context, clientset kubernetes.Interface, svcName string, svcNamespace string) (v1.Endpoints, error) {
+	eps, err := GetEndpoints(ctx, clientset, nameQuery(svcName, svcNamespace))
 	if err != nil {
-		log.Fatalln("Failed to get ClusterRoles:", err)
+		return v1.Endpoints{}, err
 	}
-	return cr.Items
+	for _, ep := range eps {
+		if ep.Name == svcName && ep.Namespace == svcNamespace {
+			return ep, nil
+		}
+	}
+	return v1.Endpoints{}, &NotFoundError{Kind: "endpoints", Namespace: svcNamespace, Name: svcName}
+}
+
+// GetServicePods : accepts a context, a clientset and a service
+//			returns the pods of the namespace of the service matched by its selector, none when it has no selector
+func GetServicePods(ctx context.Context, clientset kubernetes.Interface, svc v1.Service) ([]v1.Pod, error) {
+	if len(svc.Spec.Selector) == 0 {
+		return nil, nil
+	}
+	return GetPods(ctx, clientset, QueryOptions{Namespaces: []string{svc.Namespace}, LabelSelector: labels.SelectorFromSet(svc.Spec.Selector).String()})
+}
+
+// GetPersistentVolumes : accepts a context, a clientset and a query and returns a list of PersistentVolumes
+func GetPersistentVolumes(ctx context.Context, clientset kubernetes.Interface, query QueryOptions) ([]v1.PersistentVolume, error) {
+	var pvs []v1.PersistentVolume
+	err := listQuery(ctx, "persistentvolumes", query, false, func(_ string, opts metav1.ListOptions) (string, error) {
+		list, err := clientset.CoreV1().PersistentVolumes().List(opts)
+		if err != nil {
+			return "", err
+		}
+		pvs = append(pvs, list.Items...)
+		return list.Continue, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return pvs, nil
 }
 
-// GetClusterRoleBindings : accepts a clientset and returns a list of ClusterRoleBindings
-func GetClusterRoleBindings(clientset *kubernetes.Clientset) []rbacv1.ClusterRoleBinding {
-	crb, err := clientset.RbacV1().ClusterRoleBindings().List(metav1.ListOptions{})
+// GetPersistentVolumeClaims : accepts a context, a clientset and a query and returns a list of PersistentVolumeClaims
+func GetPersistentVolumeClaims(ctx context.Context, clientset kubernetes.Interface, query QueryOptions) ([]v1.PersistentVolumeClaim, error) {
+	var pvcs []v1.PersistentVolumeClaim
+	err := listQuery(ctx, "persistentvolumeclaims", query, true, func(ns string, opts metav1.ListOptions) (string, error) {
+		list, err := clientset.CoreV1().PersistentVolumeClaims(ns).List(opts)
+		if err != nil {
+			return "", err
+		}
+		pvcs = append(pvcs, list.Items...)
+		return list.Continue, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return pvcs, nil
+}
+
+// GetRoles : accepts a context, a clientset and a query and returns a list of Roles
+func GetRoles(ctx context.Context, clientset kubernetes.Interface, query QueryOptions) ([]rbacv1.Role, error) {
+	var roles []rbacv1.Role
+	err := listQuery(ctx, "roles", query, true, func(ns string, opts metav1.ListOptions) (string, error) {
+		list, err := clientset.RbacV1().Roles(ns).List(opts)
+		if err != nil {
+			return "", err
+		}
+		roles = append(roles, list.Items...)
+		return list.Continue, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return roles, nil
+}
+
+// GetRoleBindings : accepts a context, a clientset and a query and returns a list of RoleBindings
+func GetRoleBindings(ctx context.Context, clientset kubernetes.Interface, query QueryOptions) ([]rbacv1.RoleBinding, error) {
+	var rb []rbacv1.RoleBinding
+	err := listQuery(ctx, "rolebindings", query, true, func(ns string, opts metav1.ListOptions) (string, error) {
+		list, err := clientset.RbacV1().RoleBindings(ns).List(opts)
+		if err != nil {
+			return "", err
+		}
+		rb = append(rb, list.Items...)
+		return list.Continue, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return rb, nil
+}
+
+// GetClusterRoles : accepts a context, a clientset and a query and returns a list of ClusterRoles
+func GetClusterRoles(ctx context.Context, clientset kubernetes.Interface, query QueryOptions) ([]rbacv1.ClusterRole, error) {
+	var cr []rbacv1.ClusterRole
+	err := listQuery(ctx, "clusterroles", query, false, func(_ string, opts metav1.ListOptions) (string, error) {
+		list, err := clientset.RbacV1().ClusterRoles().List(opts)
+		if err != nil {
+			return "", err
+		}
+		cr = append(cr, list.Items...)
+		return list.Continue, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return cr, nil
+}
+
+// GetClusterRoleBindings : accepts a context, a clientset and a query and returns a list of ClusterRoleBindings
+func GetClusterRoleBindings(ctx context.Context, clientset kubernetes.Interface, query QueryOptions) ([]rbacv1.ClusterRoleBinding, error) {
+	var crb []rbacv1.ClusterRoleBinding
+	err := listQuery(ctx, "clusterrolebindings", query, false, func(_ string, opts metav1.ListOptions) (string, error) {
+		list, err := clientset.RbacV1().ClusterRoleBindings().List(opts)
+		if err != nil {
+			return "", err
+		}
+		crb = append(crb, list.Items...)
+		return list.Continue, nil
+	})
 	if err != nil {
-		log.Fatalln("Failed to get ClusterRoleBindings:", err)
+		return nil, err
 	}
-	return crb.Items
+	return crb, nil
 }
 
-// GetServerVersion : accepts a clientset and returns a list of ServerVersion
-func GetServerVersion(clientset *kubernetes.Clientset) string {
-	version, err := clientset.ServerVersion()
+// GetServerVersion : accepts a context and a clientset and returns the server version
+func GetServerVersion(ctx context.Context, clientset kubernetes.Interface) (string, error) {
+	var info *version.Info
+	err := request(ctx, "get server version", func() (err error) {
+		info, err = clientset.Discovery().ServerVersion()
+		return err
+	})
 	if err != nil {
-		log.Fatalln("Failed to get ServerVersion:", err)
+		return "", err
 	}
-	return version.String()
+	return info.String(), nil
 }
@@ -0,0 +1,361 @@
+package backend
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func testPod(name, namespace string, labels map[string]string) *v1.Pod {
+	return &v1.Pod{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace, Labels: labels}}
+}
+
+func podNames(pods []v1.Pod) []string {
+	var names []string
+	for _, p := range pods {
+		names = append(names, p.Namespace+"/"+p.Name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func TestGetPods(t *testing.T) {
+	clientset := fake.NewSimpleClientset(
+		testPod("web-0", "shop", map[string]string{"app": "web"}),
+		testPod("web-1", "shop", map[string]string{"app": "web"}),
+		testPod("db-0", "shop", map[string]string{"app": "db"}),
+		testPod("web-0", "staging", map[string]string{"app": "web"}),
+		testPod("batch", "jobs", nil),
+	)
+
+	tests := []struct {
+		name  string
+		query QueryOptions
+		want  []string
+	}{
+		{"every namespace", QueryOptions{}, []string{"jobs/batch", "shop/db-0", "shop/web-0", "shop/web-1", "staging/web-0"}},
+		{"one namespace", QueryOptions{Namespaces: []string{"shop"}}, []string{"shop/db-0", "shop/web-0", "shop/web-1"}},
+		{"several namespaces", QueryOptions{Namespaces: []string{"jobs", "staging"}}, []string{"jobs/batch", "staging/web-0"}},
+		{"label selector", QueryOptions{LabelSelector: "app=web"}, []string{"shop/web-0", "shop/web-1", "staging/web-0"}},
+		{"label selector in a namespace", QueryOptions{Namespaces: []string{"shop"}, LabelSelector: "app in (db)"}, []string{"shop/db-0"}},
+		{"no match", QueryOptions{Namespaces: []string{"default"}}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pods, err := GetPods(context.Background(), clientset, tt.query)
+			if err != nil {
+				t.Fatalf("GetPods: %v", err)
+			}
+			if got := podNames(pods); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("GetPods = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetPodByName(t *testing.T) {
+	pods := []v1.Pod{*testPod("web-0", "shop", nil), *testPod("web-0", "staging", nil)}
+
+	pod, err := GetPodByName(pods, "web-0", "staging")
+	if err != nil {
+		t.Fatalf("GetPodByName: %v", err)
+	}
+	if pod.Name != "web-0" || pod.Namespace != "staging" {
+		t.Errorf("GetPodByName = %s/%s, want staging/web-0", pod.Namespace, pod.Name)
+	}
+
+	_, err = GetPodByName(pods, "web-1", "shop")
+	var notFound *NotFoundError
+	if !errors.As(err, &notFound) {
+		t.Errorf("GetPodByName = %v, want a NotFoundError", err)
+	}
+}
+
+func TestFindPod(t *testing.T) {
+	clientset := fake.NewSimpleClientset(testPod("web-0", "shop", nil), testPod("web-1", "shop", nil), testPod("web-0", "staging", nil))
+
+	pod, err := FindPod(context.Background(), clientset, "web-0", "staging")
+	if err != nil {
+		t.Fatalf("FindPod: %v", err)
+	}
+	if pod.Name != "web-0" || pod.Namespace != "staging" {
+		t.Errorf("FindPod = %s/%s, want staging/web-0", pod.Namespace, pod.Name)
+	}
+
+	_, err = FindPod(context.Background(), clientset, "web-1", "staging")
+	var notFound *NotFoundError
+	if !errors.As(err, &notFound) {
+		t.Errorf("FindPod = %v, want a NotFoundError", err)
+	}
+}
+
+func TestGetServicePods(t *testing.T) {
+	clientset := fake.NewSimpleClientset(
+		testPod("web-0", "shop", map[string]string{"app": "web", "tier": "front"}),
+		testPod("web-1", "shop", map[string]string{"app": "web"}),
+		testPod("web-0", "staging", map[string]string{"app": "web", "tier": "front"}),
+	)
+
+	tests := []struct {
+		name     string
+		selector map[string]string
+		want     []string
+	}{
+		{"selector", map[string]string{"app": "web"}, []string{"shop/web-0", "shop/web-1"}},
+		{"every label of the selector", map[string]string{"app": "web", "tier": "front"}, []string{"shop/web-0"}},
+		{"no selector", nil, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc := v1.Service{ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "shop"}, Spec: v1.ServiceSpec{Selector: tt.selector}}
+			pods, err := GetServicePods(context.Background(), clientset, svc)
+			if err != nil {
+				t.Fatalf("GetServicePods: %v", err)
+			}
+			if got := podNames(pods); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("GetServicePods = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestListFollowsContinue(t *testing.T) {
+	clientset := fake.NewSimpleClientset()
+	pages := []v1.ServiceList{
+		{ListMeta: metav1.ListMeta{Continue: "page-2"}, Items: []v1.Service{{ObjectMeta: metav1.ObjectMeta{Name: "a", Namespace: "shop"}}}},
+		{ListMeta: metav1.ListMeta{Continue: "page-3"}, Items: []v1.Service{{ObjectMeta: metav1.ObjectMeta{Name: "b", Namespace: "shop"}}}},
+		{Items: []v1.Service{{ObjectMeta: metav1.ObjectMeta{Name: "c", Namespace: "shop"}}}},
+	}
+	calls := 0
+	clientset.PrependReactor("list", "services", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		page := pages[calls]
+		calls++
+		return true, &page, nil
+	})
+
+	svcs, err := GetServices(context.Background(), clientset, QueryOptions{Limit: 1})
+	if err != nil {
+		t.Fatalf("GetServices: %v", err)
+	}
+	if len(svcs) != 3 || calls != 3 {
+		t.Errorf("got %d services in %d requests, want 3 in 3", len(svcs), calls)
+	}
+}
+
+func TestListError(t *testing.T) {
+	clientset := fake.NewSimpleClientset()
+	clientset.PrependReactor("list", "pods", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, errors.New("connection refused")
+	})
+
+	_, err := GetPods(context.Background(), clientset, QueryOptions{})
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.Op != "list pods" {
+		t.Errorf("GetPods = %v, want an APIError of list pods", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := GetPods(ctx, fake.NewSimpleClientset(), QueryOptions{}); !errors.Is(err, context.Canceled) {
+		t.Errorf("GetPods with a canceled context = %v, want %v", err, context.Canceled)
+	}
+}
+
+func TestListPage(t *testing.T) {
+	objects := map[string][]string{
+		"jobs":    {"jobs/batch"},
+		"shop":    {"shop/db-0", "shop/web-0", "shop/web-1"},
+		"staging": {"staging/web-0"},
+	}
+	var listed []string
+	// pages the objects of a namespace like the API server, the continue token is the offset of the next page
+	call := func(ns string, opts metav1.ListOptions) (int, string, error) {
+		items := objects[ns]
+		offset := 0
+		if opts.Continue != "" {
+			offset = int(opts.Continue[0] - '0')
+		}
+		end, next := len(items), ""
+		if opts.Limit > 0 && offset+int(opts.Limit) < len(items) {
+			end = offset + int(opts.Limit)
+			next = string(rune('0' + end))
+		}
+		listed = append(listed, items[offset:end]...)
+		return end - offset, next, nil
+	}
+
+	tests := []struct {
+		name  string
+		query QueryOptions
+		want  [][]string
+	}{
+		{"pages across namespaces", QueryOptions{Namespaces: []string{"jobs", "shop", "staging"}, Limit: 2},
+			[][]string{{"jobs/batch", "shop/db-0"}, {"shop/web-0", "shop/web-1"}, {"staging/web-0"}}},
+		{"page ending with a namespace", QueryOptions{Namespaces: []string{"jobs", "staging"}, Limit: 1},
+			[][]string{{"jobs/batch"}, {"staging/web-0"}}},
+		{"no limit", QueryOptions{Namespaces: []string{"jobs", "shop"}},
+			[][]string{{"jobs/batch", "shop/db-0", "shop/web-0", "shop/web-1"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var pages [][]string
+			token := ""
+			for i := 0; i < 10; i++ {
+				listed = nil
+				next, err := listPage(context.Background(), "pods", tt.query, token, call)
+				if err != nil {
+					t.Fatalf("listPage: %v", err)
+				}
+				pages = append(pages, listed)
+				if token = next; token == "" {
+					break
+				}
+			}
+			if !reflect.DeepEqual(pages, tt.want) {
+				t.Errorf("listPage pages = %v, want %v", pages, tt.want)
+			}
+		})
+	}
+
+	query := QueryOptions{Namespaces: []string{"shop"}, Limit: 1}
+	for _, token := range []string{"not a token", pageToken{Cache: true, Offset: 2}.encode(), pageToken{Namespace: 3}.encode()} {
+		if _, err := listPage(context.Background(), "pods", query, token, call); !errors.Is(err, ErrInvalidContinue) {
+			t.Errorf("listPage(%q) = %v, want %v", token, err, ErrInvalidContinue)
+		}
+	}
+}
+
+const testKubeconfig = `
+apiVersion: v1
+kind: Config
+current-context: prod
+clusters:
+- name: prod
+  cluster:
+    server: https://prod.example.com:6443
+- name: staging
+  cluster:
+    server: https://staging.example.com:6443
+users:
+- name: admin
+  user:
+    token: secret
+contexts:
+- name: prod
+  context:
+    cluster: prod
+    user: admin
+- name: staging
+  context:
+    cluster: staging
+    user: admin
+    namespace: shop
+`
+
+func TestGetConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config")
+	if err := ioutil.WriteFile(path, []byte(testKubeconfig), 0600); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { SetKubeConfigOptions(KubeConfigOptions{}) })
+
+	tests := []struct {
+		name      string
+		opts      KubeConfigOptions
+		env       string
+		host      string
+		namespace string
+		as        string
+		err       string
+	}{
+		{name: "current context", opts: KubeConfigOptions{Kubeconfig: path}, host: "https://prod.example.com:6443", namespace: "default"},
+		{name: "KUBECONFIG", env: path, host: "https://prod.example.com:6443", namespace: "default"},
+		{name: "context", opts: KubeConfigOptions{Kubeconfig: path, Context: "staging"}, host: "https://staging.example.com:6443", namespace: "shop"},
+		{name: "namespace over the one of the context", opts: KubeConfigOptions{Kubeconfig: path, Context: "staging", Namespace: "jobs"}, host: "https://staging.example.com:6443", namespace: "jobs"},
+		{name: "impersonation", opts: KubeConfigOptions{Kubeconfig: path, As: "jane", AsGroups: []string{"devs"}}, host: "https://prod.example.com:6443", namespace: "default", as: "jane"},
+		{name: "unknown context", opts: KubeConfigOptions{Kubeconfig: path, Context: "dev"}, namespace: "default", err: `context "dev" does not exist`},
+		{name: "missing kubeconfig", opts: KubeConfigOptions{Kubeconfig: path + ".missing"}, namespace: "default", err: "no such file or directory"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("KUBECONFIG", tt.env)
+			SetKubeConfigOptions(tt.opts)
+
+			config, err := GetConfig()
+			if ns := GetNamespace(); ns != tt.namespace {
+				t.Errorf("GetNamespace() = %s, want %s", ns, tt.namespace)
+			}
+			if tt.err != "" {
+				var apiErr *APIError
+				if !errors.As(err, &apiErr) || apiErr.Op != "load kubeconfig" || !strings.Contains(err.Error(), tt.err) {
+					t.Errorf("GetConfig() error = %v, want an APIError loading the kubeconfig with %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("GetConfig: %v", err)
+			}
+			if config.Host != tt.host || config.BearerToken != "secret" || config.Impersonate.UserName != tt.as {
+				t.Errorf("GetConfig() = host %s, token %s, impersonating %q, want %s, secret, %q", config.Host, config.BearerToken, config.Impersonate.UserName, tt.host, tt.as)
+			}
+			if !reflect.DeepEqual(config.Impersonate.Groups, tt.opts.AsGroups) {
+				t.Errorf("GetConfig() impersonated groups = %v, want %v", config.Impersonate.Groups, tt.opts.AsGroups)
+			}
+		})
+	}
+}
+
+func TestListRequestTimeout(t *testing.T) {
+	var timeouts []*int64
+	call := func(ns string, opts metav1.ListOptions) (string, error) {
+		timeouts = append(timeouts, opts.TimeoutSeconds)
+		return "", nil
+	}
+
+	if err := listQuery(context.Background(), "pods", QueryOptions{}, true, call); err != nil || timeouts[0] != nil {
+		t.Errorf("listQuery without deadline = %v, timeout %v, want no timeout", err, timeouts[0])
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 90*time.Second)
+	defer cancel()
+	timeouts = nil
+	if err := listQuery(ctx, "pods", QueryOptions{Namespaces: []string{"shop", "jobs"}}, true, call); err != nil || len(timeouts) != 2 {
+		t.Fatalf("listQuery = %v with %d calls, want 2 calls", err, len(timeouts))
+	}
+	for _, timeout := range timeouts {
+		if timeout == nil || *timeout < 89 || *timeout > 90 {
+			t.Errorf("listQuery timeout = %v, want the 90s left before the deadline", timeout)
+		}
+	}
+}
+
+func TestRequestCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	release := make(chan struct{})
+	defer close(release)
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		cancel()
+	}()
+
+	err := request(ctx, "list pods", func() error {
+		<-release
+		return nil
+	})
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || !errors.Is(err, context.Canceled) {
+		t.Errorf("request() = %v, want an APIError of the cancelled context", err)
+	}
+}
@@ -0,0 +1,109 @@
+package backend
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/yaml"
+	"k8s.io/client-go/kubernetes/scheme"
+)
+
+// loadManifests : accepts a list of manifest files or directories and a function receiving the decoded objects,
+//			directories are walked for .yaml, .yml and .json files and lists are expanded into their items
+func loadManifests(paths []string, add func(obj runtime.Object)) error {
+	for _, path := range paths {
+		err := filepath.Walk(path, func(file string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if info.IsDir() {
+				return nil
+			}
+			switch strings.ToLower(filepath.Ext(file)) {
+			case ".yaml", ".yml", ".json":
+			default:
+				if file != path {
+					return nil
+				}
+			}
+			return loadManifest(file, add)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func loadManifest(file string, add func(obj runtime.Object)) error {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return fmt.Errorf("error reading manifest %s: %v", file, err)
+	}
+
+	reader := yaml.NewYAMLReader(bufio.NewReader(bytes.NewReader(data)))
+	for {
+		doc, err := reader.Read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("error reading manifest %s: %v", file, err)
+		}
+		if len(bytes.TrimSpace(doc)) == 0 {
+			continue
+		}
+		obj, _, err := scheme.Codecs.UniversalDeserializer().Decode(doc, nil, nil)
+		if ignoredManifest(err) {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("error decoding manifest %s: %v", file, err)
+		}
+		if err := addManifestObject(obj, add); err != nil {
+			return fmt.Errorf("error decoding manifest %s: %v", file, err)
+		}
+	}
+}
+
+// addManifestObject : passes the object to the function, or each of its items when it is a list
+func addManifestObject(obj runtime.Object, add func(obj runtime.Object)) error {
+	if !meta.IsListType(obj) {
+		add(obj)
+		return nil
+	}
+	items, err := meta.ExtractList(obj)
+	if err != nil {
+		return err
+	}
+	for _, item := range items {
+		if item == nil {
+			continue
+		}
+		if unknown, ok := item.(*runtime.Unknown); ok {
+			if item, _, err = scheme.Codecs.UniversalDeserializer().Decode(unknown.Raw, nil, nil); ignoredManifest(err) {
+				continue
+			} else if err != nil {
+				return err
+			}
+		}
+		if err := addManifestObject(item, add); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ignoredManifest : returns whether the decoding error is the one of a document the snapshots ignore, an object
+//			of a kind the scheme does not know, e.g. a Kustomization or a custom resource, or a document without kind
+func ignoredManifest(err error) bool {
+	return err != nil && (runtime.IsNotRegisteredError(err) || runtime.IsMissingKind(err))
+}
@@ -0,0 +1,132 @@
+package backend
+
+import (
+	"sync"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// MatrixCell : the outcome of probing a port of a target pod from a source pod
+type MatrixCell struct {
+	Source string
+	Target string
+	// Port is the probed port, 0 when the target pod declares none: the probe then connects to port 80, the
+	// default of the HTTP probers, and the cell is compared with the NetworkPolicies as port 80
+	Port      int
+	Connected bool
+	Strategy  ProbeStrategy
+	// Reason is the classified cause of the failure, empty when connected
+	Reason FailureReason `json:",omitempty"`
+	// Policy is the statically computed NetworkPolicy verdict, nil when not compared
+	Policy   *PolicyVerdict
+	Mismatch bool
+}
+
+// Inconclusive : returns true when the probe could not check the connection, e.g. without probing tool
+//			or when the target name could not be resolved, which does not show the policies block it
+func (c MatrixCell) Inconclusive() bool {
+	return c.Reason.inconclusiveFor(ExpectDeny)
+}
+
+// Matrix : the outcome of probing every selected pod against every other selected pod
+type Matrix struct {
+	Pods       []string
+	Cells      []MatrixCell
+	Mismatches int
+}
+
+// MatrixTargetPorts : accepts a pod, a list of ports and a protocol, empty for TCP
+//			returns the ports to probe on the pod: the given ones, else the ports of the protocol declared by
+//			its containers, else 0 to probe without a port
+func MatrixTargetPorts(pod v1.Pod, ports []int, protocol v1.Protocol) []int {
+	if len(ports) > 0 {
+		return ports
+	}
+	var declared []int
+	for _, c := range pod.Spec.Containers {
+		for _, p := range c.Ports {
+			if portProtocol(p.Protocol) == portProtocol(protocol) {
+				declared = append(declared, int(p.ContainerPort))
+			}
+		}
+	}
+	if len(declared) == 0 {
+		return []int{0}
+	}
+	return declared
+}
+
+// ConnectionMatrix : accepts a clientset, a list of pods, a list of ports, the maximum number of concurrent probes
+//			and the connection options
+//			probes every pod port from every other pod and returns the resulting matrix.
+//			When a snapshot is given, every conclusive cell is compared against the NetworkPolicy verdict,
+//			probes without a port are compared as port 80 which is the default of the probing tools.
+func ConnectionMatrix(clientset kubernetes.Interface, pods []v1.Pod, ports []int, parallelism int, opts ConnectionOptions, snapshot *PolicySnapshot) Matrix {
+	var matrix Matrix
+
+	type probe struct {
+		src  v1.Pod
+		dst  v1.Pod
+		port int
+	}
+	var probes []probe
+	for _, src := range pods {
+		matrix.Pods = append(matrix.Pods, src.Namespace+"/"+src.Name)
+		for _, dst := range pods {
+			if src.Namespace == dst.Namespace && src.Name == dst.Name {
+				continue
+			}
+			for _, port := range MatrixTargetPorts(dst, ports, opts.Protocol) {
+				probes = append(probes, probe{src, dst, port})
+			}
+		}
+	}
+
+	opts.Quiet = true
+	if parallelism < 1 {
+		parallelism = 1
+	}
+	matrix.Cells = make([]MatrixCell, len(probes))
+	sem := make(chan struct{}, parallelism)
+	var wg sync.WaitGroup
+	for i, p := range probes {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, p probe) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			result := ConnectionPodToPod(clientset, p.src, p.dst, p.port, opts)
+			matrix.Cells[i] = MatrixCell{
+				Source:    p.src.Namespace + "/" + p.src.Name,
+				Target:    p.dst.Namespace + "/" + p.dst.Name,
+				Port:      p.port,
+				Connected: result.Connected,
+				Strategy:  result.Strategy,
+				Reason:    result.Reason,
+			}
+		}(i, p)
+	}
+	wg.Wait()
+
+	if snapshot != nil {
+		for i, p := range probes {
+			// a probe without a port connects to port 80, the default of the HTTP probers: the only ones
+			// probing without a port
+			policyPort := p.port
+			if policyPort == 0 {
+				policyPort = 80
+			}
+			dst := p.dst
+			verdict := snapshot.SimulateConnection(p.src, PolicyEndpoint{Pod: &dst}, policyPort, portProtocol(opts.Protocol))
+			matrix.Cells[i].Policy = &verdict
+			// an inconclusive probe tells nothing about the CNI, it is not compared
+			if !matrix.Cells[i].Inconclusive() && verdict.Allowed != matrix.Cells[i].Connected {
+				matrix.Cells[i].Mismatch = true
+				matrix.Mismatches++
+			}
+		}
+	}
+
+	return matrix
+}
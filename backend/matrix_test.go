@@ -0,0 +1,159 @@
+package backend
+
+import (
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
+	utilexec "k8s.io/client-go/util/exec"
+)
+
+// fakeExec : replaces the execution of commands in pods with exec for the duration of the test
+func fakeExec(t *testing.T, exec func(pod *v1.Pod, command string) (string, string, error)) {
+	previous := execInPod
+	execInPod = func(clientset kubernetes.Interface, pod *v1.Pod, command []string, stdin io.Reader) (string, string, error) {
+		return exec(pod, strings.Join(command, " "))
+	}
+	t.Cleanup(func() { execInPod = previous })
+}
+
+// exitError : returns the error of a command exited with the code
+func exitError(code int) error {
+	return utilexec.CodeExitError{Err: fmt.Errorf("command terminated with exit code %d", code), Code: code}
+}
+
+// fakeNetwork : fakes the probers connecting from pods to the reachable "<source pod> <target IP> <port>"
+//
+//	connections, the other connections are refused
+func fakeNetwork(t *testing.T, reachable ...string) {
+	fakeExec(t, func(pod *v1.Pod, command string) (string, string, error) {
+		for _, r := range reachable {
+			fields := strings.Fields(r)
+			target := "'" + fields[1] + "'"
+			if len(fields) > 2 {
+				target += " " + fields[2]
+			}
+			if pod.Name == fields[0] && strings.Contains(command, target) {
+				return "", "", nil
+			}
+		}
+		return "", "nc: connect failed: Connection refused", exitError(1)
+	})
+}
+
+func matrixPod(name string, ip string, labels map[string]string, ports ...int32) v1.Pod {
+	pod := *testPod(name, "shop", labels)
+	pod.Status.PodIP = ip
+	container := v1.Container{Name: name}
+	for _, p := range ports {
+		container.Ports = append(container.Ports, v1.ContainerPort{ContainerPort: p})
+	}
+	pod.Spec.Containers = []v1.Container{container}
+	return pod
+}
+
+func TestConnectionMatrix(t *testing.T) {
+	web := matrixPod("web", "10.0.0.1", map[string]string{"app": "web"}, 8080)
+	db := matrixPod("db", "10.0.0.2", map[string]string{"app": "db"}, 5432)
+	batch := matrixPod("batch", "10.0.0.3", map[string]string{"app": "batch"})
+	pending := matrixPod("pending", "", map[string]string{"app": "pending"}, 80)
+	pods := []v1.Pod{web, db, batch}
+
+	// only web may reach db on 5432
+	snapshot := &PolicySnapshot{
+		Pods:       append(pods, pending),
+		Namespaces: []v1.Namespace{{ObjectMeta: metav1.ObjectMeta{Name: "shop"}}},
+		NetworkPolicies: []networkingv1.NetworkPolicy{{
+			ObjectMeta: metav1.ObjectMeta{Name: "db-ingress", Namespace: "shop"},
+			Spec: networkingv1.NetworkPolicySpec{
+				PodSelector: metav1.LabelSelector{MatchLabels: map[string]string{"app": "db"}},
+				Ingress: []networkingv1.NetworkPolicyIngressRule{{
+					From: []networkingv1.NetworkPolicyPeer{{PodSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"app": "web"}}}},
+				}},
+			},
+		}},
+	}
+	// batch reaches db although the policy denies it, batch declares no port and is probed without one, as
+	// port 80 for the policies
+	fakeNetwork(t, "web 10.0.0.2 5432", "batch 10.0.0.2 5432", "db 10.0.0.1 8080", "web 10.0.0.3")
+	opts := ConnectionOptions{Strategy: ProbeStrategyExec, Probers: []string{"nc", "wget"}}
+
+	matrix := ConnectionMatrix(fake.NewSimpleClientset(), append(pods, pending), nil, 4, opts, snapshot)
+
+	var got []string
+	for _, c := range matrix.Cells {
+		cell := fmt.Sprintf("%s->%s:%d connected=%t", c.Source, c.Target, c.Port, c.Connected)
+		if c.Inconclusive() {
+			cell += " inconclusive"
+		}
+		if c.Mismatch {
+			cell += " mismatch"
+		}
+		got = append(got, cell)
+	}
+	want := []string{
+		"shop/web->shop/db:5432 connected=true",
+		"shop/web->shop/batch:0 connected=true",
+		"shop/web->shop/pending:80 connected=false inconclusive",
+		"shop/db->shop/web:8080 connected=true",
+		"shop/db->shop/batch:0 connected=false mismatch",
+		"shop/db->shop/pending:80 connected=false inconclusive",
+		"shop/batch->shop/web:8080 connected=false mismatch",
+		"shop/batch->shop/db:5432 connected=true mismatch",
+		"shop/batch->shop/pending:80 connected=false inconclusive",
+		"shop/pending->shop/web:8080 connected=false mismatch",
+		"shop/pending->shop/db:5432 connected=false",
+		"shop/pending->shop/batch:0 connected=false mismatch",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ConnectionMatrix cells =\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+	if matrix.Mismatches != 5 {
+		t.Errorf("ConnectionMatrix mismatches = %d, want 5", matrix.Mismatches)
+	}
+}
+
+func TestConnectionMatrixParallelism(t *testing.T) {
+	var mu sync.Mutex
+	running, max, probes := 0, 0, 0
+	fakeExec(t, func(pod *v1.Pod, command string) (string, string, error) {
+		mu.Lock()
+		running++
+		probes++
+		if running > max {
+			max = running
+		}
+		mu.Unlock()
+		time.Sleep(20 * time.Millisecond)
+		mu.Lock()
+		running--
+		mu.Unlock()
+		return "", "", nil
+	})
+
+	var pods []v1.Pod
+	for i := 1; i <= 4; i++ {
+		pods = append(pods, matrixPod(fmt.Sprintf("pod-%d", i), fmt.Sprintf("10.0.0.%d", i), nil, 80))
+	}
+	opts := ConnectionOptions{Strategy: ProbeStrategyExec, Probers: []string{"nc"}}
+
+	for _, parallelism := range []int{1, 3} {
+		max, probes = 0, 0
+		matrix := ConnectionMatrix(fake.NewSimpleClientset(), pods, nil, parallelism, opts, nil)
+		if len(matrix.Cells) != 12 || probes != 12 {
+			t.Errorf("parallelism %d: %d cells and %d probes, want 12", parallelism, len(matrix.Cells), probes)
+		}
+		if max != parallelism {
+			t.Errorf("parallelism %d: %d concurrent probes", parallelism, max)
+		}
+	}
+}
@@ -0,0 +1,298 @@
+package backend
+
+import (
+	"context"
+	"net"
+
+	v1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/client-go/kubernetes"
+)
+
+// PolicySnapshot : the Pods, Namespaces and NetworkPolicies a reachability simulation is computed on
+type PolicySnapshot struct {
+	Pods            []v1.Pod
+	Namespaces      []v1.Namespace
+	NetworkPolicies []networkingv1.NetworkPolicy
+}
+
+// PolicyEndpoint : the target of a simulated connection, either a pod or a bare IP address
+type PolicyEndpoint struct {
+	Pod *v1.Pod
+	IP  string
+}
+
+// PolicyDirectionVerdict : the outcome of the egress or ingress side of a simulated connection
+type PolicyDirectionVerdict struct {
+	// Isolated is true when at least one policy selects the pod for this direction
+	Isolated  bool
+	Allowed   bool
+	Policies  []string
+	AllowedBy []string
+}
+
+// PolicyVerdict : the outcome of a simulated connection
+type PolicyVerdict struct {
+	Source   string
+	Target   string
+	Port     int
+	Protocol v1.Protocol
+	// External is true when the target is not a pod, ingress is then not evaluated
+	External bool
+	Egress   PolicyDirectionVerdict
+	Ingress  PolicyDirectionVerdict
+	Allowed  bool
+}
+
+// GetPolicySnapshot : accepts a context and a clientset and returns the Pods, Namespaces and NetworkPolicies of the cluster
+func GetPolicySnapshot(ctx context.Context, clientset kubernetes.Interface) (PolicySnapshot, error) {
+	var snapshot PolicySnapshot
+	var err error
+
+	if snapshot.Pods, err = GetPods(ctx, clientset, QueryOptions{}); err != nil {
+		return snapshot, err
+	}
+	if snapshot.Namespaces, err = GetNamespaces(ctx, clientset, QueryOptions{}); err != nil {
+		return snapshot, err
+	}
+	if snapshot.NetworkPolicies, err = GetNetworkPolicies(ctx, clientset, QueryOptions{}); err != nil {
+		return snapshot, err
+	}
+	return snapshot, nil
+}
+
+// LoadPolicySnapshot : accepts a list of manifest files or directories
+//			returns the Pods, Namespaces and NetworkPolicies they declare, other kinds are ignored
+func LoadPolicySnapshot(paths []string) (PolicySnapshot, error) {
+	var snapshot PolicySnapshot
+	err := loadManifests(paths, snapshot.add)
+	return snapshot, err
+}
+
+func (s *PolicySnapshot) add(obj runtime.Object) {
+	switch o := obj.(type) {
+	case *v1.Pod:
+		if o.Namespace == "" {
+			o.Namespace = "default"
+		}
+		s.Pods = append(s.Pods, *o)
+	case *v1.Namespace:
+		s.Namespaces = append(s.Namespaces, *o)
+	case *networkingv1.NetworkPolicy:
+		if o.Namespace == "" {
+			o.Namespace = "default"
+		}
+		s.NetworkPolicies = append(s.NetworkPolicies, *o)
+	}
+}
+
+// namespaceNameLabel : the label the API server sets on every namespace to its name
+const namespaceNameLabel = "kubernetes.io/metadata.name"
+
+// namespaceLabels : returns the labels of a namespace, only the implicit name label if the namespace is unknown
+func (s PolicySnapshot) namespaceLabels(name string) labels.Set {
+	set := labels.Set{}
+	for _, ns := range s.Namespaces {
+		if ns.Name == name {
+			for k, v := range ns.Labels {
+				set[k] = v
+			}
+		}
+	}
+	if _, ok := set[namespaceNameLabel]; !ok {
+		set[namespaceNameLabel] = name
+	}
+	return set
+}
+
+// SimulateConnection : accepts a source pod, a target endpoint, a port and a protocol
+//			returns whether the NetworkPolicies of the snapshot permit the traffic.
+//			A port of 0 only matches rules that do not restrict ports.
+func (s PolicySnapshot) SimulateConnection(src v1.Pod, dst PolicyEndpoint, port int, protocol v1.Protocol) PolicyVerdict {
+	if protocol == "" {
+		protocol = v1.ProtocolTCP
+	}
+
+	verdict := PolicyVerdict{
+		Source:   "pod " + src.Namespace + "/" + src.Name,
+		Target:   dst.String(),
+		Port:     port,
+		Protocol: protocol,
+		External: dst.Pod == nil,
+		Egress:   PolicyDirectionVerdict{Allowed: true},
+		Ingress:  PolicyDirectionVerdict{Allowed: true},
+	}
+	srcEndpoint := PolicyEndpoint{Pod: &src}
+
+	for _, np := range s.NetworkPolicies {
+		policyName := np.Namespace + "/" + np.Name
+
+		if np.Namespace == src.Namespace && policyHasType(np, networkingv1.PolicyTypeEgress) && selectorMatches(&np.Spec.PodSelector, src.Labels) {
+			verdict.Egress.Policies = append(verdict.Egress.Policies, policyName)
+			for _, rule := range np.Spec.Egress {
+				if s.portsMatch(rule.Ports, port, protocol, dst.Pod) && s.peersMatch(rule.To, np.Namespace, dst) {
+					verdict.Egress.AllowedBy = append(verdict.Egress.AllowedBy, policyName)
+					break
+				}
+			}
+		}
+
+		if dst.Pod != nil && np.Namespace == dst.Pod.Namespace && policyHasType(np, networkingv1.PolicyTypeIngress) && selectorMatches(&np.Spec.PodSelector, dst.Pod.Labels) {
+			verdict.Ingress.Policies = append(verdict.Ingress.Policies, policyName)
+			for _, rule := range np.Spec.Ingress {
+				if s.portsMatch(rule.Ports, port, protocol, dst.Pod) && s.peersMatch(rule.From, np.Namespace, srcEndpoint) {
+					verdict.Ingress.AllowedBy = append(verdict.Ingress.AllowedBy, policyName)
+					break
+				}
+			}
+		}
+	}
+
+	for _, d := range []*PolicyDirectionVerdict{&verdict.Egress, &verdict.Ingress} {
+		d.Isolated = len(d.Policies) > 0
+		d.Allowed = !d.Isolated || len(d.AllowedBy) > 0
+	}
+	verdict.Allowed = verdict.Egress.Allowed && verdict.Ingress.Allowed
+
+	return verdict
+}
+
+// String : returns a human readable name of the endpoint
+func (e PolicyEndpoint) String() string {
+	if e.Pod != nil {
+		return "pod " + e.Pod.Namespace + "/" + e.Pod.Name
+	}
+	return e.IP
+}
+
+func (e PolicyEndpoint) ip() string {
+	if e.Pod != nil {
+		return GetPodIP(*e.Pod)
+	}
+	return e.IP
+}
+
+// policyHasType : returns true if the policy applies to the given direction,
+// policies without policyTypes always apply to ingress and to egress when they declare egress rules
+func policyHasType(np networkingv1.NetworkPolicy, policyType networkingv1.PolicyType) bool {
+	if len(np.Spec.PolicyTypes) == 0 {
+		return policyType == networkingv1.PolicyTypeIngress || len(np.Spec.Egress) > 0
+	}
+	for _, t := range np.Spec.PolicyTypes {
+		if t == policyType {
+			return true
+		}
+	}
+	return false
+}
+
+func selectorMatches(selector *metav1.LabelSelector, set map[string]string) bool {
+	sel, err := metav1.LabelSelectorAsSelector(selector)
+	if err != nil {
+		return false
+	}
+	return sel.Matches(labels.Set(set))
+}
+
+func (s PolicySnapshot) portsMatch(ports []networkingv1.NetworkPolicyPort, port int, protocol v1.Protocol, dst *v1.Pod) bool {
+	if len(ports) == 0 {
+		return true
+	}
+	for _, p := range ports {
+		portProtocol := v1.ProtocolTCP
+		if p.Protocol != nil {
+			portProtocol = *p.Protocol
+		}
+		if portProtocol != protocol {
+			continue
+		}
+		if p.Port == nil {
+			return true
+		}
+		if port == 0 {
+			continue
+		}
+		if p.Port.Type == intstr.Int && p.Port.IntValue() == port {
+			return true
+		}
+		if p.Port.Type == intstr.String && namedPortMatches(dst, p.Port.StrVal, port, protocol) {
+			return true
+		}
+	}
+	return false
+}
+
+// namedPortMatches : returns true if a container of the pod declares the named port with the given number and protocol
+func namedPortMatches(pod *v1.Pod, name string, port int, protocol v1.Protocol) bool {
+	if pod == nil {
+		return false
+	}
+	for _, c := range pod.Spec.Containers {
+		for _, cp := range c.Ports {
+			cpProtocol := cp.Protocol
+			if cpProtocol == "" {
+				cpProtocol = v1.ProtocolTCP
+			}
+			if cp.Name == name && int(cp.ContainerPort) == port && cpProtocol == protocol {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (s PolicySnapshot) peersMatch(peers []networkingv1.NetworkPolicyPeer, policyNamespace string, ep PolicyEndpoint) bool {
+	if len(peers) == 0 {
+		return true
+	}
+	for _, peer := range peers {
+		if s.peerMatches(peer, policyNamespace, ep) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s PolicySnapshot) peerMatches(peer networkingv1.NetworkPolicyPeer, policyNamespace string, ep PolicyEndpoint) bool {
+	if peer.IPBlock != nil {
+		return ipBlockMatches(*peer.IPBlock, ep.ip())
+	}
+	if ep.Pod == nil {
+		return false
+	}
+
+	if peer.NamespaceSelector != nil {
+		if !selectorMatches(peer.NamespaceSelector, s.namespaceLabels(ep.Pod.Namespace)) {
+			return false
+		}
+	} else if ep.Pod.Namespace != policyNamespace {
+		return false
+	}
+
+	if peer.PodSelector != nil {
+		return selectorMatches(peer.PodSelector, ep.Pod.Labels)
+	}
+	return true
+}
+
+func ipBlockMatches(block networkingv1.IPBlock, ip string) bool {
+	addr := net.ParseIP(ip)
+	if addr == nil {
+		return false
+	}
+	_, cidr, err := net.ParseCIDR(block.CIDR)
+	if err != nil || !cidr.Contains(addr) {
+		return false
+	}
+	for _, except := range block.Except {
+		_, exceptCidr, err := net.ParseCIDR(except)
+		if err == nil && exceptCidr.Contains(addr) {
+			return false
+		}
+	}
+	return true
+}
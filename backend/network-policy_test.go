@@ -0,0 +1,176 @@
+package backend
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+const policyManifests = `
+apiVersion: v1
+kind: Namespace
+metadata:
+  name: shop
+  labels:
+    team: shop
+---
+apiVersion: v1
+kind: Pod
+metadata:
+  name: web
+  namespace: shop
+  labels:
+    app: web
+spec:
+  containers:
+  - name: web
+    image: web
+---
+apiVersion: v1
+kind: Pod
+metadata:
+  name: db
+  namespace: shop
+  labels:
+    app: db
+spec:
+  containers:
+  - name: db
+    image: db
+    ports:
+    - name: pg
+      containerPort: 5432
+---
+apiVersion: v1
+kind: Pod
+metadata:
+  name: batch
+  namespace: jobs
+  labels:
+    app: batch
+status:
+  podIP: 10.0.0.7
+spec:
+  containers:
+  - name: batch
+    image: batch
+---
+apiVersion: networking.k8s.io/v1
+kind: NetworkPolicy
+metadata:
+  name: db-ingress
+  namespace: shop
+spec:
+  podSelector:
+    matchLabels:
+      app: db
+  ingress:
+  - from:
+    - podSelector:
+        matchLabels:
+          app: web
+    ports:
+    - port: pg
+  - from:
+    - namespaceSelector:
+        matchLabels:
+          kubernetes.io/metadata.name: jobs
+    ports:
+    - port: 5432
+      protocol: TCP
+---
+apiVersion: networking.k8s.io/v1
+kind: NetworkPolicy
+metadata:
+  name: web-egress
+  namespace: shop
+spec:
+  podSelector:
+    matchLabels:
+      app: web
+  policyTypes:
+  - Egress
+  egress:
+  - to:
+    - podSelector: {}
+  - to:
+    - ipBlock:
+        cidr: 10.0.0.0/8
+        except:
+        - 10.1.0.0/16
+    ports:
+    - port: 53
+      protocol: UDP
+`
+
+const kustomization = `
+apiVersion: kustomize.config.k8s.io/v1beta1
+kind: Kustomization
+resources:
+- manifests.yaml
+`
+
+func loadTestSnapshot(t *testing.T) PolicySnapshot {
+	dir := t.TempDir()
+	for name, content := range map[string]string{"manifests.yaml": policyManifests, "kustomization.yaml": kustomization} {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	snapshot, err := LoadPolicySnapshot([]string{dir})
+	if err != nil {
+		t.Fatalf("LoadPolicySnapshot: %v", err)
+	}
+	return snapshot
+}
+
+func TestLoadPolicySnapshot(t *testing.T) {
+	snapshot := loadTestSnapshot(t)
+	if len(snapshot.Pods) != 3 || len(snapshot.Namespaces) != 1 || len(snapshot.NetworkPolicies) != 2 {
+		t.Errorf("got %d pods, %d namespaces, %d policies, want 3, 1, 2", len(snapshot.Pods), len(snapshot.Namespaces), len(snapshot.NetworkPolicies))
+	}
+}
+
+func TestSimulateConnection(t *testing.T) {
+	snapshot := loadTestSnapshot(t)
+	pod := func(name, namespace string) v1.Pod {
+		p, err := GetPodByName(snapshot.Pods, name, namespace)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return p
+	}
+	web, db, batch := pod("web", "shop"), pod("db", "shop"), pod("batch", "jobs")
+
+	tests := []struct {
+		name     string
+		src      v1.Pod
+		dst      PolicyEndpoint
+		port     int
+		protocol v1.Protocol
+		allowed  bool
+	}{
+		{"named port of an allowed pod", web, PolicyEndpoint{Pod: &db}, 5432, v1.ProtocolTCP, true},
+		{"other port of an allowed pod", web, PolicyEndpoint{Pod: &db}, 6432, v1.ProtocolTCP, false},
+		{"wrong protocol", web, PolicyEndpoint{Pod: &db}, 5432, v1.ProtocolUDP, false},
+		{"namespace without manifest selected by its name label", batch, PolicyEndpoint{Pod: &db}, 5432, "", true},
+		{"pod not selected by the ingress rules", db, PolicyEndpoint{Pod: &db}, 5432, v1.ProtocolTCP, false},
+		{"pod not isolated", db, PolicyEndpoint{Pod: &web}, 80, v1.ProtocolTCP, true},
+		{"egress to a pod of the namespace", web, PolicyEndpoint{Pod: &db}, 5432, v1.ProtocolTCP, true},
+		{"egress to an other namespace", web, PolicyEndpoint{Pod: &batch}, 80, v1.ProtocolTCP, false},
+		{"egress to an allowed ip block", web, PolicyEndpoint{IP: "10.2.3.4"}, 53, v1.ProtocolUDP, true},
+		{"egress to an excepted ip block", web, PolicyEndpoint{IP: "10.1.3.4"}, 53, v1.ProtocolUDP, false},
+		{"egress to an ip outside the block", web, PolicyEndpoint{IP: "192.168.1.1"}, 53, v1.ProtocolUDP, false},
+		{"any port only matches rules without ports", web, PolicyEndpoint{IP: "10.2.3.4"}, 0, v1.ProtocolUDP, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			verdict := snapshot.SimulateConnection(tt.src, tt.dst, tt.port, tt.protocol)
+			if verdict.Allowed != tt.allowed {
+				t.Errorf("allowed = %t, want %t (egress %+v, ingress %+v)", verdict.Allowed, tt.allowed, verdict.Egress, verdict.Ingress)
+			}
+		})
+	}
+}
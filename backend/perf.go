@@ -0,0 +1,497 @@
+package backend
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/client-go/kubernetes"
+)
+
+// DefaultPerfCount : the number of samples of a latency measurement without count nor duration
+const DefaultPerfCount = 10
+
+// perfSampleTimeout : the maximum duration of a latency sample
+const perfSampleTimeout = 5 * time.Second
+
+// throughputTimeout : the maximum duration of the transfer of a throughput test
+const throughputTimeout = 5 * time.Minute
+
+// probeServerPort : the port the probe server of the throughput tests listens on
+const probeServerPort = 8080
+
+// PerfOptions : the repetitions of a latency measurement, or the size of the transfer of a throughput test
+type PerfOptions struct {
+	// Count is the number of samples, default is DefaultPerfCount, ignored when Duration is set
+	Count int
+	// Duration repeats the samples for this duration instead of a number of samples
+	Duration time.Duration
+	// Interval is the pause between two samples
+	Interval time.Duration
+	// Bytes is the size of the transfer of a throughput test, 0 for latency measurements
+	Bytes int64
+}
+
+// LatencyStats : the distribution of the latency of the successful samples
+type LatencyStats struct {
+	Samples int
+	Min     time.Duration
+	Avg     time.Duration
+	P50     time.Duration
+	P95     time.Duration
+	P99     time.Duration
+	Max     time.Duration
+}
+
+// ThroughputResult : the outcome of a transfer from a temporary probe server pod to the source pod
+type ThroughputResult struct {
+	// Server is the namespace/name of the probe server pod, deleted after the test
+	Server  string
+	Node    string
+	Address string
+	Bytes   int64
+	// Duration is the duration of the transfer, BytesPerSecond its average speed
+	Duration       time.Duration
+	BytesPerSecond float64
+	Strategy       ProbeStrategy
+	Reason         FailureReason `json:",omitempty"`
+	Error          string        `json:",omitempty"`
+	Attempts       []ProbeAttempt
+}
+
+// PerfResult : the latency of the connections from a pod to a target, and the throughput of an optional transfer
+type PerfResult struct {
+	Source   string
+	Target   string `json:",omitempty"`
+	Port     int    `json:",omitempty"`
+	Strategy ProbeStrategy
+	Prober   string `json:",omitempty"`
+	// Samples is the number of samples, Failures the number of samples that did not connect
+	Samples  int
+	Failures int
+	// Connect is the latency of the TCP connection, FirstByte the latency of the first byte of the response
+	// of HTTP targets, nil when no sample succeeded
+	Connect   *LatencyStats `json:",omitempty"`
+	FirstByte *LatencyStats `json:",omitempty"`
+	Reason    FailureReason `json:",omitempty"`
+	Error     string        `json:",omitempty"`
+	Attempts  []ProbeAttempt
+	Duration  time.Duration
+	// Throughput is the result of the throughput test, nil when not requested
+	Throughput *ThroughputResult `json:",omitempty"`
+}
+
+// perfSample : a latency sample measured from the pod
+type perfSample struct {
+	connect   time.Duration
+	firstByte time.Duration
+	connected bool
+}
+
+// isHTTPTarget : returns whether the target is an http or https URL, whose first byte latency is measured
+func isHTTPTarget(target ProbeTarget) bool {
+	u, err := url.Parse(target.Address)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
+// maxDuration : returns the maximum duration of the samples or of the transfer
+func (o PerfOptions) maxDuration() time.Duration {
+	switch {
+	case o.Bytes > 0:
+		return throughputTimeout
+	case o.Duration > 0:
+		return o.Duration + perfSampleTimeout
+	}
+	return time.Duration(o.count()) * (o.Interval + perfSampleTimeout)
+}
+
+func (o PerfOptions) count() int {
+	if o.Count <= 0 {
+		return DefaultPerfCount
+	}
+	return o.Count
+}
+
+// probeTimeoutFor : returns the maximum time to wait for the probe of the target, extended by the duration of
+//			the perf measurements
+func probeTimeoutFor(target ProbeTarget) time.Duration {
+	if target.Perf == nil {
+		return probeTimeout
+	}
+	return probeTimeout + target.Perf.maxDuration()
+}
+
+// perfProbeArgs : returns the arguments of the kubensure-probe binary measuring the target
+func perfProbeArgs(target ProbeTarget) []string {
+	perf := target.Perf
+	if perf.Bytes > 0 {
+		return []string{"throughput", target.Address}
+	}
+	args := []string{"-count", strconv.Itoa(perf.count())}
+	if perf.Duration > 0 {
+		args = append(args, "-duration", perf.Duration.String())
+	}
+	if perf.Interval > 0 {
+		args = append(args, "-interval", perf.Interval.String())
+	}
+	if isHTTPTarget(target) {
+		return append(args, "perf", target.Address)
+	}
+	return append(args, "perf", target.Host, strconv.Itoa(target.Port))
+}
+
+// perfProber : measures the latency of the samples and the throughput of the transfers with curl, looping in
+// the shell of the container so that the samples do not include the round trips to the API server
+type perfProber struct{}
+
+func (perfProber) Name() string {
+	return "curl-perf"
+}
+
+func (perfProber) Protocols() []v1.Protocol {
+	return []v1.Protocol{v1.ProtocolTCP}
+}
+
+func (perfProber) RequiredBinaries() []string {
+	return []string{"curl"}
+}
+
+func (perfProber) Command(target ProbeTarget) (string, error) {
+	perf := target.Perf
+	if perf == nil {
+		return "", fmt.Errorf("curl-perf only probes perf measurements")
+	}
+	if perf.Bytes > 0 {
+		return fmt.Sprintf("curl -sf -o /dev/null --max-time %d -w %s %s; echo \" $?\"", int(throughputTimeout.Seconds()),
+			shellQuote(probeMarker+" throughput %{size_download} %{time_total} %{speed_download}"), shellQuote(target.Address)), nil
+	}
+
+	// a target that is not an http URL is connected with the telnet protocol of curl, which waits for the end
+	// of the transfer: the sample is cut after a second, once connected
+	sample := fmt.Sprintf("curl -s -k -o /dev/null --max-time %d -w %s %s", int(perfSampleTimeout.Seconds()),
+		shellQuote(probeMarker+" perf %{time_connect} %{time_starttransfer} %{time_total}"), shellQuote(target.Address))
+	if !isHTTPTarget(target) {
+		if target.Port == 0 {
+			return "", fmt.Errorf("curl-perf requires a port")
+		}
+		sample = fmt.Sprintf("curl -s -o /dev/null --max-time 1 -w %s %s < /dev/null",
+			shellQuote(probeMarker+" perf %{time_connect} %{time_starttransfer} %{time_total}"), shellQuote("telnet://"+net.JoinHostPort(target.Host, strconv.Itoa(target.Port))))
+	}
+	pause := ""
+	if perf.Interval > 0 {
+		pause = fmt.Sprintf("[ $i -gt 0 ] && sleep %g; ", perf.Interval.Seconds())
+	}
+	loop := fmt.Sprintf("i=0; while [ $i -lt %d ]; do ", perf.count())
+	if perf.Duration > 0 {
+		loop = fmt.Sprintf("i=0; end=$(($(date +%%s) + %d)); while [ $(date +%%s) -lt $end ]; do ", int(math.Ceil(perf.Duration.Seconds())))
+	}
+	return loop + pause + sample + "; echo \" $?\"; i=$((i + 1)); done", nil
+}
+
+func (perfProber) Interpret(exitCode int, stdout string, stderr string) error {
+	if exitCode != 0 {
+		return fmt.Errorf("exit code %d%s", exitCode, firstLine(stderr, stdout))
+	}
+	if strings.Contains(stdout, probeMarker+" throughput ") {
+		_, _, err := parseThroughput(stdout)
+		return err
+	}
+	// the kind of target does not matter to tell whether a sample connected
+	for _, s := range parsePerfSamples(stdout, false) {
+		if s.connected {
+			return nil
+		}
+	}
+	return fmt.Errorf("no sample connected%s", firstLine(stderr))
+}
+
+// parsePerfSamples : accepts the output of a latency measurement, a line per sample with the connect, first byte
+//			and total seconds followed by the exit code
+//			returns the samples, those of targets that are not HTTP connected once the connect time is known
+func parsePerfSamples(output string, isHTTP bool) []perfSample {
+	var samples []perfSample
+	for _, line := range strings.Split(output, "\n") {
+		i := strings.Index(line, probeMarker+" perf ")
+		if i < 0 {
+			continue
+		}
+		fields := strings.Fields(line[i+len(probeMarker+" perf "):])
+		if len(fields) < 4 {
+			continue
+		}
+		s := perfSample{connect: parseSeconds(fields[0]), firstByte: parseSeconds(fields[1])}
+		code, _ := strconv.Atoi(fields[3])
+		s.connected = code == 0 || !isHTTP && s.connect > 0
+		samples = append(samples, s)
+	}
+	return samples
+}
+
+// parseThroughput : accepts the output of a throughput test
+//			returns the size and the duration of the transfer
+func parseThroughput(output string) (int64, time.Duration, error) {
+	i := strings.LastIndex(output, probeMarker+" throughput ")
+	if i < 0 {
+		return 0, 0, fmt.Errorf("no transfer%s", firstLine(output))
+	}
+	fields := strings.Fields(output[i+len(probeMarker+" throughput "):])
+	if len(fields) < 4 {
+		return 0, 0, fmt.Errorf("invalid throughput probe output%s", firstLine(output[i:]))
+	}
+	if fields[3] != "0" {
+		return 0, 0, fmt.Errorf("transfer failed with exit code %s", fields[3])
+	}
+	size, _ := strconv.ParseInt(fields[0], 10, 64)
+	return size, parseSeconds(fields[1]), nil
+}
+
+// latencyStats : returns the distribution of the durations, nil when there is none
+func latencyStats(durations []time.Duration) *LatencyStats {
+	if len(durations) == 0 {
+		return nil
+	}
+	sorted := append([]time.Duration(nil), durations...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	var sum time.Duration
+	for _, d := range sorted {
+		sum += d
+	}
+	// nearest-rank percentiles
+	percentile := func(p float64) time.Duration {
+		rank := int(math.Ceil(p / 100 * float64(len(sorted))))
+		if rank < 1 {
+			rank = 1
+		}
+		return sorted[rank-1]
+	}
+	return &LatencyStats{
+		Samples: len(sorted),
+		Min:     sorted[0],
+		Avg:     sum / time.Duration(len(sorted)),
+		P50:     percentile(50),
+		P95:     percentile(95),
+		P99:     percentile(99),
+		Max:     sorted[len(sorted)-1],
+	}
+}
+
+// MeasureLatency : accepts a pod, a target (host name, IP address or URL) and a port
+//				 repeats a connection from the pod to the target and returns the distribution of the connect latency,
+//				 and of the first byte latency for http and https URLs
+func MeasureLatency(clientset kubernetes.Interface, pod v1.Pod, endpoint string, port int, perf PerfOptions, opts ConnectionOptions) PerfResult {
+	start := time.Now()
+	target := newProbeTarget(endpoint, port, v1.ProtocolTCP)
+	target.Perf = &perf
+	result := probeWithStrategy(clientset, pod, target, opts)
+
+	r := PerfResult{
+		Source:   pod.Namespace + "/" + pod.Name,
+		Target:   target.Address,
+		Port:     target.Port,
+		Strategy: result.Strategy,
+		Prober:   result.Prober,
+		Reason:   result.Reason,
+		Error:    result.Error,
+		Attempts: result.Attempts,
+	}
+	if result.Connected {
+		for i := len(result.Attempts) - 1; i >= 0; i-- {
+			if a := result.Attempts[i]; a.Reason == "" && a.Error == "" {
+				isHTTP := isHTTPTarget(target)
+				r.measure(parsePerfSamples(a.Stdout, isHTTP), isHTTP)
+				break
+			}
+		}
+	} else if r.Reason == "" {
+		r.Reason = finalReason(result.Attempts)
+	}
+	r.Duration = time.Since(start)
+	return r
+}
+
+// measure : sets the number of samples and the latency distributions of the samples, the first byte one for
+//			HTTP targets only
+func (r *PerfResult) measure(samples []perfSample, isHTTP bool) {
+	var connect, firstByte []time.Duration
+	for _, s := range samples {
+		r.Samples++
+		if !s.connected {
+			r.Failures++
+			continue
+		}
+		connect = append(connect, s.connect)
+		if isHTTP && s.firstByte > 0 {
+			firstByte = append(firstByte, s.firstByte)
+		}
+	}
+	r.Connect = latencyStats(connect)
+	r.FirstByte = latencyStats(firstByte)
+}
+
+// MeasureThroughput : accepts a pod, the namespace and the node of the probe server, empty for the namespace of
+//				 the pod and any node, and the size of the transfer
+//				 creates a temporary probe server pod, downloads the bytes from the pod and deletes the server
+func MeasureThroughput(clientset kubernetes.Interface, pod v1.Pod, namespace string, node string, bytes int64, opts ConnectionOptions) ThroughputResult {
+	if namespace == "" {
+		namespace = pod.Namespace
+	}
+	image := opts.ProbeImage
+	if image == "" {
+		image = DefaultProbeImage
+	}
+	result := ThroughputResult{Bytes: bytes}
+
+	server, err := startProbeServer(clientset, pod, namespace, node, image)
+	if server.Name != "" {
+		result.Server = server.Namespace + "/" + server.Name
+		defer clientset.CoreV1().Pods(server.Namespace).Delete(server.Name, &metav1.DeleteOptions{})
+	}
+	if err != nil {
+		result.Error = err.Error()
+		result.Reason = classifyFailure(-1, "", err)
+		return result
+	}
+	result.Node = server.Spec.NodeName
+	result.Address = net.JoinHostPort(server.Status.PodIP, strconv.Itoa(probeServerPort))
+
+	target := newProbeTarget(fmt.Sprintf("http://%s/bytes?n=%d", result.Address, bytes), 0, v1.ProtocolTCP)
+	target.Perf = &PerfOptions{Bytes: bytes}
+	probe := probeWithStrategy(clientset, pod, target, opts)
+	result.Strategy = probe.Strategy
+	result.Attempts = probe.Attempts
+	result.Error = probe.Error
+	if !probe.Connected {
+		result.Reason = probe.Reason
+		if result.Reason == "" {
+			result.Reason = finalReason(probe.Attempts)
+		}
+		return result
+	}
+	size, duration, _ := parseThroughput(probe.Attempts[len(probe.Attempts)-1].Stdout)
+	result.Bytes, result.Duration = size, duration
+	if duration > 0 {
+		result.BytesPerSecond = float64(size) / duration.Seconds()
+	}
+	return result
+}
+
+// startProbeServer : creates a pod running the probe server, without labels so that no service routes to it,
+//			and waits for it to be ready
+//			returns the pod, with a name as soon as it is created
+func startProbeServer(clientset kubernetes.Interface, pod v1.Pod, namespace string, node string, image string) (v1.Pod, error) {
+	automount := false
+	server := &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			GenerateName: "kubensure-probe-server-",
+			Namespace:    namespace,
+			Annotations:  map[string]string{"kubensure/probe-server-for": pod.Namespace + "/" + pod.Name},
+		},
+		Spec: v1.PodSpec{
+			NodeName:                     node,
+			RestartPolicy:                v1.RestartPolicyNever,
+			AutomountServiceAccountToken: &automount,
+			Containers: []v1.Container{{
+				Name:            "server",
+				Image:           image,
+				Command:         []string{"/kubensure-probe", "serve", strconv.Itoa(probeServerPort)},
+				ImagePullPolicy: v1.PullIfNotPresent,
+				Ports:           []v1.ContainerPort{{Name: "http", ContainerPort: probeServerPort}},
+				ReadinessProbe: &v1.Probe{
+					Handler:       v1.Handler{HTTPGet: &v1.HTTPGetAction{Path: "/", Port: intstr.FromInt(probeServerPort)}},
+					PeriodSeconds: 1,
+				},
+			}},
+		},
+	}
+
+	created, err := clientset.CoreV1().Pods(namespace).Create(server)
+	if err != nil {
+		return v1.Pod{}, fmt.Errorf("error creating probe server pod: %w", err)
+	}
+	deadline := time.Now().Add(probeTimeout)
+	for time.Now().Before(deadline) {
+		p, err := clientset.CoreV1().Pods(namespace).Get(created.Name, metav1.GetOptions{})
+		if err != nil {
+			return *created, fmt.Errorf("error getting probe server pod %s: %w", created.Name, err)
+		}
+		if p.Status.Phase == v1.PodFailed || p.Status.Phase == v1.PodSucceeded {
+			return *p, fmt.Errorf("probe server pod %s terminated", created.Name)
+		}
+		for _, c := range p.Status.Conditions {
+			if c.Type == v1.PodReady && c.Status == v1.ConditionTrue && p.Status.PodIP != "" {
+				return *p, nil
+			}
+		}
+		time.Sleep(time.Second)
+	}
+	return *created, fmt.Errorf("timeout waiting for probe server pod %s to be ready", created.Name)
+}
+
+// Report : returns the latency measurement and the throughput test as cases
+func (r PerfResult) Report() Report {
+	report := Report{Name: "perf"}
+	if r.Target != "" {
+		passed := r.Samples > 0 && r.Failures == 0
+		message := fmt.Sprintf("%d samples, %d failed, probe strategy %s", r.Samples, r.Failures, r.Strategy)
+		if r.Connect != nil {
+			message += ", connect " + r.Connect.String()
+		}
+		if r.FirstByte != nil {
+			message += ", first byte " + r.FirstByte.String()
+		}
+		if r.Reason != "" {
+			message += ", reason " + string(r.Reason)
+		}
+		report.Cases = append(report.Cases, ReportCase{
+			Name:     r.Source + " -> " + r.Target,
+			Passed:   passed,
+			Message:  message,
+			Details:  attemptsDetails(r.Attempts),
+			Duration: r.Duration,
+			ExitCode: caseExitCode(passed, r.Reason),
+		})
+	}
+	if t := r.Throughput; t != nil {
+		passed := t.BytesPerSecond > 0
+		message := "probe strategy " + string(t.Strategy)
+		if passed {
+			message = fmt.Sprintf("%d bytes in %s, %s, %s", t.Bytes, t.Duration.Round(time.Millisecond), FormatThroughput(t.BytesPerSecond), message)
+		}
+		if t.Reason != "" {
+			message += ", reason " + string(t.Reason)
+		}
+		if t.Error != "" {
+			message += ", " + t.Error
+		}
+		report.Cases = append(report.Cases, ReportCase{
+			Name:     r.Source + " <- " + t.Server + " (throughput)",
+			Passed:   passed,
+			Message:  message,
+			Details:  attemptsDetails(t.Attempts),
+			Duration: t.Duration,
+			ExitCode: caseExitCode(passed, t.Reason),
+		})
+	}
+	return report
+}
+
+// String : returns the distribution as min/avg/p50/p95/p99/max in milliseconds
+func (s LatencyStats) String() string {
+	ms := func(d time.Duration) string {
+		return strconv.FormatFloat(float64(d)/float64(time.Millisecond), 'f', 2, 64)
+	}
+	return fmt.Sprintf("min/avg/p50/p95/p99/max %s/%s/%s/%s/%s/%s ms", ms(s.Min), ms(s.Avg), ms(s.P50), ms(s.P95), ms(s.P99), ms(s.Max))
+}
+
+// FormatThroughput : returns a speed in bytes per second in Mbit/s
+func FormatThroughput(bytesPerSecond float64) string {
+	return strconv.FormatFloat(bytesPerSecond*8/1e6, 'f', 1, 64) + " Mbit/s"
+}
@@ -0,0 +1,39 @@
+package backend
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestLatencyStats(t *testing.T) {
+	ms := func(values ...int) []time.Duration {
+		var durations []time.Duration
+		for _, v := range values {
+			durations = append(durations, time.Duration(v)*time.Millisecond)
+		}
+		return durations
+	}
+	hundred := make([]int, 100)
+	for i := range hundred {
+		hundred[i] = 100 - i
+	}
+
+	tests := []struct {
+		name      string
+		durations []time.Duration
+		want      *LatencyStats
+	}{
+		{"no sample", nil, nil},
+		{"one sample", ms(7), &LatencyStats{Samples: 1, Min: 7 * time.Millisecond, Avg: 7 * time.Millisecond, P50: 7 * time.Millisecond, P95: 7 * time.Millisecond, P99: 7 * time.Millisecond, Max: 7 * time.Millisecond}},
+		{"unsorted samples", ms(30, 10, 20, 40), &LatencyStats{Samples: 4, Min: 10 * time.Millisecond, Avg: 25 * time.Millisecond, P50: 20 * time.Millisecond, P95: 40 * time.Millisecond, P99: 40 * time.Millisecond, Max: 40 * time.Millisecond}},
+		{"nearest rank", ms(hundred...), &LatencyStats{Samples: 100, Min: time.Millisecond, Avg: 50500 * time.Microsecond, P50: 50 * time.Millisecond, P95: 95 * time.Millisecond, P99: 99 * time.Millisecond, Max: 100 * time.Millisecond}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := latencyStats(tt.durations); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("latencyStats = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,444 @@
+package backend
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// ProbeStrategy : the way a connection is probed from the source pod
+type ProbeStrategy string
+
+const (
+	// ProbeStrategyAuto : exec into the pod, fall back to an ephemeral container, then to a probe pod
+	// when none of the probing tools is available in the pod
+	ProbeStrategyAuto ProbeStrategy = "auto"
+	// ProbeStrategyExec : exec the probing tools available in the source container
+	ProbeStrategyExec ProbeStrategy = "exec"
+	// ProbeStrategyEphemeral : run the kubensure probe in an ephemeral container attached to the source pod
+	ProbeStrategyEphemeral ProbeStrategy = "ephemeral"
+	// ProbeStrategyPod : run the kubensure probe in a short-lived pod sharing the node and the NetworkPolicy labels
+	// of the source pod
+	ProbeStrategyPod ProbeStrategy = "pod"
+)
+
+// DefaultProbeImage : the image carrying the static kubensure-probe binary, see probe/Dockerfile
+const DefaultProbeImage = "philranzato/kubensure-probe:latest"
+
+// probeTimeout : the maximum time to wait for a probe container or pod to complete
+const probeTimeout = 60 * time.Second
+
+// ConnectionOptions : tunes how connections are probed
+type ConnectionOptions struct {
+	Strategy   ProbeStrategy
+	ProbeImage string
+	// Probers restricts the exec strategy to the named probers, in this order, default is every registered prober
+	Probers []string
+	// Quiet disables the progress messages printed while probing
+	Quiet bool
+	// Protocol is the protocol of the targets declaring none: pods, external endpoints and ports not declared
+	// by a service, default is TCP. The ports of a service are probed with their own protocol.
+	Protocol v1.Protocol
+	// HTTP makes the TCP checks send an HTTP request and assert its response, nil for plain connection checks
+	HTTP *HTTPCheck
+	// TLS makes the TCP checks perform a TLS handshake verified by the trust store of the pod, nil for plain
+	// connection checks. It is ignored when HTTP is set.
+	TLS *TLSCheck
+}
+
+// ParseProbeStrategy : accepts a strategy string, an empty string defaults to auto
+//			returns the corresponding ProbeStrategy
+func ParseProbeStrategy(s string) (ProbeStrategy, error) {
+	switch ProbeStrategy(s) {
+	case "", ProbeStrategyAuto:
+		return ProbeStrategyAuto, nil
+	case ProbeStrategyExec, ProbeStrategyEphemeral, ProbeStrategyPod:
+		return ProbeStrategy(s), nil
+	}
+	return "", fmt.Errorf("invalid probe strategy '%s': must be one of auto, exec, ephemeral, pod", s)
+}
+
+// ParseProtocol : accepts a protocol string, case insensitive, an empty string is kept empty
+//			returns the corresponding Protocol
+func ParseProtocol(s string) (v1.Protocol, error) {
+	switch protocol := v1.Protocol(strings.ToUpper(s)); protocol {
+	case "", v1.ProtocolTCP, v1.ProtocolUDP, v1.ProtocolSCTP:
+		return protocol, nil
+	}
+	return "", fmt.Errorf("invalid protocol '%s': must be one of tcp, udp, sctp", s)
+}
+
+// probeConnection : probes the target from the pod with the strategy of the options
+func probeConnection(clientset kubernetes.Interface, pod v1.Pod, target ProbeTarget, opts ConnectionOptions) ConnectionResult {
+	start := time.Now()
+	if target.Protocol == v1.ProtocolTCP {
+		target.HTTP = opts.HTTP
+		if opts.HTTP == nil {
+			target.TLS = opts.TLS
+		}
+	}
+	result := probeWithStrategy(clientset, pod, target, opts)
+	evaluateHTTP(&result, target.HTTP)
+	evaluateTLS(&result, target)
+
+	result.Source = pod.Namespace + "/" + pod.Name
+	result.Target = target.Address
+	result.Port = target.Port
+	result.Duration = time.Since(start)
+	if !result.Connected && result.Reason == "" {
+		result.Reason = finalReason(result.Attempts)
+	}
+	return result
+}
+
+func probeWithStrategy(clientset kubernetes.Interface, pod v1.Pod, target ProbeTarget, opts ConnectionOptions) ConnectionResult {
+	strategy := opts.Strategy
+	if strategy == "" {
+		strategy = ProbeStrategyAuto
+	}
+	image := opts.ProbeImage
+	if image == "" {
+		image = DefaultProbeImage
+	}
+	verbose := !opts.Quiet
+	var attempts []ProbeAttempt
+
+	if strategy == ProbeStrategyExec || strategy == ProbeStrategyAuto {
+		result, available := runProbers(clientset, pod, target, opts)
+		if result.Connected || available || strategy == ProbeStrategyExec {
+			return result
+		}
+		if reason := finalReason(result.Attempts); reason == ReasonExecForbidden || reason == ReasonPodNotFound {
+			return result
+		}
+		if verbose {
+			fmt.Println("No probing tool available in the pod, falling back to an ephemeral probe container")
+		}
+		attempts = result.Attempts
+	}
+
+	if strategy == ProbeStrategyEphemeral || strategy == ProbeStrategyAuto {
+		attempt, err := probeWithEphemeralContainer(clientset, pod, target, image)
+		if err == nil || strategy == ProbeStrategyEphemeral {
+			return probeStrategyResult(ProbeStrategyEphemeral, append(attempts, attempt), err, verbose)
+		}
+		if verbose {
+			fmt.Printf("%v, falling back to a probe pod\n", err)
+		}
+		attempts = append(attempts, attempt)
+	}
+
+	attempt, err := probeWithPod(clientset, pod, target, image)
+	return probeStrategyResult(ProbeStrategyPod, append(attempts, attempt), err, verbose)
+}
+
+// probeStrategyResult : returns the result of the ephemeral and pod strategies, whose last attempt is the probe
+func probeStrategyResult(strategy ProbeStrategy, attempts []ProbeAttempt, err error, verbose bool) ConnectionResult {
+	last := attempts[len(attempts)-1]
+	result := ConnectionResult{
+		Connected: err == nil && last.Reason == "",
+		Strategy:  strategy,
+		Attempts:  attempts,
+	}
+	if result.Connected {
+		result.Prober = last.Prober
+	} else {
+		result.Reason = last.Reason
+	}
+	if err != nil {
+		result.Error = err.Error()
+		if verbose {
+			fmt.Println(err)
+		}
+	}
+	return result
+}
+
+// probeCommand : returns the command of the kubensure-probe binary checking the target
+func probeCommand(target ProbeTarget) []string {
+	host, port := target.Host, target.Port
+	check := "connect"
+	switch target.Protocol {
+	case v1.ProtocolUDP:
+		check = "udp"
+	case v1.ProtocolSCTP:
+		check = "sctp"
+	}
+	command := []string{"/kubensure-probe"}
+	if target.Proxy != "" {
+		command = append(command, "-proxy", target.Proxy)
+	}
+	if target.HTTP != nil {
+		if target.HTTP.Method != "" {
+			command = append(command, "-method", target.HTTP.Method)
+		}
+		if target.HTTP.FollowRedirects {
+			command = append(command, "-follow")
+		}
+		if target.HTTP.HTTP2 {
+			command = append(command, "-http2")
+		}
+		return append(command, "http", httpURL(target))
+	}
+	if target.Perf != nil {
+		return append(command, perfProbeArgs(target)...)
+	}
+	if target.TLS != nil {
+		command = append(command, "-server-name", tlsServerName(target))
+		if target.TLS.CAFile != "" {
+			command = append(command, "-ca-file", target.TLS.CAFile)
+		}
+		host, port, _ := net.SplitHostPort(tlsAddress(target))
+		return append(command, "tls", host, port)
+	}
+	command = append(command, check, host)
+	if port != 0 {
+		command = append(command, strconv.Itoa(port))
+	}
+	return command
+}
+
+// probePodPrefix : the prefix of the names of the probe pods and containers, the API server generates the suffix
+// of the pod names
+const probePodPrefix = "kubensure-probe-"
+
+// ephemeralProbeName : returns the first name of an ephemeral probe container not used by the ephemeral containers
+//			of the pod, which cannot be removed from it
+func ephemeralProbeName(existing []v1.EphemeralContainer) string {
+	used := map[string]bool{}
+	for _, c := range existing {
+		used[c.Name] = true
+	}
+	for i := len(existing) + 1; ; i++ {
+		if name := probePodPrefix + strconv.Itoa(i); !used[name] {
+			return name
+		}
+	}
+}
+
+// probeWithEphemeralContainer : attaches an ephemeral container running the probe to the pod
+//			and waits for it to terminate. Ephemeral containers cannot be removed from a pod,
+//			the container terminates as soon as the probe completes.
+func probeWithEphemeralContainer(clientset kubernetes.Interface, pod v1.Pod, target ProbeTarget, image string) (ProbeAttempt, error) {
+	start := time.Now()
+	attempt := ProbeAttempt{Prober: "ephemeral-container", Command: strings.Join(probeCommand(target), " ")}
+
+	current, err := clientset.CoreV1().Pods(pod.Namespace).Get(pod.Name, metav1.GetOptions{})
+	if err != nil {
+		return failedProbeAttempt(attempt, start, fmt.Errorf("error getting pod %s: %w", pod.Name, err))
+	}
+	// the update carries the resource version of the pod, concurrent probes attaching the same name conflict
+	name := ephemeralProbeName(current.Spec.EphemeralContainers)
+
+	ec := v1.EphemeralContainer{
+		EphemeralContainerCommon: v1.EphemeralContainerCommon{
+			Name:                     name,
+			Image:                    image,
+			Command:                  probeCommand(target),
+			ImagePullPolicy:          v1.PullIfNotPresent,
+			TerminationMessagePolicy: v1.TerminationMessageFallbackToLogsOnError,
+		},
+	}
+	if len(current.Spec.Containers) > 0 {
+		ec.TargetContainerName = current.Spec.Containers[0].Name
+	}
+	body := &v1.EphemeralContainers{
+		ObjectMeta:          metav1.ObjectMeta{Name: current.Name, Namespace: current.Namespace, ResourceVersion: current.ResourceVersion},
+		EphemeralContainers: append(current.Spec.EphemeralContainers, ec),
+	}
+
+	err = clientset.CoreV1().RESTClient().Put().
+		Namespace(pod.Namespace).
+		Resource("pods").
+		Name(pod.Name).
+		SubResource("ephemeralcontainers").
+		Body(body).
+		Do().
+		Error()
+	if err != nil {
+		return failedProbeAttempt(attempt, start, fmt.Errorf("error attaching ephemeral container to pod %s: %w", pod.Name, err))
+	}
+
+	deadline := time.Now().Add(probeTimeoutFor(target))
+	for time.Now().Before(deadline) {
+		p, err := clientset.CoreV1().Pods(pod.Namespace).Get(pod.Name, metav1.GetOptions{})
+		if err != nil {
+			return failedProbeAttempt(attempt, start, fmt.Errorf("error getting pod %s: %w", pod.Name, err))
+		}
+		for _, s := range p.Status.EphemeralContainerStatuses {
+			if s.Name == name && s.State.Terminated != nil {
+				return withProbeLogs(clientset, pod, name, terminatedProbeAttempt(attempt, start, s.State.Terminated)), nil
+			}
+		}
+		time.Sleep(time.Second)
+	}
+	return failedProbeAttempt(attempt, start, fmt.Errorf("timeout waiting for ephemeral container %s of pod %s", name, pod.Name))
+}
+
+// failedProbeAttempt : returns the attempt failed with the error, and the error
+func failedProbeAttempt(attempt ProbeAttempt, start time.Time, err error) (ProbeAttempt, error) {
+	attempt.Duration = time.Since(start)
+	attempt.ExitCode = -1
+	attempt.Error = err.Error()
+	attempt.Reason = classifyFailure(-1, "", err)
+	return attempt, err
+}
+
+// terminatedProbeAttempt : returns the attempt completed by the terminated probe container
+func terminatedProbeAttempt(attempt ProbeAttempt, start time.Time, state *v1.ContainerStateTerminated) ProbeAttempt {
+	attempt.Duration = time.Since(start)
+	attempt.Available = true
+	attempt.ExitCode = int(state.ExitCode)
+	attempt.Stdout = state.Message
+	if state.ExitCode != 0 {
+		attempt.Error = fmt.Sprintf("exit code %d%s", state.ExitCode, firstLine(state.Message))
+		attempt.Reason = classifyFailure(attempt.ExitCode, state.Message, nil)
+	}
+	return attempt
+}
+
+// withProbeLogs : returns the attempt with the logs of the terminated probe container as output, the termination
+//			message being limited to 4096 bytes. The message is kept when the logs cannot be read.
+func withProbeLogs(clientset kubernetes.Interface, pod v1.Pod, container string, attempt ProbeAttempt) ProbeAttempt {
+	logs, err := clientset.CoreV1().Pods(pod.Namespace).GetLogs(pod.Name, &v1.PodLogOptions{Container: container}).Do().Raw()
+	if err == nil && len(logs) > 0 {
+		attempt.Stdout = string(logs)
+	}
+	return attempt
+}
+
+// controllerLabels : the labels that controllers add to the selector of the pods they own, not copied to the
+// probe pod so that the ReplicaSet, StatefulSet or Job of the source pod does not adopt it
+var controllerLabels = []string{
+	"pod-template-hash",
+	"controller-revision-hash",
+	"statefulset.kubernetes.io/pod-name",
+	"apps.kubernetes.io/pod-index",
+	"controller-uid",
+	"job-name",
+	"batch.kubernetes.io/controller-uid",
+	"batch.kubernetes.io/job-name",
+}
+
+// probePodLabel : the label marking the probe pods, e.g. to delete the ones left by an interrupted run
+const probePodLabel = "kubensure/probe"
+
+// probeReadinessGate : a readiness gate no controller sets, so that the probe pod never becomes ready and
+// services do not send traffic to it
+const probeReadinessGate = "kubensure/probe"
+
+// probeLabels : returns the labels of the source pod that the NetworkPolicies of its namespace select on, plus the
+//			probe pod label. Fails when the NetworkPolicies cannot be listed, the probe pod would not be subject
+//			to the same policies as the source pod.
+func probeLabels(clientset kubernetes.Interface, pod v1.Pod) (map[string]string, error) {
+	policies, err := GetNetworkPolicies(context.Background(), clientset, QueryOptions{Namespaces: []string{pod.Namespace}})
+	if err != nil {
+		return nil, fmt.Errorf("error reading the NetworkPolicies selecting the probe pod: %w", err)
+	}
+	selected := map[string]bool{}
+	for _, np := range policies {
+		for _, s := range policyPodSelectors(np) {
+			for k := range s.MatchLabels {
+				selected[k] = true
+			}
+			for _, e := range s.MatchExpressions {
+				selected[e.Key] = true
+			}
+		}
+	}
+
+	labels := map[string]string{}
+	for k, v := range pod.Labels {
+		if selected[k] {
+			labels[k] = v
+		}
+	}
+	for _, k := range controllerLabels {
+		delete(labels, k)
+	}
+	labels[probePodLabel] = "true"
+	return labels, nil
+}
+
+// policyPodSelectors : returns the pod selectors of the NetworkPolicy, the one of the policy and those of its peers
+func policyPodSelectors(np networkingv1.NetworkPolicy) []metav1.LabelSelector {
+	selectors := []metav1.LabelSelector{np.Spec.PodSelector}
+	peers := func(peers []networkingv1.NetworkPolicyPeer) {
+		for _, p := range peers {
+			if p.PodSelector != nil {
+				selectors = append(selectors, *p.PodSelector)
+			}
+		}
+	}
+	for _, r := range np.Spec.Ingress {
+		peers(r.From)
+	}
+	for _, r := range np.Spec.Egress {
+		peers(r.To)
+	}
+	return selectors
+}
+
+// probeWithPod : creates a short-lived pod running the probe on the node and with the labels of the source pod
+//			NetworkPolicies select on, so that the same NetworkPolicies apply, waits for it to complete and
+//			deletes it. The pod never becomes ready, so that services do not send traffic to it.
+func probeWithPod(clientset kubernetes.Interface, pod v1.Pod, target ProbeTarget, image string) (ProbeAttempt, error) {
+	start := time.Now()
+	attempt := ProbeAttempt{Prober: "probe-pod", Command: strings.Join(probeCommand(target), " ")}
+	labels, err := probeLabels(clientset, pod)
+	if err != nil {
+		return failedProbeAttempt(attempt, start, err)
+	}
+	automount := false
+	probe := &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			GenerateName: probePodPrefix,
+			Namespace:    pod.Namespace,
+			Labels:       labels,
+			Annotations:  map[string]string{"kubensure/probe-for": pod.Name},
+		},
+		Spec: v1.PodSpec{
+			NodeName:                     pod.Spec.NodeName,
+			ReadinessGates:               []v1.PodReadinessGate{{ConditionType: probeReadinessGate}},
+			RestartPolicy:                v1.RestartPolicyNever,
+			AutomountServiceAccountToken: &automount,
+			Containers: []v1.Container{{
+				Name:            "probe",
+				Image:           image,
+				Command:         probeCommand(target),
+				ImagePullPolicy: v1.PullIfNotPresent,
+				// the probe prints the reason of a failure, surfaced in the termination message
+				TerminationMessagePolicy: v1.TerminationMessageFallbackToLogsOnError,
+			}},
+		},
+	}
+
+	created, err := clientset.CoreV1().Pods(pod.Namespace).Create(probe)
+	if err != nil {
+		return failedProbeAttempt(attempt, start, fmt.Errorf("error creating probe pod: %w", err))
+	}
+	defer clientset.CoreV1().Pods(created.Namespace).Delete(created.Name, &metav1.DeleteOptions{})
+
+	deadline := time.Now().Add(probeTimeoutFor(target))
+	for time.Now().Before(deadline) {
+		p, err := clientset.CoreV1().Pods(created.Namespace).Get(created.Name, metav1.GetOptions{})
+		if err != nil {
+			return failedProbeAttempt(attempt, start, fmt.Errorf("error getting probe pod %s: %w", created.Name, err))
+		}
+		for _, s := range p.Status.ContainerStatuses {
+			if s.State.Terminated != nil {
+				return withProbeLogs(clientset, *created, s.Name, terminatedProbeAttempt(attempt, start, s.State.Terminated)), nil
+			}
+		}
+		time.Sleep(time.Second)
+	}
+	return failedProbeAttempt(attempt, start, fmt.Errorf("timeout waiting for probe pod %s", created.Name))
+}
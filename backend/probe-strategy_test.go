@@ -0,0 +1,86 @@
+package backend
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func TestProbeLabels(t *testing.T) {
+	pod := *testPod("web-0", "shop", map[string]string{
+		"app":               "web",
+		"tier":              "front",
+		"version":           "v2",
+		"pod-template-hash": "5d4f8",
+	})
+	policy := func(name, namespace string, selector metav1.LabelSelector, peers ...metav1.LabelSelector) runtime.Object {
+		np := &networkingv1.NetworkPolicy{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace}, Spec: networkingv1.NetworkPolicySpec{PodSelector: selector}}
+		for i := range peers {
+			np.Spec.Ingress = append(np.Spec.Ingress, networkingv1.NetworkPolicyIngressRule{From: []networkingv1.NetworkPolicyPeer{{PodSelector: &peers[i]}}})
+		}
+		return np
+	}
+
+	tests := []struct {
+		name     string
+		policies []runtime.Object
+		want     map[string]string
+	}{
+		{"no policy", nil, map[string]string{probePodLabel: "true"}},
+		{"policy selector", []runtime.Object{policy("web", "shop", metav1.LabelSelector{MatchLabels: map[string]string{"app": "web"}})},
+			map[string]string{"app": "web", probePodLabel: "true"}},
+		{"peer expression", []runtime.Object{policy("db", "shop", metav1.LabelSelector{}, metav1.LabelSelector{MatchExpressions: []metav1.LabelSelectorRequirement{{Key: "tier", Operator: metav1.LabelSelectorOpExists}}})},
+			map[string]string{"tier": "front", probePodLabel: "true"}},
+		{"policy of another namespace", []runtime.Object{policy("web", "staging", metav1.LabelSelector{MatchLabels: map[string]string{"version": "v2"}})},
+			map[string]string{probePodLabel: "true"}},
+		{"controller label", []runtime.Object{policy("web", "shop", metav1.LabelSelector{MatchLabels: map[string]string{"pod-template-hash": "5d4f8"}})},
+			map[string]string{probePodLabel: "true"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			labels, err := probeLabels(fake.NewSimpleClientset(tt.policies...), pod)
+			if err != nil {
+				t.Fatalf("probeLabels: %v", err)
+			}
+			if !reflect.DeepEqual(labels, tt.want) {
+				t.Errorf("probeLabels = %v, want %v", labels, tt.want)
+			}
+		})
+	}
+
+	clientset := fake.NewSimpleClientset()
+	clientset.PrependReactor("list", "networkpolicies", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, errors.New("connection refused")
+	})
+	if labels, err := probeLabels(clientset, pod); err == nil {
+		t.Errorf("probeLabels without NetworkPolicies = %v, want an error", labels)
+	}
+}
+
+func TestEphemeralProbeName(t *testing.T) {
+	tests := []struct {
+		existing []string
+		want     string
+	}{
+		{nil, "kubensure-probe-1"},
+		{[]string{"debugger"}, "kubensure-probe-2"},
+		{[]string{"kubensure-probe-1"}, "kubensure-probe-2"},
+		{[]string{"kubensure-probe-2", "kubensure-probe-3"}, "kubensure-probe-4"},
+	}
+	for _, tt := range tests {
+		var existing []v1.EphemeralContainer
+		for _, name := range tt.existing {
+			existing = append(existing, v1.EphemeralContainer{EphemeralContainerCommon: v1.EphemeralContainerCommon{Name: name}})
+		}
+		if got := ephemeralProbeName(existing); got != tt.want {
+			t.Errorf("ephemeralProbeName(%v) = %s, want %s", tt.existing, got, tt.want)
+		}
+	}
+}
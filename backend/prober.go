@@ -0,0 +1,292 @@
+package backend
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"text/template"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+// ProbeTarget : the endpoint a prober checks
+type ProbeTarget struct {
+	// Host is the host name or IP address of the endpoint
+	Host string
+	// Port is the port of the endpoint, 0 when unknown
+	Port int
+	// Address is the endpoint as given to URL-aware tools: the URL or the host, with the port when known
+	Address  string
+	Protocol v1.Protocol
+	// HTTP is the HTTP request and assertions of the check, nil for plain connection checks
+	HTTP *HTTPCheck
+	// TLS is the TLS handshake and assertions of the check, nil for plain connection checks
+	TLS *TLSCheck
+	// Proxy is the URL of the HTTP proxy the target is reached through, empty for direct connections
+	Proxy string
+	// Perf repeats the probe to measure its latency or transfers a body to measure the throughput, nil for
+	// connection checks
+	Perf *PerfOptions
+}
+
+// Prober : builds and interprets a command probing a connection from inside a pod
+type Prober interface {
+	// Name : returns the unique name of the prober
+	Name() string
+	// Protocols : returns the protocols the prober can check
+	Protocols() []v1.Protocol
+	// RequiredBinaries : returns the binaries that must be available in the container
+	RequiredBinaries() []string
+	// Command : returns the shell command probing the target, or an error when the target is not supported
+	Command(target ProbeTarget) (string, error)
+	// Interpret : accepts the exit code, stdout and stderr of the command
+	//			returns nil when the connection succeeded, else the reason of the failure
+	Interpret(exitCode int, stdout string, stderr string) error
+}
+
+// ProberSpec : describes a prober running a command template, used by the built-in probers
+// and by the probers declared in the configuration file
+type ProberSpec struct {
+	Name      string        `json:"name" mapstructure:"name"`
+	Protocols []v1.Protocol `json:"protocols,omitempty" mapstructure:"protocols"`
+	Binaries  []string      `json:"binaries,omitempty" mapstructure:"binaries"`
+	// Command is a text/template with the fields of ProbeTarget, e.g. "nc -z -w 2 {{.Host}} {{.Port}}".
+	// Host, Address and Proxy are quoted for sh, they must be used as whole words and not inside quotes.
+	Command string `json:"command" mapstructure:"command"`
+	// PortRequired makes the prober unsupported for targets without port
+	PortRequired bool `json:"portRequired,omitempty" mapstructure:"portRequired"`
+	// Ports restricts the prober to targets on these ports, e.g. application-level probers like DNS queries
+	Ports []int `json:"ports,omitempty" mapstructure:"ports"`
+	// SuccessPattern is an optional regular expression stdout must match for the connection to succeed
+	SuccessPattern string `json:"successPattern,omitempty" mapstructure:"successPattern"`
+}
+
+type commandProber struct {
+	spec    ProberSpec
+	tmpl    *template.Template
+	success *regexp.Regexp
+}
+
+// NewCommandProber : accepts a prober spec
+//			returns a Prober running the command template of the spec
+func NewCommandProber(spec ProberSpec) (Prober, error) {
+	if spec.Name == "" {
+		return nil, fmt.Errorf("prober without name")
+	}
+	if len(spec.Protocols) == 0 {
+		spec.Protocols = []v1.Protocol{v1.ProtocolTCP}
+	}
+	for i, p := range spec.Protocols {
+		spec.Protocols[i] = v1.Protocol(strings.ToUpper(string(p)))
+	}
+	if len(spec.Binaries) == 0 && spec.Command != "" {
+		spec.Binaries = []string{strings.Fields(spec.Command)[0]}
+	}
+
+	tmpl, err := template.New(spec.Name).Option("missingkey=error").Parse(spec.Command)
+	if err != nil {
+		return nil, fmt.Errorf("prober %s: invalid command: %v", spec.Name, err)
+	}
+	p := &commandProber{spec: spec, tmpl: tmpl}
+	if spec.SuccessPattern != "" {
+		if p.success, err = regexp.Compile(spec.SuccessPattern); err != nil {
+			return nil, fmt.Errorf("prober %s: invalid success pattern: %v", spec.Name, err)
+		}
+	}
+	return p, nil
+}
+
+func (p *commandProber) Name() string {
+	return p.spec.Name
+}
+
+func (p *commandProber) Protocols() []v1.Protocol {
+	return p.spec.Protocols
+}
+
+func (p *commandProber) RequiredBinaries() []string {
+	return p.spec.Binaries
+}
+
+func (p *commandProber) Command(target ProbeTarget) (string, error) {
+	if p.spec.PortRequired && target.Port == 0 {
+		return "", fmt.Errorf("%s requires a port", p.spec.Name)
+	}
+	if len(p.spec.Ports) > 0 && !containsPort(p.spec.Ports, target.Port) {
+		return "", fmt.Errorf("%s only probes ports %s", p.spec.Name, strings.Trim(fmt.Sprint(p.spec.Ports), "[]"))
+	}
+	// the target comes from the command line or a suite file and must not be interpreted by the shell
+	quoted := target
+	quoted.Host, quoted.Address = shellQuote(target.Host), shellQuote(target.Address)
+	if target.Proxy != "" {
+		quoted.Proxy = shellQuote(target.Proxy)
+	}
+	var buf bytes.Buffer
+	if err := p.tmpl.Execute(&buf, quoted); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+func (p *commandProber) Interpret(exitCode int, stdout string, stderr string) error {
+	if exitCode != 0 {
+		return fmt.Errorf("exit code %d%s", exitCode, firstLine(stderr, stdout))
+	}
+	if p.success != nil && !p.success.MatchString(stdout) {
+		return fmt.Errorf("output does not match '%s'%s", p.spec.SuccessPattern, firstLine(stdout))
+	}
+	return nil
+}
+
+// shellQuote : returns the string quoted for sh
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// firstLine : returns ": " followed by the first non-empty line of the outputs, or an empty string
+func firstLine(outputs ...string) string {
+	for _, o := range outputs {
+		for _, l := range strings.Split(o, "\n") {
+			if l = strings.TrimSpace(l); l != "" {
+				return ": " + l
+			}
+		}
+	}
+	return ""
+}
+
+func containsPort(ports []int, port int) bool {
+	for _, p := range ports {
+		if p == port {
+			return true
+		}
+	}
+	return false
+}
+
+// builtinProbers : the probers registered by default, tried in this order.
+// UDP has no handshake: the UDP probers only succeed when the target answers, with a DNS response
+// or by echoing the datagram, since a silently dropped datagram cannot be told from an ignored one.
+var builtinProbers = []ProberSpec{
+	{Name: "wget", Command: "wget --spider -q --timeout=5 {{.Address}}"},
+	{Name: "curl", Command: "curl -s -k --max-time 5 -o /dev/null {{.Address}}"},
+	{Name: "nmap", Command: "nmap -p {{.Port}} {{.Host}}", PortRequired: true, SuccessPattern: `\d+/tcp\s+open`},
+	{Name: "nc", Command: "nc -z -v -w 2 {{.Host}} {{.Port}}", PortRequired: true},
+	{Name: "telnet", Command: "echo -n | telnet {{.Host}} {{.Port}}", Binaries: []string{"telnet"}, PortRequired: true, SuccessPattern: "Connected"},
+	{Name: "bash", Command: "timeout 5 bash -c 'echo > /dev/tcp/$0/$1' {{.Host}} {{.Port}}", Binaries: []string{"bash", "timeout"}, PortRequired: true},
+	{Name: "dig", Protocols: []v1.Protocol{v1.ProtocolUDP}, Command: "dig +notcp +time=2 +tries=1 -p {{.Port}} @{{.Host}} kubernetes.default.svc.cluster.local A", Ports: []int{53}, PortRequired: true},
+	{Name: "nc-udp", Protocols: []v1.Protocol{v1.ProtocolUDP}, Command: "echo kubensure | nc -u -w 2 {{.Host}} {{.Port}}", Binaries: []string{"nc"}, PortRequired: true, SuccessPattern: `\S`},
+	{Name: "ncat-sctp", Protocols: []v1.Protocol{v1.ProtocolSCTP}, Command: "ncat --sctp -z -w 2 {{.Host}} {{.Port}}", PortRequired: true},
+	{Name: "socat-sctp", Protocols: []v1.Protocol{v1.ProtocolSCTP}, Command: "socat -T2 /dev/null SCTP-CONNECT:{{.Host}}:{{.Port}},connect-timeout=2", PortRequired: true},
+}
+
+var proberRegistry struct {
+	sync.RWMutex
+	probers []Prober
+}
+
+func init() {
+	for _, spec := range builtinProbers {
+		p, err := NewCommandProber(spec)
+		if err != nil {
+			panic(err)
+		}
+		RegisterProber(p)
+	}
+}
+
+// RegisterProber : accepts a prober and adds it to the registry,
+//			a prober with the same name is replaced in place
+func RegisterProber(p Prober) {
+	proberRegistry.Lock()
+	defer proberRegistry.Unlock()
+
+	for i, registered := range proberRegistry.probers {
+		if registered.Name() == p.Name() {
+			proberRegistry.probers[i] = p
+			return
+		}
+	}
+	proberRegistry.probers = append(proberRegistry.probers, p)
+}
+
+// Probers : returns the registered probers in the order they are tried
+func Probers() []Prober {
+	proberRegistry.RLock()
+	defer proberRegistry.RUnlock()
+
+	return append([]Prober(nil), proberRegistry.probers...)
+}
+
+// selectProbers : returns the registered probers supporting the protocol,
+//			restricted to and ordered by the given names when not empty
+func selectProbers(names []string, protocol v1.Protocol) ([]Prober, error) {
+	registered := Probers()
+
+	var candidates []Prober
+	if len(names) == 0 {
+		candidates = registered
+	} else {
+		for _, name := range names {
+			found := false
+			for _, p := range registered {
+				if p.Name() == name {
+					candidates = append(candidates, p)
+					found = true
+				}
+			}
+			if !found {
+				return nil, fmt.Errorf("unknown prober '%s'", name)
+			}
+		}
+	}
+
+	var selected []Prober
+	for _, p := range candidates {
+		for _, proto := range p.Protocols() {
+			if proto == protocol {
+				selected = append(selected, p)
+				break
+			}
+		}
+	}
+	return selected, nil
+}
+
+// newProbeTarget : accepts an endpoint (host name, IP address or URL), a port and a protocol
+//			returns the corresponding ProbeTarget, the port of a URL defaults to the one of its scheme
+func newProbeTarget(endpoint string, port int, protocol v1.Protocol) ProbeTarget {
+	if protocol == "" {
+		protocol = v1.ProtocolTCP
+	}
+	target := ProbeTarget{Host: endpoint, Port: port, Address: endpoint, Protocol: protocol}
+
+	u, err := url.Parse(endpoint)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		if port != 0 {
+			target.Address = net.JoinHostPort(endpoint, strconv.Itoa(port))
+		}
+		return target
+	}
+
+	target.Host = u.Hostname()
+	if port == 0 {
+		switch {
+		case u.Port() != "":
+			target.Port, _ = strconv.Atoi(u.Port())
+		case u.Scheme == "http":
+			target.Port = 80
+		case u.Scheme == "https":
+			target.Port = 443
+		}
+	} else {
+		u.Host = net.JoinHostPort(target.Host, strconv.Itoa(port))
+		target.Address = u.String()
+	}
+	return target
+}
@@ -0,0 +1,47 @@
+package backend
+
+import (
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+func TestCommandProberQuotesTarget(t *testing.T) {
+	hostile := ProbeTarget{Host: "db;touch /tmp/pwned", Port: 5432, Address: "https://x/?a=1&b=2", Protocol: v1.ProtocolTCP}
+	tests := []struct {
+		name    string
+		command string
+		target  ProbeTarget
+		want    string
+	}{
+		{"wget", "", hostile, "wget --spider -q --timeout=5 'https://x/?a=1&b=2'"},
+		{"nc", "", hostile, "nc -z -v -w 2 'db;touch /tmp/pwned' 5432"},
+		{"bash", "", hostile, "timeout 5 bash -c 'echo > /dev/tcp/$0/$1' 'db;touch /tmp/pwned' 5432"},
+		{"dig", "", ProbeTarget{Host: "db;touch /tmp/pwned", Port: 53, Protocol: v1.ProtocolUDP}, "dig +notcp +time=2 +tries=1 -p 53 @'db;touch /tmp/pwned' kubernetes.default.svc.cluster.local A"},
+		{"custom", "probe {{.Host}} {{.Port}}", ProbeTarget{Host: "it's", Port: 80}, `probe 'it'\''s' 80`},
+		{"proxy", "probe -x {{.Proxy}} {{.Address}}", ProbeTarget{Address: "web", Proxy: "http://u:p@proxy:3128"}, "probe -x 'http://u:p@proxy:3128' 'web'"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			spec := ProberSpec{Name: tt.name, Command: tt.command}
+			if tt.command == "" {
+				for _, builtin := range builtinProbers {
+					if builtin.Name == tt.name {
+						spec = builtin
+					}
+				}
+			}
+			p, err := NewCommandProber(spec)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := p.Command(tt.target)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("Command() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
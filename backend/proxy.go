@@ -0,0 +1,456 @@
+package backend
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// ExpectProxyOnly : the external endpoint is expected to be reachable through the proxy of the pod only,
+// the direct connection being blocked
+const ExpectProxyOnly Expectation = "proxy-only"
+
+const (
+	// VerdictOpenOnlyViaProxy : the endpoint is reachable through the proxy only, as expected
+	VerdictOpenOnlyViaProxy Verdict = "open only via proxy"
+	// VerdictBypassesProxy : the endpoint is reachable directly while it is expected to be reachable through the proxy only
+	VerdictBypassesProxy Verdict = "unexpectedly open bypassing the proxy"
+	// VerdictNoProxy : no proxy of the pod applies to the endpoint expected to be reachable through the proxy only
+	VerdictNoProxy Verdict = "no proxy applies"
+)
+
+// proxyVariables : the proxy environment variables, the upper case name takes precedence as in net/http
+var proxyVariables = [][]string{{"HTTP_PROXY", "http_proxy"}, {"HTTPS_PROXY", "https_proxy"}, {"NO_PROXY", "no_proxy"}}
+
+// ProxyConfig : the HTTP proxy environment of a container
+type ProxyConfig struct {
+	Container  string
+	HTTPProxy  string `json:",omitempty"`
+	HTTPSProxy string `json:",omitempty"`
+	NoProxy    string `json:",omitempty"`
+}
+
+// ExternalConnectionResult : the outcome of a check of an external endpoint probed directly and, when a proxy
+// of the pod applies to it, through the proxy
+type ExternalConnectionResult struct {
+	ProxyConfig ProxyConfig
+	// Proxy is the proxy the pod reaches the endpoint through, empty when none applies or NO_PROXY excludes it
+	Proxy    string `json:",omitempty"`
+	Direct   ConnectionResult
+	ViaProxy *ConnectionResult `json:",omitempty"`
+}
+
+// ExternalConnectionCheck : an external connection result evaluated against its expectation
+type ExternalConnectionCheck struct {
+	ExternalConnectionResult
+	Expect  Expectation
+	Verdict Verdict
+	Passed  bool
+	// Reason is the reason of the failed path, empty when the check passed
+	Reason FailureReason `json:",omitempty"`
+}
+
+// ParseExternalExpectation : accepts an expectation string of an external endpoint, an empty string defaults to allow
+//			returns the corresponding Expectation, proxy-only included
+func ParseExternalExpectation(s string) (Expectation, error) {
+	if Expectation(s) == ExpectProxyOnly {
+		return ExpectProxyOnly, nil
+	}
+	expect, err := ParseExpectation(s)
+	if err != nil {
+		return "", fmt.Errorf("invalid expectation '%s': must be '%s', '%s' or '%s'", s, ExpectAllow, ExpectDeny, ExpectProxyOnly)
+	}
+	return expect, nil
+}
+
+// PodProxyConfig : accepts a context, a clientset and a pod
+//			returns the proxy environment of the first container of the pod, the one the probes are executed in,
+//			resolving the variables set from ConfigMaps and Secrets
+func PodProxyConfig(ctx context.Context, clientset kubernetes.Interface, pod v1.Pod) (ProxyConfig, error) {
+	var config ProxyConfig
+	if len(pod.Spec.Containers) == 0 {
+		return config, nil
+	}
+	container := pod.Spec.Containers[0]
+	config.Container = container.Name
+
+	env := map[string]string{}
+	for _, from := range container.EnvFrom {
+		var data map[string]string
+		switch {
+		case from.ConfigMapRef != nil:
+			cms, err := GetConfigMaps(ctx, clientset, nameQuery(from.ConfigMapRef.Name, pod.Namespace))
+			if err != nil {
+				return config, err
+			}
+			for _, cm := range cms {
+				data = cm.Data
+			}
+		case from.SecretRef != nil:
+			secrets, err := GetSecrets(ctx, clientset, nameQuery(from.SecretRef.Name, pod.Namespace))
+			if err != nil {
+				return config, err
+			}
+			for _, s := range secrets {
+				data = map[string]string{}
+				for k, v := range s.Data {
+					data[k] = string(v)
+				}
+			}
+		}
+		for k, v := range data {
+			env[from.Prefix+k] = v
+		}
+	}
+	for _, e := range container.Env {
+		if !isProxyVariable(e.Name) {
+			continue
+		}
+		value, err := envValue(ctx, clientset, pod.Namespace, e)
+		if err != nil {
+			return config, err
+		}
+		env[e.Name] = value
+	}
+
+	values := make([]string, len(proxyVariables))
+	for i, names := range proxyVariables {
+		for _, name := range names {
+			if v, ok := env[name]; ok && values[i] == "" {
+				values[i] = v
+			}
+		}
+	}
+	config.HTTPProxy, config.HTTPSProxy, config.NoProxy = values[0], values[1], values[2]
+	return config, nil
+}
+
+func isProxyVariable(name string) bool {
+	for _, names := range proxyVariables {
+		for _, n := range names {
+			if n == name {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// envValue : returns the value of an environment variable of a container, read from its ConfigMap or Secret
+func envValue(ctx context.Context, clientset kubernetes.Interface, namespace string, e v1.EnvVar) (string, error) {
+	switch {
+	case e.ValueFrom == nil:
+		return e.Value, nil
+	case e.ValueFrom.ConfigMapKeyRef != nil:
+		ref := e.ValueFrom.ConfigMapKeyRef
+		cms, err := GetConfigMaps(ctx, clientset, nameQuery(ref.Name, namespace))
+		if err != nil {
+			return "", err
+		}
+		for _, cm := range cms {
+			return cm.Data[ref.Key], nil
+		}
+	case e.ValueFrom.SecretKeyRef != nil:
+		ref := e.ValueFrom.SecretKeyRef
+		secrets, err := GetSecrets(ctx, clientset, nameQuery(ref.Name, namespace))
+		if err != nil {
+			return "", err
+		}
+		for _, s := range secrets {
+			return string(s.Data[ref.Key]), nil
+		}
+	}
+	return "", nil
+}
+
+// ProxyFor : accepts a probe target
+//			returns the proxy URL the target is reached through, empty when none applies or NO_PROXY excludes the
+//			target. Plain HTTP targets use HTTP_PROXY, any other port is tunneled through HTTPS_PROXY.
+func (c ProxyConfig) ProxyFor(target ProbeTarget) string {
+	if target.Protocol != "" && target.Protocol != v1.ProtocolTCP {
+		return ""
+	}
+	proxy := c.HTTPSProxy
+	if u, err := url.Parse(target.Address); err == nil && u.Scheme == "http" || target.Port == 80 {
+		proxy = c.HTTPProxy
+	}
+	if proxy == "" || noProxyMatches(c.NoProxy, target.Host, target.Port) {
+		return ""
+	}
+	if !strings.Contains(proxy, "://") {
+		proxy = "http://" + proxy
+	}
+	return proxy
+}
+
+// noProxyMatches : returns whether an entry of the NO_PROXY list matches the host: *, an IP address, a CIDR or a
+//			domain matching itself and its subdomains, optionally followed by a port
+func noProxyMatches(noProxy string, host string, port int) bool {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	ip := net.ParseIP(host)
+	for _, entry := range strings.Split(noProxy, ",") {
+		entry = strings.ToLower(strings.TrimSpace(entry))
+		if entry == "" {
+			continue
+		}
+		if entry == "*" {
+			return true
+		}
+		if h, p, err := net.SplitHostPort(entry); err == nil {
+			if p != strconv.Itoa(port) {
+				continue
+			}
+			entry = h
+		}
+		if _, cidr, err := net.ParseCIDR(entry); err == nil {
+			if ip != nil && cidr.Contains(ip) {
+				return true
+			}
+			continue
+		}
+		if entryIP := net.ParseIP(entry); entryIP != nil {
+			if ip != nil && entryIP.Equal(ip) {
+				return true
+			}
+			continue
+		}
+		entry = strings.TrimPrefix(strings.TrimPrefix(entry, "*"), ".")
+		if host == entry || strings.HasSuffix(host, "."+entry) {
+			return true
+		}
+	}
+	return false
+}
+
+// ConnectionPodToExternalWithProxy : accepts a pod, an external endpoint and the proxy environment of the pod
+//				 probes the endpoint directly, ignoring the proxy environment, and through the proxy that applies to it.
+//				 The passwords of the proxies are masked in the result.
+func ConnectionPodToExternalWithProxy(clientset kubernetes.Interface, pod v1.Pod, url string, urlPort int, config ProxyConfig, opts ConnectionOptions) ExternalConnectionResult {
+	target := newProbeTarget(url, urlPort, opts.Protocol)
+	proxy := config.ProxyFor(target)
+	config.HTTPProxy, config.HTTPSProxy = RedactProxy(config.HTTPProxy), RedactProxy(config.HTTPSProxy)
+	result := ExternalConnectionResult{
+		ProxyConfig: config,
+		Proxy:       RedactProxy(proxy),
+		Direct:      probeConnection(clientset, pod, target, opts),
+	}
+	if proxy != "" {
+		if !opts.Quiet {
+			fmt.Printf("Testing through proxy %s\n", result.Proxy)
+		}
+		target.Proxy = proxy
+		viaProxy := probeConnection(clientset, pod, target, opts)
+		for i := range viaProxy.Attempts {
+			viaProxy.Attempts[i].Command = maskProxyPassword(viaProxy.Attempts[i].Command, proxy)
+		}
+		result.ViaProxy = &viaProxy
+	}
+	return result
+}
+
+// maskProxyPassword : returns the command with the password of the proxy masked
+func maskProxyPassword(command string, proxy string) string {
+	u, err := url.Parse(proxy)
+	if err != nil || u.User == nil {
+		return command
+	}
+	if password, ok := u.User.Password(); ok && password != "" {
+		command = strings.ReplaceAll(command, proxy, RedactProxy(proxy))
+		command = strings.ReplaceAll(command, "pass:"+password, "pass:xxxxx")
+	}
+	return command
+}
+
+// RedactProxy : returns the proxy URL with its password masked
+func RedactProxy(proxy string) string {
+	u, err := url.Parse(proxy)
+	if err != nil || u.User == nil {
+		return proxy
+	}
+	if _, ok := u.User.Password(); ok {
+		u.User = url.UserPassword(u.User.Username(), "xxxxx")
+	}
+	return u.String()
+}
+
+// EvaluateExternalConnection : accepts an external connection result and its expectation
+//			returns the evaluated ExternalConnectionCheck. The pod reaches the endpoint through the proxy when one
+//			applies: allow passes when that path connects, deny when neither path connects and proxy-only when
+//			the proxy connects while the direct connection is blocked.
+func EvaluateExternalConnection(result ExternalConnectionResult, expect Expectation) ExternalConnectionCheck {
+	check := ExternalConnectionCheck{ExternalConnectionResult: result, Expect: expect}
+	direct := EvaluateConnection(result.Direct, ExpectDeny)
+	if expect != ExpectProxyOnly {
+		direct = EvaluateConnection(result.Direct, expect)
+	}
+
+	switch {
+	case expect == ExpectProxyOnly && result.ViaProxy == nil:
+		check.Verdict = VerdictNoProxy
+	case expect == ExpectProxyOnly:
+		via := EvaluateConnection(*result.ViaProxy, ExpectAllow)
+		check.Passed = via.Passed && direct.Passed
+		switch {
+		case direct.Connected:
+			check.Verdict = VerdictBypassesProxy
+		case via.Connected:
+			check.Verdict = VerdictOpenOnlyViaProxy
+		default:
+			check.Verdict = VerdictUnexpectedlyBlocked
+		}
+		if !via.Passed {
+			check.Reason = via.Reason
+		} else if !direct.Passed {
+			check.Reason = direct.Reason
+		}
+	case result.ViaProxy == nil:
+		check.Verdict, check.Passed, check.Reason = direct.Verdict, direct.Passed, direct.Reason
+	case expect == ExpectDeny:
+		via := EvaluateConnection(*result.ViaProxy, ExpectDeny)
+		check.Verdict = EvaluateExpectation(direct.Connected || via.Connected, ExpectDeny)
+		check.Passed = via.Passed && direct.Passed
+		if !via.Passed {
+			check.Reason = via.Reason
+		} else if !direct.Passed {
+			check.Reason = direct.Reason
+		}
+	default:
+		via := EvaluateConnection(*result.ViaProxy, expect)
+		check.Verdict, check.Passed, check.Reason = via.Verdict, via.Passed, via.Reason
+	}
+	if check.Passed {
+		check.Reason = ""
+	}
+	return check
+}
+
+// Connected : returns whether the pod reaches the endpoint, through the proxy when one applies
+func (c ExternalConnectionCheck) Connected() bool {
+	if c.ViaProxy != nil {
+		return c.ViaProxy.Connected
+	}
+	return c.Direct.Connected
+}
+
+// Effective : returns the result of the path the pod reaches the endpoint through, the proxy when one applies
+func (c ExternalConnectionCheck) Effective() ConnectionResult {
+	if c.ViaProxy != nil {
+		return *c.ViaProxy
+	}
+	return c.Direct
+}
+
+// ExitCode : returns the exit code of the check
+func (c ExternalConnectionCheck) ExitCode() int {
+	return caseExitCode(c.Passed, c.Reason)
+}
+
+// Report : returns the check as a single case report
+func (c ExternalConnectionCheck) Report() Report {
+	message := string(c.Verdict) + ", direct: " + connectionMessage(c.Direct, pathState(c.Direct.Connected))
+	details := attemptsDetails(c.Direct.Attempts)
+	duration := c.Direct.Duration
+	if c.ViaProxy != nil {
+		message += "; via proxy " + RedactProxy(c.Proxy) + ": " + connectionMessage(*c.ViaProxy, pathState(c.ViaProxy.Connected))
+		details += "\n" + attemptsDetails(c.ViaProxy.Attempts)
+		duration += c.ViaProxy.Duration
+	}
+	return Report{
+		Name: "connection",
+		Cases: []ReportCase{{
+			Name:     c.Direct.Source + " -> " + c.Direct.Target,
+			Passed:   c.Passed,
+			Message:  message,
+			Details:  details,
+			Duration: duration,
+			ExitCode: c.ExitCode(),
+		}},
+	}
+}
+
+// pathState : returns the state of a single path of a check evaluated as a whole
+func pathState(connected bool) Verdict {
+	if connected {
+		return "open"
+	}
+	return "blocked"
+}
+
+// proxyCodesRe : matches the status codes printed by curl for the CONNECT request and the last response,
+// 000 when there was none. curl is not verbose as it would print the Proxy-Authorization header.
+var proxyCodesRe = regexp.MustCompile(probeMarker + ` proxy (\d{3}) (\d{3})`)
+
+// proxyRefusedStatus : the status codes of the responses a forwarding proxy answers instead of the target,
+// when it denies the request or cannot reach the target
+var proxyRefusedStatus = map[string]bool{"403": true, "407": true, "502": true, "503": true, "504": true}
+
+// proxyProber : probes the connections through a proxy with curl. Plain HTTP targets, http URLs and port 80, are
+// forwarded by the proxy, as most proxies only tunnel the TLS ports: the connection succeeds when the response is
+// not a refusal of the proxy. Any other target is tunneled with a CONNECT request: the connection succeeds once
+// the proxy established the tunnel, whatever the protocol of the target.
+type proxyProber struct{}
+
+func (proxyProber) Name() string {
+	return "curl-proxy"
+}
+
+func (proxyProber) Protocols() []v1.Protocol {
+	return []v1.Protocol{v1.ProtocolTCP}
+}
+
+func (proxyProber) RequiredBinaries() []string {
+	return []string{"curl"}
+}
+
+func (proxyProber) Command(target ProbeTarget) (string, error) {
+	if target.Proxy == "" {
+		return "", fmt.Errorf("curl-proxy only probes connections through a proxy")
+	}
+	address := target.Address
+	forward := false
+	if u, err := url.Parse(address); err != nil || u.Scheme == "" || u.Host == "" {
+		address = "https://" + target.Host
+		if target.Port != 0 {
+			address = "http://" + net.JoinHostPort(target.Host, strconv.Itoa(target.Port))
+		}
+		forward = target.Port == 80
+	} else {
+		forward = u.Scheme == "http"
+	}
+	tunnel := "--proxytunnel "
+	if forward {
+		tunnel = ""
+	}
+	return "curl -sS -k --max-time 5 -o /dev/null " + tunnel + "-x " + shellQuote(target.Proxy) +
+		" -w " + shellQuote(`\n`+probeMarker+` proxy %{http_connect} %{http_code}\n`) + " " + shellQuote(address), nil
+}
+
+func (proxyProber) Interpret(exitCode int, stdout string, stderr string) error {
+	m := proxyCodesRe.FindStringSubmatch(stdout)
+	if m == nil {
+		return fmt.Errorf("exit code %d%s", exitCode, firstLine(stderr, stdout))
+	}
+	connect, status := m[1], m[2]
+	// the target may not speak the protocol of the URL, once the tunnel is established the exit code does not matter
+	if connect == "200" {
+		return nil
+	}
+	if connect != "000" {
+		return fmt.Errorf("exit code %d: proxy answered %s to CONNECT", exitCode, connect)
+	}
+	// a forwarded request: the last response is the one of the target, or the refusal of the proxy
+	if proxyRefusedStatus[status] {
+		return fmt.Errorf("exit code %d: proxy answered %s", exitCode, status)
+	}
+	if status != "000" {
+		return nil
+	}
+	return fmt.Errorf("exit code %d%s", exitCode, firstLine(stderr))
+}
@@ -0,0 +1,183 @@
+package backend
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// QueryOptions : scopes the objects returned by the listers
+type QueryOptions struct {
+	// Namespaces restricts the list to the given namespaces, empty for every namespace.
+	// It is ignored by the listers of cluster-scoped objects.
+	Namespaces    []string
+	LabelSelector string
+	FieldSelector string
+	// Limit is the maximum number of objects returned by a single request, the listers follow the
+	// continue tokens until every object is returned. 0 lists every object in a single request.
+	// It is the size of the page returned by the Page listers.
+	Limit int64
+}
+
+// Validate : returns an error when a selector cannot be parsed or the query is inconsistent
+func (q QueryOptions) Validate() error {
+	if _, err := labels.Parse(q.LabelSelector); err != nil {
+		return fmt.Errorf("invalid label selector '%s': %v", q.LabelSelector, err)
+	}
+	if _, err := fields.ParseSelector(q.FieldSelector); err != nil {
+		return fmt.Errorf("invalid field selector '%s': %v", q.FieldSelector, err)
+	}
+	if q.Limit < 0 {
+		return fmt.Errorf("invalid limit %d: must be positive", q.Limit)
+	}
+	return nil
+}
+
+// listOptions : returns the list options of the first request of the query
+func (q QueryOptions) listOptions() metav1.ListOptions {
+	return metav1.ListOptions{
+		LabelSelector: q.LabelSelector,
+		FieldSelector: q.FieldSelector,
+		Limit:         q.Limit,
+	}
+}
+
+// requestTimeout : sets the timeout of the list request to the time left before the deadline of the context,
+//			so that a request abandoned when the context is done does not outlive the deadline
+func requestTimeout(ctx context.Context, opts *metav1.ListOptions) {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		return
+	}
+	seconds := int64(math.Ceil(time.Until(deadline).Seconds()))
+	if seconds < 1 {
+		seconds = 1
+	}
+	opts.TimeoutSeconds = &seconds
+}
+
+// listQuery : runs the list call for every namespace of the query, or once for cluster-scoped objects,
+//			following the continue tokens returned by the call until the last page
+func listQuery(ctx context.Context, resource string, query QueryOptions, namespaced bool, call func(namespace string, opts metav1.ListOptions) (string, error)) error {
+	namespaces := query.Namespaces
+	if len(namespaces) == 0 || !namespaced {
+		namespaces = []string{metav1.NamespaceAll}
+	}
+
+	for _, ns := range namespaces {
+		opts := query.listOptions()
+		for {
+			var next string
+			requestTimeout(ctx, &opts)
+			err := request(ctx, "list "+resource, func() (err error) {
+				next, err = call(ns, opts)
+				return err
+			})
+			if err != nil {
+				return err
+			}
+			if next == "" {
+				break
+			}
+			opts.Continue = next
+		}
+	}
+	return nil
+}
+
+// pageToken : the position of a page of the objects matching a query, returned to the clients as an opaque
+// continue token. The pages read from the API server resume from a continue token of the API server in a
+// namespace of the query, the pages read from the cache from an offset in its sorted objects.
+type pageToken struct {
+	// Cache is true for the pages read from the cache
+	Cache bool `json:"cache,omitempty"`
+	// Namespace is the index of the namespace of the query the page starts in
+	Namespace int `json:"ns,omitempty"`
+	// Continue is the continue token of the API server in that namespace
+	Continue string `json:"continue,omitempty"`
+	// Offset is the index of the first object of the page in the objects of the cache
+	Offset int `json:"offset,omitempty"`
+}
+
+// encode : returns the opaque continue token of the page
+func (t pageToken) encode() string {
+	b, _ := json.Marshal(t)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// parsePageToken : returns the page of a continue token, the first page for an empty token
+func parsePageToken(token string) (pageToken, error) {
+	var t pageToken
+	if token == "" {
+		return t, nil
+	}
+	b, err := base64.RawURLEncoding.DecodeString(token)
+	if err == nil {
+		err = json.Unmarshal(b, &t)
+	}
+	if err != nil || t.Namespace < 0 || t.Offset < 0 {
+		return t, fmt.Errorf("%w '%s'", ErrInvalidContinue, token)
+	}
+	return t, nil
+}
+
+// CachePageToken : returns true when the continue token is the one of a page read from the cache, the
+//			other tokens must be used with the API server
+func CachePageToken(token string) bool {
+	t, err := parsePageToken(token)
+	return err == nil && t.Cache
+}
+
+// listPage : runs the list call for the namespaces of the query from the page of the token until Limit
+//			objects are listed, returns the continue token of the next page, empty on the last one.
+//			Without a limit, every object is listed. The call returns the number of objects it listed
+//			and the continue token of the API server.
+func listPage(ctx context.Context, resource string, query QueryOptions, token string, call func(namespace string, opts metav1.ListOptions) (int, string, error)) (string, error) {
+	page, err := parsePageToken(token)
+	if err != nil {
+		return "", err
+	}
+	namespaces := query.Namespaces
+	if len(namespaces) == 0 {
+		namespaces = []string{metav1.NamespaceAll}
+	}
+	if page.Cache || page.Namespace >= len(namespaces) {
+		return "", fmt.Errorf("%w '%s': not a page of this query", ErrInvalidContinue, token)
+	}
+	remaining := query.Limit
+	for ns := page.Namespace; ns < len(namespaces); ns++ {
+		opts := query.listOptions()
+		opts.Limit = remaining
+		opts.Continue, page.Continue = page.Continue, ""
+		var count int
+		var next string
+		requestTimeout(ctx, &opts)
+		err := request(ctx, "list "+resource, func() (err error) {
+			count, next, err = call(namespaces[ns], opts)
+			return err
+		})
+		if err != nil {
+			return "", err
+		}
+		if next != "" {
+			return pageToken{Namespace: ns, Continue: next}.encode(), nil
+		}
+		if query.Limit == 0 {
+			continue
+		}
+		if remaining -= int64(count); remaining <= 0 {
+			if ns+1 < len(namespaces) {
+				return pageToken{Namespace: ns + 1}.encode(), nil
+			}
+			break
+		}
+	}
+	return "", nil
+}
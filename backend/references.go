@@ -0,0 +1,353 @@
+package backend
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+
+	appv1 "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+	networkingv1beta1 "k8s.io/api/networking/v1beta1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+// ReferenceRules : the IDs of the rules reporting dangling references and orphaned objects
+var ReferenceRules = []string{"dangling-references", "orphaned-objects"}
+
+// Reference : an object, and optionally a key or a port of it, referenced by another object
+type Reference struct {
+	Kind      string
+	Namespace string
+	Name      string
+	// Key is the referenced key of a ConfigMap or Secret, empty when the whole object is referenced
+	Key string `json:",omitempty"`
+	// Port is the referenced port of a Service, nil when no port is referenced
+	Port *intstr.IntOrString `json:",omitempty"`
+	// Field is where the reference is declared in the referencing object, e.g. volume config
+	Field string
+	// Optional is true when the referencing object tolerates the absence of the referenced one
+	Optional bool `json:",omitempty"`
+}
+
+// DanglingReference : a reference to an object, a key or a port that does not exist
+type DanglingReference struct {
+	Reference
+	// Problem is what is missing, e.g. "missing ConfigMap app-config"
+	Problem string
+}
+
+// References : accepts an object of the snapshot
+//			returns the ConfigMaps, Secrets, ServiceAccounts, PersistentVolumeClaims and Services it references
+func References(obj runtime.Object) []Reference {
+	var refs []Reference
+	switch o := obj.(type) {
+	case *v1.Pod:
+		refs = podSpecReferences(o.Namespace, &o.Spec)
+	case *appv1.Deployment:
+		refs = podSpecReferences(o.Namespace, &o.Spec.Template.Spec)
+	case *appv1.DaemonSet:
+		refs = podSpecReferences(o.Namespace, &o.Spec.Template.Spec)
+	case *appv1.StatefulSet:
+		refs = podSpecReferences(o.Namespace, &o.Spec.Template.Spec)
+	case *networkingv1beta1.Ingress:
+		refs = ingressReferences(o)
+	case *v1.ServiceAccount:
+		for _, s := range o.Secrets {
+			refs = append(refs, Reference{Kind: "Secret", Namespace: o.Namespace, Name: s.Name, Field: "secrets"})
+		}
+		for _, s := range o.ImagePullSecrets {
+			refs = append(refs, Reference{Kind: "Secret", Namespace: o.Namespace, Name: s.Name, Field: "imagePullSecrets"})
+		}
+	}
+	return refs
+}
+
+func podSpecReferences(namespace string, spec *v1.PodSpec) []Reference {
+	var refs []Reference
+	ref := func(kind string, name string, key string, field string, optional *bool) {
+		refs = append(refs, Reference{
+			Kind:      kind,
+			Namespace: namespace,
+			Name:      name,
+			Key:       key,
+			Field:     field,
+			Optional:  optional != nil && *optional,
+		})
+	}
+
+	sa := spec.ServiceAccountName
+	if sa == "" {
+		sa = spec.DeprecatedServiceAccount
+	}
+	if sa != "" {
+		ref("ServiceAccount", sa, "", "serviceAccountName", nil)
+	}
+	for _, s := range spec.ImagePullSecrets {
+		ref("Secret", s.Name, "", "imagePullSecrets", nil)
+	}
+
+	for _, vol := range spec.Volumes {
+		field := "volume " + vol.Name
+		switch {
+		case vol.ConfigMap != nil:
+			ref("ConfigMap", vol.ConfigMap.Name, "", field, vol.ConfigMap.Optional)
+		case vol.Secret != nil:
+			ref("Secret", vol.Secret.SecretName, "", field, vol.Secret.Optional)
+		case vol.PersistentVolumeClaim != nil:
+			ref("PersistentVolumeClaim", vol.PersistentVolumeClaim.ClaimName, "", field, nil)
+		case vol.Projected != nil:
+			for _, src := range vol.Projected.Sources {
+				if src.ConfigMap != nil {
+					ref("ConfigMap", src.ConfigMap.Name, "", field, src.ConfigMap.Optional)
+				}
+				if src.Secret != nil {
+					ref("Secret", src.Secret.Name, "", field, src.Secret.Optional)
+				}
+			}
+		}
+	}
+
+	containers := append(append([]v1.Container(nil), spec.InitContainers...), spec.Containers...)
+	for _, c := range containers {
+		for _, env := range c.EnvFrom {
+			field := "envFrom of container " + c.Name
+			if env.ConfigMapRef != nil {
+				ref("ConfigMap", env.ConfigMapRef.Name, "", field, env.ConfigMapRef.Optional)
+			}
+			if env.SecretRef != nil {
+				ref("Secret", env.SecretRef.Name, "", field, env.SecretRef.Optional)
+			}
+		}
+		for _, env := range c.Env {
+			if env.ValueFrom == nil {
+				continue
+			}
+			field := "env " + env.Name + " of container " + c.Name
+			if k := env.ValueFrom.ConfigMapKeyRef; k != nil {
+				ref("ConfigMap", k.Name, k.Key, field, k.Optional)
+			}
+			if k := env.ValueFrom.SecretKeyRef; k != nil {
+				ref("Secret", k.Name, k.Key, field, k.Optional)
+			}
+		}
+	}
+	return refs
+}
+
+func ingressReferences(ing *networkingv1beta1.Ingress) []Reference {
+	var refs []Reference
+	backend := func(b *networkingv1beta1.IngressBackend, field string) {
+		if b == nil || b.ServiceName == "" {
+			return
+		}
+		ref := Reference{Kind: "Service", Namespace: ing.Namespace, Name: b.ServiceName, Field: field}
+		if b.ServicePort != (intstr.IntOrString{}) {
+			port := b.ServicePort
+			ref.Port = &port
+		}
+		refs = append(refs, ref)
+	}
+
+	backend(ing.Spec.Backend, "spec.backend")
+	for i, rule := range ing.Spec.Rules {
+		if rule.HTTP == nil {
+			continue
+		}
+		for j := range rule.HTTP.Paths {
+			backend(&rule.HTTP.Paths[j].Backend, fmt.Sprintf("spec.rules[%d].http.paths[%d].backend", i, j))
+		}
+	}
+	for i, tls := range ing.Spec.TLS {
+		if tls.SecretName != "" {
+			refs = append(refs, Reference{Kind: "Secret", Namespace: ing.Namespace, Name: tls.SecretName, Field: fmt.Sprintf("spec.tls[%d]", i)})
+		}
+	}
+	return refs
+}
+
+// DanglingReferences : accepts an object of the snapshot
+//			returns its references to objects, keys or ports missing from the snapshot,
+//			optional references and the default ServiceAccount are never dangling
+func (s *ClusterSnapshot) DanglingReferences(obj runtime.Object) []DanglingReference {
+	var dangling []DanglingReference
+	for _, ref := range References(obj) {
+		if ref.Optional {
+			continue
+		}
+		if problem := s.resolve(ref); problem != "" {
+			dangling = append(dangling, DanglingReference{Reference: ref, Problem: problem})
+		}
+	}
+	return dangling
+}
+
+// resolve : returns what the reference misses in the snapshot, empty when it resolves
+func (s *ClusterSnapshot) resolve(ref Reference) string {
+	missing := "missing " + ref.Kind + " " + ref.Name
+	switch ref.Kind {
+	case "ConfigMap":
+		for _, cm := range s.ConfigMaps {
+			if cm.Namespace == ref.Namespace && cm.Name == ref.Name {
+				if ref.Key == "" || hasKey(cm.Data, ref.Key) || hasBinaryKey(cm.BinaryData, ref.Key) {
+					return ""
+				}
+				return "missing key " + ref.Key + " in ConfigMap " + ref.Name
+			}
+		}
+		return missing
+	case "Secret":
+		for _, secret := range s.Secrets {
+			if secret.Namespace == ref.Namespace && secret.Name == ref.Name {
+				if ref.Key == "" || hasBinaryKey(secret.Data, ref.Key) || hasKey(secret.StringData, ref.Key) {
+					return ""
+				}
+				return "missing key " + ref.Key + " in Secret " + ref.Name
+			}
+		}
+		return missing
+	case "ServiceAccount":
+		if ref.Name == "default" {
+			return ""
+		}
+		for _, sa := range s.ServiceAccounts {
+			if sa.Namespace == ref.Namespace && sa.Name == ref.Name {
+				return ""
+			}
+		}
+		return missing
+	case "PersistentVolumeClaim":
+		for _, pvc := range s.PersistentVolumeClaims {
+			if pvc.Namespace == ref.Namespace && pvc.Name == ref.Name {
+				return ""
+			}
+		}
+		return missing
+	case "Service":
+		for _, svc := range s.Services {
+			if svc.Namespace == ref.Namespace && svc.Name == ref.Name {
+				if ref.Port == nil || servicePortExists(svc, *ref.Port) {
+					return ""
+				}
+				return "missing port " + ref.Port.String() + " in Service " + ref.Name
+			}
+		}
+		return missing
+	}
+	return ""
+}
+
+func hasKey(data map[string]string, key string) bool {
+	_, ok := data[key]
+	return ok
+}
+
+func hasBinaryKey(data map[string][]byte, key string) bool {
+	_, ok := data[key]
+	return ok
+}
+
+// servicePortExists : returns true if the service exposes the port, by number or by name
+func servicePortExists(svc v1.Service, port intstr.IntOrString) bool {
+	for _, p := range svc.Spec.Ports {
+		if port.Type == intstr.Int && p.Port == port.IntVal || port.Type == intstr.String && p.Name == port.StrVal {
+			return true
+		}
+	}
+	return false
+}
+
+// referenceKey : returns the key of an object in the reference index
+func referenceKey(kind string, namespace string, name string) string {
+	return kind + "/" + namespace + "/" + name
+}
+
+// isReferenced : returns true if an object of the snapshot, pods managed by a controller included,
+//			references the object of the given kind, namespace and name
+func (s *ClusterSnapshot) isReferenced(kind string, namespace string, name string) bool {
+	if s.referenced == nil {
+		s.referenced = map[string]bool{}
+		index := func(obj runtime.Object) {
+			for _, ref := range References(obj) {
+				s.referenced[referenceKey(ref.Kind, ref.Namespace, ref.Name)] = true
+			}
+		}
+		for i := range s.Pods {
+			index(&s.Pods[i])
+		}
+		for _, obj := range s.objects() {
+			index(obj)
+		}
+	}
+	return s.referenced[referenceKey(kind, namespace, name)]
+}
+
+// claimTemplatePVC : returns true if the PersistentVolumeClaim was created from the volumeClaimTemplates
+//			of a StatefulSet of the snapshot, it is then named <template>-<statefulset>-<ordinal>
+func (s *ClusterSnapshot) claimTemplatePVC(pvc v1.PersistentVolumeClaim) bool {
+	for _, sts := range s.StatefulSets {
+		if sts.Namespace != pvc.Namespace {
+			continue
+		}
+		for _, tmpl := range sts.Spec.VolumeClaimTemplates {
+			prefix := tmpl.Name + "-" + sts.Name + "-"
+			if len(pvc.Name) > len(prefix) && pvc.Name[:len(prefix)] == prefix {
+				if _, err := strconv.Atoi(pvc.Name[len(prefix):]); err == nil {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// unreferencedSecretTypes : the types of the Secrets consumed by Kubernetes or by tools rather than by workloads
+var unreferencedSecretTypes = regexp.MustCompile(`^(kubernetes\.io/service-account-token|bootstrap\.kubernetes\.io/token|helm\.sh/release\.v\d+)$`)
+
+// orphaned : returns true if nothing of the snapshot references the ConfigMap, Secret or PersistentVolumeClaim,
+//			the objects managed by Kubernetes itself are never orphaned
+func (s *ClusterSnapshot) orphaned(obj runtime.Object) bool {
+	switch o := obj.(type) {
+	case *v1.ConfigMap:
+		if o.Name == "kube-root-ca.crt" {
+			return false
+		}
+		return !s.isReferenced("ConfigMap", o.Namespace, o.Name)
+	case *v1.Secret:
+		if unreferencedSecretTypes.MatchString(string(o.Type)) {
+			return false
+		}
+		return !s.isReferenced("Secret", o.Namespace, o.Name)
+	case *v1.PersistentVolumeClaim:
+		return !s.isReferenced("PersistentVolumeClaim", o.Namespace, o.Name) && !s.claimTemplatePVC(*o)
+	}
+	return false
+}
+
+func init() {
+	RegisterRule(&funcRule{
+		id:          "dangling-references",
+		description: "workloads and ingresses only reference existing ConfigMaps, Secrets, ServiceAccounts, PersistentVolumeClaims, Services and ports",
+		severity:    SeverityError,
+		kinds:       []string{"Pod", "Deployment", "DaemonSet", "StatefulSet", "Ingress"},
+		evaluate: func(obj runtime.Object, snapshot *ClusterSnapshot) []Finding {
+			var findings []Finding
+			for _, d := range snapshot.DanglingReferences(obj) {
+				findings = append(findings, Finding{Message: d.Field + " references " + d.Problem})
+			}
+			return findings
+		},
+	})
+	RegisterRule(&funcRule{
+		id:          "orphaned-objects",
+		description: "ConfigMaps, Secrets and PersistentVolumeClaims are referenced by a workload, a pod, an ingress or a service account",
+		severity:    SeverityInfo,
+		kinds:       []string{"ConfigMap", "Secret", "PersistentVolumeClaim"},
+		evaluate: func(obj runtime.Object, snapshot *ClusterSnapshot) []Finding {
+			if !snapshot.orphaned(obj) {
+				return nil
+			}
+			return []Finding{{Message: "is not referenced by any workload, pod, ingress or service account"}}
+		},
+	})
+}
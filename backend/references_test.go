@@ -0,0 +1,242 @@
+package backend
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	appv1 "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+	networkingv1beta1 "k8s.io/api/networking/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+func shopMeta(name string) metav1.ObjectMeta {
+	return metav1.ObjectMeta{Name: name, Namespace: "shop"}
+}
+
+// referenceSnapshot : returns a snapshot of the shop namespace with the objects the references resolve to
+func referenceSnapshot() *ClusterSnapshot {
+	return &ClusterSnapshot{
+		ConfigMaps: []v1.ConfigMap{
+			{ObjectMeta: shopMeta("app-config"), Data: map[string]string{"level": "debug"}, BinaryData: map[string][]byte{"logo.png": nil}},
+		},
+		Secrets: []v1.Secret{
+			{ObjectMeta: shopMeta("db"), Data: map[string][]byte{"password": nil}, StringData: map[string]string{"user": "shop"}},
+			{ObjectMeta: shopMeta("web-tls"), Type: v1.SecretTypeTLS},
+		},
+		ServiceAccounts:        []v1.ServiceAccount{{ObjectMeta: shopMeta("api")}},
+		PersistentVolumeClaims: []v1.PersistentVolumeClaim{{ObjectMeta: shopMeta("data")}},
+		Services: []v1.Service{
+			{ObjectMeta: shopMeta("web"), Spec: v1.ServiceSpec{Ports: []v1.ServicePort{{Name: "http", Port: 80}}}},
+		},
+	}
+}
+
+func referencingPod(spec v1.PodSpec) *v1.Pod {
+	if len(spec.Containers) == 0 {
+		spec.Containers = []v1.Container{{Name: "app"}}
+	}
+	return &v1.Pod{ObjectMeta: shopMeta("app"), Spec: spec}
+}
+
+func envFrom(name string, key string, secret bool) v1.EnvVar {
+	env := v1.EnvVar{Name: strings.ToUpper(key), ValueFrom: &v1.EnvVarSource{}}
+	if secret {
+		env.ValueFrom.SecretKeyRef = &v1.SecretKeySelector{LocalObjectReference: v1.LocalObjectReference{Name: name}, Key: key}
+	} else {
+		env.ValueFrom.ConfigMapKeyRef = &v1.ConfigMapKeySelector{LocalObjectReference: v1.LocalObjectReference{Name: name}, Key: key}
+	}
+	return env
+}
+
+func ingressBackend(service string, port intstr.IntOrString) *networkingv1beta1.IngressBackend {
+	return &networkingv1beta1.IngressBackend{ServiceName: service, ServicePort: port}
+}
+
+func TestDanglingReferences(t *testing.T) {
+	optional := true
+
+	tests := []struct {
+		name string
+		obj  runtime.Object
+		want []string
+	}{
+		{
+			name: "resolving references",
+			obj: referencingPod(v1.PodSpec{
+				ServiceAccountName: "api",
+				Volumes: []v1.Volume{
+					{Name: "config", VolumeSource: v1.VolumeSource{ConfigMap: &v1.ConfigMapVolumeSource{LocalObjectReference: v1.LocalObjectReference{Name: "app-config"}}}},
+					{Name: "data", VolumeSource: v1.VolumeSource{PersistentVolumeClaim: &v1.PersistentVolumeClaimVolumeSource{ClaimName: "data"}}},
+				},
+				Containers: []v1.Container{{
+					Name: "app",
+					Env:  []v1.EnvVar{envFrom("app-config", "level", false), envFrom("app-config", "logo.png", false), envFrom("db", "password", true), envFrom("db", "user", true)},
+				}},
+			}),
+		},
+		{
+			name: "default service account",
+			obj:  referencingPod(v1.PodSpec{ServiceAccountName: "default"}),
+		},
+		{
+			name: "missing service account",
+			obj:  referencingPod(v1.PodSpec{ServiceAccountName: "web"}),
+			want: []string{"serviceAccountName references missing ServiceAccount web"},
+		},
+		{
+			name: "missing deprecated service account",
+			obj:  referencingPod(v1.PodSpec{DeprecatedServiceAccount: "web"}),
+			want: []string{"serviceAccountName references missing ServiceAccount web"},
+		},
+		{
+			name: "missing volumes",
+			obj: referencingPod(v1.PodSpec{Volumes: []v1.Volume{
+				{Name: "config", VolumeSource: v1.VolumeSource{ConfigMap: &v1.ConfigMapVolumeSource{LocalObjectReference: v1.LocalObjectReference{Name: "web-config"}}}},
+				{Name: "certs", VolumeSource: v1.VolumeSource{Secret: &v1.SecretVolumeSource{SecretName: "web-certs"}}},
+				{Name: "data", VolumeSource: v1.VolumeSource{PersistentVolumeClaim: &v1.PersistentVolumeClaimVolumeSource{ClaimName: "web-data"}}},
+				{Name: "all", VolumeSource: v1.VolumeSource{Projected: &v1.ProjectedVolumeSource{Sources: []v1.VolumeProjection{
+					{ConfigMap: &v1.ConfigMapProjection{LocalObjectReference: v1.LocalObjectReference{Name: "app-config"}}},
+					{Secret: &v1.SecretProjection{LocalObjectReference: v1.LocalObjectReference{Name: "api-token"}}},
+				}}}},
+			}}),
+			want: []string{
+				"volume config references missing ConfigMap web-config",
+				"volume certs references missing Secret web-certs",
+				"volume data references missing PersistentVolumeClaim web-data",
+				"volume all references missing Secret api-token",
+			},
+		},
+		{
+			name: "optional missing objects",
+			obj: referencingPod(v1.PodSpec{
+				Volumes: []v1.Volume{
+					{Name: "certs", VolumeSource: v1.VolumeSource{Secret: &v1.SecretVolumeSource{SecretName: "web-certs", Optional: &optional}}},
+				},
+				Containers: []v1.Container{{
+					Name:    "app",
+					EnvFrom: []v1.EnvFromSource{{ConfigMapRef: &v1.ConfigMapEnvSource{LocalObjectReference: v1.LocalObjectReference{Name: "web-config"}, Optional: &optional}}},
+				}},
+			}),
+		},
+		{
+			name: "missing keys and environment of every container",
+			obj: referencingPod(v1.PodSpec{
+				InitContainers: []v1.Container{{
+					Name:    "migrate",
+					EnvFrom: []v1.EnvFromSource{{SecretRef: &v1.SecretEnvSource{LocalObjectReference: v1.LocalObjectReference{Name: "migrate-env"}}}},
+				}},
+				Containers: []v1.Container{{
+					Name: "app",
+					Env:  []v1.EnvVar{envFrom("app-config", "format", false), envFrom("db", "host", true), envFrom("cache", "url", true)},
+				}},
+			}),
+			want: []string{
+				"envFrom of container migrate references missing Secret migrate-env",
+				"env FORMAT of container app references missing key format in ConfigMap app-config",
+				"env HOST of container app references missing key host in Secret db",
+				"env URL of container app references missing Secret cache",
+			},
+		},
+		{
+			name: "image pull secrets of a deployment",
+			obj: &appv1.Deployment{ObjectMeta: shopMeta("app"), Spec: appv1.DeploymentSpec{Template: v1.PodTemplateSpec{Spec: v1.PodSpec{
+				ImagePullSecrets: []v1.LocalObjectReference{{Name: "registry"}},
+			}}}},
+			want: []string{"imagePullSecrets references missing Secret registry"},
+		},
+		{
+			name: "ingress",
+			obj: &networkingv1beta1.Ingress{ObjectMeta: shopMeta("web"), Spec: networkingv1beta1.IngressSpec{
+				Backend: ingressBackend("web", intstr.FromString("http")),
+				Rules: []networkingv1beta1.IngressRule{{IngressRuleValue: networkingv1beta1.IngressRuleValue{HTTP: &networkingv1beta1.HTTPIngressRuleValue{
+					Paths: []networkingv1beta1.HTTPIngressPath{
+						{Path: "/", Backend: *ingressBackend("web", intstr.FromInt(80))},
+						{Path: "/admin", Backend: *ingressBackend("web", intstr.FromString("admin"))},
+						{Path: "/api", Backend: *ingressBackend("api", intstr.FromInt(8080))},
+					},
+				}}}},
+				TLS: []networkingv1beta1.IngressTLS{{SecretName: "web-tls"}, {SecretName: "api-tls"}},
+			}},
+			want: []string{
+				"spec.rules[0].http.paths[1].backend references missing port admin in Service web",
+				"spec.rules[0].http.paths[2].backend references missing Service api",
+				"spec.tls[1] references missing Secret api-tls",
+			},
+		},
+		{
+			name: "service account secrets",
+			obj: &v1.ServiceAccount{
+				ObjectMeta:       shopMeta("api"),
+				Secrets:          []v1.ObjectReference{{Name: "db"}},
+				ImagePullSecrets: []v1.LocalObjectReference{{Name: "registry"}},
+			},
+			want: []string{"imagePullSecrets references missing Secret registry"},
+		},
+	}
+
+	snapshot := referenceSnapshot()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, d := range snapshot.DanglingReferences(tt.obj) {
+				got = append(got, d.Field+" references "+d.Problem)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("DanglingReferences =\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(tt.want, "\n"))
+			}
+		})
+	}
+}
+
+func TestOrphanedObjects(t *testing.T) {
+	controller := true
+	snapshot := referenceSnapshot()
+	snapshot.ConfigMaps = append(snapshot.ConfigMaps,
+		v1.ConfigMap{ObjectMeta: shopMeta("kube-root-ca.crt")},
+		v1.ConfigMap{ObjectMeta: shopMeta("unused-config")},
+	)
+	snapshot.Secrets = append(snapshot.Secrets,
+		v1.Secret{ObjectMeta: shopMeta("api-token-x2x9q"), Type: v1.SecretTypeServiceAccountToken},
+		v1.Secret{ObjectMeta: shopMeta("sh.helm.release.v1.shop.v3"), Type: "helm.sh/release.v1"},
+		v1.Secret{ObjectMeta: shopMeta("registry"), Type: v1.SecretTypeDockerConfigJson},
+	)
+	snapshot.PersistentVolumeClaims = append(snapshot.PersistentVolumeClaims,
+		v1.PersistentVolumeClaim{ObjectMeta: shopMeta("data-db-0")},
+		v1.PersistentVolumeClaim{ObjectMeta: shopMeta("data-db-backup")},
+	)
+	snapshot.ServiceAccounts[0].ImagePullSecrets = []v1.LocalObjectReference{{Name: "registry"}}
+	snapshot.StatefulSets = []appv1.StatefulSet{{
+		ObjectMeta: shopMeta("db"),
+		Spec:       appv1.StatefulSetSpec{VolumeClaimTemplates: []v1.PersistentVolumeClaim{{ObjectMeta: metav1.ObjectMeta{Name: "data"}}}},
+	}}
+	// the pod is only evaluated through its controller, its references still count
+	pod := referencingPod(v1.PodSpec{
+		Volumes: []v1.Volume{
+			{Name: "config", VolumeSource: v1.VolumeSource{ConfigMap: &v1.ConfigMapVolumeSource{LocalObjectReference: v1.LocalObjectReference{Name: "app-config"}}}},
+			{Name: "data", VolumeSource: v1.VolumeSource{PersistentVolumeClaim: &v1.PersistentVolumeClaimVolumeSource{ClaimName: "data"}}},
+		},
+		Containers: []v1.Container{{Name: "app", Env: []v1.EnvVar{envFrom("db", "password", true)}}},
+	})
+	pod.OwnerReferences = []metav1.OwnerReference{{Kind: "ReplicaSet", Name: "app-5d4f7b", Controller: &controller}}
+	snapshot.Pods = []v1.Pod{*pod}
+
+	result, err := EvaluateRules(snapshot, CheckOptions{Rules: []string{"orphaned-objects"}})
+	if err != nil {
+		t.Fatalf("EvaluateRules: %v", err)
+	}
+	want := []string{
+		"orphaned-objects info ConfigMap shop/unused-config: is not referenced by any workload, pod, ingress or service account",
+		"orphaned-objects info PersistentVolumeClaim shop/data-db-backup: is not referenced by any workload, pod, ingress or service account",
+		"orphaned-objects info Secret shop/web-tls: is not referenced by any workload, pod, ingress or service account",
+	}
+	if got := findingStrings(result.Findings); !reflect.DeepEqual(got, want) {
+		t.Errorf("EvaluateRules findings =\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+	if result.Failed() != 0 {
+		t.Errorf("EvaluateRules failed %d findings, want none at the default warning level", result.Failed())
+	}
+}
@@ -0,0 +1,237 @@
+package backend
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Report : a named list of test cases, the common shape of every check used by the test report outputs
+type Report struct {
+	Name  string
+	Cases []ReportCase
+}
+
+// ReportCase : a single passed or failed check of a report
+type ReportCase struct {
+	Name     string
+	Passed   bool
+	Message  string
+	Details  string
+	Duration time.Duration
+	// ExitCode is the exit code of the failed case, see ExitCodeForReason
+	ExitCode int
+}
+
+// Failed : returns the number of failed cases of the report
+func (r Report) Failed() int {
+	failed := 0
+	for _, c := range r.Cases {
+		if !c.Passed {
+			failed++
+		}
+	}
+	return failed
+}
+
+// ExitCode : returns the aggregated exit code of the failed cases, ExitOK when every case passed
+func (r Report) ExitCode() int {
+	code := ExitOK
+	for _, c := range r.Cases {
+		if c.Passed {
+			continue
+		}
+		if c.ExitCode == ExitOK {
+			code = AggregateExitCode(code, ExitFailed)
+		} else {
+			code = AggregateExitCode(code, c.ExitCode)
+		}
+	}
+	return code
+}
+
+// caseExitCode : returns the exit code of a case failed for the given reason, ExitOK when it passed
+func caseExitCode(passed bool, reason FailureReason) int {
+	if passed {
+		return ExitOK
+	}
+	return ExitCodeForReason(reason)
+}
+
+// ConnectionCheck : a connection result evaluated against its expectation
+type ConnectionCheck struct {
+	ConnectionResult
+	Expect  Expectation
+	Verdict Verdict
+	Passed  bool
+}
+
+// EvaluateConnection : accepts a connection result and its expectation
+//			returns the evaluated ConnectionCheck, which fails whatever the expectation
+//			when the connection could not be checked at all, fails denied connections whose target
+//			name could not be resolved, and fails allowed connections
+//			whose HTTP response or TLS handshake does not meet the assertions of the check
+func EvaluateConnection(result ConnectionResult, expect Expectation) ConnectionCheck {
+	verdict := EvaluateExpectation(result.Connected, expect)
+	return ConnectionCheck{
+		ConnectionResult: result,
+		Expect:           expect,
+		Verdict:          verdict,
+		Passed:           verdict.Met() && !result.Reason.inconclusiveFor(expect) && (result.HTTP == nil || len(result.HTTP.Failures) == 0) &&
+			(result.TLS == nil || len(result.TLS.Failures) == 0),
+	}
+}
+
+// ExitCode : returns the exit code of the check
+func (c ConnectionCheck) ExitCode() int {
+	return caseExitCode(c.Passed, c.Reason)
+}
+
+// Report : returns the check as a single case report
+func (c ConnectionCheck) Report() Report {
+	name := c.Source + " -> " + c.Target
+	return Report{
+		Name: "connection",
+		Cases: []ReportCase{{
+			Name:     name,
+			Passed:   c.Passed,
+			Message:  connectionMessage(c.ConnectionResult, c.Verdict),
+			Details:  attemptsDetails(c.Attempts),
+			Duration: c.Duration,
+			ExitCode: c.ExitCode(),
+		}},
+	}
+}
+
+func connectionMessage(result ConnectionResult, verdict Verdict) string {
+	message := string(verdict) + ", probe strategy " + string(result.Strategy)
+	if result.Prober != "" {
+		message += ", prober " + result.Prober
+	}
+	if result.Reason != "" {
+		message += ", reason " + string(result.Reason)
+	}
+	if result.HTTP != nil {
+		message += fmt.Sprintf(", %s %d in %s", result.HTTP.Response.Protocol, result.HTTP.Response.Status, result.HTTP.Response.Latency.Round(time.Millisecond))
+		if len(result.HTTP.Failures) > 0 {
+			message += ", " + strings.Join(result.HTTP.Failures, ", ")
+		}
+	}
+	if result.TLS != nil {
+		message += fmt.Sprintf(", %s %s", result.TLS.Handshake.Version, result.TLS.Handshake.Cipher)
+		if len(result.TLS.Failures) > 0 {
+			message += ", " + strings.Join(result.TLS.Failures, ", ")
+		}
+	}
+	return message
+}
+
+func attemptsDetails(attempts []ProbeAttempt) string {
+	var lines []string
+	for _, a := range attempts {
+		status := "ok"
+		if a.Error != "" {
+			status = a.Error
+		}
+		lines = append(lines, a.Prober+": "+status)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Report : returns every result of the suite as a case
+func (r SuiteReport) Report() Report {
+	report := Report{Name: "suite"}
+	for _, res := range r.Results {
+		c := ReportCase{
+			Name:     res.Check + ": " + res.Source + " -> " + res.Target,
+			Passed:   res.Passed,
+			Message:  "expected " + string(res.Expect) + ", " + res.Message,
+			Details:  attemptsDetails(res.Connection.Attempts),
+			Duration: res.Connection.Duration,
+			ExitCode: caseExitCode(res.Passed, res.Reason),
+		}
+		if res.Strategy != "" {
+			c.Message = "expected " + string(res.Expect) + ", " + connectionMessage(res.Connection, res.Verdict)
+			if res.Service != nil {
+				c.Message += serviceFailures(EvaluateServiceConnection(*res.Service, res.Expect))
+			}
+		}
+		report.Cases = append(report.Cases, c)
+	}
+	return report
+}
+
+// Report : returns every cell of the matrix as a case, failed when it disagrees with the NetworkPolicies
+// or when the probe could not be executed
+func (m Matrix) Report() Report {
+	report := Report{Name: "matrix"}
+	for _, c := range m.Cells {
+		name := c.Source + " -> " + c.Target
+		if c.Port != 0 {
+			name += ":" + strconv.Itoa(c.Port)
+		}
+		message := "denied"
+		switch {
+		case c.Inconclusive():
+			message = "unknown"
+		case c.Connected:
+			message = "allowed"
+		}
+		if c.Policy != nil {
+			message += fmt.Sprintf(", policy allowed: %t", c.Policy.Allowed)
+		}
+		code := ExitOK
+		if c.Mismatch {
+			code = ExitFailed
+		}
+		if reasonCode := ExitCodeForReason(c.Reason); reasonCode != ExitFailed {
+			code = AggregateExitCode(code, reasonCode)
+			message += ", reason " + string(c.Reason)
+		}
+		report.Cases = append(report.Cases, ReportCase{
+			Name:     name,
+			Passed:   code == ExitOK,
+			Message:  message,
+			ExitCode: code,
+		})
+	}
+	return report
+}
+
+// PolicyCheck : a simulated connection evaluated against its expectation
+type PolicyCheck struct {
+	PolicyVerdict
+	Expect  Expectation
+	Verdict Verdict
+	Passed  bool
+}
+
+// EvaluatePolicy : accepts a simulated connection and its expectation
+//			returns the evaluated PolicyCheck
+func EvaluatePolicy(verdict PolicyVerdict, expect Expectation) PolicyCheck {
+	v := EvaluateExpectation(verdict.Allowed, expect)
+	return PolicyCheck{
+		PolicyVerdict: verdict,
+		Expect:        expect,
+		Verdict:       v,
+		Passed:        v.Met(),
+	}
+}
+
+// Report : returns the simulated connection as a single case report
+func (c PolicyCheck) Report() Report {
+	name := fmt.Sprintf("%s -> %s %d/%s", c.Source, c.Target, c.Port, c.Protocol)
+	return Report{
+		Name: "policy",
+		Cases: []ReportCase{{
+			Name:     name,
+			Passed:   c.Passed,
+			Message:  string(c.Verdict),
+			ExitCode: caseExitCode(c.Passed, ""),
+			Details: fmt.Sprintf("egress policies: %s, allowed by: %s\ningress policies: %s, allowed by: %s",
+				strings.Join(c.Egress.Policies, ","), strings.Join(c.Egress.AllowedBy, ","),
+				strings.Join(c.Ingress.Policies, ","), strings.Join(c.Ingress.AllowedBy, ",")),
+		}},
+	}
+}
@@ -0,0 +1,284 @@
+package backend
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// Severity : how serious the violation of a rule is
+type Severity string
+
+const (
+	// SeverityInfo : the finding is worth knowing but does not need an action
+	SeverityInfo Severity = "info"
+	// SeverityWarning : the finding should be fixed
+	SeverityWarning Severity = "warning"
+	// SeverityError : the finding is likely to cause an outage or a security issue
+	SeverityError Severity = "error"
+)
+
+// ParseSeverity : accepts a severity string, an empty string defaults to warning
+//			returns the corresponding Severity
+func ParseSeverity(s string) (Severity, error) {
+	switch Severity(strings.ToLower(s)) {
+	case "", SeverityWarning:
+		return SeverityWarning, nil
+	case SeverityInfo:
+		return SeverityInfo, nil
+	case SeverityError:
+		return SeverityError, nil
+	}
+	return "", fmt.Errorf("invalid severity '%s': must be one of %s, %s, %s", s, SeverityInfo, SeverityWarning, SeverityError)
+}
+
+// rank : returns the order of the severity, higher is more serious
+func (s Severity) rank() int {
+	switch s {
+	case SeverityInfo:
+		return 1
+	case SeverityWarning:
+		return 2
+	case SeverityError:
+		return 3
+	}
+	return 0
+}
+
+// Rule : a consistency check evaluated on every object of its target kinds
+type Rule interface {
+	// ID : returns the unique identifier of the rule
+	ID() string
+	// Description : returns a one line description of what the rule checks
+	Description() string
+	// Severity : returns the default severity of the findings of the rule
+	Severity() Severity
+	// Kinds : returns the kinds of the objects the rule is evaluated on, e.g. Deployment
+	Kinds() []string
+	// Evaluate : accepts an object of one of the target kinds and the snapshot it belongs to
+	//			returns the violations of the rule, the engine fills the rule, the object
+	//			and, when empty, the severity of the findings
+	Evaluate(obj runtime.Object, snapshot *ClusterSnapshot) []Finding
+}
+
+// Finding : a violation of a rule by an object
+type Finding struct {
+	Rule      string
+	Severity  Severity
+	Kind      string
+	Namespace string `json:",omitempty"`
+	Name      string
+	Message   string
+}
+
+// Object : returns the kind and the namespaced name of the object of the finding
+func (f Finding) Object() string {
+	if f.Namespace == "" {
+		return f.Kind + " " + f.Name
+	}
+	return f.Kind + " " + f.Namespace + "/" + f.Name
+}
+
+var ruleRegistry struct {
+	sync.RWMutex
+	rules []Rule
+}
+
+// RegisterRule : accepts a rule and adds it to the registry,
+//			a rule with the same ID is replaced in place
+func RegisterRule(r Rule) {
+	ruleRegistry.Lock()
+	defer ruleRegistry.Unlock()
+
+	for i, registered := range ruleRegistry.rules {
+		if registered.ID() == r.ID() {
+			ruleRegistry.rules[i] = r
+			return
+		}
+	}
+	ruleRegistry.rules = append(ruleRegistry.rules, r)
+}
+
+// Rules : returns the registered rules in the order they are evaluated
+func Rules() []Rule {
+	ruleRegistry.RLock()
+	defer ruleRegistry.RUnlock()
+
+	return append([]Rule(nil), ruleRegistry.rules...)
+}
+
+// selectRules : returns the registered rules, restricted to the given IDs when not empty
+func selectRules(ids []string) ([]Rule, error) {
+	registered := Rules()
+	if len(ids) == 0 {
+		return registered, nil
+	}
+
+	var selected []Rule
+	for _, id := range ids {
+		found := false
+		for _, r := range registered {
+			if r.ID() == id {
+				selected = append(selected, r)
+				found = true
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("unknown rule '%s'", id)
+		}
+	}
+	return selected, nil
+}
+
+// CheckOptions : tunes which rules are evaluated and which findings fail the check
+type CheckOptions struct {
+	// Rules restricts the evaluation to the rules with these IDs, default is every registered rule
+	Rules []string
+	// FailOn is the minimum severity of the findings failing the check, default is warning
+	FailOn Severity
+	// Query restricts the evaluation to the objects of its namespaces matching its selectors,
+	// a Namespace matches when it is one of the namespaces. Limit and Continue are ignored.
+	Query QueryOptions
+}
+
+// CheckResult : the findings of the rules evaluated on a snapshot
+type CheckResult struct {
+	Rules []string
+	// Objects is the number of objects the rules were evaluated on
+	Objects  int
+	FailOn   Severity
+	Findings []Finding
+}
+
+// EvaluateRules : accepts a snapshot and the check options
+//			returns the findings of the selected rules on every object of their target kinds,
+//			sorted by object then by rule
+func EvaluateRules(snapshot *ClusterSnapshot, opts CheckOptions) (CheckResult, error) {
+	rules, err := selectRules(opts.Rules)
+	if err != nil {
+		return CheckResult{}, err
+	}
+	if err := opts.Query.Validate(); err != nil {
+		return CheckResult{}, err
+	}
+	labelSelector, _ := labels.Parse(opts.Query.LabelSelector)
+	fieldSelector, _ := fields.ParseSelector(opts.Query.FieldSelector)
+	result := CheckResult{FailOn: opts.FailOn}
+	if result.FailOn == "" {
+		result.FailOn = SeverityWarning
+	}
+	for _, r := range rules {
+		result.Rules = append(result.Rules, r.ID())
+	}
+
+	for _, obj := range snapshot.objects() {
+		kind := objectKind(obj)
+		o, err := meta.Accessor(obj)
+		if err != nil {
+			continue
+		}
+		namespace := o.GetNamespace()
+		if kind == "Namespace" {
+			namespace = o.GetName()
+		}
+		if len(opts.Query.Namespaces) > 0 && !containsString(opts.Query.Namespaces, namespace) {
+			continue
+		}
+		if !labelSelector.Matches(labels.Set(o.GetLabels())) || !fieldSelector.Matches(objectFields(obj, o)) {
+			continue
+		}
+		evaluated := false
+		for _, r := range rules {
+			if !containsString(r.Kinds(), kind) {
+				continue
+			}
+			evaluated = true
+			for _, f := range r.Evaluate(obj, snapshot) {
+				f.Rule = r.ID()
+				f.Kind = kind
+				f.Namespace = o.GetNamespace()
+				f.Name = o.GetName()
+				if f.Severity == "" {
+					f.Severity = r.Severity()
+				}
+				result.Findings = append(result.Findings, f)
+			}
+		}
+		if evaluated {
+			result.Objects++
+		}
+	}
+
+	sort.SliceStable(result.Findings, func(i, j int) bool {
+		a, b := result.Findings[i], result.Findings[j]
+		if a.Namespace != b.Namespace {
+			return a.Namespace < b.Namespace
+		}
+		if a.Kind != b.Kind {
+			return a.Kind < b.Kind
+		}
+		if a.Name != b.Name {
+			return a.Name < b.Name
+		}
+		return a.Rule < b.Rule
+	})
+	return result, nil
+}
+
+// Fails : returns true if the finding is at least as serious as the given severity
+func (f Finding) Fails(failOn Severity) bool {
+	return f.Severity.rank() >= failOn.rank()
+}
+
+// Failed : returns the number of findings failing the check
+func (r CheckResult) Failed() int {
+	failed := 0
+	for _, f := range r.Findings {
+		if f.Fails(r.FailOn) {
+			failed++
+		}
+	}
+	return failed
+}
+
+// Report : returns every finding as a case, failed when it is at least as serious as FailOn,
+// and a passed case for every rule without findings
+func (r CheckResult) Report() Report {
+	report := Report{Name: "check"}
+	withFindings := map[string]bool{}
+	for _, f := range r.Findings {
+		withFindings[f.Rule] = true
+		passed := !f.Fails(r.FailOn)
+		report.Cases = append(report.Cases, ReportCase{
+			Name:     f.Rule + ": " + f.Object(),
+			Passed:   passed,
+			Message:  string(f.Severity) + ", " + f.Message,
+			ExitCode: caseExitCode(passed, ""),
+		})
+	}
+	for _, id := range r.Rules {
+		if !withFindings[id] {
+			report.Cases = append(report.Cases, ReportCase{
+				Name:    id,
+				Passed:  true,
+				Message: "no finding",
+			})
+		}
+	}
+	return report
+}
+
+func containsString(list []string, s string) bool {
+	for _, l := range list {
+		if l == s {
+			return true
+		}
+	}
+	return false
+}
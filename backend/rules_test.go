@@ -0,0 +1,242 @@
+package backend
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const ruleManifests = `
+apiVersion: v1
+kind: Namespace
+metadata:
+  name: prod
+  labels:
+    kubensure.io/protected: "true"
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+  namespace: prod
+spec:
+  selector:
+    matchLabels:
+      app: web
+  template:
+    metadata:
+      labels:
+        app: web
+    spec:
+      initContainers:
+      - name: migrate
+        image: registry.example.com:5000/migrate
+        resources:
+          requests: {cpu: 10m, memory: 16Mi}
+          limits: {memory: 16Mi}
+      containers:
+      - name: web
+        image: nginx:latest
+        securityContext:
+          privileged: true
+        resources:
+          requests: {cpu: 100m}
+        readinessProbe:
+          httpGet: {path: /, port: 80}
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: api
+  namespace: dev
+spec:
+  replicas: 1
+  selector:
+    matchLabels:
+      app: api
+  template:
+    metadata:
+      labels:
+        app: api
+    spec:
+      containers:
+      - name: api
+        image: registry.example.com/api@sha256:4b0b5ac4c3ad4d4e5c8e12b4fcbcd8e8f9d4a1c0b6e4d2c8a7f3b1e9d5c6a2f0
+        resources:
+          requests: {cpu: 100m, memory: 64Mi}
+          limits: {memory: 64Mi}
+        livenessProbe:
+          tcpSocket: {port: 8080}
+        readinessProbe:
+          tcpSocket: {port: 8080}
+---
+apiVersion: v1
+kind: Pod
+metadata:
+  name: debug
+  namespace: dev
+  labels:
+    app: debug
+spec:
+  containers:
+  - name: debug
+    image: busybox:1.36
+---
+apiVersion: v1
+kind: Pod
+metadata:
+  name: api-5d4f7b-x2x9q
+  namespace: dev
+  labels:
+    app: api
+  ownerReferences:
+  - apiVersion: apps/v1
+    kind: ReplicaSet
+    name: api-5d4f7b
+    uid: 0b6e4d2c-8a7f-4b1e-9d5c-6a2f04b0b5ac
+    controller: true
+spec:
+  containers:
+  - name: api
+    image: registry.example.com/api
+`
+
+func loadRuleSnapshot(t *testing.T) *ClusterSnapshot {
+	dir := t.TempDir()
+	if err := ioutil.WriteFile(filepath.Join(dir, "manifests.yaml"), []byte(ruleManifests), 0644); err != nil {
+		t.Fatal(err)
+	}
+	snapshot, err := LoadClusterSnapshot([]string{dir})
+	if err != nil {
+		t.Fatalf("LoadClusterSnapshot: %v", err)
+	}
+	return &snapshot
+}
+
+// builtinRules : the container and replica rules registered by builtin-rules.go
+var builtinRules = []string{"resources", "image-latest-tag", "probes", "privileged", "single-replica"}
+
+func findingStrings(findings []Finding) []string {
+	var s []string
+	for _, f := range findings {
+		s = append(s, fmt.Sprintf("%s %s %s: %s", f.Rule, f.Severity, f.Object(), f.Message))
+	}
+	return s
+}
+
+func TestBuiltinRules(t *testing.T) {
+	result, err := EvaluateRules(loadRuleSnapshot(t), CheckOptions{Rules: builtinRules})
+	if err != nil {
+		t.Fatalf("EvaluateRules: %v", err)
+	}
+
+	want := []string{
+		"probes warning Pod dev/debug: container debug has no liveness and readiness probe",
+		"resources warning Pod dev/debug: container debug has no cpu request, memory request, memory limit",
+		"image-latest-tag warning Deployment prod/web: container migrate uses image registry.example.com:5000/migrate without tag, which defaults to latest",
+		"image-latest-tag warning Deployment prod/web: container web uses image nginx:latest",
+		"privileged error Deployment prod/web: container web is privileged",
+		"probes warning Deployment prod/web: container web has no liveness probe",
+		"resources warning Deployment prod/web: container web has no memory request, memory limit",
+		"single-replica error Deployment prod/web: runs a single replica in protected namespace prod",
+	}
+	if got := findingStrings(result.Findings); !reflect.DeepEqual(got, want) {
+		t.Errorf("EvaluateRules findings =\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+	// the pod managed by the ReplicaSet is evaluated through its Deployment
+	if result.Objects != 3 {
+		t.Errorf("EvaluateRules evaluated %d objects, want 3", result.Objects)
+	}
+	if !reflect.DeepEqual(result.Rules, builtinRules) || result.FailOn != SeverityWarning || result.Failed() != 8 {
+		t.Errorf("EvaluateRules rules %v, fail on %s, failed %d, want %v, warning, 8", result.Rules, result.FailOn, result.Failed(), builtinRules)
+	}
+}
+
+func TestEvaluateRulesOptions(t *testing.T) {
+	snapshot := loadRuleSnapshot(t)
+
+	tests := []struct {
+		name     string
+		opts     CheckOptions
+		findings int
+		failed   int
+		err      string
+	}{
+		{"fail on errors", CheckOptions{Rules: builtinRules, FailOn: SeverityError}, 8, 2, ""},
+		{"fail on info", CheckOptions{Rules: builtinRules, FailOn: SeverityInfo}, 8, 8, ""},
+		{"selected rule", CheckOptions{Rules: []string{"privileged"}}, 1, 1, ""},
+		{"namespace", CheckOptions{Rules: builtinRules, Query: QueryOptions{Namespaces: []string{"dev"}}}, 2, 2, ""},
+		{"label selector", CheckOptions{Rules: builtinRules, Query: QueryOptions{LabelSelector: "app=debug"}}, 2, 2, ""},
+		{"field selector", CheckOptions{Rules: builtinRules, Query: QueryOptions{FieldSelector: "metadata.name=web"}}, 6, 6, ""},
+		{"unknown rule", CheckOptions{Rules: []string{"resources", "no-such-rule"}}, 0, 0, "unknown rule 'no-such-rule'"},
+		{"invalid selector", CheckOptions{Query: QueryOptions{LabelSelector: "app in web"}}, 0, 0, "app in web"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := EvaluateRules(snapshot, tt.opts)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("EvaluateRules error = %v, want %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("EvaluateRules: %v", err)
+			}
+			if len(result.Findings) != tt.findings || result.Failed() != tt.failed {
+				t.Errorf("EvaluateRules %d findings, %d failed, want %d, %d:\n%s", len(result.Findings), result.Failed(), tt.findings, tt.failed, strings.Join(findingStrings(result.Findings), "\n"))
+			}
+		})
+	}
+}
+
+func TestSingleReplicaRule(t *testing.T) {
+	snapshot := loadRuleSnapshot(t)
+	web, api := &snapshot.Deployments[0], &snapshot.Deployments[1]
+
+	tests := []struct {
+		name      string
+		protected []string
+		replicas  int32
+		findings  int
+	}{
+		{"unprotected namespace", nil, 1, 0},
+		{"protected by name", []string{"dev"}, 1, 1},
+		{"more than one replica", []string{"dev"}, 2, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			api.Spec.Replicas = &tt.replicas
+			if got := NewSingleReplicaRule(tt.protected).Evaluate(api, snapshot); len(got) != tt.findings {
+				t.Errorf("Evaluate = %v, want %d findings", got, tt.findings)
+			}
+		})
+	}
+	// protected by the label of the namespace, with the default of one replica
+	if got := NewSingleReplicaRule(nil).Evaluate(web, snapshot); len(got) != 1 {
+		t.Errorf("Evaluate = %v, want 1 finding", got)
+	}
+}
+
+func TestParseSeverity(t *testing.T) {
+	tests := []struct {
+		s    string
+		want Severity
+		err  bool
+	}{
+		{"", SeverityWarning, false},
+		{"info", SeverityInfo, false},
+		{"Warning", SeverityWarning, false},
+		{"ERROR", SeverityError, false},
+		{"critical", "", true},
+	}
+	for _, tt := range tests {
+		got, err := ParseSeverity(tt.s)
+		if got != tt.want || (err != nil) != tt.err {
+			t.Errorf("ParseSeverity(%q) = %s, %v, want %s, error %t", tt.s, got, err, tt.want, tt.err)
+		}
+	}
+}
@@ -0,0 +1,318 @@
+package backend
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/client-go/kubernetes"
+)
+
+// EndpointConnectionResult : the outcome of probing a single ready address of the Endpoints of a Service
+type EndpointConnectionResult struct {
+	ConnectionResult
+	// Address is the IP address of the endpoint
+	Address string
+	// Pod is the namespace/name of the pod behind the address, when the Endpoints reference it
+	Pod string `json:",omitempty"`
+}
+
+// ServiceConnectionResult : the outcome of probing a port of a Service through its name, load balanced by its ClusterIP,
+// and optionally through each of the ready addresses of its Endpoints
+type ServiceConnectionResult struct {
+	// PortName, Protocol and TargetPort describe the probed ServicePort, the port number is the one of Service
+	PortName   string      `json:",omitempty"`
+	Protocol   v1.Protocol `json:",omitempty"`
+	TargetPort string      `json:",omitempty"`
+	Service    ConnectionResult
+	// Unresolved are the names of the backing pods declaring no container port matching the named target port
+	Unresolved []string `json:",omitempty"`
+	// EndpointsProbed is true when the ready addresses of the Endpoints were probed
+	EndpointsProbed bool
+	Endpoints       []EndpointConnectionResult
+	// NotReady is the number of not ready addresses of the Endpoints, they are not probed
+	NotReady int
+}
+
+// ResolveServicePorts : accepts a service, a port, by number or by name, empty for every port, and a protocol,
+//			empty for every protocol
+//			returns the ServicePorts of the service to probe. A port number the service does not declare
+//			is only accepted for services declaring no port, e.g. ExternalName services, and is probed
+//			with the given protocol, TCP by default.
+func ResolveServicePorts(svc v1.Service, port string, protocol v1.Protocol) ([]v1.ServicePort, error) {
+	number, err := strconv.Atoi(port)
+	var ports []v1.ServicePort
+	for _, p := range svc.Spec.Ports {
+		if protocol != "" && portProtocol(p.Protocol) != protocol {
+			continue
+		}
+		if port == "" || err == nil && int(p.Port) == number || err != nil && p.Name == port {
+			ports = append(ports, p)
+		}
+	}
+	if len(ports) > 0 {
+		return ports, nil
+	}
+	if len(svc.Spec.Ports) == 0 && (port == "" || err == nil) {
+		return []v1.ServicePort{{Port: int32(number), Protocol: portProtocol(protocol)}}, nil
+	}
+
+	var declared []string
+	for _, p := range svc.Spec.Ports {
+		declared = append(declared, servicePortString(p))
+	}
+	wanted := port
+	if protocol != "" {
+		wanted = strings.TrimPrefix(wanted+"/"+string(protocol), "/")
+	}
+	return nil, fmt.Errorf("service %s/%s has no port '%s', declared ports: %s", svc.Namespace, svc.Name, wanted, strings.Join(declared, ", "))
+}
+
+// servicePort : accepts a service, a port number, 0 when unknown, and a protocol, empty for any protocol
+//			returns the ServicePort of the service with that number and protocol, the only port of the service
+//			when the number is unknown, or a port with that number and protocol, TCP by default,
+//			when the service does not declare it
+func servicePort(svc v1.Service, port int, protocol v1.Protocol) v1.ServicePort {
+	for _, p := range svc.Spec.Ports {
+		if protocol != "" && portProtocol(p.Protocol) != protocol {
+			continue
+		}
+		if int(p.Port) == port || port == 0 && len(svc.Spec.Ports) == 1 {
+			return p
+		}
+	}
+	return v1.ServicePort{Port: int32(port), Protocol: portProtocol(protocol)}
+}
+
+// servicePortString : returns the number, protocol and name of a ServicePort, e.g. 80/TCP (http)
+func servicePortString(p v1.ServicePort) string {
+	s := fmt.Sprintf("%d/%s", p.Port, portProtocol(p.Protocol))
+	if p.Name != "" {
+		s += " (" + p.Name + ")"
+	}
+	return s
+}
+
+// portProtocol : returns the protocol of a port, TCP when it is not set
+func portProtocol(protocol v1.Protocol) v1.Protocol {
+	if protocol == "" {
+		return v1.ProtocolTCP
+	}
+	return protocol
+}
+
+// targetPortResolves : returns true if the target port of the ServicePort resolves on the pod,
+//			a named target port resolves when a container declares a port with that name and protocol
+func targetPortResolves(pod v1.Pod, port v1.ServicePort) bool {
+	if port.TargetPort.Type != intstr.String {
+		return true
+	}
+	for _, c := range pod.Spec.Containers {
+		for _, p := range c.Ports {
+			if p.Name == port.TargetPort.StrVal && portProtocol(p.Protocol) == portProtocol(port.Protocol) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// ConnectionPodToServicePorts : accepts a pod, a service, the ServicePorts to probe, the pods backing the service
+//				 and optionally the endpoints of the service
+//				 probes each port of the service with its protocol, checks that its target port resolves on the
+//				 backing pods and, when the endpoints are given, probes every ready address on the matching port
+func ConnectionPodToServicePorts(clientset kubernetes.Interface, pod v1.Pod, svc v1.Service, ports []v1.ServicePort, backends []v1.Pod, endpoints *v1.Endpoints, opts ConnectionOptions) []ServiceConnectionResult {
+	var results []ServiceConnectionResult
+	for _, port := range ports {
+		results = append(results, connectionPodToServicePort(clientset, pod, svc, port, backends, endpoints, opts))
+	}
+	return results
+}
+
+func connectionPodToServicePort(clientset kubernetes.Interface, pod v1.Pod, svc v1.Service, port v1.ServicePort, backends []v1.Pod, endpoints *v1.Endpoints, opts ConnectionOptions) ServiceConnectionResult {
+	protocol := portProtocol(port.Protocol)
+	result := ServiceConnectionResult{
+		PortName: port.Name,
+		Protocol: protocol,
+		Service:  probeConnection(clientset, pod, newProbeTarget(svc.Name+"."+svc.Namespace, int(port.Port), protocol), opts),
+	}
+	if port.TargetPort != (intstr.IntOrString{}) {
+		result.TargetPort = port.TargetPort.String()
+	}
+	for _, backend := range backends {
+		if !targetPortResolves(backend, port) {
+			result.Unresolved = append(result.Unresolved, backend.Name)
+		}
+	}
+	if endpoints == nil {
+		return result
+	}
+
+	result.EndpointsProbed = true
+	if opts.TLS != nil && opts.TLS.ServerName == "" {
+		// the backends are reached by IP but serve the certificate of the service
+		check := *opts.TLS
+		check.ServerName = svc.Name + "." + svc.Namespace
+		opts.TLS = &check
+	}
+	for _, subset := range endpoints.Subsets {
+		epPort := endpointPort(port, subset)
+		result.NotReady += len(subset.NotReadyAddresses)
+		for _, addr := range subset.Addresses {
+			ep := EndpointConnectionResult{
+				ConnectionResult: probeConnection(clientset, pod, newProbeTarget(addr.IP, epPort, protocol), opts),
+				Address:          addr.IP,
+			}
+			if addr.TargetRef != nil && addr.TargetRef.Kind == "Pod" {
+				ep.Pod = addr.TargetRef.Namespace + "/" + addr.TargetRef.Name
+			}
+			result.Endpoints = append(result.Endpoints, ep)
+		}
+	}
+	return result
+}
+
+// endpointPort : accepts a ServicePort and a subset of the endpoints of its service
+//			returns the port of the subset with the name and protocol of the ServicePort,
+//			the numeric target port, or the service port itself when the subset has none
+func endpointPort(port v1.ServicePort, subset v1.EndpointSubset) int {
+	for _, p := range subset.Ports {
+		if p.Name == port.Name && portProtocol(p.Protocol) == portProtocol(port.Protocol) {
+			return int(p.Port)
+		}
+	}
+	if port.TargetPort.Type == intstr.Int && port.TargetPort.IntVal != 0 {
+		return int(port.TargetPort.IntVal)
+	}
+	return int(port.Port)
+}
+
+// ServiceConnectionCheck : a service connection result evaluated against its expectation
+type ServiceConnectionCheck struct {
+	PortName   string      `json:",omitempty"`
+	Protocol   v1.Protocol `json:",omitempty"`
+	TargetPort string      `json:",omitempty"`
+	Service    ConnectionCheck
+	Unresolved []string `json:",omitempty"`
+	// EndpointsProbed is true when the ready addresses of the Endpoints were probed
+	EndpointsProbed bool
+	Endpoints       []EndpointConnectionCheck
+	NotReady        int
+	Passed          bool
+}
+
+// EndpointConnectionCheck : an endpoint connection result evaluated against its expectation
+type EndpointConnectionCheck struct {
+	ConnectionCheck
+	Address string
+	Pod     string `json:",omitempty"`
+}
+
+// EvaluateServiceConnection : accepts a service connection result and its expectation
+//			returns the evaluated ServiceConnectionCheck, which passes when the service and every probed
+//			endpoint meet the expectation. Allowed connections also fail when the target port does not
+//			resolve on a backing pod, or when the endpoints are probed and none of them is ready.
+func EvaluateServiceConnection(result ServiceConnectionResult, expect Expectation) ServiceConnectionCheck {
+	check := ServiceConnectionCheck{
+		PortName:        result.PortName,
+		Protocol:        result.Protocol,
+		TargetPort:      result.TargetPort,
+		Service:         EvaluateConnection(result.Service, expect),
+		Unresolved:      result.Unresolved,
+		EndpointsProbed: result.EndpointsProbed,
+		NotReady:        result.NotReady,
+	}
+	check.Passed = check.Service.Passed && (expect == ExpectDeny || len(check.unreadyFailure())+len(check.unresolvedFailure()) == 0)
+	for _, ep := range result.Endpoints {
+		epCheck := EndpointConnectionCheck{
+			ConnectionCheck: EvaluateConnection(ep.ConnectionResult, expect),
+			Address:         ep.Address,
+			Pod:             ep.Pod,
+		}
+		check.Passed = check.Passed && epCheck.Passed
+		check.Endpoints = append(check.Endpoints, epCheck)
+	}
+	return check
+}
+
+// EvaluateServiceConnections : accepts the results of the ports of a service and their expectation
+//			returns the evaluated ServiceConnectionChecks
+func EvaluateServiceConnections(results []ServiceConnectionResult, expect Expectation) ServiceConnectionChecks {
+	var checks ServiceConnectionChecks
+	for _, result := range results {
+		checks = append(checks, EvaluateServiceConnection(result, expect))
+	}
+	return checks
+}
+
+// Port : returns the number, protocol and name of the probed ServicePort, e.g. 80/TCP (http)
+func (c ServiceConnectionCheck) Port() string {
+	return servicePortString(v1.ServicePort{Name: c.PortName, Port: int32(c.Service.Port), Protocol: c.Protocol})
+}
+
+func (c ServiceConnectionCheck) unreadyFailure() string {
+	if !c.EndpointsProbed || len(c.Endpoints) > 0 {
+		return ""
+	}
+	return fmt.Sprintf("no ready endpoint address, %d not ready", c.NotReady)
+}
+
+func (c ServiceConnectionCheck) unresolvedFailure() string {
+	if len(c.Unresolved) == 0 {
+		return ""
+	}
+	return "target port " + c.TargetPort + " is not declared by the containers of pods " + strings.Join(c.Unresolved, ", ")
+}
+
+// Report : returns the service and every endpoint as a case, and a failed case when connections are expected
+//			but the target port does not resolve on the backing pods or no endpoint is ready
+func (c ServiceConnectionCheck) Report() Report {
+	report := Report{Name: "service"}
+	service := c.Service.Source + " -> " + c.Service.Target + " port " + c.Port()
+	report.Cases = append(report.Cases, ReportCase{
+		Name:     service,
+		Passed:   c.Service.Passed,
+		Message:  connectionMessage(c.Service.ConnectionResult, c.Service.Verdict),
+		Details:  attemptsDetails(c.Service.Attempts),
+		Duration: c.Service.Duration,
+		ExitCode: c.Service.ExitCode(),
+	})
+	for _, ep := range c.Endpoints {
+		name := c.Service.Source + " -> endpoint " + ep.Target + " port " + c.Port()
+		if ep.Pod != "" {
+			name += " (pod " + ep.Pod + ")"
+		}
+		report.Cases = append(report.Cases, ReportCase{
+			Name:     name,
+			Passed:   ep.Passed,
+			Message:  connectionMessage(ep.ConnectionResult, ep.Verdict),
+			Details:  attemptsDetails(ep.Attempts),
+			Duration: ep.Duration,
+			ExitCode: ep.ExitCode(),
+		})
+	}
+	if c.Service.Expect == ExpectDeny {
+		return report
+	}
+	if message := c.unresolvedFailure(); message != "" {
+		report.Cases = append(report.Cases, ReportCase{Name: service + " target port", Passed: false, Message: message, ExitCode: ExitFailed})
+	}
+	if message := c.unreadyFailure(); message != "" {
+		report.Cases = append(report.Cases, ReportCase{Name: service + " endpoints", Passed: false, Message: message, ExitCode: ExitFailed})
+	}
+	return report
+}
+
+// ServiceConnectionChecks : the evaluated checks of the ports of a service
+type ServiceConnectionChecks []ServiceConnectionCheck
+
+// Report : returns the cases of every port of the service
+func (c ServiceConnectionChecks) Report() Report {
+	report := Report{Name: "service"}
+	for _, check := range c {
+		report.Cases = append(report.Cases, check.Report().Cases...)
+	}
+	return report
+}
@@ -0,0 +1,64 @@
+package backend
+
+import (
+	"reflect"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestResolveServicePorts(t *testing.T) {
+	http := v1.ServicePort{Name: "http", Port: 80}
+	https := v1.ServicePort{Name: "https", Port: 443, Protocol: v1.ProtocolTCP}
+	dns := v1.ServicePort{Name: "dns", Port: 53, Protocol: v1.ProtocolUDP}
+	dnsTCP := v1.ServicePort{Name: "dns-tcp", Port: 53, Protocol: v1.ProtocolTCP}
+	svc := v1.Service{
+		ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "shop"},
+		Spec:       v1.ServiceSpec{Ports: []v1.ServicePort{http, https, dns, dnsTCP}},
+	}
+	external := v1.Service{
+		ObjectMeta: metav1.ObjectMeta{Name: "api", Namespace: "shop"},
+		Spec:       v1.ServiceSpec{Type: v1.ServiceTypeExternalName, ExternalName: "api.example.com"},
+	}
+
+	tests := []struct {
+		name     string
+		svc      v1.Service
+		port     string
+		protocol v1.Protocol
+		want     []v1.ServicePort
+		wantErr  bool
+	}{
+		{"every port", svc, "", "", []v1.ServicePort{http, https, dns, dnsTCP}, false},
+		{"by number", svc, "443", "", []v1.ServicePort{https}, false},
+		{"by name", svc, "http", "", []v1.ServicePort{http}, false},
+		{"number of several protocols", svc, "53", "", []v1.ServicePort{dns, dnsTCP}, false},
+		{"number and protocol", svc, "53", v1.ProtocolUDP, []v1.ServicePort{dns}, false},
+		{"default protocol is TCP", svc, "80", v1.ProtocolTCP, []v1.ServicePort{http}, false},
+		{"every port of a protocol", svc, "", v1.ProtocolUDP, []v1.ServicePort{dns}, false},
+		{"undeclared number", svc, "8080", "", nil, true},
+		{"undeclared name", svc, "metrics", "", nil, true},
+		{"name with an other protocol", svc, "http", v1.ProtocolUDP, nil, true},
+		{"number of a service without ports", external, "8443", "", []v1.ServicePort{{Port: 8443, Protocol: v1.ProtocolTCP}}, false},
+		{"number and protocol of a service without ports", external, "53", v1.ProtocolUDP, []v1.ServicePort{{Port: 53, Protocol: v1.ProtocolUDP}}, false},
+		{"name of a service without ports", external, "https", "", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ports, err := ResolveServicePorts(tt.svc, tt.port, tt.protocol)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("ResolveServicePorts = %v, want an error", ports)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ResolveServicePorts: %v", err)
+			}
+			if !reflect.DeepEqual(ports, tt.want) {
+				t.Errorf("ResolveServicePorts = %v, want %v", ports, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,218 @@
+package backend
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	appv1 "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+// ServiceRules : the IDs of the rules validating the selectors, Endpoints and target ports of the Services
+var ServiceRules = []string{"service-no-pods", "service-no-ready-endpoints", "service-target-ports", "service-multiple-workloads"}
+
+// serviceBackend : a workload, or a bare pod, selected by a Service
+type serviceBackend struct {
+	// workload is the kind and name of the workload, e.g. Deployment web
+	workload string
+	// specs are the pod specs of the running pods and of the template of the workload
+	specs []*v1.PodSpec
+	pods  int
+}
+
+// serviceBackends : returns the workloads and bare pods selected by the Service, sorted by name,
+//			nil when the Service has no selector
+func (s *ClusterSnapshot) serviceBackends(svc *v1.Service) []*serviceBackend {
+	if len(svc.Spec.Selector) == 0 {
+		return nil
+	}
+	selector := labels.SelectorFromSet(svc.Spec.Selector)
+
+	backends := map[string]*serviceBackend{}
+	backend := func(workload string) *serviceBackend {
+		if backends[workload] == nil {
+			backends[workload] = &serviceBackend{workload: workload}
+		}
+		return backends[workload]
+	}
+	for i := range s.Pods {
+		pod := &s.Pods[i]
+		if pod.Namespace != svc.Namespace || pod.DeletionTimestamp != nil || !selector.Matches(labels.Set(pod.Labels)) {
+			continue
+		}
+		if pod.Status.Phase == v1.PodSucceeded || pod.Status.Phase == v1.PodFailed {
+			continue
+		}
+		b := backend(podWorkload(pod))
+		b.specs = append(b.specs, &pod.Spec)
+		b.pods++
+	}
+	template := func(kind string, meta metav1.ObjectMeta, tmpl *v1.PodTemplateSpec) {
+		if meta.Namespace == svc.Namespace && selector.Matches(labels.Set(tmpl.Labels)) {
+			b := backend(kind + " " + meta.Name)
+			b.specs = append(b.specs, &tmpl.Spec)
+		}
+	}
+	for i := range s.Deployments {
+		template("Deployment", s.Deployments[i].ObjectMeta, &s.Deployments[i].Spec.Template)
+	}
+	for i := range s.DaemonSets {
+		template("DaemonSet", s.DaemonSets[i].ObjectMeta, &s.DaemonSets[i].Spec.Template)
+	}
+	for i := range s.StatefulSets {
+		template("StatefulSet", s.StatefulSets[i].ObjectMeta, &s.StatefulSets[i].Spec.Template)
+	}
+
+	var sorted []*serviceBackend
+	for _, b := range backends {
+		sorted = append(sorted, b)
+	}
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].workload < sorted[j].workload })
+	return sorted
+}
+
+// podWorkload : returns the kind and name of the workload managing the pod, the pod itself when it is bare.
+//			The ReplicaSets of a Deployment are named after it with the pod-template-hash suffix.
+func podWorkload(pod *v1.Pod) string {
+	owner := metav1.GetControllerOf(pod)
+	if owner == nil {
+		return "Pod " + pod.Name
+	}
+	if owner.Kind == "ReplicaSet" {
+		if hash := pod.Labels[appv1.DefaultDeploymentUniqueLabelKey]; hash != "" && strings.HasSuffix(owner.Name, "-"+hash) {
+			return "Deployment " + strings.TrimSuffix(owner.Name, "-"+hash)
+		}
+	}
+	return owner.Kind + " " + owner.Name
+}
+
+// endpoints : returns the Endpoints with the given namespace and name, nil if the snapshot does not know it
+func (s *ClusterSnapshot) endpoints(namespace string, name string) *v1.Endpoints {
+	for i := range s.Endpoints {
+		if s.Endpoints[i].Namespace == namespace && s.Endpoints[i].Name == name {
+			return &s.Endpoints[i]
+		}
+	}
+	return nil
+}
+
+// selectsPods : returns true if the Service routes to pods through its selector
+func selectsPods(svc *v1.Service) bool {
+	return len(svc.Spec.Selector) > 0 && svc.Spec.Type != v1.ServiceTypeExternalName
+}
+
+// exposesPort : returns true if a container of the pod spec declares the target port, by number or by name
+func exposesPort(spec *v1.PodSpec, target intstr.IntOrString, protocol v1.Protocol) bool {
+	for _, c := range spec.Containers {
+		for _, p := range c.Ports {
+			proto := p.Protocol
+			if proto == "" {
+				proto = v1.ProtocolTCP
+			}
+			if proto != protocol {
+				continue
+			}
+			if target.Type == intstr.String && p.Name == target.StrVal || target.Type == intstr.Int && p.ContainerPort == target.IntVal {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func serviceRule(id string, description string, severity Severity, evaluate func(svc *v1.Service, snapshot *ClusterSnapshot) []Finding) Rule {
+	return &funcRule{
+		id:          id,
+		description: description,
+		severity:    severity,
+		kinds:       []string{"Service"},
+		evaluate: func(obj runtime.Object, snapshot *ClusterSnapshot) []Finding {
+			svc, ok := obj.(*v1.Service)
+			if !ok || !selectsPods(svc) {
+				return nil
+			}
+			return evaluate(svc, snapshot)
+		},
+	}
+}
+
+func init() {
+	RegisterRule(serviceRule("service-no-pods", "the selector of services matches at least one pod or workload", SeverityError,
+		func(svc *v1.Service, snapshot *ClusterSnapshot) []Finding {
+			if len(snapshot.serviceBackends(svc)) > 0 {
+				return nil
+			}
+			return []Finding{{Message: "selector " + labels.SelectorFromSet(svc.Spec.Selector).String() + " matches no pod and no workload"}}
+		}))
+
+	RegisterRule(serviceRule("service-no-ready-endpoints", "the Endpoints of services have at least one ready address", SeverityError,
+		func(svc *v1.Service, snapshot *ClusterSnapshot) []Finding {
+			ep := snapshot.endpoints(svc.Namespace, svc.Name)
+			if ep == nil {
+				return nil
+			}
+			notReady := 0
+			for _, subset := range ep.Subsets {
+				if len(subset.Addresses) > 0 {
+					return nil
+				}
+				notReady += len(subset.NotReadyAddresses)
+			}
+			return []Finding{{Message: fmt.Sprintf("has no ready endpoint address, %d not ready", notReady)}}
+		}))
+
+	RegisterRule(serviceRule("service-target-ports", "the target ports of services are exposed by the containers of the selected pods", SeverityError,
+		func(svc *v1.Service, snapshot *ClusterSnapshot) []Finding {
+			backends := snapshot.serviceBackends(svc)
+			if len(backends) == 0 {
+				return nil
+			}
+			var findings []Finding
+			for _, port := range svc.Spec.Ports {
+				target := port.TargetPort
+				if target.Type == intstr.Int && target.IntVal == 0 || target.Type == intstr.String && target.StrVal == "" {
+					target = intstr.FromInt(int(port.Port))
+				}
+				protocol := port.Protocol
+				if protocol == "" {
+					protocol = v1.ProtocolTCP
+				}
+				var missing []string
+				for _, b := range backends {
+					exposed := false
+					for _, spec := range b.specs {
+						if exposesPort(spec, target, protocol) {
+							exposed = true
+							break
+						}
+					}
+					if !exposed {
+						missing = append(missing, b.workload)
+					}
+				}
+				if len(missing) > 0 {
+					findings = append(findings, Finding{Message: fmt.Sprintf("port %d targets %s/%s which is not declared by the containers of %s",
+						port.Port, target.String(), protocol, strings.Join(missing, ", "))})
+				}
+			}
+			return findings
+		}))
+
+	RegisterRule(serviceRule("service-multiple-workloads", "the selector of services matches the pods of a single workload", SeverityWarning,
+		func(svc *v1.Service, snapshot *ClusterSnapshot) []Finding {
+			backends := snapshot.serviceBackends(svc)
+			if len(backends) < 2 {
+				return nil
+			}
+			var workloads []string
+			for _, b := range backends {
+				workloads = append(workloads, b.workload)
+			}
+			return []Finding{{Message: "selector " + labels.SelectorFromSet(svc.Spec.Selector).String() + " matches the pods of " + strings.Join(workloads, ", ")}}
+		}))
+}
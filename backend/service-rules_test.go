@@ -0,0 +1,143 @@
+package backend
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	appv1 "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+func selectingService(selector map[string]string, ports ...v1.ServicePort) v1.Service {
+	return v1.Service{ObjectMeta: shopMeta("web"), Spec: v1.ServiceSpec{Selector: selector, Ports: ports}}
+}
+
+func servingPod(name string, labels map[string]string, ports ...v1.ContainerPort) v1.Pod {
+	pod := referencingPod(v1.PodSpec{Containers: []v1.Container{{Name: "app", Ports: ports}}})
+	pod.Name = name
+	pod.Labels = labels
+	return *pod
+}
+
+func servingDeployment(name string, labels map[string]string, ports ...v1.ContainerPort) appv1.Deployment {
+	return appv1.Deployment{ObjectMeta: shopMeta(name), Spec: appv1.DeploymentSpec{Template: v1.PodTemplateSpec{
+		ObjectMeta: metav1.ObjectMeta{Labels: labels},
+		Spec:       v1.PodSpec{Containers: []v1.Container{{Name: "app", Ports: ports}}},
+	}}}
+}
+
+func TestServiceRules(t *testing.T) {
+	web := map[string]string{"app": "web"}
+	http := v1.ContainerPort{Name: "http", ContainerPort: 8080}
+	controller := true
+	replicaPod := servingPod("web-5d4f7b-x2x9q", map[string]string{"app": "web", appv1.DefaultDeploymentUniqueLabelKey: "5d4f7b"}, http)
+	replicaPod.OwnerReferences = []metav1.OwnerReference{{Kind: "ReplicaSet", Name: "web-5d4f7b", Controller: &controller}}
+	finished := servingPod("web-job", web, http)
+	finished.Status.Phase = v1.PodSucceeded
+	deleting := servingPod("web-0", web, http)
+	deleting.DeletionTimestamp = &metav1.Time{}
+
+	tests := []struct {
+		name        string
+		svc         v1.Service
+		pods        []v1.Pod
+		deployments []appv1.Deployment
+		endpoints   []v1.Endpoints
+		want        []string
+	}{
+		{
+			name: "selector matching nothing",
+			svc:  selectingService(web, v1.ServicePort{Port: 80}),
+			pods: []v1.Pod{servingPod("api-0", map[string]string{"app": "api"}, http)},
+			want: []string{"service-no-pods error Service shop/web: selector app=web matches no pod and no workload"},
+		},
+		{
+			name: "finished and deleted pods",
+			svc:  selectingService(web, v1.ServicePort{Port: 80, TargetPort: intstr.FromString("http")}),
+			pods: []v1.Pod{finished, deleting},
+			want: []string{"service-no-pods error Service shop/web: selector app=web matches no pod and no workload"},
+		},
+		{
+			name: "service without selector",
+			svc:  selectingService(nil, v1.ServicePort{Port: 80}),
+		},
+		{
+			name: "ExternalName service",
+			svc:  v1.Service{ObjectMeta: shopMeta("web"), Spec: v1.ServiceSpec{Type: v1.ServiceTypeExternalName, ExternalName: "example.com", Selector: web}},
+		},
+		{
+			name:        "named target port of a deployment template",
+			svc:         selectingService(web, v1.ServicePort{Port: 80, TargetPort: intstr.FromString("http")}),
+			deployments: []appv1.Deployment{servingDeployment("web", web, http)},
+		},
+		{
+			name: "target port defaulting to the port",
+			svc:  selectingService(web, v1.ServicePort{Port: 8080}),
+			pods: []v1.Pod{servingPod("web-0", web, http)},
+		},
+		{
+			name: "target port not declared",
+			svc:  selectingService(web, v1.ServicePort{Port: 80, TargetPort: intstr.FromInt(9090)}, v1.ServicePort{Port: 443, TargetPort: intstr.FromString("https")}),
+			pods: []v1.Pod{servingPod("web-0", web, http)},
+			want: []string{
+				"service-target-ports error Service shop/web: port 80 targets 9090/TCP which is not declared by the containers of Pod web-0",
+				"service-target-ports error Service shop/web: port 443 targets https/TCP which is not declared by the containers of Pod web-0",
+			},
+		},
+		{
+			name: "protocol mismatch",
+			svc:  selectingService(web, v1.ServicePort{Port: 53, Protocol: v1.ProtocolUDP}),
+			pods: []v1.Pod{servingPod("web-0", web, v1.ContainerPort{ContainerPort: 53})},
+			want: []string{"service-target-ports error Service shop/web: port 53 targets 53/UDP which is not declared by the containers of Pod web-0"},
+		},
+		{
+			name:        "pods of several workloads",
+			svc:         selectingService(web, v1.ServicePort{Port: 80, TargetPort: intstr.FromString("http")}),
+			pods:        []v1.Pod{replicaPod},
+			deployments: []appv1.Deployment{servingDeployment("web", web, http), servingDeployment("web-canary", web, v1.ContainerPort{ContainerPort: 8080})},
+			want: []string{
+				"service-multiple-workloads warning Service shop/web: selector app=web matches the pods of Deployment web, Deployment web-canary",
+				"service-target-ports error Service shop/web: port 80 targets http/TCP which is not declared by the containers of Deployment web-canary",
+			},
+		},
+		{
+			name: "no ready endpoint",
+			svc:  selectingService(web, v1.ServicePort{Port: 8080}),
+			pods: []v1.Pod{servingPod("web-0", web, http)},
+			endpoints: []v1.Endpoints{{ObjectMeta: shopMeta("web"), Subsets: []v1.EndpointSubset{
+				{NotReadyAddresses: []v1.EndpointAddress{{IP: "10.0.0.1"}, {IP: "10.0.0.2"}}},
+			}}},
+			want: []string{"service-no-ready-endpoints error Service shop/web: has no ready endpoint address, 2 not ready"},
+		},
+		{
+			name: "ready endpoint",
+			svc:  selectingService(web, v1.ServicePort{Port: 8080}),
+			pods: []v1.Pod{servingPod("web-0", web, http)},
+			endpoints: []v1.Endpoints{{ObjectMeta: shopMeta("web"), Subsets: []v1.EndpointSubset{
+				{NotReadyAddresses: []v1.EndpointAddress{{IP: "10.0.0.1"}}},
+				{Addresses: []v1.EndpointAddress{{IP: "10.0.0.2"}}},
+			}}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			snapshot := &ClusterSnapshot{
+				Services:    []v1.Service{tt.svc},
+				Pods:        tt.pods,
+				Deployments: tt.deployments,
+				Endpoints:   tt.endpoints,
+			}
+			result, err := EvaluateRules(snapshot, CheckOptions{Rules: ServiceRules})
+			if err != nil {
+				t.Fatalf("EvaluateRules: %v", err)
+			}
+			if got := findingStrings(result.Findings); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("EvaluateRules findings =\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(tt.want, "\n"))
+			}
+		})
+	}
+}
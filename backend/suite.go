@@ -0,0 +1,485 @@
+package backend
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/client-go/kubernetes"
+	"sigs.k8s.io/yaml"
+)
+
+// Suite : a list of connectivity expectations describing the expected network topology
+type Suite struct {
+	Checks []SuiteCheck `json:"checks"`
+}
+
+// SuiteCheck : a single connectivity expectation of a suite
+type SuiteCheck struct {
+	Name string      `json:"name"`
+	From SuiteSource `json:"from"`
+	To   SuiteTarget `json:"to"`
+	// Port is the port of the target, for services the port to probe among the declared ones, by number or
+	// by name, none for every port
+	Port intstr.IntOrString `json:"port,omitempty"`
+	// Protocol is the protocol of the connection, default is TCP, or the protocol of the service port
+	Protocol v1.Protocol `json:"protocol,omitempty"`
+	// HTTP sends an HTTP request and asserts its response, for TCP connections only
+	HTTP *HTTPCheck `json:"http,omitempty"`
+	// TLS performs a TLS handshake verified by the trust store of the source pods, for TCP connections only
+	TLS    *TLSCheck   `json:"tls,omitempty"`
+	Expect Expectation `json:"expect,omitempty"`
+}
+
+// SuiteSource : the pods a check is executed from, selected by name or by label selector
+type SuiteSource struct {
+	Namespace string `json:"namespace"`
+	Pod       string `json:"pod,omitempty"`
+	Selector  string `json:"selector,omitempty"`
+}
+
+// SuiteTarget : the endpoint a check connects to, exactly one of Pod, Service or External must be set
+type SuiteTarget struct {
+	Namespace string `json:"namespace,omitempty"`
+	Pod       string `json:"pod,omitempty"`
+	Service   string `json:"service,omitempty"`
+	External  string `json:"external,omitempty"`
+	// Endpoints also probes every ready address of the Endpoints of the target service
+	Endpoints bool `json:"endpoints,omitempty"`
+}
+
+// SuiteResult : the outcome of a check executed from a single source pod
+type SuiteResult struct {
+	Check     string
+	Source    string
+	Target    string
+	Expect    Expectation
+	Connected bool
+	Strategy  ProbeStrategy
+	Verdict   Verdict
+	Passed    bool
+	Message   string
+	// Reason is the classified cause of the failure, empty when connected
+	Reason FailureReason `json:",omitempty"`
+	// Connection is the detailed outcome of the probe, empty when the check could not be executed.
+	// For external targets it is the path the pod reaches the target through, the proxy when one applies.
+	Connection ConnectionResult
+	// External is the outcome of the direct and proxied probes of an external target
+	External *ExternalConnectionResult `json:",omitempty"`
+	// Service is the outcome of the probe of a port of a target service
+	Service *ServiceConnectionResult `json:",omitempty"`
+}
+
+// SuiteReport : the aggregated outcome of a suite run
+type SuiteReport struct {
+	Results []SuiteResult
+	Passed  int
+	Failed  int
+}
+
+// LoadSuite : accepts the path of a YAML suite file
+//			returns the parsed and validated Suite
+func LoadSuite(path string) (Suite, error) {
+	var suite Suite
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return suite, fmt.Errorf("error reading suite file %s: %v", path, err)
+	}
+	if err := yaml.UnmarshalStrict(data, &suite); err != nil {
+		return suite, fmt.Errorf("error parsing suite file %s: %v", path, err)
+	}
+
+	for i := range suite.Checks {
+		if err := suite.Checks[i].validate(i); err != nil {
+			return suite, err
+		}
+	}
+	return suite, nil
+}
+
+func (c *SuiteCheck) validate(index int) error {
+	if c.Name == "" {
+		c.Name = fmt.Sprintf("check-%d", index+1)
+	}
+	parse := ParseExpectation
+	if c.To.External != "" {
+		parse = ParseExternalExpectation
+	}
+	expect, err := parse(string(c.Expect))
+	if err != nil {
+		return fmt.Errorf("check %s: %v", c.Name, err)
+	}
+	c.Expect = expect
+	if c.Protocol, err = ParseProtocol(string(c.Protocol)); err != nil {
+		return fmt.Errorf("check %s: %v", c.Name, err)
+	}
+	if c.HTTP != nil {
+		if c.Protocol != "" && c.Protocol != v1.ProtocolTCP {
+			return fmt.Errorf("check %s: http checks need the TCP protocol", c.Name)
+		}
+		if err := c.HTTP.Validate(); err != nil {
+			return fmt.Errorf("check %s: http: %v", c.Name, err)
+		}
+	}
+	if c.TLS != nil {
+		if c.HTTP != nil {
+			return fmt.Errorf("check %s: only one of http and tls can be set", c.Name)
+		}
+		if c.Protocol != "" && c.Protocol != v1.ProtocolTCP {
+			return fmt.Errorf("check %s: tls checks need the TCP protocol", c.Name)
+		}
+		if err := c.TLS.Validate(); err != nil {
+			return fmt.Errorf("check %s: tls: %v", c.Name, err)
+		}
+	}
+	if c.From.Namespace == "" {
+		c.From.Namespace = "default"
+	}
+	if (c.From.Pod == "") == (c.From.Selector == "") {
+		return fmt.Errorf("check %s: exactly one of from.pod and from.selector must be set", c.Name)
+	}
+	if c.From.Selector != "" {
+		if _, err := labels.Parse(c.From.Selector); err != nil {
+			return fmt.Errorf("check %s: invalid selector '%s': %v", c.Name, c.From.Selector, err)
+		}
+	}
+
+	targets := 0
+	for _, t := range []string{c.To.Pod, c.To.Service, c.To.External} {
+		if t != "" {
+			targets++
+		}
+	}
+	if targets != 1 {
+		return fmt.Errorf("check %s: exactly one of to.pod, to.service and to.external must be set", c.Name)
+	}
+	if c.To.Service == "" {
+		if c.Port.Type == intstr.String {
+			return fmt.Errorf("check %s: port names apply to service targets only", c.Name)
+		}
+		if c.To.Endpoints {
+			return fmt.Errorf("check %s: to.endpoints applies to service targets only", c.Name)
+		}
+	}
+	if c.To.Namespace == "" && c.To.External == "" {
+		c.To.Namespace = c.From.Namespace
+	}
+	return nil
+}
+
+// suiteSourcePods : returns the pods a check has to be executed from
+func suiteSourcePods(pods []v1.Pod, src SuiteSource) []v1.Pod {
+	var matching []v1.Pod
+
+	selector := labels.Everything()
+	if src.Selector != "" {
+		selector, _ = labels.Parse(src.Selector)
+	}
+	for _, p := range pods {
+		if p.Namespace != src.Namespace {
+			continue
+		}
+		if src.Pod != "" && p.Name != src.Pod {
+			continue
+		}
+		if selector.Matches(labels.Set(p.Labels)) {
+			matching = append(matching, p)
+		}
+	}
+	return matching
+}
+
+// namespaces : returns the namespaces of the source and target pods and services of the checks
+func (s Suite) namespaces() []string {
+	var namespaces []string
+	seen := map[string]bool{}
+	for _, c := range s.Checks {
+		for _, ns := range []string{c.From.Namespace, c.To.Namespace} {
+			if ns != "" && !seen[ns] {
+				seen[ns] = true
+				namespaces = append(namespaces, ns)
+			}
+		}
+	}
+	return namespaces
+}
+
+// ValidateProbers : returns an error when the probers of the options exclude the only prober able to run the
+//			HTTP or TLS check of a check of the suite
+func (s Suite) ValidateProbers(opts ConnectionOptions) error {
+	for _, c := range s.Checks {
+		opts.HTTP, opts.TLS = c.HTTP, c.TLS
+		if err := opts.ValidateProbers(false, false); err != nil {
+			return fmt.Errorf("check %s: %v", c.Name, err)
+		}
+	}
+	return nil
+}
+
+// probesEndpoints : returns true when a check of the suite probes the endpoints of its target service
+func (s Suite) probesEndpoints() bool {
+	for _, c := range s.Checks {
+		if c.To.Endpoints {
+			return true
+		}
+	}
+	return false
+}
+
+// RunSuite : accepts a context, a clientset, a suite and the connection options
+//			executes every check of the suite and returns the aggregated report,
+//			or an error when the pods, services and endpoints cannot be listed or the context is done
+func RunSuite(ctx context.Context, clientset kubernetes.Interface, suite Suite, opts ConnectionOptions) (SuiteReport, error) {
+	var report SuiteReport
+
+	query := QueryOptions{Namespaces: suite.namespaces()}
+	pods, err := GetPods(ctx, clientset, query)
+	if err != nil {
+		return report, err
+	}
+	svcs, err := GetServices(ctx, clientset, query)
+	if err != nil {
+		return report, err
+	}
+	var endpoints []v1.Endpoints
+	if suite.probesEndpoints() {
+		if endpoints, err = GetEndpoints(ctx, clientset, query); err != nil {
+			return report, err
+		}
+	}
+
+	for _, c := range suite.Checks {
+		if err := ctx.Err(); err != nil {
+			return report, &APIError{Op: "run check " + c.Name, Err: err}
+		}
+		for _, r := range runSuiteCheck(ctx, clientset, pods, svcs, endpoints, c, opts) {
+			if r.Passed {
+				report.Passed++
+			} else {
+				report.Failed++
+			}
+			report.Results = append(report.Results, r)
+		}
+	}
+	return report, nil
+}
+
+func runSuiteCheck(ctx context.Context, clientset kubernetes.Interface, pods []v1.Pod, svcs []v1.Service, endpoints []v1.Endpoints, c SuiteCheck, opts ConnectionOptions) []SuiteResult {
+	var results []SuiteResult
+	opts.Protocol = c.Protocol
+	opts.HTTP = c.HTTP
+	opts.TLS = c.TLS
+
+	var target string
+	switch {
+	case c.To.Pod != "":
+		target = "pod " + c.To.Namespace + "/" + c.To.Pod
+	case c.To.Service != "":
+		target = "service " + c.To.Namespace + "/" + c.To.Service
+	default:
+		target = c.To.External
+	}
+
+	sources := suiteSourcePods(pods, c.From)
+	if len(sources) == 0 {
+		source := c.From.Pod
+		if source == "" {
+			source = c.From.Selector
+		}
+		return append(results, SuiteResult{
+			Check:   c.Name,
+			Source:  c.From.Namespace + "/" + source,
+			Target:  target,
+			Expect:  c.Expect,
+			Message: "no source pod found",
+			Reason:  ReasonPodNotFound,
+		})
+	}
+
+	for _, pod := range sources {
+		r := SuiteResult{
+			Check:  c.Name,
+			Source: pod.Namespace + "/" + pod.Name,
+			Target: target,
+			Expect: c.Expect,
+		}
+
+		var result ConnectionResult
+		switch {
+		case c.To.Pod != "":
+			trgt, err := GetPodByName(pods, c.To.Pod, c.To.Namespace)
+			if err != nil {
+				r.Message = "target pod not found"
+				r.Reason = ReasonTargetNotFound
+				results = append(results, r)
+				continue
+			}
+			result = ConnectionPodToPod(clientset, pod, trgt, c.Port.IntValue(), opts)
+		case c.To.Service != "":
+			svc, err := GetServiceByName(svcs, c.To.Service, c.To.Namespace)
+			if err != nil {
+				r.Message = "target service not found"
+				r.Reason = ReasonTargetNotFound
+				results = append(results, r)
+				continue
+			}
+			var ep *v1.Endpoints
+			if c.To.Endpoints {
+				if ep = findEndpoints(endpoints, svc.Namespace, svc.Name); ep == nil {
+					r.Message = "endpoints of the target service not found"
+					r.Reason = ReasonTargetNotFound
+					results = append(results, r)
+					continue
+				}
+			}
+			results = append(results, runSuiteServiceCheck(clientset, pod, svc, pods, ep, c, opts, r)...)
+			continue
+		default:
+			config, err := PodProxyConfig(ctx, clientset, pod)
+			if err != nil {
+				r.Message = fmt.Sprintf("error reading the proxy environment of the pod: %v", err)
+				r.Reason = proxyConfigFailure(err)
+				results = append(results, r)
+				continue
+			}
+			external := ConnectionPodToExternalWithProxy(clientset, pod, c.To.External, c.Port.IntValue(), config, opts)
+			check := EvaluateExternalConnection(external, c.Expect)
+			r.External = &external
+			r.Connection = check.Effective()
+			r.Connected = check.Connected()
+			r.Strategy = r.Connection.Strategy
+			r.Reason = check.Reason
+			r.Verdict = check.Verdict
+			r.Passed = check.Passed
+			r.Message = string(r.Verdict)
+			if external.Proxy != "" {
+				r.Message += ", via proxy " + RedactProxy(external.Proxy)
+			}
+			r.Message += assertionFailures(r.Connection)
+			results = append(results, r)
+			continue
+		}
+
+		r.Connected = result.Connected
+		r.Strategy = result.Strategy
+		r.Connection = result
+		r.Reason = result.Reason
+		check := EvaluateConnection(result, c.Expect)
+		r.Verdict = check.Verdict
+		r.Passed = check.Passed
+		r.Message = string(r.Verdict) + assertionFailures(result)
+		results = append(results, r)
+	}
+	return results
+}
+
+// proxyConfigFailure : returns the reason the proxy environment of a source pod could not be read
+func proxyConfigFailure(err error) FailureReason {
+	switch {
+	case errors.Is(err, ErrForbidden):
+		return ReasonExecForbidden
+	case errors.Is(err, ErrNotFound):
+		return ReasonPodNotFound
+	}
+	return ReasonConnectionFailed
+}
+
+// runSuiteServiceCheck : probes the ports of the service selected by the check from the pod, every declared
+//			port when the check sets none, and the endpoints when given, and returns a result per port
+//			from the base result r
+func runSuiteServiceCheck(clientset kubernetes.Interface, pod v1.Pod, svc v1.Service, pods []v1.Pod, endpoints *v1.Endpoints, c SuiteCheck, opts ConnectionOptions, r SuiteResult) []SuiteResult {
+	port := ""
+	if c.Port != (intstr.IntOrString{}) {
+		port = c.Port.String()
+	}
+	ports, err := ResolveServicePorts(svc, port, c.Protocol)
+	if err != nil {
+		r.Message = err.Error()
+		return []SuiteResult{r}
+	}
+	if (opts.HTTP != nil || opts.TLS != nil) && len(ports) > 1 {
+		r.Message = "the HTTP and TLS checks apply to a single port of the service, select it with port"
+		return []SuiteResult{r}
+	}
+
+	var results []SuiteResult
+	for _, result := range ConnectionPodToServicePorts(clientset, pod, svc, ports, serviceBackends(pods, svc), endpoints, opts) {
+		result := result
+		check := EvaluateServiceConnection(result, c.Expect)
+		res := r
+		res.Target += " port " + check.Port()
+		res.Service = &result
+		res.Connection = result.Service
+		res.Connected = result.Service.Connected
+		res.Strategy = result.Service.Strategy
+		res.Reason = result.Service.Reason
+		res.Verdict = check.Service.Verdict
+		res.Passed = check.Passed
+		res.Message = string(res.Verdict) + assertionFailures(result.Service) + serviceFailures(check)
+		results = append(results, res)
+	}
+	return results
+}
+
+// serviceBackends : returns the pods of the namespace of the service matched by its selector, none when it has
+//			no selector
+func serviceBackends(pods []v1.Pod, svc v1.Service) []v1.Pod {
+	var backends []v1.Pod
+	if len(svc.Spec.Selector) == 0 {
+		return backends
+	}
+	selector := labels.SelectorFromSet(svc.Spec.Selector)
+	for _, p := range pods {
+		if p.Namespace == svc.Namespace && selector.Matches(labels.Set(p.Labels)) {
+			backends = append(backends, p)
+		}
+	}
+	return backends
+}
+
+// serviceFailures : returns the endpoints not meeting the expectation and, for a check expecting connections,
+//			the unresolved target port and the missing ready endpoints, each preceded by a comma
+func serviceFailures(check ServiceConnectionCheck) string {
+	message := ""
+	for _, ep := range check.Endpoints {
+		if ep.Passed {
+			continue
+		}
+		message += ", endpoint " + ep.Address
+		if ep.Pod != "" {
+			message += " (pod " + ep.Pod + ")"
+		}
+		message += " " + string(ep.Verdict)
+		if ep.Reason != "" {
+			message += " (" + string(ep.Reason) + ")"
+		}
+		message += assertionFailures(ep.ConnectionResult)
+	}
+	if check.Service.Expect == ExpectDeny {
+		return message
+	}
+	for _, failure := range []string{check.unresolvedFailure(), check.unreadyFailure()} {
+		if failure != "" {
+			message += ", " + failure
+		}
+	}
+	return message
+}
+
+// assertionFailures : returns the failed HTTP and TLS assertions of the result, each preceded by a comma
+func assertionFailures(result ConnectionResult) string {
+	message := ""
+	if result.HTTP != nil && len(result.HTTP.Failures) > 0 {
+		message += ", " + strings.Join(result.HTTP.Failures, ", ")
+	}
+	if result.TLS != nil && len(result.TLS.Failures) > 0 {
+		message += ", " + strings.Join(result.TLS.Failures, ", ")
+	}
+	return message
+}
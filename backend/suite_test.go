@@ -0,0 +1,255 @@
+package backend
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func loadTestSuite(t *testing.T, content string) (Suite, error) {
+	path := filepath.Join(t.TempDir(), "suite.yaml")
+	if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return LoadSuite(path)
+}
+
+func TestLoadSuite(t *testing.T) {
+	tests := []struct {
+		name  string
+		suite string
+		want  SuiteCheck
+		err   string
+	}{
+		{
+			name:  "defaults",
+			suite: "checks:\n- from: {pod: web}\n  to: {pod: db}\n",
+			want: SuiteCheck{
+				Name:   "check-1",
+				From:   SuiteSource{Namespace: "default", Pod: "web"},
+				To:     SuiteTarget{Namespace: "default", Pod: "db"},
+				Expect: ExpectAllow,
+			},
+		},
+		{
+			name:  "service port by name with endpoints",
+			suite: "checks:\n- name: web\n  from: {namespace: shop, selector: app=web}\n  to: {service: db, endpoints: true}\n  port: postgres\n  protocol: tcp\n  expect: deny\n",
+			want: SuiteCheck{
+				Name:     "web",
+				From:     SuiteSource{Namespace: "shop", Selector: "app=web"},
+				To:       SuiteTarget{Namespace: "shop", Service: "db", Endpoints: true},
+				Port:     intstr.FromString("postgres"),
+				Protocol: v1.ProtocolTCP,
+				Expect:   ExpectDeny,
+			},
+		},
+		{
+			name:  "external port by number",
+			suite: "checks:\n- from: {pod: web}\n  to: {external: example.com}\n  port: 443\n  expect: proxy-only\n",
+			want: SuiteCheck{
+				Name:   "check-1",
+				From:   SuiteSource{Namespace: "default", Pod: "web"},
+				To:     SuiteTarget{External: "example.com"},
+				Port:   intstr.FromInt(443),
+				Expect: ExpectProxyOnly,
+			},
+		},
+		{
+			name:  "source pod and selector",
+			suite: "checks:\n- from: {pod: web, selector: app=web}\n  to: {pod: db}\n",
+			err:   "exactly one of from.pod and from.selector must be set",
+		},
+		{
+			name:  "invalid selector",
+			suite: "checks:\n- from: {selector: 'app in web'}\n  to: {pod: db}\n",
+			err:   "invalid selector",
+		},
+		{
+			name:  "no target",
+			suite: "checks:\n- from: {pod: web}\n",
+			err:   "exactly one of to.pod, to.service and to.external must be set",
+		},
+		{
+			name:  "two targets",
+			suite: "checks:\n- from: {pod: web}\n  to: {pod: db, service: db}\n",
+			err:   "exactly one of to.pod, to.service and to.external must be set",
+		},
+		{
+			name:  "port name of a pod",
+			suite: "checks:\n- from: {pod: web}\n  to: {pod: db}\n  port: postgres\n",
+			err:   "port names apply to service targets only",
+		},
+		{
+			name:  "endpoints of an external target",
+			suite: "checks:\n- from: {pod: web}\n  to: {external: example.com, endpoints: true}\n",
+			err:   "to.endpoints applies to service targets only",
+		},
+		{
+			name:  "proxy-only expectation of a pod",
+			suite: "checks:\n- from: {pod: web}\n  to: {pod: db}\n  expect: proxy-only\n",
+			err:   "invalid expectation",
+		},
+		{
+			name:  "http check over UDP",
+			suite: "checks:\n- from: {pod: web}\n  to: {service: db}\n  protocol: UDP\n  http: {path: /}\n",
+			err:   "http checks need the TCP protocol",
+		},
+		{
+			name:  "unknown field",
+			suite: "checks:\n- from: {pod: web}\n  to: {pod: db}\n  ports: 80\n",
+			err:   "error parsing suite file",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			suite, err := loadTestSuite(t, tt.suite)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("LoadSuite error = %v, want %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("LoadSuite: %v", err)
+			}
+			if len(suite.Checks) != 1 || !reflect.DeepEqual(suite.Checks[0], tt.want) {
+				t.Errorf("LoadSuite checks = %+v, want %+v", suite.Checks, tt.want)
+			}
+		})
+	}
+}
+
+// suitePod : returns a pod of the shop namespace with the IP, backends serve http on 8080 and metrics on 9090
+func suitePod(name string, ip string, labels map[string]string) *v1.Pod {
+	pod := testPod(name, "shop", labels)
+	pod.Status.PodIP = ip
+	container := v1.Container{Name: name}
+	if labels["app"] == "backend" {
+		container.Ports = []v1.ContainerPort{{Name: "http", ContainerPort: 8080}, {Name: "metrics", ContainerPort: 9090}}
+	}
+	pod.Spec.Containers = []v1.Container{container}
+	return pod
+}
+
+func TestRunSuite(t *testing.T) {
+	proxied := suitePod("proxied", "10.0.0.4", map[string]string{"app": "proxied"})
+	proxied.Spec.Containers[0].EnvFrom = []v1.EnvFromSource{{ConfigMapRef: &v1.ConfigMapEnvSource{LocalObjectReference: v1.LocalObjectReference{Name: "proxy"}}}}
+	backend := &v1.Service{
+		ObjectMeta: metav1.ObjectMeta{Name: "backend", Namespace: "shop"},
+		Spec: v1.ServiceSpec{
+			Selector: map[string]string{"app": "backend"},
+			Ports: []v1.ServicePort{
+				{Name: "http", Port: 80, TargetPort: intstr.FromString("http")},
+				{Name: "metrics", Port: 9090, TargetPort: intstr.FromInt(9090)},
+			},
+		},
+	}
+	endpoints := &v1.Endpoints{
+		ObjectMeta: metav1.ObjectMeta{Name: "backend", Namespace: "shop"},
+		Subsets: []v1.EndpointSubset{{
+			Addresses: []v1.EndpointAddress{
+				{IP: "10.0.0.2", TargetRef: &v1.ObjectReference{Kind: "Pod", Namespace: "shop", Name: "backend-0"}},
+				{IP: "10.0.0.3", TargetRef: &v1.ObjectReference{Kind: "Pod", Namespace: "shop", Name: "backend-1"}},
+			},
+			Ports: []v1.EndpointPort{{Name: "http", Port: 8080}, {Name: "metrics", Port: 9090}},
+		}},
+	}
+	clientset := fake.NewSimpleClientset(
+		suitePod("frontend", "10.0.0.1", map[string]string{"app": "frontend"}),
+		suitePod("backend-0", "10.0.0.2", map[string]string{"app": "backend"}),
+		suitePod("backend-1", "10.0.0.3", map[string]string{"app": "backend"}),
+		proxied, backend, endpoints,
+	)
+	clientset.PrependReactor("list", "configmaps", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, apierrors.NewForbidden(schema.GroupResource{Resource: "configmaps"}, "", fmt.Errorf("denied"))
+	})
+	// backend-1 does not serve http, the metrics port of the service is blocked
+	fakeNetwork(t, "frontend 10.0.0.2 8080", "frontend backend.shop 80")
+
+	suite, err := loadTestSuite(t, `
+checks:
+- name: pod
+  from: {namespace: shop, pod: frontend}
+  to: {pod: backend-0}
+  port: 8080
+- name: service
+  from: {namespace: shop, selector: app=frontend}
+  to: {service: backend}
+- name: endpoints
+  from: {namespace: shop, pod: frontend}
+  to: {service: backend, endpoints: true}
+  port: http
+- name: deny
+  from: {namespace: shop, selector: app=backend}
+  to: {pod: frontend}
+  port: 80
+  expect: deny
+- name: missing-source
+  from: {namespace: shop, pod: ghost}
+  to: {pod: frontend}
+- name: proxied
+  from: {namespace: shop, pod: proxied}
+  to: {external: https://example.com}
+`)
+	if err != nil {
+		t.Fatalf("LoadSuite: %v", err)
+	}
+	opts := ConnectionOptions{Strategy: ProbeStrategyExec, Probers: []string{"nc"}}
+
+	report, err := RunSuite(context.Background(), clientset, suite, opts)
+	if err != nil {
+		t.Fatalf("RunSuite: %v", err)
+	}
+
+	var got []string
+	for _, r := range report.Results {
+		got = append(got, fmt.Sprintf("%s %s -> %s passed=%t reason=%s: %s", r.Check, r.Source, r.Target, r.Passed, r.Reason, r.Message))
+	}
+	want := []string{
+		"pod shop/frontend -> pod shop/backend-0 passed=true reason=: open as expected",
+		"service shop/frontend -> service shop/backend port 80/TCP (http) passed=true reason=: open as expected",
+		"service shop/frontend -> service shop/backend port 9090/TCP (metrics) passed=false reason=ConnectionRefused: unexpectedly blocked",
+		"endpoints shop/frontend -> service shop/backend port 80/TCP (http) passed=false reason=: open as expected, endpoint 10.0.0.3 (pod shop/backend-1) unexpectedly blocked (ConnectionRefused)",
+		"deny shop/backend-0 -> pod shop/frontend passed=true reason=ConnectionRefused: blocked as expected",
+		"deny shop/backend-1 -> pod shop/frontend passed=true reason=ConnectionRefused: blocked as expected",
+		"missing-source shop/ghost -> pod shop/frontend passed=false reason=PodNotFound: no source pod found",
+		"proxied shop/proxied -> https://example.com passed=false reason=ExecForbidden: error reading the proxy environment of the pod: failed to list configmaps: configmaps is forbidden: denied",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("RunSuite results =\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+	if report.Passed != 4 || report.Failed != 4 {
+		t.Errorf("RunSuite passed %d, failed %d, want 4 and 4", report.Passed, report.Failed)
+	}
+}
+
+func TestProxyConfigFailure(t *testing.T) {
+	tests := []struct {
+		err  error
+		want FailureReason
+	}{
+		{&APIError{Op: "list secrets", Err: apierrors.NewForbidden(schema.GroupResource{Resource: "secrets"}, "", fmt.Errorf("denied"))}, ReasonExecForbidden},
+		{&APIError{Op: "list configmaps", Err: apierrors.NewUnauthorized("expired token")}, ReasonExecForbidden},
+		{&NotFoundError{Kind: "configmap", Namespace: "shop", Name: "proxy"}, ReasonPodNotFound},
+		{&APIError{Op: "list configmaps", Err: fmt.Errorf("connection refused")}, ReasonConnectionFailed},
+	}
+	for _, tt := range tests {
+		if got := proxyConfigFailure(tt.err); got != tt.want {
+			t.Errorf("proxyConfigFailure(%v) = %s, want %s", tt.err, got, tt.want)
+		}
+	}
+}
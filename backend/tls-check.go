@@ -0,0 +1,320 @@
+package backend
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"net"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+// TLSCheck : the TLS handshake of a connection check, verified with the trust store of the pod, and the assertions
+// on the certificate the server presents
+type TLSCheck struct {
+	// ServerName is sent as SNI and matched against the certificate, default is the host of the target
+	ServerName string `json:"serverName,omitempty"`
+	// CAFile is the CA bundle of the pod verifying the chain, default is the system trust store of the pod
+	CAFile string `json:"caFile,omitempty"`
+	// MinValidity is the minimum remaining validity of the certificates of the chain, e.g. 720h
+	MinValidity string `json:"minValidity,omitempty"`
+	// MinVersion is the minimum negotiated TLS version: 1.0, 1.1, 1.2 or 1.3
+	MinVersion string `json:"minVersion,omitempty"`
+}
+
+// TLSCertificate : a certificate of the chain presented by the server
+type TLSCertificate struct {
+	Subject   string
+	Issuer    string
+	DNSNames  []string `json:",omitempty"`
+	IPs       []string `json:",omitempty"`
+	NotBefore time.Time
+	NotAfter  time.Time
+	IsCA      bool
+	// SHA256 is the fingerprint of the certificate
+	SHA256 string
+}
+
+// TLSHandshake : the values measured by a TLS check
+type TLSHandshake struct {
+	ServerName string
+	// Version is the negotiated protocol, e.g. TLSv1.3
+	Version string
+	Cipher  string
+	// Chain is the chain presented by the server, leaf first
+	Chain []TLSCertificate
+	// TrustStore is the trust store that verified the chain: the CA file, pod, or probe image when the probe
+	// could not read the trust store of the pod
+	TrustStore string
+	// Trusted is true when the trust store accepts the chain, else VerifyError is the reason
+	Trusted     bool
+	VerifyError string `json:",omitempty"`
+}
+
+// TLSResult : the measured handshake of a TLS check and the assertions it failed
+type TLSResult struct {
+	Handshake TLSHandshake
+	Failures  []string `json:",omitempty"`
+}
+
+// tlsVersions : the TLS versions, in the format of openssl
+var tlsVersions = map[string]string{"1.0": "TLSv1", "1.1": "TLSv1.1", "1.2": "TLSv1.2", "1.3": "TLSv1.3"}
+
+// Validate : returns an error when an assertion of the check cannot be parsed
+func (c TLSCheck) Validate() error {
+	if c.MinValidity != "" {
+		if _, err := time.ParseDuration(c.MinValidity); err != nil {
+			return fmt.Errorf("invalid min validity '%s': %v", c.MinValidity, err)
+		}
+	}
+	if _, ok := tlsVersions[c.MinVersion]; c.MinVersion != "" && !ok {
+		return fmt.Errorf("invalid min version '%s': must be one of 1.0, 1.1, 1.2, 1.3", c.MinVersion)
+	}
+	return nil
+}
+
+// tlsVersionRank : returns the rank of a TLS version in the format of openssl, 0 when unknown
+func tlsVersionRank(version string) int {
+	for i, v := range []string{"TLSv1", "TLSv1.1", "TLSv1.2", "TLSv1.3"} {
+		if v == version {
+			return i + 1
+		}
+	}
+	return 0
+}
+
+// Evaluate : accepts the measured handshake
+//			returns the assertions of the check the handshake fails: a chain the trust store rejects, a server name
+//			the leaf certificate does not cover, certificates expired or expiring within the minimum validity
+//			and a protocol older than the minimum version
+func (c TLSCheck) Evaluate(handshake TLSHandshake) []string {
+	var failures []string
+	if !handshake.Trusted {
+		failures = append(failures, fmt.Sprintf("the %s trust store rejects the chain: %s", handshake.TrustStore, handshake.VerifyError))
+	}
+	if len(handshake.Chain) == 0 {
+		return append(failures, "the server presented no certificate")
+	}
+	leaf := handshake.Chain[0]
+	if !leaf.covers(handshake.ServerName) {
+		failures = append(failures, fmt.Sprintf("certificate of %s does not cover %s", leaf.Subject, handshake.ServerName))
+	}
+	now := time.Now()
+	minValidity, _ := time.ParseDuration(c.MinValidity)
+	for _, cert := range handshake.Chain {
+		switch {
+		case now.After(cert.NotAfter):
+			failures = append(failures, fmt.Sprintf("certificate %s expired on %s", cert.Subject, cert.NotAfter.Format(time.RFC3339)))
+		case now.Before(cert.NotBefore):
+			failures = append(failures, fmt.Sprintf("certificate %s is not valid before %s", cert.Subject, cert.NotBefore.Format(time.RFC3339)))
+		case minValidity > 0 && cert.NotAfter.Sub(now) < minValidity:
+			failures = append(failures, fmt.Sprintf("certificate %s expires on %s, within %s", cert.Subject, cert.NotAfter.Format(time.RFC3339), minValidity))
+		}
+	}
+	if c.MinVersion != "" && tlsVersionRank(handshake.Version) < tlsVersionRank(tlsVersions[c.MinVersion]) {
+		failures = append(failures, fmt.Sprintf("negotiated %s is older than %s", handshake.Version, tlsVersions[c.MinVersion]))
+	}
+	return failures
+}
+
+// covers : returns whether the SANs of the certificate cover the server name, the common name is ignored as by current clients
+func (cert TLSCertificate) covers(serverName string) bool {
+	c := &x509.Certificate{DNSNames: cert.DNSNames}
+	for _, ip := range cert.IPs {
+		c.IPAddresses = append(c.IPAddresses, net.ParseIP(ip))
+	}
+	return c.VerifyHostname(serverName) == nil
+}
+
+// tlsServerName : returns the server name of the TLS check of the target
+func tlsServerName(target ProbeTarget) string {
+	if target.TLS.ServerName != "" {
+		return target.TLS.ServerName
+	}
+	return target.Host
+}
+
+// tlsAddress : returns the host:port of the TLS check of the target, the port defaults to 443
+func tlsAddress(target ProbeTarget) string {
+	port := target.Port
+	if port == 0 {
+		port = 443
+	}
+	return net.JoinHostPort(target.Host, strconv.Itoa(port))
+}
+
+// tlsProber : probes the TLS checks with openssl, which prints the chain presented by the server, the negotiated
+// protocol and cipher, and the verification of the chain by the trust store of the container
+type tlsProber struct{}
+
+func (tlsProber) Name() string {
+	return "openssl-tls"
+}
+
+func (tlsProber) Protocols() []v1.Protocol {
+	return []v1.Protocol{v1.ProtocolTCP}
+}
+
+func (tlsProber) RequiredBinaries() []string {
+	return []string{"openssl"}
+}
+
+func (tlsProber) Command(target ProbeTarget) (string, error) {
+	if target.TLS == nil {
+		return "", fmt.Errorf("openssl-tls only probes TLS checks")
+	}
+	// s_client completes the handshake and exits on the end of stdin, a rejected chain does not abort it
+	command := "echo | openssl s_client -connect " + shellQuote(tlsAddress(target)) + " -servername " + shellQuote(tlsServerName(target)) + " -showcerts"
+	if target.TLS.CAFile != "" {
+		command += " -CAfile " + shellQuote(target.TLS.CAFile)
+	}
+	if target.Proxy != "" {
+		u, err := url.Parse(target.Proxy)
+		if err != nil || u.Scheme != "http" {
+			return "", fmt.Errorf("openssl-tls only tunnels through http proxies")
+		}
+		command += " -proxy " + shellQuote(u.Host)
+		if u.User != nil {
+			password, _ := u.User.Password()
+			command += " -proxy_user " + shellQuote(u.User.Username()) + " -proxy_pass " + shellQuote("pass:"+password)
+		}
+	}
+	return command + " 2>&1", nil
+}
+
+func (tlsProber) Interpret(exitCode int, stdout string, stderr string) error {
+	if exitCode != 0 {
+		return fmt.Errorf("exit code %d%s", exitCode, tlsError(stdout+"\n"+stderr))
+	}
+	if _, err := parseTLSHandshake(stdout); err != nil {
+		return err
+	}
+	return nil
+}
+
+// tlsError : returns ": " followed by the error of a failed openssl handshake, or the first line of the output
+func tlsError(output string) string {
+	for _, l := range strings.Split(output, "\n") {
+		if strings.Contains(l, "errno=") || strings.Contains(l, ":error:") || strings.Contains(l, "connect:") {
+			return ": " + strings.TrimSpace(l)
+		}
+	}
+	return firstLine(output)
+}
+
+var (
+	tlsNewSessionRe = regexp.MustCompile(`(?m)^New, (\S+), Cipher is (\S+)`)
+	tlsProtocolRe   = regexp.MustCompile(`(?m)^\s*Protocol\s*:\s*(\S+)`)
+	tlsCipherRe     = regexp.MustCompile(`(?m)^\s*Cipher\s*:\s*(\S+)`)
+	tlsVerifyRe     = regexp.MustCompile(`(?m)^\s*Verify return code: (\d+) \((.*)\)`)
+	tlsTrustStoreRe = regexp.MustCompile(`(?m)^Trust store: (.+)$`)
+)
+
+// parseTLSHandshake : accepts the output of a TLS probe, in the format of openssl s_client -showcerts, where the
+//			kubensure probe prints the certificates as JSON lines following the probe marker to fit in the
+//			termination message
+//			returns the measured handshake, without server name
+func parseTLSHandshake(output string) (TLSHandshake, error) {
+	var handshake TLSHandshake
+	for _, line := range strings.Split(output, "\n") {
+		if data := strings.TrimPrefix(line, probeMarker+" cert "); data != line {
+			var cert TLSCertificate
+			if err := json.Unmarshal([]byte(data), &cert); err != nil {
+				return handshake, fmt.Errorf("invalid certificate in the TLS probe output: %v", err)
+			}
+			handshake.Chain = append(handshake.Chain, cert)
+		}
+	}
+	// the kubensure probe prints the certificates on marker lines and may relay the PEM chain of openssl,
+	// which is only parsed without them
+	rest := []byte(output)
+	for len(handshake.Chain) == 0 {
+		var block *pem.Block
+		if block, rest = pem.Decode(rest); block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return handshake, fmt.Errorf("invalid certificate presented by the server: %v", err)
+		}
+		handshake.Chain = append(handshake.Chain, tlsCertificate(cert))
+	}
+	if len(handshake.Chain) == 0 {
+		return handshake, fmt.Errorf("no TLS handshake%s", tlsError(output))
+	}
+
+	if m := tlsNewSessionRe.FindStringSubmatch(output); m != nil {
+		handshake.Version, handshake.Cipher = m[1], m[2]
+	}
+	if m := tlsProtocolRe.FindStringSubmatch(output); m != nil && handshake.Version == "" {
+		handshake.Version = m[1]
+	}
+	if m := tlsCipherRe.FindStringSubmatch(output); m != nil && (handshake.Cipher == "" || handshake.Cipher == "(NONE)") {
+		handshake.Cipher = m[1]
+	}
+	handshake.TrustStore = "pod"
+	if m := tlsTrustStoreRe.FindStringSubmatch(output); m != nil {
+		handshake.TrustStore = strings.TrimSpace(m[1])
+	}
+	m := tlsVerifyRe.FindStringSubmatch(output)
+	if m == nil {
+		return handshake, fmt.Errorf("no verification of the chain in the TLS probe output")
+	}
+	handshake.Trusted = m[1] == "0"
+	if !handshake.Trusted {
+		handshake.VerifyError = m[2]
+	}
+	return handshake, nil
+}
+
+// tlsCertificate : returns the reported fields of a certificate
+func tlsCertificate(cert *x509.Certificate) TLSCertificate {
+	sum := sha256.Sum256(cert.Raw)
+	c := TLSCertificate{
+		Subject:   cert.Subject.String(),
+		Issuer:    cert.Issuer.String(),
+		DNSNames:  cert.DNSNames,
+		NotBefore: cert.NotBefore,
+		NotAfter:  cert.NotAfter,
+		IsCA:      cert.IsCA,
+		SHA256:    hex.EncodeToString(sum[:]),
+	}
+	for _, ip := range cert.IPAddresses {
+		c.IPs = append(c.IPs, ip.String())
+	}
+	return c
+}
+
+// evaluateTLS : sets the measured handshake and the failed assertions of the TLS check of a connected result
+func evaluateTLS(result *ConnectionResult, target ProbeTarget) {
+	if target.TLS == nil || !result.Connected {
+		return
+	}
+	for i := len(result.Attempts) - 1; i >= 0; i-- {
+		a := result.Attempts[i]
+		if a.Reason != "" || a.Error != "" {
+			continue
+		}
+		handshake, err := parseTLSHandshake(a.Stdout)
+		if err != nil {
+			continue
+		}
+		handshake.ServerName = tlsServerName(target)
+		if handshake.TrustStore == "pod" && target.TLS.CAFile != "" {
+			handshake.TrustStore = target.TLS.CAFile
+		}
+		result.TLS = &TLSResult{Handshake: handshake, Failures: target.TLS.Evaluate(handshake)}
+		return
+	}
+}
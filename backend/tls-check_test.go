@@ -0,0 +1,98 @@
+package backend
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"reflect"
+	"testing"
+	"time"
+)
+
+const tlsCertLine = probeMarker + ` cert {"Subject":"CN=web.shop.svc","Issuer":"CN=shop-ca","DNSNames":["web.shop.svc"],"NotBefore":"2026-01-01T00:00:00Z","NotAfter":"2027-01-01T00:00:00Z","IsCA":false,"SHA256":"ab"}`
+
+// testCertPEM : returns a self-signed certificate of the common name in PEM, as printed by openssl -showcerts
+func testCertPEM(t *testing.T, cn string) string {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: cn},
+		DNSNames:     []string{cn},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}))
+}
+
+func TestParseTLSHandshake(t *testing.T) {
+	pemCert := testCertPEM(t, "web.shop.svc")
+	tests := []struct {
+		name    string
+		output  string
+		want    TLSHandshake
+		wantErr bool
+	}{
+		{
+			name:   "trusted by the pod",
+			output: "CONNECTED(00000003)\n" + tlsCertLine + "\n---\nNew, TLSv1.3, Cipher is TLS_AES_256_GCM_SHA384\nVerify return code: 0 (ok)\n",
+			want:   TLSHandshake{Version: "TLSv1.3", Cipher: "TLS_AES_256_GCM_SHA384", TrustStore: "pod", Trusted: true},
+		},
+		{
+			name:   "untrusted by a CA file",
+			output: tlsCertLine + "\nNew, TLSv1.2, Cipher is ECDHE-RSA-AES128-GCM-SHA256\nTrust store: /etc/ssl/shop-ca.pem\nVerify return code: 19 (self-signed certificate in certificate chain)\n",
+			want:   TLSHandshake{Version: "TLSv1.2", Cipher: "ECDHE-RSA-AES128-GCM-SHA256", TrustStore: "/etc/ssl/shop-ca.pem", VerifyError: "self-signed certificate in certificate chain"},
+		},
+		{
+			name:   "openssl chain",
+			output: "CONNECTED(00000003)\n---\nCertificate chain\n 0 s:CN = web.shop.svc\n" + pemCert + "---\nNew, TLSv1.3, Cipher is TLS_AES_256_GCM_SHA384\nVerify return code: 0 (ok)\n",
+			want:   TLSHandshake{Version: "TLSv1.3", Cipher: "TLS_AES_256_GCM_SHA384", TrustStore: "pod", Trusted: true},
+		},
+		{
+			name:   "probe certificates with the openssl chain",
+			output: tlsCertLine + "\n" + pemCert + "New, TLSv1.3, Cipher is TLS_AES_256_GCM_SHA384\nVerify return code: 0 (ok)\n",
+			want:   TLSHandshake{Version: "TLSv1.3", Cipher: "TLS_AES_256_GCM_SHA384", TrustStore: "pod", Trusted: true},
+		},
+		{
+			name:    "no handshake",
+			output:  "connect: Connection refused\nconnect:errno=111\n",
+			wantErr: true,
+		},
+		{
+			name:    "no verification",
+			output:  tlsCertLine + "\nNew, TLSv1.3, Cipher is TLS_AES_256_GCM_SHA384\n",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handshake, err := parseTLSHandshake(tt.output)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("parseTLSHandshake succeeded, want an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseTLSHandshake: %v", err)
+			}
+			if len(handshake.Chain) != 1 || handshake.Chain[0].Subject != "CN=web.shop.svc" {
+				t.Errorf("chain = %+v, want the certificate of web.shop.svc", handshake.Chain)
+			}
+			handshake.Chain = nil
+			if !reflect.DeepEqual(handshake, tt.want) {
+				t.Errorf("parseTLSHandshake = %+v, want %+v", handshake, tt.want)
+			}
+		})
+	}
+}
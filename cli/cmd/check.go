@@ -0,0 +1,185 @@
+package cmd
+
+/*
+Copyright © 2021 Phil Ranzato philranzato@gmail.com
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/PhilRanzato/kubensure/backend"
+	"github.com/spf13/cobra"
+)
+
+var namespacesCheck []string
+var rulesCheck []string
+var failOnCheck string
+var manifestsCheck []string
+var protectedNamespacesCheck []string
+var listRulesCheck bool
+var ruleFilesCheck []string
+
+// checkCmd represents the check command
+var checkCmd = &cobra.Command{
+	Use:   "check",
+	Short: "Evaluate the consistency rules on the resources of the cluster.",
+	Long: `
+Evaluate the consistency rules on the resources of the cluster.
+
+Every registered rule is evaluated on the Deployments, DaemonSets, StatefulSets and
+the pods not managed by a controller of the selected namespaces, either read from
+the cluster or from manifest files. The built-in rules flag containers without
+resource requests and limits, images tagged 'latest', containers without liveness
+or readiness probes, privileged containers and single-replica Deployments in
+protected namespaces. A namespace is protected when listed with
+'--protected-namespaces', under the 'protectedNamespaces' key of the configuration
+file, or when labelled 'kubensure.io/protected=true'.
+
+Custom rules evaluating an expression on the objects are declared in rule files,
+listed under the 'ruleFiles' key of the configuration file or with '--rule-files':
+
+  rules:
+  - id: team-label
+    kinds: [Deployment, StatefulSet]
+    match:
+      namespaces: [shop]
+    expression: .metadata.labels.team exists && .metadata.labels.cost-center exists
+    message: '{{.Kind}} {{.Name}} must be labelled with its team and cost-center'
+  - id: allowed-registries
+    severity: error
+    kinds: [Deployment, DaemonSet, StatefulSet]
+    expression: .spec.template.spec.containers[*].image =~ '^registry.example.com/'
+
+The command exits with a non-zero code when a finding is at least as serious as
+'--fail-on'.
+
+Usage examples:
+
+  # Check the workloads of namespace 'shop'
+
+  kubensure check -n shop
+
+  # Check every namespace, only failing on errors
+
+  kubensure check -A --fail-on error
+
+  # Check the manifests of a repository with a subset of the rules
+
+  kubensure check -f manifests/ --rules image-latest-tag,privileged
+
+  # Check the house rules of a rule file only
+
+  kubensure check -A --rule-files rules.yaml --rules team-label,allowed-registries
+
+  # List the registered rules
+
+  kubensure check --list-rules
+
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		runCheck(cmd, nil)
+	},
+}
+
+// runCheck evaluates the rules selected by '--rules', or the given rules by default, and exits
+// with the exit code of the report
+func runCheck(cmd *cobra.Command, defaultRules []string) {
+	if cmd.Flags().Changed("protected-namespaces") {
+		backend.RegisterRule(backend.NewSingleReplicaRule(protectedNamespacesCheck))
+	}
+	for _, file := range ruleFilesCheck {
+		registerRuleFile(file)
+	}
+	if listRulesCheck {
+		printRules()
+		return
+	}
+
+	failOn, err := backend.ParseSeverity(failOnCheck)
+	if err != nil {
+		exitUsage(err)
+	}
+	rules := rulesCheck
+	if len(rules) == 0 {
+		rules = defaultRules
+	}
+
+	var snapshot backend.ClusterSnapshot
+	var query backend.QueryOptions
+	if len(manifestsCheck) > 0 {
+		query = queryOptions(namespacesCheck)
+		snapshot, err = backend.LoadClusterSnapshot(manifestsCheck)
+		if err != nil {
+			exitUsage(err)
+		}
+	} else {
+		if len(namespacesCheck) == 0 {
+			namespacesCheck = []string{backend.GetNamespace()}
+		}
+		query = queryOptions(namespacesCheck)
+		snapshot, err = backend.GetClusterSnapshot(context.Background(), clientSet(), query)
+		if err != nil {
+			exitWithError(err)
+		}
+	}
+
+	result, err := backend.EvaluateRules(&snapshot, backend.CheckOptions{Rules: rules, FailOn: failOn, Query: query})
+	if err != nil {
+		exitUsage(err)
+	}
+	report := result.Report()
+	printResult(result, report, func() { printFindings(result) })
+	exitWithReport(report)
+}
+
+func printRules() {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "RULE\tSEVERITY\tKINDS\tDESCRIPTION")
+	for _, r := range backend.Rules() {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", r.ID(), r.Severity(), strings.Join(r.Kinds(), ","), r.Description())
+	}
+	w.Flush()
+}
+
+func printFindings(result backend.CheckResult) {
+	if len(result.Findings) > 0 {
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "SEVERITY\tRULE\tOBJECT\tMESSAGE")
+		for _, f := range result.Findings {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", f.Severity, f.Rule, f.Object(), f.Message)
+		}
+		w.Flush()
+		fmt.Println()
+	}
+	fmt.Printf("%d findings on %d objects, %d of severity %s or higher\n", len(result.Findings), result.Objects, result.Failed(), result.FailOn)
+}
+
+func init() {
+	rootCmd.AddCommand(checkCmd)
+
+	checkCmd.PersistentFlags().StringSliceVarP(&namespacesCheck, "namespaces", "n", nil, "Namespaces of the resources to check (default is the namespace of the current context, or every namespace of the manifests)")
+	addQueryFlags(checkCmd.PersistentFlags())
+	checkCmd.PersistentFlags().StringSliceVar(&rulesCheck, "rules", nil, "Rules to evaluate (default is every registered rule, or the rules of the subcommand)")
+	checkCmd.PersistentFlags().StringVar(&failOnCheck, "fail-on", "warning", "Minimum severity of the findings making the command fail: info, warning or error")
+	checkCmd.PersistentFlags().StringSliceVarP(&manifestsCheck, "filename", "f", nil, "Manifest files or directories to read instead of the cluster")
+	checkCmd.PersistentFlags().StringSliceVar(&protectedNamespacesCheck, "protected-namespaces", nil, "Namespaces where Deployments must run more than one replica (default is the 'protectedNamespaces' key of the config file)")
+	checkCmd.PersistentFlags().StringSliceVar(&ruleFilesCheck, "rule-files", nil, "Additional rule files, on top of the 'ruleFiles' key of the config file")
+	checkCmd.PersistentFlags().BoolVar(&listRulesCheck, "list-rules", false, "List the registered rules and exit")
+	checkCmd.SuggestionsMinimumDistance = 2
+}
@@ -0,0 +1,64 @@
+package cmd
+
+/*
+Copyright © 2021 Phil Ranzato philranzato@gmail.com
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+import (
+	"github.com/PhilRanzato/kubensure/backend"
+	"github.com/spf13/cobra"
+)
+
+// checkReferencesCmd represents the check references command
+var checkReferencesCmd = &cobra.Command{
+	Use:   "references",
+	Short: "Report dangling references of the workloads and orphaned ConfigMaps, Secrets and PVCs.",
+	Long: `
+Report dangling references of the workloads and orphaned ConfigMaps, Secrets and PVCs.
+
+The 'dangling-references' rule flags every Pod, Deployment, DaemonSet, StatefulSet and
+Ingress referencing a ConfigMap, a Secret, a key of them, a ServiceAccount, a
+PersistentVolumeClaim or a Service port that does not exist, in envFrom, env,
+volumes, imagePullSecrets, serviceAccountName, ingress backends and TLS. Optional
+references are ignored.
+
+The 'orphaned-objects' rule lists, with the info severity, the ConfigMaps, Secrets
+and PersistentVolumeClaims nothing references. Objects consumed by Jobs that are
+not running, or by tools outside of the cluster, are reported as well.
+
+Usage examples:
+
+  # Report the dangling references of namespace 'shop', failing on them only
+
+  kubensure check references -n shop --fail-on error
+
+  # Also fail on orphaned objects
+
+  kubensure check references -n shop --fail-on info
+
+  # Check the references of the manifests of a repository
+
+  kubensure check references -f manifests/
+
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		runCheck(cmd, backend.ReferenceRules)
+	},
+}
+
+func init() {
+	checkCmd.AddCommand(checkReferencesCmd)
+	checkReferencesCmd.SuggestionsMinimumDistance = 2
+}
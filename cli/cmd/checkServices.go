@@ -0,0 +1,64 @@
+package cmd
+
+/*
+Copyright © 2021 Phil Ranzato philranzato@gmail.com
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+import (
+	"github.com/PhilRanzato/kubensure/backend"
+	"github.com/spf13/cobra"
+)
+
+// checkServicesCmd represents the check services command
+var checkServicesCmd = &cobra.Command{
+	Use:   "services",
+	Short: "Report Services that exist but route nowhere.",
+	Long: `
+Report Services that exist but route nowhere.
+
+The selector of every Service is correlated with the pods, the workloads and the
+Endpoints of its namespace. Services without selector and ExternalName Services
+are skipped. The following rules are evaluated:
+
+  service-no-pods              the selector matches no pod and no workload template
+  service-no-ready-endpoints   the Endpoints have no ready address
+  service-target-ports         a targetPort, by number or by name, is not declared
+                               by the containers of a selected workload
+  service-multiple-workloads   the selector matches the pods of several workloads
+
+Usage examples:
+
+  # Check the Services of namespace 'shop'
+
+  kubensure check services -n shop
+
+  # Check the Services of every namespace, as a JUnit report
+
+  kubensure check services -A -o junit
+
+  # Check the Services of the manifests of a repository against their workloads
+
+  kubensure check services -f manifests/
+
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		runCheck(cmd, backend.ServiceRules)
+	},
+}
+
+func init() {
+	checkCmd.AddCommand(checkServicesCmd)
+	checkServicesCmd.SuggestionsMinimumDistance = 2
+}
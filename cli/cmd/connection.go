@@ -17,9 +17,29 @@ limitations under the License.
 */
 
 import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/PhilRanzato/kubensure/backend"
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	v1 "k8s.io/api/core/v1"
 )
 
+var connectionExpect string
+var probeStrategy string
+var probeImage string
+var probers []string
+var verboseConnection bool
+var connectionProtocol string
+var httpConnection bool
+var httpCheckConnection backend.HTTPCheck
+var httpMaxLatencyConnection time.Duration
+var tlsConnection bool
+var tlsCheckConnection backend.TLSCheck
+var tlsMinValidityConnection time.Duration
+
 // connectionCmd represents the connection command
 var connectionCmd = &cobra.Command{
 	Use:   "connection",
@@ -27,6 +47,27 @@ var connectionCmd = &cobra.Command{
 	Long: `
 Check connection from a pod to a service or to another pod or to an external endpoint.
 
+By default a check passes when the connection succeeds. Use '--expect deny' to
+verify that a connection is blocked, for example by a NetworkPolicy. The exit
+code is non-zero when the expectation does not hold.
+
+Connections are probed by exec'ing wget, curl, nmap, nc or telnet into the source
+pod. When none of them is available, for example in distroless images, the probe
+falls back to an ephemeral container attached to the source pod and then to a
+short-lived pod running on the node of the source pod, with the labels of the
+source pod that NetworkPolicies select on. The fallback runs the kubensure-probe
+image, see '--probe-strategy' and '--probe-image'. Additional probers can be
+declared under the 'probers' key of the configuration file. The probe pod does not
+copy the pod-template-hash, controller-revision-hash and job labels, so that the
+controller of the source pod does not adopt it, is labeled kubensure/probe=true and
+never becomes ready, so that services do not send traffic to it.
+
+Connections are probed over TCP unless '--protocol' selects udp or sctp; the ports
+of a service are probed with their own protocol. UDP has no handshake: the UDP
+probers, dig on port 53 and nc, only succeed when the target answers the DNS
+query or the datagram. SCTP is probed with ncat or socat, and requires the sctp
+kernel module on the node.
+
 `,
 	// Args: cobra.ExactArgs(2),
 }
@@ -34,4 +75,337 @@ Check connection from a pod to a service or to another pod or to an external end
 func init() {
 	rootCmd.AddCommand(connectionCmd)
 	rootCmd.SuggestionsMinimumDistance = 2
+
+	connectionCmd.PersistentFlags().StringVar(&connectionExpect, "expect", "allow", "Expected result of the connection: allow or deny, or proxy-only for external endpoints")
+	connectionCmd.PersistentFlags().StringVar(&connectionProtocol, "protocol", "", "Protocol of the connections: tcp, udp or sctp (default is tcp, or every protocol of the ports of a service)")
+	addProbeFlags(connectionCmd.PersistentFlags())
+}
+
+// addProbeFlags defines the flags selecting how connections are probed
+func addProbeFlags(flags *pflag.FlagSet) {
+	flags.StringVar(&probeStrategy, "probe-strategy", "auto", "How connections are probed: auto, exec, ephemeral or pod")
+	flags.StringVar(&probeImage, "probe-image", backend.DefaultProbeImage, "Image of the ephemeral container or pod running the probe")
+	flags.StringSliceVar(&probers, "probers", nil, "Probers to try in the source pod, in order (default is every registered prober), must include curl-http, openssl-tls, curl-proxy or curl-perf for the checks only they run")
+	flags.BoolVarP(&verboseConnection, "verbose", "v", false, "Print the command, exit code, output and duration of every probe attempt")
+}
+
+// addHTTPFlags defines the flags of the HTTP assertions of a connection check
+func addHTTPFlags(flags *pflag.FlagSet) {
+	flags.BoolVar(&httpConnection, "http", false, "Send an HTTP request and assert its response, implied by the other --http flags")
+	flags.StringVar(&httpCheckConnection.Scheme, "http-scheme", "", "Scheme of the HTTP request: http or https (default is the scheme of the URL, or https on port 443)")
+	flags.StringVar(&httpCheckConnection.Path, "http-path", "", "Path and query of the HTTP request (default is /)")
+	flags.StringVar(&httpCheckConnection.Method, "http-method", "", "Method of the HTTP request (default is GET)")
+	flags.StringVar(&httpCheckConnection.Status, "http-status", "", "Accepted status codes and ranges, e.g. 200-299,301 (default is 200-399)")
+	flags.StringArrayVar(&httpCheckConnection.BodyContains, "http-body-contains", nil, "Substring the response body must contain, repeatable")
+	flags.StringVar(&httpCheckConnection.BodyRegex, "http-body-regex", "", "Regular expression the response body must match")
+	flags.StringArrayVar(&httpCheckConnection.Headers, "http-header", nil, "Header the response must carry, as 'Name' or 'Name: regular expression of the value', repeatable")
+	flags.BoolVar(&httpCheckConnection.FollowRedirects, "http-follow-redirects", false, "Follow the redirects and assert the last response")
+	flags.StringVar(&httpCheckConnection.RedirectTo, "http-redirect-to", "", "Regular expression the Location of the redirect response must match")
+	flags.DurationVar(&httpMaxLatencyConnection, "http-max-latency", 0, "Maximum duration of the HTTP request, e.g. 500ms")
+	flags.BoolVar(&httpCheckConnection.HTTP2, "http2", false, "Negotiate HTTP/2 and fail when the server answers with HTTP/1.x")
+}
+
+// httpCheckOption returns the HTTP check set by the HTTP flags, nil when none of them is set
+func httpCheckOption(flags *pflag.FlagSet) *backend.HTTPCheck {
+	set := false
+	flags.Visit(func(f *pflag.Flag) {
+		set = set || strings.HasPrefix(f.Name, "http")
+	})
+	if !set {
+		return nil
+	}
+	check := httpCheckConnection
+	if httpMaxLatencyConnection > 0 {
+		check.MaxLatency = httpMaxLatencyConnection.String()
+	}
+	if err := check.Validate(); err != nil {
+		exitUsage(err)
+	}
+	if protocol := protocolOption(); protocol != "" && protocol != v1.ProtocolTCP {
+		exitUsage("the HTTP assertions need the TCP protocol")
+	}
+	return &check
+}
+
+// addTLSFlags defines the flags of the TLS inspection of a connection check
+func addTLSFlags(flags *pflag.FlagSet) {
+	flags.BoolVar(&tlsConnection, "tls", false, "Perform a TLS handshake verified by the trust store of the pod, implied by the other --tls flags")
+	flags.StringVar(&tlsCheckConnection.ServerName, "tls-server-name", "", "Server name sent as SNI and matched against the certificate (default is the host of the target)")
+	flags.StringVar(&tlsCheckConnection.CAFile, "tls-ca-file", "", "Path of the CA bundle in the pod verifying the chain (default is the system trust store of the pod)")
+	flags.DurationVar(&tlsMinValidityConnection, "tls-min-validity", 0, "Minimum remaining validity of the certificates of the chain, e.g. 720h")
+	flags.StringVar(&tlsCheckConnection.MinVersion, "tls-min-version", "", "Minimum negotiated TLS version: 1.0, 1.1, 1.2 or 1.3")
+}
+
+// tlsCheckOption returns the TLS check set by the TLS flags, nil when none of them is set
+func tlsCheckOption(flags *pflag.FlagSet) *backend.TLSCheck {
+	set := false
+	flags.Visit(func(f *pflag.Flag) {
+		set = set || strings.HasPrefix(f.Name, "tls")
+	})
+	if !set {
+		return nil
+	}
+	check := tlsCheckConnection
+	if tlsMinValidityConnection > 0 {
+		check.MinValidity = tlsMinValidityConnection.String()
+	}
+	if err := check.Validate(); err != nil {
+		exitUsage(err)
+	}
+	if protocol := protocolOption(); protocol != "" && protocol != v1.ProtocolTCP {
+		exitUsage("the TLS inspection needs the TCP protocol")
+	}
+	return &check
+}
+
+// checkOptions returns the connection options completed with the HTTP or TLS check set by the flags
+func checkOptions(flags *pflag.FlagSet) backend.ConnectionOptions {
+	opts := connectionOptions()
+	opts.HTTP = httpCheckOption(flags)
+	opts.TLS = tlsCheckOption(flags)
+	if opts.HTTP != nil && opts.TLS != nil {
+		exitUsage("the --http and --tls flags cannot be combined")
+	}
+	if err := opts.ValidateProbers(false, false); err != nil {
+		exitUsage(err)
+	}
+	return opts
+}
+
+// connectionOptions returns the connection options set by the probe flags
+func connectionOptions() backend.ConnectionOptions {
+	strategy, err := backend.ParseProbeStrategy(probeStrategy)
+	if err != nil {
+		exitUsage(err)
+	}
+	return backend.ConnectionOptions{
+		Strategy:   strategy,
+		ProbeImage: probeImage,
+		Probers:    probers,
+		Quiet:      !textOutput(),
+		Protocol:   protocolOption(),
+	}
+}
+
+// protocolOption returns the protocol set by the '--protocol' flag, empty when not set
+func protocolOption() v1.Protocol {
+	protocol, err := backend.ParseProtocol(connectionProtocol)
+	if err != nil {
+		exitUsage(err)
+	}
+	return protocol
+}
+
+// reportConnection prints the result of a connection check evaluated against the '--expect' flag
+// and exits with a non-zero code when the expectation does not hold or the connection could not be checked
+func reportConnection(from string, to string, result backend.ConnectionResult) {
+	expect, err := backend.ParseExpectation(connectionExpect)
+	if err != nil {
+		exitUsage(err)
+	}
+
+	check := backend.EvaluateConnection(result, expect)
+	printResult(check, check.Report(), func() {
+		if check.Connected {
+			fmt.Printf("Pod %s can connect to %s: %s (%s)\n", from, to, check.Verdict, probeSummary(result))
+		} else {
+			fmt.Printf("Pod %s cannot connect to %s: %s (%s)\n", from, to, check.Verdict, probeSummary(result))
+		}
+		printHTTPResult(result.HTTP)
+		printTLSResult(result.TLS)
+		if verboseConnection {
+			printProbeAttempts(result)
+		}
+	})
+
+	exitWithReport(check.Report())
+}
+
+// reportServiceConnection prints the verdict of each port of the service, and of each of its ready
+// endpoints when probed, and exits with the exit code of the report
+func reportServiceConnection(from string, to string, results []backend.ServiceConnectionResult) {
+	expect, err := backend.ParseExpectation(connectionExpect)
+	if err != nil {
+		exitUsage(err)
+	}
+
+	checks := backend.EvaluateServiceConnections(results, expect)
+	printResult(checks, checks.Report(), func() {
+		for _, check := range checks {
+			verb := "cannot"
+			if check.Service.Connected {
+				verb = "can"
+			}
+			fmt.Printf("Pod %s %s connect to %s port %s: %s (%s)\n", from, verb, to, check.Port(), check.Service.Verdict, probeSummary(check.Service.ConnectionResult))
+			printHTTPResult(check.Service.HTTP)
+			printTLSResult(check.Service.TLS)
+			if verboseConnection {
+				printProbeAttempts(check.Service.ConnectionResult)
+			}
+			if len(check.Unresolved) > 0 {
+				fmt.Printf("  target port %s is not declared by the containers of pods %s\n", check.TargetPort, strings.Join(check.Unresolved, ", "))
+			}
+			if !check.EndpointsProbed {
+				continue
+			}
+			for _, ep := range check.Endpoints {
+				backendName := ep.Target
+				if ep.Pod != "" {
+					backendName += " (pod " + ep.Pod + ")"
+				}
+				fmt.Printf("  endpoint %s port %d: %s (%s)\n", backendName, ep.Port, ep.Verdict, probeSummary(ep.ConnectionResult))
+				printHTTPResult(ep.HTTP)
+				printTLSResult(ep.TLS)
+				if verboseConnection {
+					printProbeAttempts(ep.ConnectionResult)
+				}
+			}
+			if len(check.Endpoints) == 0 {
+				fmt.Printf("  no ready endpoint address\n")
+			}
+			if check.NotReady > 0 {
+				fmt.Printf("  %d not ready endpoint addresses were not probed\n", check.NotReady)
+			}
+		}
+	})
+
+	exitWithReport(checks.Report())
+}
+
+// reportExternalConnection prints the results of the direct and proxied probes of an external endpoint
+// evaluated against the '--expect' flag and exits with the exit code of the report
+func reportExternalConnection(from string, to string, result backend.ExternalConnectionResult) {
+	expect, err := backend.ParseExternalExpectation(connectionExpect)
+	if err != nil {
+		exitUsage(err)
+	}
+
+	check := backend.EvaluateExternalConnection(result, expect)
+	printResult(check, check.Report(), func() {
+		verb := "cannot"
+		if check.Connected() {
+			verb = "can"
+		}
+		fmt.Printf("Pod %s %s connect to %s: %s\n", from, verb, to, check.Verdict)
+		if proxies := proxySummary(result.ProxyConfig); proxies != "" {
+			fmt.Printf("  proxy environment of container %s: %s\n", result.ProxyConfig.Container, proxies)
+		}
+		paths := []struct {
+			name   string
+			result *backend.ConnectionResult
+		}{{"directly", &result.Direct}, {"via proxy " + backend.RedactProxy(result.Proxy), result.ViaProxy}}
+		for _, path := range paths {
+			if path.result == nil {
+				if expect == backend.ExpectProxyOnly || proxySummary(result.ProxyConfig) != "" {
+					fmt.Printf("  no proxy applies to %s\n", to)
+				}
+				continue
+			}
+			state := "blocked"
+			if path.result.Connected {
+				state = "open"
+			}
+			fmt.Printf("  %s: %s (%s)\n", path.name, state, probeSummary(*path.result))
+			printHTTPResult(path.result.HTTP)
+			printTLSResult(path.result.TLS)
+			if verboseConnection {
+				printProbeAttempts(*path.result)
+			}
+		}
+	})
+
+	exitWithReport(check.Report())
+}
+
+// proxySummary returns the proxy variables set in the proxy environment, empty when none is set
+func proxySummary(config backend.ProxyConfig) string {
+	var vars []string
+	for _, v := range []struct{ name, value string }{{"HTTP_PROXY", backend.RedactProxy(config.HTTPProxy)}, {"HTTPS_PROXY", backend.RedactProxy(config.HTTPSProxy)}, {"NO_PROXY", config.NoProxy}} {
+		if v.value != "" {
+			vars = append(vars, v.name+"="+v.value)
+		}
+	}
+	return strings.Join(vars, " ")
+}
+
+// printHTTPResult prints the measured response of an HTTP check and the assertions it failed
+func printHTTPResult(result *backend.HTTPResult) {
+	if result == nil {
+		return
+	}
+	r := result.Response
+	fmt.Printf("  %s %d, %d bytes, first byte after %s, total %s\n", r.Protocol, r.Status, r.BodySize, r.FirstByte.Round(time.Millisecond), r.Latency.Round(time.Millisecond))
+	if r.Location != "" {
+		fmt.Printf("  redirect to %s\n", r.Location)
+	}
+	for _, f := range result.Failures {
+		fmt.Printf("  assertion failed: %s\n", f)
+	}
+}
+
+// printTLSResult prints the measured handshake of a TLS check, its chain and the assertions it failed
+func printTLSResult(result *backend.TLSResult) {
+	if result == nil {
+		return
+	}
+	h := result.Handshake
+	trust := "trusted"
+	if !h.Trusted {
+		trust = "not trusted: " + h.VerifyError
+	}
+	fmt.Printf("  %s %s, server name %s, %s by the %s trust store\n", h.Version, h.Cipher, h.ServerName, trust, h.TrustStore)
+	for i, c := range h.Chain {
+		fmt.Printf("  %d subject %s\n", i, c.Subject)
+		fmt.Printf("    issuer %s\n", c.Issuer)
+		if names := append(append([]string(nil), c.DNSNames...), c.IPs...); len(names) > 0 {
+			fmt.Printf("    SANs %s\n", strings.Join(names, ", "))
+		}
+		fmt.Printf("    valid from %s to %s, %d days left\n", c.NotBefore.Format(time.RFC3339), c.NotAfter.Format(time.RFC3339), int(time.Until(c.NotAfter).Hours()/24))
+	}
+	for _, f := range result.Failures {
+		fmt.Printf("  assertion failed: %s\n", f)
+	}
+}
+
+// printProbeAttempts prints the details of every probe attempt of the result
+func printProbeAttempts(result backend.ConnectionResult) {
+	for _, a := range result.Attempts {
+		status := "ok"
+		if a.Error != "" {
+			status = a.Error
+		}
+		fmt.Printf("  %s: %s\n", a.Prober, status)
+		if a.Command != "" {
+			fmt.Printf("    command:   %s\n", a.Command)
+		}
+		if !a.Available {
+			continue
+		}
+		fmt.Printf("    exit code: %d\n", a.ExitCode)
+		fmt.Printf("    duration:  %s\n", a.Duration)
+		if a.Reason != "" {
+			fmt.Printf("    reason:    %s\n", a.Reason)
+		}
+		if out := strings.TrimSpace(a.Stdout); out != "" {
+			fmt.Printf("    stdout:    %s\n", strings.ReplaceAll(out, "\n", "\n               "))
+		}
+		if out := strings.TrimSpace(a.Stderr); out != "" {
+			fmt.Printf("    stderr:    %s\n", strings.ReplaceAll(out, "\n", "\n               "))
+		}
+	}
+	if result.Error != "" {
+		fmt.Printf("  error: %s\n", result.Error)
+	}
+}
+
+// probeSummary returns the strategy and the prober that produced the result, or the reason of the failure
+func probeSummary(result backend.ConnectionResult) string {
+	summary := "probe strategy: " + string(result.Strategy)
+	if result.Prober != "" {
+		summary += ", prober: " + result.Prober
+	}
+	if result.Reason != "" {
+		summary += ", reason: " + string(result.Reason)
+	}
+	return summary
 }
@@ -0,0 +1,174 @@
+package cmd
+
+/*
+Copyright © 2021 Phil Ranzato philranzato@gmail.com
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"text/tabwriter"
+
+	"github.com/PhilRanzato/kubensure/backend"
+	"github.com/spf13/cobra"
+	v1 "k8s.io/api/core/v1"
+)
+
+var namespacesMatrix []string
+var portsMatrix []int
+var parallelMatrix int
+var comparePolicyMatrix bool
+
+// connectionMatrixCmd represents the connection matrix command
+var connectionMatrixCmd = &cobra.Command{
+	Use:   "matrix",
+	Short: "Check connection between every pair of selected pods.",
+	Long: `
+Check connection between every pair of selected pods.
+
+Every running pod of the selected namespaces is probed from every other selected pod,
+on the given ports or, by default, on the TCP ports declared by the target containers.
+The result is rendered as an allow/deny grid, '?' when the connection could not be
+probed, e.g. without probing tool. With '--compare-policy' every other cell is
+compared against the verdict computed from the declared NetworkPolicies, mismatches
+are marked with '!' and make the command exit with a non-zero code.
+
+Usage examples:
+
+  # Probe every pod of namespaces 'front' and 'back' against each other
+
+  kubensure connection matrix -n front,back
+
+  # Probe port 8080 of the pods labelled 'tier=api' and compare with the NetworkPolicies
+
+  kubensure connection matrix -n back -l tier=api -p 8080 --compare-policy
+
+  # Probe the pods of every namespace scheduled on node 'node-1'
+
+  kubensure connection matrix -A --field-selector spec.nodeName=node-1
+
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(namespacesMatrix) == 0 {
+			namespacesMatrix = []string{backend.GetNamespace()}
+		}
+
+		query := queryOptions(namespacesMatrix)
+		cs := clientSet()
+		selected, err := backend.GetPods(context.Background(), cs, query)
+		if err != nil {
+			exitWithError(err)
+		}
+		var pods []v1.Pod
+		for _, p := range selected {
+			if p.Status.Phase == v1.PodRunning && backend.GetPodIP(p) != "" {
+				pods = append(pods, p)
+			}
+		}
+		if len(pods) < 2 {
+			fmt.Fprintln(os.Stderr, "At least two running pods must be selected to build a matrix")
+			os.Exit(backend.ExitNotFound)
+		}
+
+		var snapshot *backend.PolicySnapshot
+		if comparePolicyMatrix {
+			s, err := backend.GetPolicySnapshot(context.Background(), cs)
+			if err != nil {
+				exitWithError(err)
+			}
+			snapshot = &s
+		}
+
+		matrix := backend.ConnectionMatrix(cs, pods, portsMatrix, parallelMatrix, connectionOptions(), snapshot)
+		report := matrix.Report()
+		printResult(matrix, report, func() { printMatrix(pods, matrix) })
+		exitWithReport(report)
+	},
+}
+
+func printMatrix(pods []v1.Pod, matrix backend.Matrix) {
+	cells := map[string]backend.MatrixCell{}
+	for _, c := range matrix.Cells {
+		cells[c.Source+"|"+c.Target+"|"+strconv.Itoa(c.Port)] = c
+	}
+
+	for i, name := range matrix.Pods {
+		fmt.Printf("%d\t%s\n", i+1, name)
+	}
+	fmt.Println()
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprint(w, "FROM\\TO")
+	for i, dst := range pods {
+		for _, port := range backend.MatrixTargetPorts(dst, portsMatrix, protocolOption()) {
+			if port == 0 {
+				fmt.Fprintf(w, "\t%d", i+1)
+			} else {
+				fmt.Fprintf(w, "\t%d:%d", i+1, port)
+			}
+		}
+	}
+	fmt.Fprintln(w)
+
+	for i, src := range matrix.Pods {
+		fmt.Fprintf(w, "%d", i+1)
+		for _, dst := range pods {
+			for _, port := range backend.MatrixTargetPorts(dst, portsMatrix, protocolOption()) {
+				c, ok := cells[src+"|"+dst.Namespace+"/"+dst.Name+"|"+strconv.Itoa(port)]
+				switch {
+				case !ok:
+					fmt.Fprint(w, "\t-")
+				case c.Inconclusive():
+					fmt.Fprint(w, "\t?")
+				case c.Mismatch:
+					fmt.Fprintf(w, "\t%s!", matrixCellValue(c.Connected))
+				default:
+					fmt.Fprintf(w, "\t%s", matrixCellValue(c.Connected))
+				}
+			}
+		}
+		fmt.Fprintln(w)
+	}
+	w.Flush()
+
+	if matrix.Mismatches > 0 {
+		fmt.Printf("\n%d probes disagree with the NetworkPolicies:\n", matrix.Mismatches)
+		for _, c := range matrix.Cells {
+			if c.Mismatch {
+				fmt.Printf("  %s -> %s port %d: probe %s, policy %s\n", c.Source, c.Target, c.Port, matrixCellValue(c.Connected), matrixCellValue(c.Policy.Allowed))
+			}
+		}
+	}
+}
+
+func matrixCellValue(allowed bool) string {
+	if allowed {
+		return "allow"
+	}
+	return "deny"
+}
+
+func init() {
+	connectionCmd.AddCommand(connectionMatrixCmd)
+
+	connectionMatrixCmd.Flags().StringSliceVarP(&namespacesMatrix, "namespaces", "n", nil, "Namespaces of the pods to probe (default is the namespace of the current context)")
+	addQueryFlags(connectionMatrixCmd.Flags())
+	connectionMatrixCmd.Flags().IntSliceVarP(&portsMatrix, "ports", "p", nil, "Target ports (default are the ports of the protocol declared by the target containers)")
+	connectionMatrixCmd.Flags().IntVar(&parallelMatrix, "parallel", 10, "Maximum number of concurrent probes")
+	connectionMatrixCmd.Flags().BoolVar(&comparePolicyMatrix, "compare-policy", false, "Compare every probe with the verdict computed from the NetworkPolicies")
+	connectionMatrixCmd.SuggestionsMinimumDistance = 2
+}
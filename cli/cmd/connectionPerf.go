@@ -0,0 +1,172 @@
+package cmd
+
+/*
+Copyright © 2021 Phil Ranzato philranzato@gmail.com
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/PhilRanzato/kubensure/backend"
+	"github.com/spf13/cobra"
+	v1 "k8s.io/api/core/v1"
+)
+
+var podNsPerf string
+var targetNsPerf string
+var portPerf int
+var perfOptions backend.PerfOptions
+var throughputPerf bool
+var throughputMBPerf int64
+var throughputToPerf string
+
+// connectionPerfCmd represents the connectionPerf command
+var connectionPerfCmd = &cobra.Command{
+	Use:   "perf",
+	Short: "Measure the latency and the throughput of the connections of a pod.",
+	Long: `
+Measure the latency and the throughput of the connections of a pod.
+
+The connection from the pod to the endpoint is repeated --count times, or for
+--duration, each sample on a new connection. The min, avg, p50, p95, p99 and max
+of the connect latency are reported, and of the first byte latency for http and
+https URLs. The samples are measured inside the pod, with curl or with the
+kubensure-probe image, so that they do not include the round trips to the API
+server. The check fails when a sample does not connect.
+
+--throughput starts a temporary probe server pod running the kubensure-probe
+image, downloads --throughput-mb from it to the pod and deletes it. The server
+runs in the namespace of the pod, or on the node and in the namespace of the pod
+given by --throughput-to to measure the path between two pods. The server pod
+has no labels: NetworkPolicies selecting pods by label do not apply to it.
+
+Usage examples:
+
+  # Measure the connect latency from pod 'example' of namespace 'test' to service 'db' on port 5432
+
+  kubensure connection perf example -n test db.test.svc -p 5432
+
+  # Measure the first byte latency of https://api.example.com for a minute, a sample per second
+
+  kubensure connection perf example -n test https://api.example.com --duration 1m --interval 1s
+
+  # Measure the throughput from the node of pod 'target' of namespace 'prod' to pod 'example'
+
+  kubensure connection perf example -n test --throughput-to target -t prod --throughput-mb 500
+
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if throughputToPerf != "" {
+			throughputPerf = true
+		}
+		if len(args) < 1 || len(args) < 2 && !throughputPerf {
+			exitUsage(`'kubensure connection perf' needs two arguments: <PodName> and <Endpoint>, the endpoint is optional with --throughput.
+See 'kubensure connection perf -h' for more information`)
+		}
+		if protocol := protocolOption(); protocol != "" && protocol != v1.ProtocolTCP {
+			exitUsage("'kubensure connection perf' only measures tcp connections")
+		}
+		if len(args) > 1 && portPerf == 0 {
+			if u, err := url.Parse(args[1]); err != nil || u.Scheme == "" || u.Host == "" {
+				exitUsage("the port of the endpoint is required, see --port")
+			}
+		}
+		if perfOptions.Count <= 0 && perfOptions.Duration <= 0 {
+			exitUsage("--count or --duration must be positive")
+		}
+		if throughputMBPerf <= 0 {
+			exitUsage("--throughput-mb must be positive")
+		}
+
+		opts := connectionOptions()
+		if err := opts.ValidateProbers(false, true); err != nil {
+			exitUsage(err)
+		}
+
+		cs := clientSet()
+		pod, err := backend.FindPod(context.Background(), cs, args[0], namespaceOrCurrent(podNsPerf))
+		if err != nil {
+			exitWithError(err)
+		}
+		var result backend.PerfResult
+		if len(args) > 1 {
+			result = backend.MeasureLatency(cs, pod, args[1], portPerf, perfOptions, opts)
+		} else {
+			result.Source = pod.Namespace + "/" + pod.Name
+		}
+		if throughputPerf {
+			namespace, node := pod.Namespace, ""
+			if throughputToPerf != "" {
+				trgt, err := backend.FindPod(context.Background(), cs, throughputToPerf, namespaceOrCurrent(targetNsPerf))
+				if err != nil {
+					exitWithError(err)
+				}
+				namespace, node = trgt.Namespace, trgt.Spec.NodeName
+			}
+			throughput := backend.MeasureThroughput(cs, pod, namespace, node, throughputMBPerf*1000*1000, opts)
+			result.Throughput = &throughput
+		}
+
+		printResult(result, result.Report(), func() { printPerfResult(args[0], result) })
+		exitWithReport(result.Report())
+	},
+}
+
+func init() {
+	connectionCmd.AddCommand(connectionPerfCmd)
+
+	connectionPerfCmd.Flags().StringVarP(&podNsPerf, "pod-ns", "n", "", "Pod namespace (default is the namespace of the current context)")
+	connectionPerfCmd.Flags().IntVarP(&portPerf, "port", "p", 0, "Endpoint port (default is the port of the URL)")
+	connectionPerfCmd.Flags().IntVar(&perfOptions.Count, "count", backend.DefaultPerfCount, "Number of samples")
+	connectionPerfCmd.Flags().DurationVar(&perfOptions.Duration, "duration", 0, "Duration of the measurement, instead of a number of samples")
+	connectionPerfCmd.Flags().DurationVar(&perfOptions.Interval, "interval", 0, "Pause between two samples")
+	connectionPerfCmd.Flags().BoolVar(&throughputPerf, "throughput", false, "Measure the throughput of a transfer from a temporary probe server pod")
+	connectionPerfCmd.Flags().Int64Var(&throughputMBPerf, "throughput-mb", 100, "Size of the transfer of the throughput test, in MB")
+	connectionPerfCmd.Flags().StringVar(&throughputToPerf, "throughput-to", "", "Pod on whose node and in whose namespace the probe server runs, implies --throughput")
+	connectionPerfCmd.Flags().StringVarP(&targetNsPerf, "target-ns", "t", "", "Namespace of the --throughput-to pod (default is the namespace of the current context)")
+	connectionPerfCmd.SuggestionsMinimumDistance = 2
+
+}
+
+// printPerfResult prints the latency distributions and the throughput of a perf result
+func printPerfResult(from string, result backend.PerfResult) {
+	if result.Target != "" {
+		fmt.Printf("Pod %s to %s: %d samples, %d failed (%s)\n", from, result.Target, result.Samples, result.Failures,
+			probeSummary(backend.ConnectionResult{Strategy: result.Strategy, Prober: result.Prober, Reason: result.Reason}))
+		if result.Connect != nil {
+			fmt.Printf("  %-11s %s\n", "connect:", result.Connect)
+		}
+		if result.FirstByte != nil {
+			fmt.Printf("  %-11s %s\n", "first byte:", result.FirstByte)
+		}
+		if verboseConnection || result.Connect == nil {
+			printProbeAttempts(backend.ConnectionResult{Attempts: result.Attempts, Error: result.Error})
+		}
+	}
+	if t := result.Throughput; t != nil {
+		if t.BytesPerSecond > 0 {
+			fmt.Printf("Throughput from %s on node %s to pod %s: %s, %d bytes in %s\n", t.Server, t.Node, from,
+				backend.FormatThroughput(t.BytesPerSecond), t.Bytes, t.Duration.Round(time.Millisecond))
+		} else {
+			fmt.Printf("Throughput from %s to pod %s: failed (probe strategy: %s, reason: %s)\n", t.Server, from, t.Strategy, t.Reason)
+		}
+		if verboseConnection || t.BytesPerSecond == 0 {
+			printProbeAttempts(backend.ConnectionResult{Attempts: t.Attempts, Error: t.Error})
+		}
+	}
+}
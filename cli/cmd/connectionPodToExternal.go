@@ -17,7 +17,7 @@ limitations under the License.
 */
 
 import (
-	"fmt"
+	"context"
 
 	"github.com/PhilRanzato/kubensure/backend"
 	"github.com/spf13/cobra"
@@ -25,6 +25,8 @@ import (
 
 var podNsToExternal string
 var extPortToExternal int
+var proxyToExternal string
+var directToExternal bool
 
 // connectionPodToExternalCmd represents the connectionPodToExternal command
 var connectionPodToExternalCmd = &cobra.Command{
@@ -33,6 +35,27 @@ var connectionPodToExternalCmd = &cobra.Command{
 	Long: `
 Check connection from a pod to an external endpoint.
 
+The HTTP_PROXY, HTTPS_PROXY and NO_PROXY variables of the first container of the
+pod, set directly or from ConfigMaps and Secrets, are read from the pod spec. The
+endpoint is probed directly and, when a proxy applies to it, through the proxy:
+HTTP_PROXY forwarding the requests to http URLs and port 80, blocked when the proxy
+answers 403, 407, 502, 503 or 504, and HTTPS_PROXY tunneling any other port. The
+check is evaluated on the path the applications of the pod take, the proxy when
+one applies. '--expect proxy-only' verifies that the endpoint is reachable through
+the proxy while the direct connection is blocked, '--expect deny' that neither path
+connects.
+
+The --http flags turn the check into an HTTP request whose response must meet the
+given assertions: status codes, body substrings or regular expression, headers,
+redirect and latency. The status defaults to 200-399, so that an error page fails
+the check. The measured values are part of the result.
+
+The --tls flags perform a TLS handshake from the pod and verify the chain with the
+trust store of the pod, instead of the unverified connection of the default probes.
+The chain, issuer, SANs and expiry of the certificates and the negotiated protocol
+and cipher are reported. The check fails when the trust store rejects the chain,
+the certificate does not cover the server name or expires within --tls-min-validity.
+
 Usage examples:
 
   # Ensure pod 'example' of namespace 'test' can connect to https://kubernetes.io
@@ -43,27 +66,61 @@ Usage examples:
 
   kubensure connection pod-to-ext example -n test http://192.168.100.112 --ext-port 90
 
+  # Ensure https://api.example.com/healthz answers 200 with 'ok' in less than 500ms
+
+  kubensure connection pod-to-ext example -n test https://api.example.com --http-path /healthz --http-status 200 --http-body-contains ok --http-max-latency 500ms
+
+  # Ensure the trust store of the pod accepts the certificate of https://api.example.com, valid for 30 more days
+
+  kubensure connection pod-to-ext example -n test https://api.example.com --tls --tls-min-validity 720h
+
+  # Ensure pod 'example' reaches https://kubernetes.io through its proxy only
+
+  kubensure connection pod-to-ext example -n test https://kubernetes.io --expect proxy-only
+
 `,
 	Run: func(cmd *cobra.Command, args []string) {
-		if len(args) > 0 {
-			cs := backend.GetClientSet()
-			pod := backend.GetPodByName(backend.GetPods(cs), args[0], podNsToExternal)
-			if backend.ConnectionPodToExternal(cs, pod, args[1], extPortToExternal) {
-				fmt.Printf("Pod %s can connect to %s", args[0], args[1])
-			} else {
-				fmt.Printf("Pod %s cannot connect to %s", args[0], args[1])
-			}
-		} else {
-			fmt.Printf(`'kubensure connection pod-to-pod' needs at least two arguments: <PodName> and <ServiceName>.
-See 'kubensure connection pod-to-pod -h' for more information`)
+		if len(args) < 2 {
+			exitUsage(`'kubensure connection pod-to-ext' needs two arguments: <PodName> and <ExternalEndpoint>.
+See 'kubensure connection pod-to-ext -h' for more information`)
+		}
+		cs := clientSet()
+		pod, err := backend.FindPod(context.Background(), cs, args[0], namespaceOrCurrent(podNsToExternal))
+		if err != nil {
+			exitWithError(err)
+		}
+		opts := checkOptions(cmd.Flags())
+		port := extPortToExternal
+		if (opts.HTTP != nil || opts.TLS != nil) && !cmd.Flags().Changed("ext-port") {
+			// the port of an HTTP or TLS check defaults to the one of the URL
+			port = 0
+		}
+		if directToExternal {
+			reportConnection(args[0], args[1], backend.ConnectionPodToExternal(cs, pod, args[1], port, opts))
+			return
+		}
+		config, err := backend.PodProxyConfig(context.Background(), cs, pod)
+		if err != nil {
+			exitWithError(err)
+		}
+		if proxyToExternal != "" {
+			config.HTTPProxy, config.HTTPSProxy, config.NoProxy = proxyToExternal, proxyToExternal, ""
+		}
+		if err := opts.ValidateProbers(config.HTTPProxy != "" || config.HTTPSProxy != "", false); err != nil {
+			exitUsage(err)
 		}
+		reportExternalConnection(args[0], args[1], backend.ConnectionPodToExternalWithProxy(cs, pod, args[1], port, config, opts))
 	},
 }
 
 func init() {
 	connectionCmd.AddCommand(connectionPodToExternalCmd)
-	connectionPodToExternalCmd.Flags().StringVarP(&podNsToExternal, "pod-ns", "n", "default", "Pod namespace")
+	connectionPodToExternalCmd.Flags().StringVarP(&podNsToExternal, "pod-ns", "n", "", "Pod namespace (default is the namespace of the current context)")
 	connectionPodToExternalCmd.Flags().IntVarP(&extPortToExternal, "ext-port", "p", 443, "External endpoint port")
+	connectionPodToExternalCmd.Flags().StringVar(&proxyToExternal, "proxy", "", "HTTP proxy the endpoint is reached through (default is the proxy environment of the container)")
+	connectionPodToExternalCmd.Flags().BoolVar(&directToExternal, "direct", false, "Ignore the proxy environment of the container and only probe the direct connection")
+	addHTTPFlags(connectionPodToExternalCmd.Flags())
+	addTLSFlags(connectionPodToExternalCmd.Flags())
 	connectionPodToExternalCmd.SuggestionsMinimumDistance = 2
 
 }
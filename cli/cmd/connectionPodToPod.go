@@ -17,7 +17,7 @@ limitations under the License.
 */
 
 import (
-	"fmt"
+	"context"
 
 	"github.com/PhilRanzato/kubensure/backend"
 
@@ -47,27 +47,28 @@ Usage examples:
 
 `,
 	Run: func(cmd *cobra.Command, args []string) {
-		if len(args) > 0 {
-			cs := backend.GetClientSet()
-			pod := backend.GetPodByName(backend.GetPods(cs), args[0], podNsToPod)
-			trgt := backend.GetPodByName(backend.GetPods(cs), args[1], targetNsToPod)
-			if backend.ConnectionPodToPod(cs, pod, trgt, targetPortToPod) {
-				fmt.Printf("Pod %s can connect to %s", args[0], args[1])
-			} else {
-				fmt.Printf("Pod %s cannot connect to %s", args[0], args[1])
-			}
-		} else {
-			fmt.Printf(`'kubensure connection pod-to-pod' needs at least two arguments: <PodName> and <PodNamespace>.
-		See 'kubensure connection pod-to-pod -h' for more information`)
+		if len(args) < 2 {
+			exitUsage(`'kubensure connection pod-to-pod' needs two arguments: <PodName> and <TargetPodName>.
+See 'kubensure connection pod-to-pod -h' for more information`)
 		}
+		cs := clientSet()
+		pod, err := backend.FindPod(context.Background(), cs, args[0], namespaceOrCurrent(podNsToPod))
+		if err != nil {
+			exitWithError(err)
+		}
+		trgt, err := backend.FindPod(context.Background(), cs, args[1], namespaceOrCurrent(targetNsToPod))
+		if err != nil {
+			exitWithError(err)
+		}
+		reportConnection(args[0], args[1], backend.ConnectionPodToPod(cs, pod, trgt, targetPortToPod, connectionOptions()))
 	},
 }
 
 func init() {
 	connectionCmd.AddCommand(connectionPodToPodCmd)
 
-	connectionPodToPodCmd.Flags().StringVarP(&podNsToPod, "pod-ns", "n", "default", "Pod namespace")
-	connectionPodToPodCmd.Flags().StringVarP(&targetNsToPod, "target-ns", "t", "default", "Target Pod namespace")
+	connectionPodToPodCmd.Flags().StringVarP(&podNsToPod, "pod-ns", "n", "", "Pod namespace (default is the namespace of the current context)")
+	connectionPodToPodCmd.Flags().StringVarP(&targetNsToPod, "target-ns", "t", "", "Target Pod namespace (default is the namespace of the current context)")
 	connectionPodToPodCmd.Flags().IntVarP(&targetPortToPod, "target-port", "p", 0, "Target Pod port")
 	connectionPodToPodCmd.SuggestionsMinimumDistance = 2
 
@@ -17,15 +17,17 @@ limitations under the License.
 */
 
 import (
-	"fmt"
+	"context"
 
 	"github.com/PhilRanzato/kubensure/backend"
 	"github.com/spf13/cobra"
+	v1 "k8s.io/api/core/v1"
 )
 
 var podNsToService string
 var svcNsToService string
-var svcPortToService int
+var svcPortToService string
+var endpointsToService bool
 
 // connectionPodToServiceCmd represents the connectionPodToService command
 var connectionPodToServiceCmd = &cobra.Command{
@@ -34,36 +36,102 @@ var connectionPodToServiceCmd = &cobra.Command{
 	Long: `
 Check connection from a pod to a service.
 
+Every port declared by the service is probed with its protocol, unless '--svc-port'
+selects a single port by number or by name, or '--protocol' the ports of a protocol.
+The target port of each probed port must
+also resolve on the pods selected by the service: a named target port must be
+declared by their containers.
+
+With '--endpoints', the ready addresses of the Endpoints of the service are also
+probed one by one from the pod, on the target port of the service port, so that a
+service load balancing on some broken backends is reported. The command fails when
+the service or any ready backend does not meet the expectation, or when connections
+are expected but the service has no ready backend.
+
+The --http flags send an HTTP request to the selected port, and to each ready
+backend with '--endpoints', whose response must meet the given assertions. The
+--tls flags perform a TLS handshake verified by the trust store of the pod and
+report the chain, issuer, SANs and expiry of the certificates, the backends are
+checked against the server name of the service.
+
 Usage examples:
 
-  # Ensure pod 'example' of namespace 'test' can connect to service 'svc-example' in namespace 'svc-test'
+  # Ensure pod 'example' of namespace 'test' can connect to service 'svc-example' in namespace 'svc-test' on every port
+
+  kubensure connection pod-to-svc example -n test svc-example -t svc-test
+
+  # Only check the port named 'http' of service 'web'
+
+  kubensure connection pod-to-svc example -n test web -p http
+
+  # Ensure pod 'example' of namespace 'test' cannot connect to service 'db' in namespace 'svc-test' on port 5432
+
+  kubensure connection pod-to-svc example -n test db -t svc-test -p 5432 --expect deny
+
+  # Only check the UDP ports of service 'kube-dns' in namespace 'kube-system'
+
+  kubensure connection pod-to-svc example -n test kube-dns -t kube-system --protocol udp
+
+  # Probe the service 'web' and each of its ready backend pods individually, to detect partially broken services
 
-  kubensure connection pod-to-svc example -n test svc-example -s svc-test
+  kubensure connection pod-to-svc example -n test web -p 80 --endpoints
+
+  # Ensure every backend of service 'web' answers /healthz with a 2xx status and a JSON content type
+
+  kubensure connection pod-to-svc example -n test web -p http --endpoints --http-path /healthz --http-status 200-299 --http-header 'Content-Type: json'
+
+  # Ensure pod 'example' trusts the certificate served by every backend of service 'web' for web.test.svc
+
+  kubensure connection pod-to-svc example -n test web -p https --endpoints --tls --tls-server-name web.test.svc
 
 `,
 	Run: func(cmd *cobra.Command, args []string) {
-		if len(args) > 0 {
-			cs := backend.GetClientSet()
-			pod := backend.GetPodByName(backend.GetPods(cs), args[0], podNsToService)
-			svc := backend.GetServiceByName(backend.GetServices(cs), args[1], svcNsToService)
-			if backend.ConnectionPodToService(cs, pod, svc, svcPortToService) {
-				fmt.Printf("Pod %s can connect to %s", args[0], args[1])
-			} else {
-				fmt.Printf("Pod %s cannot connect to %s", args[0], args[1])
+		if len(args) < 2 {
+			exitUsage(`'kubensure connection pod-to-svc' needs two arguments: <PodName> and <ServiceName>.
+See 'kubensure connection pod-to-svc -h' for more information`)
+		}
+		cs := clientSet()
+		pod, err := backend.FindPod(context.Background(), cs, args[0], namespaceOrCurrent(podNsToService))
+		if err != nil {
+			exitWithError(err)
+		}
+		svc, err := backend.FindService(context.Background(), cs, args[1], namespaceOrCurrent(svcNsToService))
+		if err != nil {
+			exitWithError(err)
+		}
+		ports, err := backend.ResolveServicePorts(svc, svcPortToService, protocolOption())
+		if err != nil {
+			exitUsage(err)
+		}
+		opts := checkOptions(cmd.Flags())
+		if (opts.HTTP != nil || opts.TLS != nil) && len(ports) > 1 {
+			exitUsage("the HTTP and TLS checks apply to a single port of the service, select it with --svc-port")
+		}
+		backends, err := backend.GetServicePods(context.Background(), cs, svc)
+		if err != nil {
+			exitWithError(err)
+		}
+		var endpoints *v1.Endpoints
+		if endpointsToService {
+			ep, err := backend.FindEndpoints(context.Background(), cs, svc.Name, svc.Namespace)
+			if err != nil {
+				exitWithError(err)
 			}
-		} else {
-			fmt.Printf(`'kubensure connection pod-to-pod' needs at least two arguments: <PodName> and <ServiceName>.
-See 'kubensure connection pod-to-pod -h' for more information`)
+			endpoints = &ep
 		}
+		reportServiceConnection(args[0], args[1], backend.ConnectionPodToServicePorts(cs, pod, svc, ports, backends, endpoints, opts))
 	},
 }
 
 func init() {
 	connectionCmd.AddCommand(connectionPodToServiceCmd)
 
-	connectionPodToServiceCmd.Flags().StringVarP(&podNsToService, "pod-ns", "n", "default", "Pod namespace")
-	connectionPodToServiceCmd.Flags().StringVarP(&svcNsToService, "svc-ns", "t", "default", "Target Service namespace")
-	connectionPodToServiceCmd.Flags().IntVarP(&svcPortToService, "svc-port", "p", 0, "Target Service port")
+	connectionPodToServiceCmd.Flags().StringVarP(&podNsToService, "pod-ns", "n", "", "Pod namespace (default is the namespace of the current context)")
+	connectionPodToServiceCmd.Flags().StringVarP(&svcNsToService, "svc-ns", "t", "", "Target Service namespace (default is the namespace of the current context)")
+	connectionPodToServiceCmd.Flags().StringVarP(&svcPortToService, "svc-port", "p", "", "Target Service port, by number or by name (default is every port of the Service)")
+	connectionPodToServiceCmd.Flags().BoolVar(&endpointsToService, "endpoints", false, "Also probe every ready address of the Endpoints of the Service individually, on the target port of the Service port")
+	addHTTPFlags(connectionPodToServiceCmd.Flags())
+	addTLSFlags(connectionPodToServiceCmd.Flags())
 	connectionPodToServiceCmd.SuggestionsMinimumDistance = 2
 
 }
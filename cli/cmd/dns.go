@@ -0,0 +1,170 @@
+package cmd
+
+/*
+Copyright © 2021 Phil Ranzato philranzato@gmail.com
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/PhilRanzato/kubensure/backend"
+	"github.com/spf13/cobra"
+	v1 "k8s.io/api/core/v1"
+)
+
+var podNsDNS string
+var targetNsDNS string
+var servicesDNS []string
+var podsDNS []string
+var externalDNS []string
+var clusterDomainDNS string
+
+// dnsCmd represents the dns command
+var dnsCmd = &cobra.Command{
+	Use:   "dns",
+	Short: "Check the DNS resolution of services, pods and external names from inside a pod.",
+	Long: `
+Check the DNS resolution of services, pods and external names from inside a pod.
+
+The /etc/resolv.conf of the pod is inspected: its first nameserver must be the
+cluster DNS service and its search list must include the service domains of the
+namespace, else short service names do not resolve. Then, with dig, nslookup or
+getent found in the container, the pod resolves:
+
+  - the FQDN and the short <service>.<namespace> name of the services, which must
+    answer their ClusterIP
+  - the FQDN of headless services, which must answer the ready addresses of their
+    Endpoints, and the SRV records of their named ports
+  - the <a-b-c-d>.<namespace>.pod name of the pods, which must answer their IP
+  - the external names, which must resolve
+
+The services default to every service of the target namespace and the
+'kubernetes' service of namespace 'default'. The latency of each query includes
+the exec into the pod.
+
+Usage examples:
+
+  # Check the resolution of the services of namespace 'shop' from pod 'frontend-0'
+
+  kubensure dns frontend-0 -n shop
+
+  # Check the services 'web' and 'db' and the pod 'db-0' of namespace 'data', and an external name
+
+  kubensure dns frontend-0 -n shop -t data --services web,db --pods db-0 --external kubernetes.io
+
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(args) < 1 {
+			exitUsage(`'kubensure dns' needs one argument: <PodName>.
+See 'kubensure dns -h' for more information`)
+		}
+		ctx := context.Background()
+		cs := clientSet()
+		pod, err := backend.FindPod(ctx, cs, args[0], namespaceOrCurrent(podNsDNS))
+		if err != nil {
+			exitWithError(err)
+		}
+		targetNs := targetNsDNS
+		if targetNs == "" {
+			targetNs = pod.Namespace
+		}
+
+		opts := backend.DNSOptions{External: externalDNS, ClusterDomain: clusterDomainDNS}
+		if len(servicesDNS) == 0 && len(podsDNS) == 0 && len(externalDNS) == 0 {
+			if opts.Services, err = backend.GetServices(ctx, cs, backend.QueryOptions{Namespaces: []string{targetNs}}); err != nil {
+				exitWithError(err)
+			}
+			if svc, err := backend.FindService(ctx, cs, "kubernetes", "default"); err == nil {
+				opts.Services = append(opts.Services, svc)
+			}
+		}
+		for _, name := range servicesDNS {
+			svc, err := backend.FindService(ctx, cs, name, targetNs)
+			if err != nil {
+				exitWithError(err)
+			}
+			opts.Services = append(opts.Services, svc)
+		}
+		for _, name := range podsDNS {
+			p, err := backend.FindPod(ctx, cs, name, targetNs)
+			if err != nil {
+				exitWithError(err)
+			}
+			opts.Pods = append(opts.Pods, p)
+		}
+		if opts.Endpoints, err = backend.GetEndpoints(ctx, cs, backend.QueryOptions{Namespaces: []string{targetNs}}); err != nil {
+			exitWithError(err)
+		}
+		// the cluster DNS service is named kube-dns by both kube-dns and CoreDNS, the nameserver
+		// is not compared when it cannot be read
+		if dns, err := backend.FindService(ctx, cs, "kube-dns", "kube-system"); err == nil && dns.Spec.ClusterIP != v1.ClusterIPNone {
+			opts.ClusterDNS = []string{dns.Spec.ClusterIP}
+		}
+
+		result := backend.CheckDNS(cs, pod, opts)
+		report := result.Report()
+		printResult(result, report, func() { printDNSResult(result) })
+		exitWithReport(report)
+	},
+}
+
+func printDNSResult(result backend.DNSResult) {
+	conf := result.ResolvConf
+	if conf.Error != "" {
+		fmt.Printf("resolv.conf of %s could not be read: %s\n", result.Source, conf.Error)
+	} else {
+		fmt.Printf("resolv.conf of %s: nameservers %s, search %s, ndots %d\n", result.Source, strings.Join(conf.Nameservers, " "), strings.Join(conf.Search, " "), conf.Ndots)
+		for _, p := range conf.Problems {
+			fmt.Printf("  problem: %s\n", p)
+		}
+	}
+	fmt.Println()
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "TYPE\tNAME\tANSWERS\tLATENCY\tRESULT")
+	failed := 0
+	for _, q := range result.Queries {
+		status := "ok"
+		switch {
+		case q.Error != "":
+			status = "failed: " + q.Error
+		case q.Mismatch != "":
+			status = "mismatch: " + q.Mismatch
+		}
+		if !q.Passed {
+			failed++
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", q.Type, q.Name, strings.Join(q.Answers, ","), q.Duration.Round(time.Millisecond), status)
+	}
+	w.Flush()
+	fmt.Printf("\n%d queries, %d failed\n", len(result.Queries), failed)
+}
+
+func init() {
+	rootCmd.AddCommand(dnsCmd)
+
+	dnsCmd.Flags().StringVarP(&podNsDNS, "pod-ns", "n", "", "Pod namespace (default is the namespace of the current context)")
+	dnsCmd.Flags().StringVarP(&targetNsDNS, "target-ns", "t", "", "Namespace of the services and pods to resolve (default is the namespace of the pod)")
+	dnsCmd.Flags().StringSliceVar(&servicesDNS, "services", nil, "Services to resolve (default is every service of the target namespace, unless pods or external names are set)")
+	dnsCmd.Flags().StringSliceVar(&podsDNS, "pods", nil, "Pods to resolve by their pod A record")
+	dnsCmd.Flags().StringSliceVar(&externalDNS, "external", nil, "External names to resolve")
+	dnsCmd.Flags().StringVar(&clusterDomainDNS, "cluster-domain", "", "Cluster domain (default is the domain of the search list of the pod, else cluster.local)")
+	dnsCmd.SuggestionsMinimumDistance = 2
+}
@@ -0,0 +1,44 @@
+package cmd
+
+/*
+Copyright © 2021 Phil Ranzato philranzato@gmail.com
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/PhilRanzato/kubensure/backend"
+)
+
+// exitUsage prints the message on stderr and exits with backend.ExitUsage
+func exitUsage(a ...interface{}) {
+	fmt.Fprintln(os.Stderr, a...)
+	os.Exit(backend.ExitUsage)
+}
+
+// exitWithError prints the error on stderr and exits with the code matching its cause,
+// backend.ExitNotFound for missing pods and services, else backend.ExitAPIError
+func exitWithError(err error) {
+	fmt.Fprintln(os.Stderr, err)
+	os.Exit(backend.ExitCodeForError(err))
+}
+
+// exitWithReport exits with the aggregated exit code of the report when one of its cases failed
+func exitWithReport(report backend.Report) {
+	if code := report.ExitCode(); code != backend.ExitOK {
+		os.Exit(code)
+	}
+}
@@ -0,0 +1,165 @@
+package cmd
+
+/*
+Copyright © 2021 Phil Ranzato philranzato@gmail.com
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/PhilRanzato/kubensure/backend"
+	"sigs.k8s.io/yaml"
+)
+
+var outputFormat string
+
+// outputFormats lists the values accepted by the '--output' flag
+var outputFormats = []string{"text", "json", "yaml", "junit", "tap"}
+
+// validateOutputFormat exits when the '--output' flag is not a supported format
+func validateOutputFormat() {
+	for _, f := range outputFormats {
+		if outputFormat == f {
+			return
+		}
+	}
+	exitUsage(fmt.Sprintf("Invalid output format '%s': must be one of %s", outputFormat, strings.Join(outputFormats, ", ")))
+}
+
+// textOutput returns true when the human readable output is selected
+func textOutput() bool {
+	return outputFormat == "" || outputFormat == "text"
+}
+
+// printResult renders a result in the format selected by the '--output' flag:
+// json and yaml encode the raw result, junit and tap render the report, text calls the given function
+func printResult(raw interface{}, report backend.Report, text func()) {
+	var err error
+	switch outputFormat {
+	case "json":
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		err = enc.Encode(raw)
+	case "yaml":
+		var data []byte
+		if data, err = yaml.Marshal(raw); err == nil {
+			_, err = os.Stdout.Write(data)
+		}
+	case "junit":
+		err = writeJUnit(os.Stdout, report)
+	case "tap":
+		err = writeTAP(os.Stdout, report)
+	default:
+		text()
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(backend.ExitFailed)
+	}
+}
+
+type junitTestSuites struct {
+	XMLName xml.Name         `xml:"testsuites"`
+	Suites  []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name     string          `xml:"name,attr"`
+	Tests    int             `xml:"tests,attr"`
+	Failures int             `xml:"failures,attr"`
+	Time     string          `xml:"time,attr"`
+	Cases    []junitTestCase `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	Classname string        `xml:"classname,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+	SystemOut string        `xml:"system-out,omitempty"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Text    string `xml:",chardata"`
+}
+
+// writeJUnit renders the report as a JUnit XML test suite
+func writeJUnit(w io.Writer, report backend.Report) error {
+	suite := junitTestSuite{
+		Name:     "kubensure " + report.Name,
+		Tests:    len(report.Cases),
+		Failures: report.Failed(),
+	}
+	var total float64
+	for _, c := range report.Cases {
+		tc := junitTestCase{
+			Name:      c.Name,
+			Classname: "kubensure." + report.Name,
+			Time:      fmt.Sprintf("%.3f", c.Duration.Seconds()),
+			SystemOut: c.Message,
+		}
+		if !c.Passed {
+			tc.Failure = &junitFailure{Message: c.Message, Text: c.Details}
+		}
+		total += c.Duration.Seconds()
+		suite.Cases = append(suite.Cases, tc)
+	}
+	suite.Time = fmt.Sprintf("%.3f", total)
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(junitTestSuites{Suites: []junitTestSuite{suite}}); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+// writeTAP renders the report as a TAP version 13 stream
+func writeTAP(w io.Writer, report backend.Report) error {
+	var b strings.Builder
+	b.WriteString("TAP version 13\n")
+	fmt.Fprintf(&b, "1..%d\n", len(report.Cases))
+	for i, c := range report.Cases {
+		status := "ok"
+		if !c.Passed {
+			status = "not ok"
+		}
+		fmt.Fprintf(&b, "%s %d - %s\n", status, i+1, c.Name)
+		if c.Passed && c.Details == "" {
+			continue
+		}
+		b.WriteString("  ---\n")
+		fmt.Fprintf(&b, "  message: %q\n", c.Message)
+		if c.Details != "" {
+			b.WriteString("  details: |\n")
+			for _, l := range strings.Split(c.Details, "\n") {
+				fmt.Fprintf(&b, "    %s\n", l)
+			}
+		}
+		b.WriteString("  ...\n")
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
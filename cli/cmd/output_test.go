@@ -0,0 +1,81 @@
+package cmd
+
+import (
+	"bytes"
+	"flag"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/PhilRanzato/kubensure/backend"
+)
+
+var update = flag.Bool("update", false, "update the golden files of testdata")
+
+// goldenReport : a report with passed and failed cases, with and without details, and characters escaped by
+// the XML and YAML encodings
+var goldenReport = backend.Report{
+	Name: "suite",
+	Cases: []backend.ReportCase{
+		{
+			Name:     "frontend-to-backend: shop/frontend-0 -> service shop/backend port 80/TCP (http)",
+			Passed:   true,
+			Message:  "expected allow, open as expected",
+			Duration: 120 * time.Millisecond,
+		},
+		{
+			Name:     "backend-no-internet: shop/backend-0 -> https://kubernetes.io",
+			Passed:   false,
+			Message:  `expected deny, unexpectedly open, via proxy "http://proxy:3128" & <redacted>`,
+			Details:  "nc: exit code 0\nwget: exit code 0",
+			Duration: 1500 * time.Millisecond,
+			ExitCode: backend.ExitFailed,
+		},
+		{
+			Name:     "frontend-to-syslog: shop/ghost -> pod logging/syslog-0",
+			Passed:   false,
+			Message:  "expected allow, no source pod found",
+			ExitCode: backend.ExitNotFound,
+		},
+		{
+			Name:    "probes",
+			Passed:  true,
+			Message: "no finding",
+			Details: "checked 3 objects",
+		},
+	},
+}
+
+func TestReportOutput(t *testing.T) {
+	tests := []struct {
+		golden string
+		write  func(b *bytes.Buffer) error
+	}{
+		{"report.junit.xml", func(b *bytes.Buffer) error { return writeJUnit(b, goldenReport) }},
+		{"report.tap", func(b *bytes.Buffer) error { return writeTAP(b, goldenReport) }},
+		{"empty.junit.xml", func(b *bytes.Buffer) error { return writeJUnit(b, backend.Report{Name: "check"}) }},
+		{"empty.tap", func(b *bytes.Buffer) error { return writeTAP(b, backend.Report{Name: "check"}) }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.golden, func(t *testing.T) {
+			var b bytes.Buffer
+			if err := tt.write(&b); err != nil {
+				t.Fatal(err)
+			}
+			path := filepath.Join("testdata", tt.golden)
+			if *update {
+				if err := ioutil.WriteFile(path, b.Bytes(), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			want, err := ioutil.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := b.String(); got != string(want) {
+				t.Errorf("output =\n%s\nwant\n%s", got, want)
+			}
+		})
+	}
+}
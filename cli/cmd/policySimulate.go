@@ -0,0 +1,158 @@
+package cmd
+
+/*
+Copyright © 2021 Phil Ranzato philranzato@gmail.com
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/PhilRanzato/kubensure/backend"
+	"github.com/spf13/cobra"
+)
+
+var podNsSimulate string
+var targetNsSimulate string
+var targetPortSimulate int
+var protocolSimulate string
+var manifestsSimulate []string
+var expectSimulate string
+
+// policySimulateCmd represents the policy simulate command
+var policySimulateCmd = &cobra.Command{
+	Use:   "simulate",
+	Short: "Compute whether NetworkPolicies permit traffic from a pod to another pod or IP address.",
+	Long: `
+Compute whether NetworkPolicies permit traffic from a pod to another pod or IP address.
+
+The verdict is computed from the declared Pods, Namespaces and NetworkPolicies,
+either read from the cluster or from manifest files, without exec'ing into any pod.
+Both the egress policies of the source pod and the ingress policies of the target
+pod are evaluated, including podSelector, namespaceSelector, ipBlock and named ports.
+
+Usage examples:
+
+  # Is pod 'example' of namespace 'test' allowed to reach pod 'db' of namespace 'prod' on port 5432?
+
+  kubensure policy simulate example -n test db -t prod -p 5432
+
+  # Is pod 'example' of namespace 'test' allowed to reach 10.0.0.1 on UDP port 53?
+
+  kubensure policy simulate example -n test 10.0.0.1 -p 53 --protocol UDP
+
+  # Ensure pod 'example' of namespace 'test' is not allowed to reach pod 'db' on port 22
+
+  kubensure policy simulate example -n test db -t prod -p 22 --expect deny
+
+  # Evaluate manifests instead of the live cluster
+
+  kubensure policy simulate example -n test db -t prod -p 5432 -f manifests/
+
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(args) < 2 {
+			exitUsage(`'kubensure policy simulate' needs two arguments: <PodName> and <TargetPodName|TargetIP>.
+See 'kubensure policy simulate -h' for more information`)
+		}
+
+		var snapshot backend.PolicySnapshot
+		var err error
+		if len(manifestsSimulate) > 0 {
+			snapshot, err = backend.LoadPolicySnapshot(manifestsSimulate)
+			if err != nil {
+				exitUsage(err)
+			}
+		} else {
+			snapshot, err = backend.GetPolicySnapshot(context.Background(), clientSet())
+			if err != nil {
+				exitWithError(err)
+			}
+		}
+
+		pod, err := backend.GetPodByName(snapshot.Pods, args[0], namespaceOrCurrent(podNsSimulate))
+		if err != nil {
+			exitWithError(err)
+		}
+
+		var target backend.PolicyEndpoint
+		if net.ParseIP(args[1]) != nil {
+			target.IP = args[1]
+		} else {
+			trgt, err := backend.GetPodByName(snapshot.Pods, args[1], namespaceOrCurrent(targetNsSimulate))
+			if err != nil {
+				exitWithError(err)
+			}
+			target.Pod = &trgt
+		}
+
+		expect, err := backend.ParseExpectation(expectSimulate)
+		if err != nil {
+			exitUsage(err)
+		}
+
+		protocol, err := backend.ParseProtocol(protocolSimulate)
+		if err != nil {
+			exitUsage(err)
+		}
+
+		verdict := snapshot.SimulateConnection(pod, target, targetPortSimulate, protocol)
+		check := backend.EvaluatePolicy(verdict, expect)
+		report := check.Report()
+		printResult(check, report, func() { printPolicyVerdict(verdict) })
+		exitWithReport(report)
+	},
+}
+
+func printPolicyVerdict(verdict backend.PolicyVerdict) {
+	result := "denied"
+	if verdict.Allowed {
+		result = "allowed"
+	}
+	port := "any port"
+	if verdict.Port != 0 {
+		port = fmt.Sprintf("port %d", verdict.Port)
+	}
+	fmt.Printf("Traffic from %s to %s on %s/%s is %s\n", verdict.Source, verdict.Target, port, verdict.Protocol, result)
+	fmt.Printf("  egress:  %s\n", policyDirectionSummary(verdict.Egress))
+	if !verdict.External {
+		fmt.Printf("  ingress: %s\n", policyDirectionSummary(verdict.Ingress))
+	}
+}
+
+func policyDirectionSummary(d backend.PolicyDirectionVerdict) string {
+	switch {
+	case !d.Isolated:
+		return "allowed, no policy selects the pod"
+	case d.Allowed:
+		return "allowed by " + strings.Join(d.AllowedBy, ", ")
+	default:
+		return "denied, selected by " + strings.Join(d.Policies, ", ") + " but no rule matches"
+	}
+}
+
+func init() {
+	policyCmd.AddCommand(policySimulateCmd)
+
+	policySimulateCmd.Flags().StringVarP(&podNsSimulate, "pod-ns", "n", "", "Pod namespace (default is the namespace of the current context)")
+	policySimulateCmd.Flags().StringVarP(&targetNsSimulate, "target-ns", "t", "", "Target Pod namespace (default is the namespace of the current context)")
+	policySimulateCmd.Flags().IntVarP(&targetPortSimulate, "target-port", "p", 0, "Target port, 0 only matches rules without port restrictions")
+	policySimulateCmd.Flags().StringVar(&protocolSimulate, "protocol", "TCP", "Protocol: TCP, UDP or SCTP")
+	policySimulateCmd.Flags().StringSliceVarP(&manifestsSimulate, "filename", "f", nil, "Manifest files or directories to read instead of the cluster")
+	policySimulateCmd.Flags().StringVar(&expectSimulate, "expect", "allow", "Expected verdict: allow or deny, the exit code is non-zero when it does not hold")
+	policySimulateCmd.SuggestionsMinimumDistance = 2
+}
@@ -0,0 +1,53 @@
+package cmd
+
+/*
+Copyright © 2021 Phil Ranzato philranzato@gmail.com
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+import (
+	"github.com/PhilRanzato/kubensure/backend"
+	"github.com/spf13/pflag"
+)
+
+var labelSelector string
+var fieldSelector string
+var allNamespaces bool
+var chunkSize int64
+
+// addQueryFlags defines the flags scoping the listed objects
+func addQueryFlags(flags *pflag.FlagSet) {
+	flags.StringVarP(&labelSelector, "selector", "l", "", "Label selector of the objects, e.g. 'app=web,tier!=db'")
+	flags.StringVar(&fieldSelector, "field-selector", "", "Field selector of the objects, e.g. 'spec.nodeName=node-1'")
+	flags.BoolVarP(&allNamespaces, "all-namespaces", "A", false, "List the objects of every namespace")
+	flags.Int64Var(&chunkSize, "chunk-size", 500, "Maximum number of objects returned by a single list request, 0 to disable pagination")
+}
+
+// queryOptions returns the query set by the query flags on the given namespaces,
+// every namespace with '--all-namespaces'
+func queryOptions(namespaces []string) backend.QueryOptions {
+	query := backend.QueryOptions{
+		Namespaces:    namespaces,
+		LabelSelector: labelSelector,
+		FieldSelector: fieldSelector,
+		Limit:         chunkSize,
+	}
+	if allNamespaces {
+		query.Namespaces = nil
+	}
+	if err := query.Validate(); err != nil {
+		exitUsage(err)
+	}
+	return query
+}
@@ -19,14 +19,19 @@ limitations under the License.
 import (
 	"fmt"
 	"os"
+	"path/filepath"
+	"strings"
 
+	"github.com/PhilRanzato/kubensure/backend"
 	"github.com/spf13/cobra"
 
 	homedir "github.com/mitchellh/go-homedir"
 	"github.com/spf13/viper"
+	"k8s.io/client-go/kubernetes"
 )
 
 var cfgFile string
+var kubeConfigOptions backend.KubeConfigOptions
 
 // rootCmd represents the base command when called without any subcommands
 var rootCmd = &cobra.Command{
@@ -39,14 +44,16 @@ kubensure is a CLI tool that allows kubernetes cluster admins to check their pol
 	// Uncomment the following line if your bare application
 	// has an action associated with it:
 	//	Run: func(cmd *cobra.Command, args []string) { },
+	PersistentPreRun: func(cmd *cobra.Command, args []string) {
+		validateOutputFormat()
+	},
 }
 
 // Execute adds all child commands to the root command and sets flags appropriately.
 // This is called by main.main(). It only needs to happen once to the rootCmd.
 func Execute() {
 	if err := rootCmd.Execute(); err != nil {
-		fmt.Println(err)
-		os.Exit(1)
+		os.Exit(backend.ExitUsage)
 	}
 }
 
@@ -58,6 +65,12 @@ func init() {
 	// will be global for your application.
 
 	rootCmd.PersistentFlags().StringVar(&cfgFile, "config", "", "config file (default is $HOME/.kubensure.yaml)")
+	rootCmd.PersistentFlags().StringVarP(&outputFormat, "output", "o", "text", "Output format: "+strings.Join(outputFormats, ", "))
+	rootCmd.PersistentFlags().StringVar(&kubeConfigOptions.Kubeconfig, "kubeconfig", "", "Path to the kubeconfig file (default is $KUBECONFIG, then $HOME/.kube/config, then the in-cluster configuration)")
+	rootCmd.PersistentFlags().StringVar(&kubeConfigOptions.Context, "context", "", "The kubeconfig context to use")
+	rootCmd.PersistentFlags().StringVar(&kubeConfigOptions.Namespace, "namespace", "", "Default namespace of the pods and services (default is the namespace of the current context)")
+	rootCmd.PersistentFlags().StringVar(&kubeConfigOptions.As, "as", "", "Username to impersonate")
+	rootCmd.PersistentFlags().StringSliceVar(&kubeConfigOptions.AsGroups, "as-group", nil, "Group to impersonate, can be repeated")
 
 	// Cobra also supports local flags, which will only run
 	// when this action is called directly.
@@ -73,8 +86,7 @@ func initConfig() {
 		// Find home directory.
 		home, err := homedir.Dir()
 		if err != nil {
-			fmt.Println(err)
-			os.Exit(1)
+			exitUsage(err)
 		}
 
 		// Search config in home directory with name ".kubensure" (without extension).
@@ -86,6 +98,77 @@ func initConfig() {
 
 	// If a config file is found, read it in.
 	if err := viper.ReadInConfig(); err == nil {
-		fmt.Println("Using config file:", viper.ConfigFileUsed())
+		fmt.Fprintln(os.Stderr, "Using config file:", viper.ConfigFileUsed())
+	}
+
+	registerConfigProbers()
+	registerConfigRules()
+
+	backend.SetKubeConfigOptions(kubeConfigOptions)
+}
+
+// clientSet returns the clientset of the resolved cluster, exits when the kubeconfig cannot be loaded
+func clientSet() kubernetes.Interface {
+	cs, err := backend.GetClientSet()
+	if err != nil {
+		exitWithError(err)
+	}
+	return cs
+}
+
+// namespaceOrCurrent returns the namespace, or the one selected by '--namespace' and the kubeconfig when empty
+func namespaceOrCurrent(ns string) string {
+	if ns == "" {
+		return backend.GetNamespace()
+	}
+	return ns
+}
+
+// registerConfigProbers registers the probers declared under the 'probers' key of the config file, e.g.
+//
+//	probers:
+//	- name: python
+//	  binaries: [python3]
+//	  command: python3 -c 'import socket; socket.create_connection(("{{.Host}}", {{.Port}}), 5)'
+//	  portRequired: true
+func registerConfigProbers() {
+	var specs []backend.ProberSpec
+	if err := viper.UnmarshalKey("probers", &specs); err != nil {
+		exitUsage("Invalid probers in config file:", err)
+	}
+	for _, spec := range specs {
+		p, err := backend.NewCommandProber(spec)
+		if err != nil {
+			exitUsage("Invalid probers in config file:", err)
+		}
+		backend.RegisterProber(p)
+	}
+}
+
+// registerConfigRules configures the built-in rules and registers the rules of the rule files
+// listed under the keys of the config file, relative paths are resolved from the config file, e.g.
+//
+//	protectedNamespaces: [prod, payments]
+//	ruleFiles: [rules/labels.yaml]
+func registerConfigRules() {
+	if namespaces := viper.GetStringSlice("protectedNamespaces"); len(namespaces) > 0 {
+		backend.RegisterRule(backend.NewSingleReplicaRule(namespaces))
+	}
+	for _, file := range viper.GetStringSlice("ruleFiles") {
+		if !filepath.IsAbs(file) && viper.ConfigFileUsed() != "" {
+			file = filepath.Join(filepath.Dir(viper.ConfigFileUsed()), file)
+		}
+		registerRuleFile(file)
+	}
+}
+
+// registerRuleFile registers the rules of a rule file, exits when the file is invalid
+func registerRuleFile(file string) {
+	rules, err := backend.LoadRuleFile(file)
+	if err != nil {
+		exitUsage(err)
+	}
+	for _, r := range rules {
+		backend.RegisterRule(r)
 	}
 }
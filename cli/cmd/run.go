@@ -0,0 +1,127 @@
+package cmd
+
+/*
+Copyright © 2021 Phil Ranzato philranzato@gmail.com
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/PhilRanzato/kubensure/backend"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// runCmd represents the run command
+var runCmd = &cobra.Command{
+	Use:   "run",
+	Short: "Run a suite of connectivity checks described in a YAML file.",
+	Long: `
+Run a suite of connectivity checks described in a YAML file.
+
+Each check describes the source pods (by name or label selector), the target
+pod, service or external endpoint, an optional port and whether the connection
+is expected to be allowed or denied. Service ports can be selected by name, and
+'endpoints: true' also probes every ready address of the Endpoints of the
+service. The suite file can also be set with the 'suite' key of the
+configuration file.
+
+Usage examples:
+
+  # Run the checks described in suite.yaml
+
+  kubensure run -f suite.yaml
+
+Suite example:
+
+  checks:
+  - name: frontend-to-backend
+    from:
+      namespace: shop
+      selector: app=frontend
+    to:
+      namespace: shop
+      service: backend
+    port: 8080
+  - name: frontend-to-every-backend
+    from:
+      namespace: shop
+      selector: app=frontend
+    to:
+      namespace: shop
+      service: backend
+      endpoints: true
+    port: http
+  - name: backend-no-internet
+    from:
+      namespace: shop
+      pod: backend-0
+    to:
+      external: https://kubernetes.io
+    expect: deny
+
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		suiteFile := viper.GetString("suite")
+		if suiteFile == "" {
+			exitUsage(`'kubensure run' needs a suite file.
+See 'kubensure run -h' for more information`)
+		}
+
+		suite, err := backend.LoadSuite(suiteFile)
+		if err != nil {
+			exitUsage(err)
+		}
+
+		opts := connectionOptions()
+		if err := suite.ValidateProbers(opts); err != nil {
+			exitUsage(err)
+		}
+
+		report, err := backend.RunSuite(context.Background(), clientSet(), suite, opts)
+		if err != nil {
+			exitWithError(err)
+		}
+		printResult(report, report.Report(), func() {
+			for _, r := range report.Results {
+				status := "PASS"
+				if !r.Passed {
+					status = "FAIL"
+				}
+				fmt.Printf("%s %s: %s -> %s (expected %s, %s", status, r.Check, r.Source, r.Target, r.Expect, r.Message)
+				if r.Strategy != "" {
+					fmt.Printf(", %s", probeSummary(r.Connection))
+				}
+				fmt.Println(")")
+				if verboseConnection && r.Strategy != "" {
+					printProbeAttempts(r.Connection)
+				}
+			}
+			fmt.Printf("\n%d passed, %d failed\n", report.Passed, report.Failed)
+		})
+
+		exitWithReport(report.Report())
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(runCmd)
+
+	runCmd.Flags().StringP("file", "f", "", "Suite file (default is the 'suite' key of the config file)")
+	viper.BindPFlag("suite", runCmd.Flags().Lookup("file"))
+	addProbeFlags(runCmd.Flags())
+	runCmd.SuggestionsMinimumDistance = 2
+}
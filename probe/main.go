@@ -0,0 +1,463 @@
+/*
+Copyright © 2021 Phil Ranzato philranzato@gmail.com
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// kubensure-probe is a static binary shipped in the probe image. It is run by kubensure
+// in an ephemeral container or in a short-lived pod when the source pod has no probing tool.
+// It exits with code 0 when the check succeeds and 1 when it fails, 2 on usage errors.
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var timeout = flag.Duration("timeout", 5*time.Second, "timeout of the check")
+var method = flag.String("method", http.MethodGet, "method of the http check")
+var follow = flag.Bool("follow", false, "follow the redirects of the http check")
+var http2 = flag.Bool("http2", false, "negotiate HTTP/2 over TLS in the http check")
+var serverName = flag.String("server-name", "", "server name of the tls check, default is the host")
+var proxy = flag.String("proxy", "", "URL of the HTTP proxy the connect, http and tls checks go through, default is direct")
+var caFile = flag.String("ca-file", "", "CA bundle verifying the chain of the tls check, default is the trust store of the pod")
+
+func usage() {
+	fmt.Fprintf(os.Stderr, `Usage: kubensure-probe [-timeout 5s] [-proxy url] [-method GET] [-follow] [-http2] [-server-name name] [-ca-file path]
+                      [-count 10] [-duration 0s] [-interval 0s] <check> <args>
+
+Checks:
+  connect <host|url> [port]   open a TCP connection to the endpoint
+  udp <host> <port>           send a datagram, a DNS query on port 53, and wait for the answer
+  sctp <host> <port>          open an SCTP association to the endpoint
+  http <url>                  send an HTTP request and print the response and the measured values
+  tls <host> <port>           perform a TLS handshake and print the chain and its verification
+  perf <host|url> [port]      measure the connect and first byte latency of -count samples or for -duration
+  throughput <url>            download the url and print the size, duration and speed of the transfer
+  serve <port>                serve the throughput checks, /bytes?n=<size> answers size zero bytes
+`)
+	os.Exit(2)
+}
+
+func main() {
+	flag.Usage = usage
+	flag.Parse()
+	args := flag.Args()
+	if len(args) < 1 {
+		usage()
+	}
+
+	if len(args) < 2 {
+		usage()
+	}
+	if args[0] == "serve" {
+		port, err := strconv.Atoi(args[1])
+		if err != nil {
+			usage()
+		}
+		fmt.Println(serve(port))
+		os.Exit(1)
+	}
+	port := 0
+	if len(args) > 2 {
+		var err error
+		if port, err = strconv.Atoi(args[2]); err != nil {
+			usage()
+		}
+	}
+
+	var err error
+	switch args[0] {
+	case "connect":
+		err = connect(args[1], port)
+	case "udp":
+		if port == 0 {
+			usage()
+		}
+		err = udp(args[1], port)
+	case "sctp":
+		if port == 0 {
+			usage()
+		}
+		err = sctp(args[1], port)
+	case "http":
+		err = httpCheck(args[1])
+		if err == nil {
+			return
+		}
+	case "tls":
+		if port == 0 {
+			port = 443
+		}
+		err = tlsCheck(args[1], port)
+		if err == nil {
+			return
+		}
+	case "perf":
+		err = perf(args[1], port)
+		if err == nil {
+			return
+		}
+	case "throughput":
+		err = throughput(args[1])
+		if err == nil {
+			return
+		}
+	default:
+		usage()
+	}
+
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	fmt.Println("ok")
+}
+
+// endpoint returns the host:port to dial, the port of a URL defaults to the one of its scheme
+func endpoint(target string, port int) (string, error) {
+	host := target
+	if u, err := url.Parse(target); err == nil && u.Host != "" {
+		host = u.Hostname()
+		if port == 0 && u.Port() != "" {
+			port, _ = strconv.Atoi(u.Port())
+		}
+		if port == 0 && u.Scheme == "https" {
+			port = 443
+		}
+	}
+	if port == 0 {
+		port = 80
+	}
+	if host == "" {
+		return "", fmt.Errorf("invalid target %s", target)
+	}
+	return net.JoinHostPort(host, strconv.Itoa(port)), nil
+}
+
+func connect(target string, port int) error {
+	addr, err := endpoint(target, port)
+	if err != nil {
+		return err
+	}
+	if target, ok := forwardedURL(target, port, addr); ok && *proxy != "" {
+		return forward(target)
+	}
+	conn, err := dial(addr)
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
+
+// forwardedURL returns the URL of a plain HTTP target, an http URL or port 80, which proxies forward instead of
+// tunneling as most of them only tunnel the TLS ports
+func forwardedURL(target string, port int, addr string) (string, bool) {
+	if u, err := url.Parse(target); err == nil && u.Host != "" {
+		return target, u.Scheme == "http"
+	}
+	return "http://" + addr + "/", port == 80
+}
+
+// forward sends a request to the target through the proxy, the connection fails when the proxy answers instead
+// of the target, denying the request or failing to reach the target
+func forward(target string) error {
+	client := &http.Client{
+		Timeout:       *timeout,
+		Transport:     &http.Transport{Proxy: proxyURL},
+		CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+	}
+	resp, err := client.Get(target)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusForbidden, http.StatusProxyAuthRequired, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return fmt.Errorf("proxy answered %s", resp.Status)
+	}
+	return nil
+}
+
+// dial opens a TCP connection to the address, tunneled with a CONNECT request when a proxy is set
+func dial(addr string) (net.Conn, error) {
+	if *proxy == "" {
+		return net.DialTimeout("tcp", addr, *timeout)
+	}
+	u, err := url.Parse(*proxy)
+	if err != nil || u.Scheme != "http" {
+		return nil, fmt.Errorf("invalid proxy %s: only http proxies are supported", *proxy)
+	}
+	proxyAddr := u.Host
+	if u.Port() == "" {
+		proxyAddr = net.JoinHostPort(u.Hostname(), "80")
+	}
+	conn, err := net.DialTimeout("tcp", proxyAddr, *timeout)
+	if err != nil {
+		return nil, fmt.Errorf("proxy %s: %v", u.Host, err)
+	}
+	conn.SetDeadline(time.Now().Add(*timeout))
+	req := &http.Request{Method: http.MethodConnect, URL: &url.URL{Opaque: addr}, Host: addr, Header: http.Header{}}
+	if u.User != nil {
+		password, _ := u.User.Password()
+		req.SetBasicAuth(u.User.Username(), password)
+		req.Header.Set("Proxy-Authorization", req.Header.Get("Authorization"))
+		req.Header.Del("Authorization")
+	}
+	if err := req.Write(conn); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("proxy %s: %v", u.Host, err)
+	}
+	resp, err := http.ReadResponse(bufio.NewReader(conn), req)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("proxy %s: %v", u.Host, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		conn.Close()
+		return nil, fmt.Errorf("proxy %s refused the tunnel to %s: %s", u.Host, addr, resp.Status)
+	}
+	conn.SetDeadline(time.Time{})
+	return conn, nil
+}
+
+// dnsQuery is a DNS query of the NS records of the root zone, any DNS server answers it
+var dnsQuery = []byte{0x6b, 0x75, 0x01, 0x00, 0x00, 0x01, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0x00, 0x01}
+
+// udp sends a datagram to the endpoint and waits for an answer: UDP has no handshake,
+// a dropped datagram cannot be told from a datagram ignored by the server
+func udp(target string, port int) error {
+	addr, err := endpoint(target, port)
+	if err != nil {
+		return err
+	}
+	conn, err := net.DialTimeout("udp", addr, *timeout)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(*timeout))
+
+	payload := []byte("kubensure\n")
+	if port == 53 {
+		payload = dnsQuery
+	}
+	if _, err := conn.Write(payload); err != nil {
+		return err
+	}
+	_, err = conn.Read(make([]byte, 512))
+	return err
+}
+
+// probeMarker prefixes the lines of the measured values parsed by kubensure
+const probeMarker = "__kubensure__"
+
+// maxMessageBody is the part of the body written to the termination message, limited to 4096 bytes
+const maxMessageBody = 2048
+
+// proxyURL returns the proxy of the http check, the environment of the probe is ignored
+func proxyURL(*http.Request) (*url.URL, error) {
+	if *proxy == "" {
+		return nil, nil
+	}
+	return url.Parse(*proxy)
+}
+
+// httpCheck sends the request and prints the headers and the body of the response followed by the measured
+// values. The output is also written to the termination message read by kubensure.
+func httpCheck(target string) error {
+	redirects := 0
+	client := &http.Client{
+		Timeout: *timeout,
+		Transport: &http.Transport{
+			Proxy:             proxyURL,
+			TLSClientConfig:   &tls.Config{InsecureSkipVerify: true},
+			ForceAttemptHTTP2: *http2,
+		},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if !*follow || len(via) >= 10 {
+				return http.ErrUseLastResponse
+			}
+			redirects++
+			return nil
+		},
+	}
+	req, err := http.NewRequest(*method, target, nil)
+	if err != nil {
+		return err
+	}
+	start := time.Now()
+	var firstByte time.Duration
+	req = req.WithContext(httptrace.WithClientTrace(req.Context(), &httptrace.ClientTrace{
+		GotFirstResponseByte: func() { firstByte = time.Since(start) },
+	}))
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	total := time.Since(start)
+
+	location := ""
+	if resp.StatusCode >= 300 && resp.StatusCode < 400 {
+		if u, err := resp.Location(); err == nil {
+			location = u.String()
+		}
+	}
+	version := strings.TrimPrefix(resp.Proto, "HTTP/")
+	if resp.ProtoMajor == 2 {
+		version = "2"
+	}
+
+	var head bytes.Buffer
+	fmt.Fprintf(&head, "%s %s\r\n", resp.Proto, resp.Status)
+	resp.Header.Write(&head)
+	head.WriteString("\r\n")
+	measured := fmt.Sprintf("\n%s %d %s %.6f %.6f %d %s\n", probeMarker, resp.StatusCode, version, firstByte.Seconds(), total.Seconds(), redirects, location)
+
+	os.Stdout.Write(head.Bytes())
+	os.Stdout.Write(body)
+	fmt.Print(measured)
+	if len(body) > maxMessageBody {
+		body = body[:maxMessageBody]
+	}
+	// the termination log does not exist when the probe is run outside of a container
+	ioutil.WriteFile("/dev/termination-log", append(append(head.Bytes(), body...), measured...), 0644)
+	return nil
+}
+
+// certificate is the JSON line of a certificate of the chain, with the fields of the TLSCertificate of kubensure
+type certificate struct {
+	Subject   string
+	Issuer    string
+	DNSNames  []string `json:",omitempty"`
+	IPs       []string `json:",omitempty"`
+	NotBefore time.Time
+	NotAfter  time.Time
+	IsCA      bool
+	SHA256    string
+}
+
+// trustStores are the CA bundles of the common distributions, as searched by crypto/x509
+var trustStores = []string{
+	"/etc/ssl/certs/ca-certificates.crt",
+	"/etc/pki/tls/certs/ca-bundle.crt",
+	"/etc/ssl/ca-bundle.pem",
+	"/etc/pki/tls/cacert.pem",
+	"/etc/pki/ca-trust/extracted/pem/tls-ca-bundle.pem",
+	"/etc/ssl/cert.pem",
+}
+
+// podTrustStore returns the trust store of the pod and its name. In an ephemeral container the probe shares
+// the process namespace of the target container, whose file system is reachable through /proc/1/root. Else,
+// or when it cannot be read, the trust store is the one of the probe image.
+func podTrustStore() (*x509.CertPool, string, error) {
+	if *caFile != "" {
+		pem, err := ioutil.ReadFile(*caFile)
+		if err != nil && os.Getpid() != 1 {
+			pem, err = ioutil.ReadFile("/proc/1/root" + *caFile)
+		}
+		if err != nil {
+			return nil, "", err
+		}
+		pool := x509.NewCertPool()
+		pool.AppendCertsFromPEM(pem)
+		return pool, *caFile, nil
+	}
+	if os.Getpid() != 1 {
+		for _, f := range trustStores {
+			if pem, err := ioutil.ReadFile("/proc/1/root" + f); err == nil {
+				pool := x509.NewCertPool()
+				if pool.AppendCertsFromPEM(pem) {
+					return pool, "pod", nil
+				}
+			}
+		}
+	}
+	pool, err := x509.SystemCertPool()
+	return pool, "probe image", err
+}
+
+// tlsCheck performs the handshake, verifies the chain with the trust store of the pod and prints the chain, the
+// negotiated protocol and cipher and the verification in the format of openssl s_client parsed by kubensure.
+// The output is also written to the termination message read by kubensure.
+func tlsCheck(host string, port int) error {
+	name := *serverName
+	if name == "" {
+		name = host
+	}
+	raw, err := dial(net.JoinHostPort(host, strconv.Itoa(port)))
+	if err != nil {
+		return err
+	}
+	raw.SetDeadline(time.Now().Add(*timeout))
+	// the chain is verified below with the trust store of the pod, the hostname is checked by kubensure
+	conn := tls.Client(raw, &tls.Config{ServerName: name, InsecureSkipVerify: true})
+	if err := conn.Handshake(); err != nil {
+		raw.Close()
+		return err
+	}
+	state := conn.ConnectionState()
+	conn.Close()
+
+	var out bytes.Buffer
+	for _, c := range state.PeerCertificates {
+		sum := sha256.Sum256(c.Raw)
+		cert := certificate{Subject: c.Subject.String(), Issuer: c.Issuer.String(), DNSNames: c.DNSNames, NotBefore: c.NotBefore, NotAfter: c.NotAfter, IsCA: c.IsCA, SHA256: hex.EncodeToString(sum[:])}
+		for _, ip := range c.IPAddresses {
+			cert.IPs = append(cert.IPs, ip.String())
+		}
+		line, _ := json.Marshal(cert)
+		fmt.Fprintf(&out, "%s cert %s\n", probeMarker, line)
+	}
+	version := map[uint16]string{tls.VersionTLS10: "TLSv1", tls.VersionTLS11: "TLSv1.1", tls.VersionTLS12: "TLSv1.2", tls.VersionTLS13: "TLSv1.3"}[state.Version]
+	fmt.Fprintf(&out, "New, %s, Cipher is %s\n", version, tls.CipherSuiteName(state.CipherSuite))
+
+	code, reason := 0, "ok"
+	pool, store, err := podTrustStore()
+	if err == nil && len(state.PeerCertificates) > 0 {
+		intermediates := x509.NewCertPool()
+		for _, c := range state.PeerCertificates[1:] {
+			intermediates.AddCert(c)
+		}
+		_, err = state.PeerCertificates[0].Verify(x509.VerifyOptions{Roots: pool, Intermediates: intermediates})
+	}
+	if err != nil {
+		code, reason = 1, err.Error()
+	}
+	fmt.Fprintf(&out, "Trust store: %s\nVerify return code: %d (%s)\n", store, code, reason)
+
+	os.Stdout.Write(out.Bytes())
+	ioutil.WriteFile("/dev/termination-log", out.Bytes(), 0644)
+	return nil
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"bytes"
+	"crypto/tls"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"net/url"
+	"os"
+	"strconv"
+	"time"
+)
+
+var count = flag.Int("count", 10, "number of samples of the perf check")
+var duration = flag.Duration("duration", 0, "duration of the perf check, instead of a number of samples")
+var interval = flag.Duration("interval", 0, "pause between the samples of the perf check")
+
+// maxMessageSamples is the number of samples written to the termination message, limited to 4096 bytes
+const maxMessageSamples = 80
+
+// perf measures the connect and first byte latency of the target, with a new connection for each sample, and
+// prints a line per sample in the format of the curl prober of kubensure: connect, first byte and total seconds,
+// followed by the exit code, 0 when the sample succeeded
+func perf(target string, port int) error {
+	isHTTP := false
+	if u, err := url.Parse(target); err == nil && (u.Scheme == "http" || u.Scheme == "https") {
+		isHTTP = true
+	}
+	addr, err := endpoint(target, port)
+	if err != nil {
+		return err
+	}
+
+	var out bytes.Buffer
+	end := time.Now().Add(*duration)
+	for i := 0; *duration > 0 && time.Now().Before(end) || *duration == 0 && i < *count; i++ {
+		if i > 0 {
+			time.Sleep(*interval)
+		}
+		var connect, firstByte time.Duration
+		code := 0
+		start := time.Now()
+		if isHTTP {
+			connect, firstByte, err = httpSample(target)
+		} else {
+			var conn net.Conn
+			if conn, err = dial(addr); err == nil {
+				connect = time.Since(start)
+				conn.Close()
+			}
+		}
+		if err != nil {
+			code = 1
+		}
+		line := fmt.Sprintf("%s perf %.6f %.6f %.6f %d\n", probeMarker, connect.Seconds(), firstByte.Seconds(), time.Since(start).Seconds(), code)
+		fmt.Print(line)
+		if i < maxMessageSamples {
+			out.WriteString(line)
+		}
+	}
+	ioutil.WriteFile("/dev/termination-log", out.Bytes(), 0644)
+	return nil
+}
+
+// httpSample sends a request on a new connection and returns the connect and first byte latency
+func httpSample(target string) (time.Duration, time.Duration, error) {
+	client := &http.Client{
+		Timeout: *timeout,
+		Transport: &http.Transport{
+			Proxy:             proxyURL,
+			TLSClientConfig:   &tls.Config{InsecureSkipVerify: true},
+			DisableKeepAlives: true,
+		},
+		CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+	}
+	req, err := http.NewRequest(http.MethodGet, target, nil)
+	if err != nil {
+		return 0, 0, err
+	}
+	start := time.Now()
+	var connect, firstByte time.Duration
+	req = req.WithContext(httptrace.WithClientTrace(req.Context(), &httptrace.ClientTrace{
+		ConnectDone:          func(string, string, error) { connect = time.Since(start) },
+		GotFirstResponseByte: func() { firstByte = time.Since(start) },
+	}))
+	resp, err := client.Do(req)
+	if err != nil {
+		return connect, firstByte, err
+	}
+	io.Copy(ioutil.Discard, resp.Body)
+	return connect, firstByte, resp.Body.Close()
+}
+
+// throughput downloads the body of the target and prints the size, the duration and the speed in bytes per second
+// in the format of the curl prober of kubensure
+func throughput(target string) error {
+	client := &http.Client{Transport: &http.Transport{Proxy: proxyURL}}
+	start := time.Now()
+	resp, err := client.Get(target)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	n, err := io.Copy(ioutil.Discard, resp.Body)
+	if err != nil {
+		return err
+	}
+	elapsed := time.Since(start)
+	line := fmt.Sprintf("%s throughput %d %.6f %.0f 0\n", probeMarker, n, elapsed.Seconds(), float64(n)/elapsed.Seconds())
+	fmt.Print(line)
+	ioutil.WriteFile("/dev/termination-log", []byte(line), 0644)
+	return nil
+}
+
+// zeros is an endless reader of zero bytes
+type zeros struct{}
+
+func (zeros) Read(p []byte) (int, error) {
+	for i := range p {
+		p[i] = 0
+	}
+	return len(p), nil
+}
+
+// serve runs the server of the throughput check: GET /bytes?n=<size> answers size zero bytes, any other
+// request answers ok
+func serve(port int) error {
+	http.HandleFunc("/bytes", func(w http.ResponseWriter, r *http.Request) {
+		n, err := strconv.ParseInt(r.URL.Query().Get("n"), 10, 64)
+		if err != nil || n < 0 {
+			http.Error(w, "invalid size", http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Length", strconv.FormatInt(n, 10))
+		io.CopyN(w, zeros{}, n)
+	})
+	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, "ok")
+	})
+	fmt.Fprintf(os.Stderr, "serving on port %d\n", port)
+	return http.ListenAndServe(":"+strconv.Itoa(port), nil)
+}
@@ -0,0 +1,59 @@
+// +build linux
+
+package main
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+// sctp opens an SCTP association to the endpoint, the standard library has no SCTP support
+func sctp(target string, port int) error {
+	addr, err := endpoint(target, port)
+	if err != nil {
+		return err
+	}
+	host, p, _ := net.SplitHostPort(addr)
+	port, _ = strconv.Atoi(p)
+	ips, err := net.LookupIP(host)
+	if err != nil {
+		return err
+	}
+
+	family := syscall.AF_INET
+	var sa syscall.Sockaddr
+	if ip := ips[0].To4(); ip != nil {
+		sa4 := &syscall.SockaddrInet4{Port: port}
+		copy(sa4.Addr[:], ip)
+		sa = sa4
+	} else {
+		family = syscall.AF_INET6
+		sa6 := &syscall.SockaddrInet6{Port: port}
+		copy(sa6.Addr[:], ips[0].To16())
+		sa = sa6
+	}
+
+	fd, err := syscall.Socket(family, syscall.SOCK_STREAM, syscall.IPPROTO_SCTP)
+	if err != nil {
+		return os.NewSyscallError("socket", err)
+	}
+	defer syscall.Close(fd)
+
+	done := make(chan error, 1)
+	go func() {
+		done <- syscall.Connect(fd, sa)
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			return os.NewSyscallError("connect", err)
+		}
+		return nil
+	case <-time.After(*timeout):
+		return fmt.Errorf("connect %s: timed out", addr)
+	}
+}
@@ -0,0 +1,12 @@
+// +build !linux
+
+package main
+
+import (
+	"fmt"
+	"runtime"
+)
+
+func sctp(target string, port int) error {
+	return fmt.Errorf("sctp: protocol not supported on %s", runtime.GOOS)
+}